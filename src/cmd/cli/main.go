@@ -29,8 +29,8 @@ func main() {
 		Name: *table,
 		Columns: []storage.ColumnSchema{
 			{Name: "user_id", Type: columnar.TypeInt},
-			{Name: "event_type", Type: columnar.TypeString},
-			{Name: "ts", Type: columnar.TypeString},
+			{Name: "event_type", Type: columnar.TypeString, Encoding: string(columnar.EncodingDictionary)},
+			{Name: "ts", Type: columnar.TypeTimestamp, Encoding: string(columnar.EncodingDelta)},
 			{Name: "value", Type: columnar.TypeFloat},
 		},
 	}
@@ -46,7 +46,7 @@ func main() {
 		row := storage.Row{
 			"user_id":    columnar.NewIntValue(int64(rand.Intn(1000))),
 			"event_type": columnar.NewStringValue(fmt.Sprintf("event_%d", rand.Intn(5))),
-			"ts":         columnar.NewStringValue(now.Add(time.Duration(i) * time.Second).Format(time.RFC3339)),
+			"ts":         columnar.NewTimestampValue(now.Add(time.Duration(i) * time.Second)),
 			"value":      columnar.NewFloatValue(rand.Float64() * 100),
 		}
 		rowsData = append(rowsData, row)
@@ -8,22 +8,30 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
 	"time"
 
 	"github.com/Jonatan852/distributed-query-processing/internal/api"
 	"github.com/Jonatan852/distributed-query-processing/internal/distributed"
+	"github.com/Jonatan852/distributed-query-processing/internal/executor"
 	"github.com/Jonatan852/distributed-query-processing/internal/planner"
+	"github.com/Jonatan852/distributed-query-processing/internal/runtime/fragment"
 	runtimerunner "github.com/Jonatan852/distributed-query-processing/internal/runtime/runner"
 	"github.com/Jonatan852/distributed-query-processing/internal/storage"
-	"github.com/Jonatan852/distributed-query-processing/pkg/query"
 )
 
 func main() {
 	var (
-		httpAddr        = flag.String("http-addr", ":8080", "Endereço HTTP para expor a API")
-		dataDir         = flag.String("data-dir", "./data", "Diretório do storage local")
-		embeddedWorkers = flag.Int("embedded-workers", 0, "Número de workers locais registrados automaticamente")
+		httpAddr          = flag.String("http-addr", ":8080", "Endereço HTTP para expor a API")
+		dataDir           = flag.String("data-dir", "./data", "Diretório do storage local")
+		embeddedWorkers   = flag.Int("embedded-workers", 0, "Número de workers locais registrados automaticamente")
+		partitionsPerTask = flag.Int("partitions-per-task", 1, "Quantidade de partições lidas por cada task de scan")
+		sortMemory        = flag.Int64("sort-memory", 64<<20, "Bytes que um SORT (nos workers embarcados e no ORDER BY do merge) mantém em memória antes de gravar runs em <data-dir>/spill (0 desliga o spill)")
+		hashMemory        = flag.Int64("hash-memory", 64<<20, "Bytes de estado que uma agregação ou a tabela hash de um join (nos workers embarcados e no merge) mantém em memória antes de gravar partições em <data-dir>/spill (0 desliga o spill)")
+		processMemory     = flag.Int64("process-memory", 0, "Bytes que todas as queries do processo (workers embarcados, merge e resultados guardados) podem reservar juntas (0 sem limite)")
+		queryMemory       = flag.Int64("query-memory", 0, "Bytes que uma query pode reservar nos seus tasks dos workers embarcados, somados, e no merge do coordinator (0 sem limite)")
+		resultTTL         = flag.Duration("result-ttl", 30*time.Minute, "Tempo que as linhas de um resultado ficam guardadas para GET /query/{id} (0 guarda enquanto o coordinator estiver no ar)")
 	)
 	flag.Parse()
 
@@ -31,14 +39,33 @@ func main() {
 	if err != nil {
 		log.Fatalf("falha ao abrir storage: %v", err)
 	}
-	coord := distributed.NewCoordinator()
+	coord := distributed.NewCoordinatorWithConfig(distributed.Config{
+		Catalog:           engine,
+		PartitionsPerTask: *partitionsPerTask,
+	})
 	plan := planner.New(engine)
-	queryRunner := runtimerunner.New(engine)
+	spillDir, err := processSpillDir(*dataDir, "coordinator")
+	if err != nil {
+		log.Fatalf("falha ao criar diretório de spill: %v", err)
+	}
+	queryRunner := runtimerunner.NewWithConfig(engine, runtimerunner.Config{
+		SpillDir:   spillDir,
+		SortMemory: *sortMemory,
+		HashMemory: *hashMemory,
+	})
 
+	memory := executor.NewMemoryTracker("coordinator", *processMemory)
+	fragmentConfig := fragment.Config{
+		SpillDir:    spillDir,
+		SortMemory:  *sortMemory,
+		HashMemory:  *hashMemory,
+		Memory:      memory,
+		QueryMemory: *queryMemory,
+	}
 	for i := 0; i < *embeddedWorkers; i++ {
 		id := fmt.Sprintf("embedded-%d", i+1)
 		worker := distributed.NewLocalWorker(id, func(req distributed.TaskRequest) distributed.TaskResult {
-			return executeFragment(engine, req.Fragment, id, req.TaskID)
+			return fragment.ExecuteWithConfig(engine, req, fragmentConfig)
 		})
 		coord.Register(worker)
 	}
@@ -51,6 +78,9 @@ func main() {
 		Runner:       queryRunner,
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 0, // long-poll em /workers/* não deve expirar cedo
+		Memory:       memory,
+		QueryMemory:  *queryMemory,
+		ResultTTL:    *resultTTL,
 	})
 	if err != nil {
 		log.Fatalf("erro criando API: %v", err)
@@ -71,32 +101,19 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	_ = server.Shutdown(ctx)
+	if err := os.RemoveAll(spillDir); err != nil {
+		log.Printf("falha ao apagar %s: %v", spillDir, err)
+	}
 }
 
-func executeFragment(engine *storage.Engine, node *query.PlanNode, workerID, taskID string) distributed.TaskResult {
-	start := time.Now()
-	if node == nil {
-		return distributed.TaskResult{TaskID: taskID, WorkerID: workerID, Error: "fragmento vazio"}
-	}
-	if node.Type != query.PlanNodeScan {
-		return distributed.TaskResult{TaskID: taskID, WorkerID: workerID, Error: fmt.Sprintf("nó %s não suportado", node.Type)}
-	}
-	table, _ := node.Properties["table"].(string)
-	if table == "" {
-		return distributed.TaskResult{TaskID: taskID, WorkerID: workerID, Error: "fragmento sem tabela"}
-	}
-	batches, err := engine.Scan(table, storage.ScanOptions{})
-	if err != nil {
-		return distributed.TaskResult{TaskID: taskID, WorkerID: workerID, Error: err.Error()}
-	}
-	rows := 0
-	for _, batch := range batches {
-		rows += batch.RowCount
-	}
-	return distributed.TaskResult{
-		TaskID:   taskID,
-		WorkerID: workerID,
-		Rows:     rows,
-		Duration: time.Since(start),
+// processSpillDir cria, em <data-dir>/spill, o diretório temporário deste
+// processo para os runs e partições dos operadores externos. Cada processo
+// usa o seu e o apaga ao encerrar, de modo que processos que dividem o
+// data-dir não apagam os arquivos uns dos outros.
+func processSpillDir(dataDir, name string) (string, error) {
+	base := filepath.Join(dataDir, "spill")
+	if err := os.MkdirAll(base, 0o755); err != nil {
+		return "", err
 	}
+	return os.MkdirTemp(base, name+"-*")
 }
@@ -7,13 +7,18 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
 	"path"
+	"path/filepath"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/Jonatan852/distributed-query-processing/internal/distributed"
+	"github.com/Jonatan852/distributed-query-processing/internal/executor"
+	"github.com/Jonatan852/distributed-query-processing/internal/runtime/fragment"
 	"github.com/Jonatan852/distributed-query-processing/internal/storage"
-	"github.com/Jonatan852/distributed-query-processing/pkg/query"
 )
 
 type registrationResponse struct {
@@ -30,10 +35,14 @@ type pollResponse struct {
 
 func main() {
 	var (
-		id       = flag.String("id", "", "ID do worker (opcional, será gerado se vazio)")
-		dataDir  = flag.String("data-dir", "./data", "Diretório com partições locais")
-		coordURL = flag.String("coordinator", "http://localhost:8080", "URL do coordinator")
-		idleWait = flag.Duration("idle-wait", 3*time.Second, "Tempo de espera quando não há tasks")
+		id            = flag.String("id", "", "ID do worker (opcional, será gerado se vazio)")
+		dataDir       = flag.String("data-dir", "./data", "Diretório com partições locais")
+		coordURL      = flag.String("coordinator", "http://localhost:8080", "URL do coordinator")
+		idleWait      = flag.Duration("idle-wait", 3*time.Second, "Tempo de espera quando não há tasks")
+		sortMemory    = flag.Int64("sort-memory", 64<<20, "Bytes que um SORT mantém em memória antes de gravar runs em <data-dir>/spill (0 desliga o spill)")
+		hashMemory    = flag.Int64("hash-memory", 64<<20, "Bytes de estado que uma agregação ou a tabela hash de um join mantém em memória antes de gravar partições em <data-dir>/spill (0 desliga o spill)")
+		processMemory = flag.Int64("process-memory", 0, "Bytes que todos os tasks do worker podem reservar juntos (0 sem limite)")
+		queryMemory   = flag.Int64("query-memory", 0, "Bytes que os tasks simultâneos de uma query podem reservar juntos (0 sem limite)")
 	)
 	flag.Parse()
 
@@ -41,6 +50,28 @@ func main() {
 	if err != nil {
 		log.Fatalf("erro abrindo storage: %v", err)
 	}
+	spillDir, err := processSpillDir(*dataDir, "worker")
+	if err != nil {
+		log.Fatalf("falha ao criar diretório de spill: %v", err)
+	}
+	// o diretório de spill é deste processo: sai junto com ele
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sig
+		log.Printf("encerrando worker...")
+		if err := os.RemoveAll(spillDir); err != nil {
+			log.Printf("falha ao apagar %s: %v", spillDir, err)
+		}
+		os.Exit(0)
+	}()
+	config := fragment.Config{
+		SpillDir:    spillDir,
+		SortMemory:  *sortMemory,
+		HashMemory:  *hashMemory,
+		Memory:      executor.NewMemoryTracker("worker", *processMemory),
+		QueryMemory: *queryMemory,
+	}
 
 	reg, err := registerWorker(*coordURL, *id)
 	if err != nil {
@@ -60,14 +91,25 @@ func main() {
 			time.Sleep(*idleWait)
 			continue
 		}
-		result := executeFragment(engine, task.Fragment)
-		result.TaskID = task.TaskID
+		result := fragment.ExecuteWithConfig(engine, *task, config)
 		if err := sendResult(client, *coordURL, reg, result); err != nil {
 			log.Printf("erro enviando resultado: %v", err)
 		}
 	}
 }
 
+// processSpillDir cria, em <data-dir>/spill, o diretório temporário deste
+// processo para os runs e partições dos operadores externos. Cada processo
+// usa o seu e o apaga ao encerrar, de modo que processos que dividem o
+// data-dir não apagam os arquivos uns dos outros.
+func processSpillDir(dataDir, name string) (string, error) {
+	base := filepath.Join(dataDir, "spill")
+	if err := os.MkdirAll(base, 0o755); err != nil {
+		return "", err
+	}
+	return os.MkdirTemp(base, name+"-*")
+}
+
 func registerWorker(coordURL, id string) (registrationResponse, error) {
 	payload := map[string]string{"id": id}
 	data, _ := json.Marshal(payload)
@@ -135,29 +177,3 @@ func joinURL(base, endpoint string) string {
 	}
 	return base + path.Clean("/"+endpoint)
 }
-
-func executeFragment(engine *storage.Engine, node *query.PlanNode) distributed.TaskResult {
-	start := time.Now()
-	if node == nil {
-		return distributed.TaskResult{Error: "fragmento vazio"}
-	}
-	if node.Type != query.PlanNodeScan {
-		return distributed.TaskResult{Error: fmt.Sprintf("nó %s não suportado no worker", node.Type)}
-	}
-	table, _ := node.Properties["table"].(string)
-	if table == "" {
-		return distributed.TaskResult{Error: "fragmento sem tabela"}
-	}
-	batches, err := engine.Scan(table, storage.ScanOptions{})
-	if err != nil {
-		return distributed.TaskResult{Error: err.Error()}
-	}
-	total := 0
-	for _, batch := range batches {
-		total += batch.RowCount
-	}
-	return distributed.TaskResult{
-		Rows:     total,
-		Duration: time.Since(start),
-	}
-}
@@ -2,6 +2,7 @@ package api
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
@@ -17,12 +18,17 @@ type loadRequest struct {
 }
 
 type tableSchemaPayload struct {
-	Columns []columnSchemaPayload `json:"columns"`
+	Columns    []columnSchemaPayload `json:"columns"`
+	Properties map[string]string     `json:"properties,omitempty"`
 }
 
 type columnSchemaPayload struct {
-	Name string `json:"name"`
-	Type string `json:"type"`
+	Name     string                `json:"name"`
+	Type     string                `json:"type"`
+	Nullable bool                  `json:"nullable,omitempty"`
+	Encoding string                `json:"encoding,omitempty"`
+	Repeated bool                  `json:"repeated,omitempty"`
+	Fields   []columnSchemaPayload `json:"fields,omitempty"`
 }
 
 func (s *Server) applyLoadRequest(req loadRequest) error {
@@ -36,14 +42,23 @@ func (s *Server) applyLoadRequest(req loadRequest) error {
 	if err != nil {
 		return err
 	}
-	rows, err := buildRows(schema, req.Rows)
-	if err != nil {
-		return err
-	}
 	partitionID := req.PartitionID
 	if partitionID == "" {
 		partitionID = fmt.Sprintf("part-%d", time.Now().UnixNano())
 	}
+	if schema.IsNested() {
+		// objetos e listas do JSON são decompostos em colunas por campo
+		records, err := buildRecords(schema, req.Rows)
+		if err != nil {
+			return err
+		}
+		_, err = s.cfg.Engine.IngestRecords(req.Table, partitionID, records)
+		return err
+	}
+	rows, err := buildRows(schema, req.Rows)
+	if err != nil {
+		return err
+	}
 	_, err = s.cfg.Engine.Ingest(req.Table, partitionID, rows)
 	return err
 }
@@ -62,20 +77,14 @@ func (s *Server) ensureTableSchema(table string, payload *tableSchemaPayload) (s
 	if len(payload.Columns) == 0 {
 		return storage.TableSchema{}, fmt.Errorf("columns não pode ser vazio")
 	}
-	columns := make([]storage.ColumnSchema, 0, len(payload.Columns))
-	for _, col := range payload.Columns {
-		dt, err := parseColumnType(col.Type)
-		if err != nil {
-			return storage.TableSchema{}, err
-		}
-		columns = append(columns, storage.ColumnSchema{
-			Name: strings.ToLower(col.Name),
-			Type: dt,
-		})
+	columns, err := buildColumnSchemas(payload.Columns)
+	if err != nil {
+		return storage.TableSchema{}, err
 	}
 	schema = storage.TableSchema{
-		Name:    table,
-		Columns: columns,
+		Name:       table,
+		Columns:    columns,
+		Properties: payload.Properties,
 	}
 	if err := s.cfg.Engine.RegisterTable(schema); err != nil {
 		return storage.TableSchema{}, err
@@ -83,14 +92,55 @@ func (s *Server) ensureTableSchema(table string, payload *tableSchemaPayload) (s
 	return schema, nil
 }
 
+// buildColumnSchemas converte as colunas do payload, incluindo os campos de
+// STRUCTs.
+func buildColumnSchemas(payload []columnSchemaPayload) ([]storage.ColumnSchema, error) {
+	columns := make([]storage.ColumnSchema, 0, len(payload))
+	for _, col := range payload {
+		typeName := strings.TrimSpace(col.Type)
+		// ARRAY<T> é um atalho para um campo T repetido
+		upper := strings.ToUpper(typeName)
+		if strings.HasPrefix(upper, "ARRAY<") && strings.HasSuffix(upper, ">") {
+			typeName = typeName[len("ARRAY<") : len(typeName)-1]
+			col.Repeated = true
+		}
+		dt, precision, scale, err := parseColumnType(typeName)
+		if err != nil {
+			return nil, err
+		}
+		var fields []storage.ColumnSchema
+		if len(col.Fields) > 0 {
+			if fields, err = buildColumnSchemas(col.Fields); err != nil {
+				return nil, err
+			}
+		}
+		columns = append(columns, storage.ColumnSchema{
+			Name:      strings.ToLower(col.Name),
+			Type:      dt,
+			Nullable:  col.Nullable,
+			Precision: precision,
+			Scale:     scale,
+			Encoding:  strings.ToUpper(strings.TrimSpace(col.Encoding)),
+			Repeated:  col.Repeated,
+			Fields:    fields,
+		})
+	}
+	return columns, nil
+}
+
 func buildRows(schema storage.TableSchema, data []map[string]interface{}) ([]storage.Row, error) {
 	rows := make([]storage.Row, 0, len(data))
 	for _, item := range data {
 		row := storage.Row{}
 		for _, col := range schema.Columns {
 			raw, ok := item[col.Name]
-			if !ok {
-				return nil, fmt.Errorf("coluna %s ausente", col.Name)
+			if !ok || raw == nil {
+				// chaves ausentes e null viram NULL em colunas nullable
+				if !col.Nullable {
+					return nil, fmt.Errorf("coluna %s ausente", col.Name)
+				}
+				row[col.Name] = columnar.NewNullValue(col.Type)
+				continue
 			}
 			value, err := convertValue(col.Type, raw)
 			if err != nil {
@@ -103,19 +153,116 @@ func buildRows(schema storage.TableSchema, data []map[string]interface{}) ([]sto
 	return rows, nil
 }
 
-func parseColumnType(name string) (columnar.DataType, error) {
-	switch strings.ToUpper(name) {
+// buildRecords converte linhas JSON aninhadas em registros: objetos viram
+// storage.Record e listas alimentam campos repetidos. A validação de NULLs fica
+// com o storage.
+func buildRecords(schema storage.TableSchema, data []map[string]interface{}) ([]storage.Record, error) {
+	records := make([]storage.Record, 0, len(data))
+	for i, item := range data {
+		record, err := convertRecord(schema.Columns, "", item)
+		if err != nil {
+			return nil, fmt.Errorf("linha %d: %w", i, err)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+func convertRecord(fields []storage.ColumnSchema, prefix string, item map[string]interface{}) (storage.Record, error) {
+	record := storage.Record{}
+	for _, field := range fields {
+		path := prefix + field.Name
+		raw := item[field.Name]
+		if raw == nil {
+			continue
+		}
+		if !field.Repeated {
+			value, err := convertField(field, path, raw)
+			if err != nil {
+				return nil, err
+			}
+			record[field.Name] = value
+			continue
+		}
+		list, ok := raw.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("campo %s é repetido e espera uma lista", path)
+		}
+		items := make([]interface{}, 0, len(list))
+		for _, element := range list {
+			if element == nil {
+				return nil, fmt.Errorf("campo %s: elementos de listas não podem ser null", path)
+			}
+			value, err := convertField(field, path, element)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, value)
+		}
+		record[field.Name] = items
+	}
+	return record, nil
+}
+
+// convertField converte uma ocorrência do campo: objeto para STRUCT, valor
+// escalar para os demais tipos.
+func convertField(field storage.ColumnSchema, path string, raw interface{}) (interface{}, error) {
+	if field.Type == columnar.TypeStruct {
+		object, ok := raw.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("campo %s é STRUCT e espera um objeto", path)
+		}
+		return convertRecord(field.Fields, path+".", object)
+	}
+	value, err := convertValue(field.Type, raw)
+	if err != nil {
+		return nil, fmt.Errorf("campo %s: %w", path, err)
+	}
+	return value, nil
+}
+
+// parseColumnType converte o nome do tipo; DECIMAL aceita DECIMAL(p,s) e
+// devolve a precisão p e a escala s (DECIMAL sem argumentos não limita a
+// precisão).
+func parseColumnType(name string) (columnar.DataType, int32, int32, error) {
+	upper := strings.ToUpper(strings.TrimSpace(name))
+	switch upper {
 	case "INT", "INT64":
-		return columnar.TypeInt, nil
+		return columnar.TypeInt, 0, 0, nil
 	case "STRING":
-		return columnar.TypeString, nil
+		return columnar.TypeString, 0, 0, nil
 	case "FLOAT", "FLOAT64":
-		return columnar.TypeFloat, nil
+		return columnar.TypeFloat, 0, 0, nil
 	case "BOOL", "BOOLEAN":
-		return columnar.TypeBool, nil
-	default:
-		return 0, fmt.Errorf("tipo %s não suportado", name)
+		return columnar.TypeBool, 0, 0, nil
+	case "TIMESTAMP":
+		return columnar.TypeTimestamp, 0, 0, nil
+	case "DATE":
+		return columnar.TypeDate, 0, 0, nil
+	case "DECIMAL", "NUMERIC":
+		return columnar.TypeDecimal, 0, 0, nil
+	case "STRUCT", "RECORD":
+		return columnar.TypeStruct, 0, 0, nil
+	}
+	base, args, ok := strings.Cut(upper, "(")
+	if ok && (base == "DECIMAL" || base == "NUMERIC") && strings.HasSuffix(args, ")") {
+		var precision, scale int
+		parts := strings.Split(strings.TrimSuffix(args, ")"), ",")
+		var err error
+		if precision, err = strconv.Atoi(strings.TrimSpace(parts[0])); err != nil || len(parts) > 2 {
+			return 0, 0, 0, fmt.Errorf("tipo %s inválido", name)
+		}
+		if len(parts) == 2 {
+			if scale, err = strconv.Atoi(strings.TrimSpace(parts[1])); err != nil {
+				return 0, 0, 0, fmt.Errorf("tipo %s inválido", name)
+			}
+		}
+		if precision < 1 || precision > columnar.MaxDecimalPrecision || scale < 0 || scale > precision {
+			return 0, 0, 0, fmt.Errorf("tipo %s: precisão deve estar entre 1 e %d e escala entre 0 e a precisão", name, columnar.MaxDecimalPrecision)
+		}
+		return columnar.TypeDecimal, int32(precision), int32(scale), nil
 	}
+	return 0, 0, 0, fmt.Errorf("tipo %s não suportado", name)
 }
 
 func convertValue(dt columnar.DataType, raw interface{}) (columnar.Value, error) {
@@ -152,6 +299,31 @@ func convertValue(dt columnar.DataType, raw interface{}) (columnar.Value, error)
 			return columnar.NewBoolValue(v), nil
 		}
 		return columnar.Value{}, fmt.Errorf("valor %v não é boolean", raw)
+	case columnar.TypeTimestamp:
+		switch v := raw.(type) {
+		case string:
+			return columnar.ParseValue(dt, v)
+		case float64:
+			// números são segundos desde a época
+			return columnar.NewTimestampValue(time.UnixMicro(int64(v * 1e6))), nil
+		default:
+			return columnar.Value{}, fmt.Errorf("valor %v não é timestamp", raw)
+		}
+	case columnar.TypeDate:
+		if v, ok := raw.(string); ok {
+			return columnar.ParseValue(dt, v)
+		}
+		return columnar.Value{}, fmt.Errorf("valor %v não é data", raw)
+	case columnar.TypeDecimal:
+		switch v := raw.(type) {
+		case string:
+			return columnar.ParseValue(dt, v)
+		case float64:
+			// a menor representação do float recupera o literal enviado no JSON
+			return columnar.ParseValue(dt, strconv.FormatFloat(v, 'f', -1, 64))
+		default:
+			return columnar.Value{}, fmt.Errorf("valor %v não é decimal", raw)
+		}
 	default:
 		return columnar.Value{}, fmt.Errorf("tipo %s não suportado", dt)
 	}
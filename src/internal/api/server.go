@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/Jonatan852/distributed-query-processing/internal/distributed"
+	"github.com/Jonatan852/distributed-query-processing/internal/executor"
 	"github.com/Jonatan852/distributed-query-processing/internal/parser"
 	"github.com/Jonatan852/distributed-query-processing/internal/planner"
 	"github.com/Jonatan852/distributed-query-processing/internal/runtime/runner"
@@ -31,8 +32,26 @@ type Config struct {
 	ParseSQL     ParserFunc
 	ReadTimeout  time.Duration
 	WriteTimeout time.Duration
+	// Memory é o orçamento do processo. Cada query reserva nele, limitada a
+	// QueryMemory bytes, os batches recebidos e as linhas montadas no merge;
+	// os resultados guardados para GET /query/{id} continuam reservados até
+	// expirarem. Um resultado que não cabe no que sobrou falha com
+	// ErrorCodeMemoryLimit; os resultados de outras queries nunca são
+	// descartados para abrir espaço.
+	Memory      *executor.MemoryTracker
+	QueryMemory int64
+	// ResultTTL é por quanto tempo o resultado de uma query fica guardado
+	// depois de pronto; em seguida o resultado e o estado da query no
+	// coordinator são descartados, a reserva é devolvida e GET /query/{id}
+	// responde com status EXPIRED e error_code ErrorCodeResultExpired. Zero
+	// guarda os resultados enquanto o servidor estiver no ar.
+	ResultTTL time.Duration
 }
 
+// ErrorCodeResultExpired marca, em GET /query/{id}, queries descartadas por
+// Config.ResultTTL.
+const ErrorCodeResultExpired = "RESULT_EXPIRED"
+
 // Server expõe API REST para consultas, carga de dados e workers.
 type Server struct {
 	cfg        Config
@@ -41,8 +60,13 @@ type Server struct {
 	workersMu sync.Mutex
 	workers   map[string]*workerBridge
 
-	resultsMu sync.RWMutex
+	resultsMu sync.Mutex
 	results   map[string]queryResult
+	// resultOrder guarda, com ResultTTL, os IDs na ordem em que os resultados
+	// foram gravados, que é também a ordem em que expiram
+	resultOrder   []string
+	resultsMemory *executor.MemoryTracker
+	now           func() time.Time
 }
 
 // NewServer cria o servidor HTTP e registra as rotas.
@@ -57,6 +81,9 @@ func NewServer(cfg Config) (*Server, error) {
 		cfg:     cfg,
 		workers: map[string]*workerBridge{},
 		results: map[string]queryResult{},
+		// sem limite próprio: o que limita os resultados é o orçamento do processo
+		resultsMemory: cfg.Memory.Child("resultados", 0),
+		now:           time.Now,
 	}
 	mux := http.NewServeMux()
 	s.registerRoutes(mux)
@@ -126,9 +153,7 @@ func (s *Server) handleQuery(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusServiceUnavailable, err.Error())
 		return
 	}
-	if s.cfg.Runner != nil {
-		go s.executeLocalResult(id, stmt)
-	}
+	go s.collectResult(id, stmt)
 	status, _ := s.cfg.Coordinator.QueryStatus(id)
 	writeJSON(w, http.StatusAccepted, map[string]interface{}{
 		"id":        id,
@@ -161,20 +186,38 @@ func (s *Server) handleQueryPath(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) handleQueryStatus(w http.ResponseWriter, r *http.Request, id string) {
+	// resultFor vem antes: descarta as queries expiradas
+	res, stored := s.resultFor(id)
 	status, err := s.cfg.Coordinator.QueryStatus(id)
 	if err != nil {
 		writeError(w, http.StatusNotFound, err.Error())
 		return
 	}
+	if status == distributed.StatusExpired {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"id":           id,
+			"status":       status,
+			"result_error": "resultado expirado",
+			"error_code":   ErrorCodeResultExpired,
+		})
+		return
+	}
 	results, _ := s.cfg.Coordinator.QueryResults(id)
+	summaries := make([]distributed.TaskResult, 0, len(results))
+	for _, res := range results {
+		summaries = append(summaries, res.Summary())
+	}
 	resp := map[string]interface{}{
 		"id":      id,
 		"status":  status,
-		"results": results,
+		"results": summaries,
 	}
-	if res, ok := s.resultFor(id); ok && res.Ready {
+	if stored && res.Ready {
 		if res.Error != "" {
 			resp["result_error"] = res.Error
+			if res.ErrorCode != "" {
+				resp["error_code"] = res.ErrorCode
+			}
 		} else {
 			resp["rows"] = res.Rows
 		}
@@ -328,7 +371,12 @@ func (s *Server) handleWorkerResult(w http.ResponseWriter, r *http.Request, brid
 		return
 	}
 	result.WorkerID = bridge.id
-	if !bridge.deliverResult(result) {
+	delivered, err := bridge.deliverResult(result)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("resultado inválido: %v", err))
+		return
+	}
+	if !delivered {
 		writeError(w, http.StatusConflict, "nenhum task aguardando resultado")
 		return
 	}
@@ -384,35 +432,104 @@ func writeError(w http.ResponseWriter, status int, message string) {
 	writeJSON(w, status, map[string]string{"error": message})
 }
 
-func (s *Server) executeLocalResult(id string, stmt *query.SelectStatement) {
+// collectResult aguarda os tasks da query e combina os batches devolvidos pelos
+// workers no resultado final exposto em GET /query/{id}.
+func (s *Server) collectResult(id string, stmt *query.SelectStatement) {
+	if err := s.cfg.Coordinator.Wait(id); err != nil {
+		s.storeResult(id, nil, err)
+		return
+	}
 	if s.cfg.Runner == nil {
 		return
 	}
-	rows, err := s.cfg.Runner.Execute(stmt)
+	// o coordinator entrega os batches e deixa de guardá-los
+	batches, err := s.cfg.Coordinator.TakeBatches(id)
+	if err != nil {
+		s.storeResult(id, nil, err)
+		return
+	}
+	memory := s.cfg.Memory.Child("query "+id, s.cfg.QueryMemory)
+	var size int64
+	for _, batch := range batches {
+		if batch != nil {
+			size += executor.BatchBytes(batch)
+		}
+	}
+	if err := memory.Reserve(size); err != nil {
+		s.storeResult(id, nil, err)
+		return
+	}
+	rows, stats, err := s.cfg.Runner.MergeWithMemory(stmt, batches, memory)
+	memory.Release(size)
+	if err == nil {
+		// o spill do ORDER BY feito no merge aparece em /query/{id}/tree
+		err = s.cfg.Coordinator.RecordMergeStats(id, stats)
+	}
 	s.storeResult(id, rows, err)
 }
 
+// storeResult guarda o resultado reservando as linhas em resultsMemory,
+// depois de descartar os resultados expirados; se ainda não couber, guarda o
+// erro de memória no lugar das linhas.
 func (s *Server) storeResult(id string, rows []map[string]interface{}, execErr error) {
 	res := queryResult{Ready: true}
+	if execErr == nil {
+		for _, row := range rows {
+			res.Bytes += runner.RowBytes(row)
+		}
+	}
+	s.resultsMu.Lock()
+	defer s.resultsMu.Unlock()
+	now := s.now()
+	s.expireResults(now)
+	if execErr == nil {
+		execErr = s.resultsMemory.Reserve(res.Bytes)
+	}
 	if execErr != nil {
+		res.Bytes = 0
 		res.Error = execErr.Error()
+		res.ErrorCode = distributed.ErrorCode(execErr)
 	} else {
 		res.Rows = rows
 	}
-	s.resultsMu.Lock()
-	defer s.resultsMu.Unlock()
+	res.Stored = now
 	s.results[id] = res
+	if s.cfg.ResultTTL > 0 {
+		s.resultOrder = append(s.resultOrder, id)
+	}
+}
+
+// expireResults descarta os resultados guardados há mais de ResultTTL, junto
+// com o estado das queries no coordinator. Chamado com resultsMu travado.
+func (s *Server) expireResults(now time.Time) {
+	for len(s.resultOrder) > 0 {
+		id := s.resultOrder[0]
+		res := s.results[id]
+		if now.Sub(res.Stored) < s.cfg.ResultTTL {
+			return
+		}
+		s.resultOrder = s.resultOrder[1:]
+		s.resultsMemory.Release(res.Bytes)
+		delete(s.results, id)
+		_ = s.cfg.Coordinator.Forget(id)
+	}
 }
 
 func (s *Server) resultFor(id string) (queryResult, bool) {
-	s.resultsMu.RLock()
-	defer s.resultsMu.RUnlock()
+	s.resultsMu.Lock()
+	defer s.resultsMu.Unlock()
+	s.expireResults(s.now())
 	res, ok := s.results[id]
 	return res, ok
 }
 
 type queryResult struct {
-	Rows  []map[string]interface{}
-	Error string
-	Ready bool
+	Rows      []map[string]interface{}
+	Error     string
+	ErrorCode string
+	Ready     bool
+	// Bytes é o que Rows ocupa em resultsMemory
+	Bytes int64
+	// Stored é quando o resultado ficou pronto; conta para ResultTTL
+	Stored time.Time
 }
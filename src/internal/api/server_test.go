@@ -0,0 +1,129 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Jonatan852/distributed-query-processing/internal/distributed"
+	"github.com/Jonatan852/distributed-query-processing/internal/executor"
+	"github.com/Jonatan852/distributed-query-processing/internal/planner"
+	"github.com/Jonatan852/distributed-query-processing/internal/runtime/runner"
+	"github.com/Jonatan852/distributed-query-processing/internal/storage"
+	"github.com/Jonatan852/distributed-query-processing/pkg/query"
+)
+
+func TestStoredResultsMemory(t *testing.T) {
+	engine, err := storage.NewEngine(filepath.Join(t.TempDir(), "data"))
+	if err != nil {
+		t.Fatalf("erro criando engine: %v", err)
+	}
+	var rows []map[string]interface{}
+	var size int64
+	for i := 0; i < 10; i++ {
+		row := map[string]interface{}{"id": int64(i), "name": fmt.Sprintf("linha %d", i)}
+		rows = append(rows, row)
+		size += runner.RowBytes(row)
+	}
+	coord := distributed.NewCoordinator()
+	coord.Register(distributed.NewLocalWorker("w1", func(req distributed.TaskRequest) distributed.TaskResult {
+		return distributed.TaskResult{}
+	}))
+	submit := func() string {
+		t.Helper()
+		root := query.NewPlanNode(query.PlanNodeRoot)
+		root.AddChild(query.NewPlanNode(query.PlanNodeScan))
+		id, err := coord.Submit(&query.PhysicalPlan{Root: root})
+		if err != nil {
+			t.Fatalf("submit falhou: %v", err)
+		}
+		if err := coord.Wait(id); err != nil {
+			t.Fatalf("query falhou: %v", err)
+		}
+		return id
+	}
+	// cabe um resultado e meio
+	memory := executor.NewMemoryTracker("processo", size+size/2)
+	s, err := NewServer(Config{
+		Engine:      engine,
+		Planner:     planner.New(engine),
+		Coordinator: coord,
+		Memory:      memory,
+		ResultTTL:   time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("erro criando servidor: %v", err)
+	}
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+	status := func(id string) map[string]interface{} {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		s.handleQueryPath(rec, httptest.NewRequest(http.MethodGet, "/query/"+id, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET /query/%s respondeu %d: %s", id, rec.Code, rec.Body)
+		}
+		var resp map[string]interface{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("resposta inválida: %v", err)
+		}
+		return resp
+	}
+
+	first, second := submit(), submit()
+	s.storeResult(first, rows, nil)
+	// o resultado novo que não cabe falha; o guardado continua disponível
+	now = now.Add(30 * time.Second)
+	s.storeResult(second, rows, nil)
+	if res, _ := s.resultFor(second); res.ErrorCode != distributed.ErrorCodeMemoryLimit || res.Rows != nil {
+		t.Fatalf("%s deveria falhar por memória: %+v", second, res)
+	}
+	if res, _ := s.resultFor(first); res.Error != "" || len(res.Rows) != len(rows) {
+		t.Fatalf("%s não deveria ser descartado por outra query: %+v", first, res)
+	}
+	if memory.Used() != size {
+		t.Fatalf("esperava %d bytes reservados, obteve %d", size, memory.Used())
+	}
+
+	// passado ResultTTL o resultado e o estado da query são descartados e a
+	// reserva volta ao processo
+	now = now.Add(45 * time.Second)
+	if resp := status(first); resp["status"] != string(distributed.StatusExpired) || resp["error_code"] != ErrorCodeResultExpired || resp["rows"] != nil {
+		t.Fatalf("%s deveria ter expirado: %v", first, resp)
+	}
+	if _, ok := s.resultFor(first); ok {
+		t.Fatalf("o resultado expirado deveria sair do mapa")
+	}
+	if _, err := coord.QueryResults(first); err == nil {
+		t.Fatalf("o coordinator deveria descartar o estado da query expirada")
+	}
+	if memory.Used() != 0 {
+		t.Fatalf("o resultado expirado deveria devolver a reserva, restaram %d bytes", memory.Used())
+	}
+	third := submit()
+	s.storeResult(third, rows, nil)
+	if resp := status(third); resp["status"] != string(distributed.StatusSuccess) || len(resp["rows"].([]interface{})) != len(rows) {
+		t.Fatalf("%s deveria caber depois da expiração: %v", third, resp)
+	}
+	// erros também expiram
+	now = now.Add(time.Minute)
+	for _, id := range []string{second, third} {
+		if resp := status(id); resp["status"] != string(distributed.StatusExpired) {
+			t.Fatalf("%s deveria ter expirado: %v", id, resp)
+		}
+	}
+	if memory.Used() != 0 || len(s.results) != 0 || len(s.resultOrder) != 0 {
+		t.Fatalf("restaram %d bytes e %d resultados guardados", memory.Used(), len(s.results))
+	}
+
+	// sem ResultTTL nada expira e resultOrder não cresce
+	s.cfg.ResultTTL = 0
+	s.storeResult(submit(), nil, nil)
+	if len(s.resultOrder) != 0 {
+		t.Fatalf("sem ResultTTL os IDs não deveriam ser enfileirados")
+	}
+}
@@ -78,12 +78,17 @@ func (w *workerBridge) waitTask(ctx context.Context) (distributed.TaskRequest, b
 	}
 }
 
-func (w *workerBridge) deliverResult(result distributed.TaskResult) bool {
+// deliverResult valida os batches decodificados do payload do worker e entrega o
+// resultado ao task que aguarda em Execute.
+func (w *workerBridge) deliverResult(result distributed.TaskResult) (bool, error) {
+	if err := distributed.AssembleResult(&result); err != nil {
+		return false, err
+	}
 	select {
 	case w.resultCh <- result:
-		return true
+		return true, nil
 	case <-time.After(5 * time.Second):
-		return false
+		return false, nil
 	}
 }
 
@@ -6,11 +6,27 @@ import (
 	"sync"
 	"time"
 
+	"github.com/Jonatan852/distributed-query-processing/internal/executor"
 	"github.com/Jonatan852/distributed-query-processing/pkg/query"
 )
 
+// PartitionCatalog lista as partições de uma tabela para dividir scans em tasks.
+type PartitionCatalog interface {
+	PartitionIDs(table string) ([]string, error)
+}
+
+// Config ajusta como o coordinator divide os fragmentos em tasks.
+type Config struct {
+	// Catalog permite abrir um task por grupo de partições; sem ele cada
+	// fragmento vira um único task que lê a tabela inteira.
+	Catalog PartitionCatalog
+	// PartitionsPerTask define o tamanho do grupo de partições (padrão 1).
+	PartitionsPerTask int
+}
+
 // Coordinator gerencia workers e execução de planos distribuídos.
 type Coordinator struct {
+	cfg      Config
 	mu       sync.Mutex
 	workers  map[string]WorkerClient
 	queries  map[string]*queryState
@@ -25,10 +41,21 @@ type queryState struct {
 	Results     []TaskResult
 	Error       error
 	SubmittedAt time.Time
+	done        chan struct{}
 }
 
 func NewCoordinator() *Coordinator {
+	return NewCoordinatorWithConfig(Config{})
+}
+
+// NewCoordinatorWithConfig cria um coordinator que consulta o catálogo para
+// dividir scans por partição.
+func NewCoordinatorWithConfig(cfg Config) *Coordinator {
+	if cfg.PartitionsPerTask <= 0 {
+		cfg.PartitionsPerTask = 1
+	}
 	return &Coordinator{
+		cfg:     cfg,
 		workers: map[string]WorkerClient{},
 		queries: map[string]*queryState{},
 	}
@@ -65,6 +92,7 @@ func (c *Coordinator) Submit(plan *query.PhysicalPlan) (string, error) {
 		Status:      StatusPending,
 		Plan:        plan,
 		SubmittedAt: time.Now(),
+		done:        make(chan struct{}),
 	}
 	c.queries[id] = state
 	go c.execute(state)
@@ -72,40 +100,215 @@ func (c *Coordinator) Submit(plan *query.PhysicalPlan) (string, error) {
 }
 
 func (c *Coordinator) execute(state *queryState) {
-	state.Status = StatusRunning
-	fragments := collectFragments(state.Plan.Root)
+	defer close(state.done)
+	c.finish(state, StatusRunning, nil, nil)
 	workers := c.snapshotWorkers()
 	if len(workers) == 0 {
-		state.Status = StatusFailed
-		state.Error = errors.New("nenhum worker disponível")
+		c.finish(state, StatusFailed, nil, errors.New("nenhum worker disponível"))
 		return
 	}
-	var wg sync.WaitGroup
+	fragments, err := c.splitFragments(collectFragments(state.Plan.Root))
+	if err != nil {
+		c.finish(state, StatusFailed, nil, err)
+		return
+	}
+
+	// Cada worker consome tasks de uma fila compartilhada: workers rápidos pegam
+	// mais partições e nenhum worker recebe mais de um task simultâneo.
+	queue := make(chan int, len(fragments))
+	for i := range fragments {
+		queue <- i
+	}
+	close(queue)
 	results := make([]TaskResult, len(fragments))
-	for i, fragment := range fragments {
+	var wg sync.WaitGroup
+	for _, worker := range workers {
 		wg.Add(1)
-		worker := workers[i%len(workers)]
-		taskID := fmt.Sprintf("%s-task-%d", state.ID, i+1)
-		req := TaskRequest{
-			QueryID:  state.ID,
-			TaskID:   taskID,
-			Fragment: fragment,
-		}
-		go func(idx int, w WorkerClient, tr TaskRequest) {
+		go func(w WorkerClient) {
 			defer wg.Done()
-			results[idx] = w.Execute(tr)
-		}(i, worker, req)
+			for idx := range queue {
+				req := TaskRequest{
+					QueryID:  state.ID,
+					TaskID:   fmt.Sprintf("%s-task-%d", state.ID, idx+1),
+					Fragment: fragments[idx],
+				}
+				res := w.Execute(req)
+				if err := AssembleResult(&res); err != nil {
+					res.Error = err.Error()
+				}
+				results[idx] = res
+			}
+		}(worker)
 	}
 	wg.Wait()
-	state.Results = results
+	c.recordStats(state, results)
 	for _, res := range results {
 		if res.Error != "" {
-			state.Status = StatusFailed
-			state.Error = errors.New(res.Error)
+			c.finish(state, StatusFailed, results, res.Err())
 			return
 		}
 	}
-	state.Status = StatusSuccess
+	c.finish(state, StatusSuccess, results, nil)
+}
+
+// finish atualiza o estado da query sob o lock do coordinator.
+func (c *Coordinator) finish(state *queryState, status QueryStatus, results []TaskResult, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	state.Status = status
+	if results != nil {
+		state.Results = results
+	}
+	state.Error = err
+}
+
+// recordStats soma as métricas devolvidas pelos tasks em PlanNode.Stats. Os
+// fragmentos enviados são cópias do plano e mantêm os IDs dos nós.
+func (c *Coordinator) recordStats(state *queryState, results []TaskResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	nodes := map[string]*query.PlanNode{}
+	var index func(node *query.PlanNode)
+	index = func(node *query.PlanNode) {
+		if node == nil {
+			return
+		}
+		nodes[node.ID] = node
+		for _, child := range node.Children {
+			index(child)
+		}
+	}
+	index(state.Plan.Root)
+	for _, res := range results {
+		for id, stats := range res.Stats {
+			if node, ok := nodes[id]; ok {
+				addStats(node, stats)
+			}
+		}
+	}
+}
+
+// RecordMergeStats soma ao plano da query as métricas dos operadores que o
+// coordinator executa depois dos tasks (o merge do runner, como o SORT de um
+// ORDER BY). Cada tipo vai para o nó desse tipo mais próximo da raiz.
+func (c *Coordinator) RecordMergeStats(id string, stats map[query.PlanNodeType]map[string]int64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	state, ok := c.queries[id]
+	if !ok {
+		return fmt.Errorf("query %s não encontrada", id)
+	}
+	for typ, values := range stats {
+		if node := topNode(state.Plan.Root, typ); node != nil {
+			addStats(node, values)
+		}
+	}
+	return nil
+}
+
+// topNode faz uma busca em largura pelo primeiro nó do tipo informado.
+func topNode(root *query.PlanNode, typ query.PlanNodeType) *query.PlanNode {
+	queue := []*query.PlanNode{root}
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		if node == nil {
+			continue
+		}
+		if node.Type == typ {
+			return node
+		}
+		queue = append(queue, node.Children...)
+	}
+	return nil
+}
+
+func addStats(node *query.PlanNode, stats map[string]int64) {
+	if node.Stats == nil {
+		node.Stats = map[string]interface{}{}
+	}
+	for key, value := range stats {
+		total, _ := node.Stats[key].(int64)
+		node.Stats[key] = total + value
+	}
+}
+
+// splitFragments abre um task por grupo de partições da tabela lida em cada
+// fragmento. Cada task recebe uma cópia do fragmento com a lista de partições
+// gravada em Properties["partitions"] do SCAN. Um LIMIT parcial não é
+// dividido: um único task lê as partições em ordem e para assim que tiver as
+// linhas pedidas, em vez de abrir todas em paralelo.
+func (c *Coordinator) splitFragments(fragments []*query.PlanNode) ([]*query.PlanNode, error) {
+	if c.cfg.Catalog == nil {
+		return fragments, nil
+	}
+	var result []*query.PlanNode
+	for _, fragment := range fragments {
+		scan := findScan(fragment)
+		if scan == nil {
+			result = append(result, fragment)
+			continue
+		}
+		partitions, explicit, err := c.fragmentPartitions(scan)
+		if err != nil {
+			return nil, err
+		}
+		if explicit && len(partitions) == 0 {
+			// O planner podou todas as partições: nenhum task é necessário.
+			continue
+		}
+		if len(partitions) == 0 || fragment.Type == query.PlanNodeLimit {
+			result = append(result, fragment)
+			continue
+		}
+		for start := 0; start < len(partitions); start += c.cfg.PartitionsPerTask {
+			end := start + c.cfg.PartitionsPerTask
+			if end > len(partitions) {
+				end = len(partitions)
+			}
+			clone := fragment.Clone()
+			findScan(clone).Properties["partitions"] = partitions[start:end]
+			result = append(result, clone)
+		}
+	}
+	return result, nil
+}
+
+// fragmentPartitions devolve as partições do SCAN; explicit indica que a lista
+// veio do plano (já podada) em vez do catálogo.
+func (c *Coordinator) fragmentPartitions(scan *query.PlanNode) ([]string, bool, error) {
+	var partitions []string
+	found, err := scan.DecodeProperty("partitions", &partitions)
+	if err != nil {
+		return nil, false, err
+	}
+	if found {
+		return partitions, true, nil
+	}
+	var table string
+	if _, err := scan.DecodeProperty("table", &table); err != nil {
+		return nil, false, err
+	}
+	if table == "" {
+		return nil, false, nil
+	}
+	partitions, err = c.cfg.Catalog.PartitionIDs(table)
+	return partitions, false, err
+}
+
+func findScan(node *query.PlanNode) *query.PlanNode {
+	if node == nil {
+		return nil
+	}
+	if node.Type == query.PlanNodeScan {
+		return node
+	}
+	for _, child := range node.Children {
+		if scan := findScan(child); scan != nil {
+			return scan
+		}
+	}
+	return nil
 }
 
 func (c *Coordinator) snapshotWorkers() []WorkerClient {
@@ -118,18 +321,62 @@ func (c *Coordinator) snapshotWorkers() []WorkerClient {
 	return list
 }
 
-// QueryStatus retorna o status atual de uma query enviada.
+// QueryStatus retorna o status atual de uma query enviada; StatusExpired para
+// uma query já descartada por Forget.
 func (c *Coordinator) QueryStatus(id string) (QueryStatus, error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	state, ok := c.queries[id]
 	if !ok {
+		if c.forgotten(id) {
+			return StatusExpired, nil
+		}
 		return "", fmt.Errorf("query %s não encontrada", id)
 	}
 	return state.Status, nil
 }
 
-// QueryResults devolve o detalhamento dos tasks.
+// Forget descarta o estado de uma query que já terminou (plano, resultados
+// dos tasks e métricas).
+func (c *Coordinator) Forget(id string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	state, ok := c.queries[id]
+	if !ok {
+		return fmt.Errorf("query %s não encontrada", id)
+	}
+	select {
+	case <-state.done:
+	default:
+		return fmt.Errorf("query %s ainda está em execução", id)
+	}
+	delete(c.queries, id)
+	return nil
+}
+
+// forgotten indica se id foi emitido por Submit e não está mais em queries,
+// ou seja, foi descartado por Forget. Chamado com c.mu travado.
+func (c *Coordinator) forgotten(id string) bool {
+	var seq int64
+	if n, err := fmt.Sscanf(id, "q-%d", &seq); err != nil || n != 1 || id != fmt.Sprintf("q-%04d", seq) {
+		return false
+	}
+	return seq >= 1 && seq <= c.querySeq
+}
+
+// Wait bloqueia até a query terminar e devolve o erro de execução, se houver.
+func (c *Coordinator) Wait(id string) error {
+	c.mu.Lock()
+	state, ok := c.queries[id]
+	c.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("query %s não encontrada", id)
+	}
+	<-state.done
+	return state.Error
+}
+
+// QueryResults devolve uma cópia do detalhamento dos tasks.
 func (c *Coordinator) QueryResults(id string) ([]TaskResult, error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -137,7 +384,25 @@ func (c *Coordinator) QueryResults(id string) ([]TaskResult, error) {
 	if !ok {
 		return nil, fmt.Errorf("query %s não encontrada", id)
 	}
-	return state.Results, nil
+	return append([]TaskResult(nil), state.Results...), nil
+}
+
+// TakeBatches entrega os batches produzidos por todos os tasks, na ordem dos
+// fragmentos, e os retira do estado da query: depois do merge eles não ficam
+// presos ao coordinator. Uma segunda chamada não devolve nada.
+func (c *Coordinator) TakeBatches(id string) ([]*executor.Batch, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	state, ok := c.queries[id]
+	if !ok {
+		return nil, fmt.Errorf("query %s não encontrada", id)
+	}
+	var batches []*executor.Batch
+	for i := range state.Results {
+		batches = append(batches, state.Results[i].Batches...)
+		state.Results[i].Batches = nil
+	}
+	return batches, nil
 }
 
 // QueryPlan devolve o plano físico utilizado na execução.
@@ -148,19 +413,69 @@ func (c *Coordinator) QueryPlan(id string) (*query.PhysicalPlan, error) {
 	if !ok {
 		return nil, fmt.Errorf("query %s não encontrada", id)
 	}
-	return state.Plan, nil
+	// uma cópia: as métricas continuam sendo somadas ao plano da query
+	return &query.PhysicalPlan{Root: state.Plan.Root.Clone()}, nil
 }
 
+// collectFragments devolve as subárvores que podem ser executadas integralmente
+// por um worker: cadeias de FILTER sobre um único SCAN, opcionalmente sob o
+// AGGREGATE LOCAL ou o TOPN marcados como partial (os workers devolvem estados
+// parciais ou as primeiras linhas de cada task). O restante do plano (agregação
+// GLOBAL, projeção, ordenação, limite, joins) é resolvido no coordinator com os
+// batches devolvidos pelos tasks.
 func collectFragments(node *query.PlanNode) []*query.PlanNode {
 	if node == nil {
 		return nil
 	}
-	var fragments []*query.PlanNode
-	if node.Type == query.PlanNodeScan {
-		fragments = append(fragments, node)
+	if isWorkerFragment(node) {
+		return []*query.PlanNode{node}
 	}
+	var fragments []*query.PlanNode
 	for _, child := range node.Children {
 		fragments = append(fragments, collectFragments(child)...)
 	}
 	return fragments
 }
+
+func isWorkerFragment(node *query.PlanNode) bool {
+	switch node.Type {
+	case query.PlanNodeScan:
+		return true
+	case query.PlanNodeFilter:
+		return len(node.Children) == 1 && isWorkerFragment(node.Children[0])
+	case query.PlanNodeAggregate:
+		return isPartialAggregate(node)
+	case query.PlanNodeTopN, query.PlanNodeLimit:
+		return isPartial(node)
+	default:
+		return false
+	}
+}
+
+// isPartialAggregate indica se o nó é um AGGREGATE LOCAL que o planner liberou
+// para os workers.
+func isPartialAggregate(node *query.PlanNode) bool {
+	var stage string
+	if _, err := node.DecodeProperty("stage", &stage); err != nil || stage != "LOCAL" {
+		return false
+	}
+	return isPartial(node)
+}
+
+// isPartial indica se o planner marcou o nó como partial e ele está sobre um
+// fragmento de worker; a projeção entre o nó e o fragmento é aplicada depois,
+// no coordinator.
+func isPartial(node *query.PlanNode) bool {
+	var partial bool
+	if _, err := node.DecodeProperty("partial", &partial); err != nil || !partial {
+		return false
+	}
+	if len(node.Children) != 1 {
+		return false
+	}
+	child := node.Children[0]
+	if child.Type == query.PlanNodeProject && len(child.Children) == 1 {
+		child = child.Children[0]
+	}
+	return child.Type != query.PlanNodeAggregate && child.Type != query.PlanNodeTopN && child.Type != query.PlanNodeLimit && isWorkerFragment(child)
+}
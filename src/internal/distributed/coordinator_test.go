@@ -1,9 +1,17 @@
 package distributed
 
 import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/Jonatan852/distributed-query-processing/internal/executor"
+	"github.com/Jonatan852/distributed-query-processing/pkg/columnar"
 	"github.com/Jonatan852/distributed-query-processing/pkg/query"
 )
 
@@ -16,7 +24,9 @@ func TestCoordinatorSubmitAndStatus(t *testing.T) {
 	coord := NewCoordinator()
 	worker := NewLocalWorker("worker-1", func(req TaskRequest) TaskResult {
 		time.Sleep(10 * time.Millisecond)
-		return TaskResult{Rows: 10, Duration: 10 * time.Millisecond}
+		return TaskResult{Rows: 10, Duration: 10 * time.Millisecond, Stats: map[string]map[string]int64{
+			scan.ID: {"spilledRuns": 2},
+		}}
 	})
 	coord.Register(worker)
 
@@ -33,6 +43,13 @@ func TestCoordinatorSubmitAndStatus(t *testing.T) {
 	if len(results) != 1 {
 		t.Fatalf("esperava 1 task, obteve %d", len(results))
 	}
+	executed, err := coord.QueryPlan(id)
+	if err != nil {
+		t.Fatalf("erro consultando plano: %v", err)
+	}
+	if got := executed.Root.Children[0].Stats["spilledRuns"]; got != int64(2) {
+		t.Fatalf("métricas do task não chegaram ao plano: %v", got)
+	}
 }
 
 func TestCoordinatorHandlesWorkerError(t *testing.T) {
@@ -68,3 +85,386 @@ func waitForStatus(t *testing.T, coord *Coordinator, id string, desired QuerySta
 	}
 	t.Fatalf("status não atingiu %s dentro do timeout", desired)
 }
+
+func TestCoordinatorKeepsMemoryLimitError(t *testing.T) {
+	root := query.NewPlanNode(query.PlanNodeRoot)
+	root.AddChild(query.NewPlanNode(query.PlanNodeScan))
+
+	coord := NewCoordinator()
+	coord.Register(NewLocalWorker("w-mem", func(req TaskRequest) TaskResult {
+		var res TaskResult
+		res.SetError(executor.NewMemoryTracker("query "+req.QueryID, 10).Reserve(11))
+		// o erro atravessa o transporte como texto e código
+		data, err := json.Marshal(res)
+		if err != nil {
+			t.Errorf("marshal falhou: %v", err)
+		}
+		var decoded TaskResult
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Errorf("unmarshal falhou: %v", err)
+		}
+		return decoded
+	}))
+	id, err := coord.Submit(&query.PhysicalPlan{Root: root})
+	if err != nil {
+		t.Fatalf("submit falhou: %v", err)
+	}
+	err = coord.Wait(id)
+	if !errors.Is(err, executor.ErrMemoryLimitExceeded) || ErrorCode(err) != ErrorCodeMemoryLimit {
+		t.Fatalf("esperava erro de limite de memória, obteve %v", err)
+	}
+	if !strings.Contains(err.Error(), "query "+id) {
+		t.Fatalf("a mensagem deveria citar o orçamento excedido: %v", err)
+	}
+}
+
+func TestTaskResultWireRoundTrip(t *testing.T) {
+	ids := columnar.NewColumn("user_id", columnar.TypeInt)
+	names := columnar.NewColumn("country", columnar.TypeString)
+	values := columnar.NewColumn("value", columnar.TypeFloat)
+	flags := columnar.NewColumn("active", columnar.TypeBool)
+	stamps := columnar.NewColumn("ts", columnar.TypeTimestamp)
+	amounts := columnar.NewColumn("amount", columnar.TypeDecimal)
+	// campo repetido: registros com uma ou duas entradas
+	tags := columnar.NewColumn("tags", columnar.TypeString)
+	tags.RepetitionLevels, tags.DefinitionLevels = []uint8{}, []uint8{}
+	for i := 0; i < 10; i++ {
+		_ = ids.Append(columnar.NewIntValue(int64(i - 5)))
+		if i == 4 {
+			_ = names.Append(columnar.NewNullValue(columnar.TypeString))
+		} else {
+			_ = names.Append(columnar.NewStringValue(fmt.Sprintf("c%d", i)))
+		}
+		_ = values.Append(columnar.NewFloatValue(float64(i) / 3))
+		_ = flags.Append(columnar.NewBoolValue(i%3 == 0))
+		_ = stamps.Append(columnar.NewTimestampValue(time.Date(2025, 1, 1, 12, i, 0, 1000, time.UTC)))
+		_ = amounts.Append(columnar.NewDecimalValue(columnar.NewDecimal(int64(i*125-300), 2)))
+		for j := 0; j <= i%2; j++ {
+			_ = tags.Append(columnar.NewStringValue(fmt.Sprintf("t%d.%d", i, j)))
+			tags.RepetitionLevels = append(tags.RepetitionLevels, uint8(j))
+			tags.DefinitionLevels = append(tags.DefinitionLevels, 1)
+		}
+	}
+	original := TaskResult{
+		TaskID:   "q-0001-task-1",
+		Duration: 5 * time.Millisecond,
+		Stats:    map[string]map[string]int64{"node-001": {"spilledBytes": 42}},
+		Batches: []*executor.Batch{{
+			Columns: map[string]*columnar.Column{
+				"user_id": ids, "country": names, "value": values, "active": flags,
+				"ts": stamps, "amount": amounts, "tags": tags,
+			},
+			RowCount: 10,
+			Meta:     map[string]string{"table": "events"},
+		}},
+	}
+	data, err := json.Marshal(original)
+	if err != nil {
+		t.Fatalf("marshal falhou: %v", err)
+	}
+	var decoded TaskResult
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("unmarshal falhou: %v", err)
+	}
+	if err := AssembleResult(&decoded); err != nil {
+		t.Fatalf("assemble falhou: %v", err)
+	}
+	if decoded.Rows != 10 || len(decoded.Batches) != 1 {
+		t.Fatalf("resultado inesperado: rows=%d batches=%d", decoded.Rows, len(decoded.Batches))
+	}
+	batch := decoded.Batches[0]
+	for name, col := range original.Batches[0].Columns {
+		got := batch.Columns[name]
+		if got == nil || got.Type != col.Type || got.Len() != col.Len() {
+			t.Fatalf("coluna %s divergente", name)
+		}
+		if fmt.Sprint(got.RepetitionLevels, got.DefinitionLevels) != fmt.Sprint(col.RepetitionLevels, col.DefinitionLevels) {
+			t.Fatalf("coluna %s: níveis divergentes", name)
+		}
+		for i := 0; i < col.Len(); i++ {
+			want, _ := col.Get(i)
+			have, _ := got.Get(i)
+			if want != have {
+				t.Fatalf("coluna %s linha %d: esperava %v, obteve %v", name, i, want, have)
+			}
+		}
+	}
+	if batch.Meta["table"] != "events" {
+		t.Fatalf("meta perdida: %v", batch.Meta)
+	}
+	if decoded.Stats["node-001"]["spilledBytes"] != 42 {
+		t.Fatalf("stats perdidas: %v", decoded.Stats)
+	}
+}
+
+func TestDecodeBatchesRejectsCorruptPayload(t *testing.T) {
+	ids := columnar.NewColumn("user_id", columnar.TypeInt)
+	names := columnar.NewColumn("country", columnar.TypeString)
+	values := columnar.NewColumn("value", columnar.TypeFloat)
+	for i := 0; i < 20; i++ {
+		_ = ids.Append(columnar.NewIntValue(int64(i)))
+		_ = names.Append(columnar.NewStringValue(fmt.Sprintf("c%d", i)))
+		_ = values.Append(columnar.NewFloatValue(float64(i)))
+	}
+	data, err := EncodeBatches([]*executor.Batch{{
+		Columns:  map[string]*columnar.Column{"user_id": ids, "country": names, "value": values},
+		RowCount: 20,
+		Meta:     map[string]string{"table": "events"},
+	}})
+	if err != nil {
+		t.Fatalf("encode falhou: %v", err)
+	}
+	if _, err := DecodeBatches(data); err != nil {
+		t.Fatalf("decode do payload íntegro falhou: %v", err)
+	}
+	// todo corte do payload deve falhar com erro, nunca com panic
+	for cut := len(batchWireMagic); cut < len(data); cut++ {
+		if _, err := DecodeBatches(data[:cut]); err == nil {
+			t.Fatalf("payload truncado em %d bytes foi aceito", cut)
+		}
+	}
+
+	// tamanhos gigantes vindos do payload são recusados antes de alocar
+	header := func(count, rows uint64) []byte {
+		payload := append([]byte(nil), batchWireMagic...)
+		payload = binary.AppendUvarint(payload, count)
+		payload = binary.AppendUvarint(payload, rows)
+		return binary.AppendUvarint(payload, 0) // sem meta
+	}
+	column := func(payload []byte, typ columnar.DataType, length uint64, flags byte) []byte {
+		payload = binary.AppendUvarint(payload, 1)
+		payload = append(payload, 1, 'x', 1, 'x')
+		payload = binary.AppendUvarint(payload, uint64(typ))
+		payload = binary.AppendUvarint(payload, length)
+		return append(payload, flags)
+	}
+	corrupt := map[string][]byte{
+		"batches":         binary.AppendUvarint(append([]byte(nil), batchWireMagic...), 1<<40),
+		"meta":            binary.AppendUvarint(header(1, 1)[:len(header(1, 1))-1], 1<<40),
+		"entradas":        column(header(1, 1), columnar.TypeInt, 1<<31-1, 0),
+		"floats":          column(header(1, 1<<30), columnar.TypeFloat, 1<<30, 0),
+		"repetidos":       column(header(1, 1), columnar.TypeString, 1<<30, 2),
+		"string":          append(column(header(1, 1), columnar.TypeString, 1, 0), 0xff, 0xff, 0xff, 0xff, 0x0f),
+		"linhas":          binary.AppendUvarint(append([]byte(nil), batchWireMagic...), 1),
+		"booleanos":       column(header(1, 1<<30), columnar.TypeBool, 1<<30, 0),
+		"bitmap de nulos": column(header(1, 1<<30), columnar.TypeBool, 1<<30, 1),
+	}
+	for name, payload := range corrupt {
+		if _, err := DecodeBatches(payload); err == nil {
+			t.Fatalf("%s: payload corrompido foi aceito", name)
+		}
+	}
+}
+
+type fakeCatalog map[string][]string
+
+func (f fakeCatalog) PartitionIDs(table string) ([]string, error) {
+	return f[table], nil
+}
+
+func TestCoordinatorSplitsScanByPartition(t *testing.T) {
+	root := query.NewPlanNode(query.PlanNodeRoot)
+	scan := query.NewPlanNode(query.PlanNodeScan)
+	scan.Properties["table"] = "events"
+	root.AddChild(scan)
+	plan := &query.PhysicalPlan{Root: root}
+
+	coord := NewCoordinatorWithConfig(Config{
+		Catalog:           fakeCatalog{"events": {"p1", "p2", "p3", "p4", "p5"}},
+		PartitionsPerTask: 2,
+	})
+	var mu sync.Mutex
+	seen := map[string]bool{}
+	for _, id := range []string{"w1", "w2"} {
+		coord.Register(NewLocalWorker(id, func(req TaskRequest) TaskResult {
+			var partitions []string
+			if _, err := req.Fragment.DecodeProperty("partitions", &partitions); err != nil {
+				return TaskResult{Error: err.Error()}
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			for _, p := range partitions {
+				seen[p] = true
+			}
+			return TaskResult{}
+		}))
+	}
+
+	id, err := coord.Submit(plan)
+	if err != nil {
+		t.Fatalf("submit falhou: %v", err)
+	}
+	if err := coord.Wait(id); err != nil {
+		t.Fatalf("query falhou: %v", err)
+	}
+	results, _ := coord.QueryResults(id)
+	if len(results) != 3 {
+		t.Fatalf("esperava 3 tasks (grupos de 2 partições), obteve %d", len(results))
+	}
+	if len(seen) != 5 {
+		t.Fatalf("nem todas as partições foram lidas: %v", seen)
+	}
+	if _, ok := scan.Properties["partitions"]; ok {
+		t.Fatalf("o plano original não deve ser alterado")
+	}
+}
+
+func TestCoordinatorKeepsLimitFragmentInOneTask(t *testing.T) {
+	scan := query.NewPlanNode(query.PlanNodeScan)
+	scan.Properties["table"] = "events"
+	limit := query.NewPlanNode(query.PlanNodeLimit)
+	limit.Properties["count"] = int64(5)
+	limit.Properties["partial"] = true
+	limit.AddChild(scan)
+	root := query.NewPlanNode(query.PlanNodeRoot)
+	root.AddChild(limit)
+
+	coord := NewCoordinatorWithConfig(Config{Catalog: fakeCatalog{"events": {"p1", "p2", "p3", "p4"}}})
+	var tasks []*query.PlanNode
+	var mu sync.Mutex
+	coord.Register(NewLocalWorker("w1", func(req TaskRequest) TaskResult {
+		mu.Lock()
+		defer mu.Unlock()
+		tasks = append(tasks, req.Fragment)
+		return TaskResult{Rows: 5}
+	}))
+	id, err := coord.Submit(&query.PhysicalPlan{Root: root})
+	if err != nil {
+		t.Fatalf("submit falhou: %v", err)
+	}
+	if err := coord.Wait(id); err != nil {
+		t.Fatalf("query falhou: %v", err)
+	}
+	if len(tasks) != 1 || tasks[0].Type != query.PlanNodeLimit {
+		t.Fatalf("o LIMIT parcial deveria ir inteiro para um único task: %d tasks", len(tasks))
+	}
+	if _, ok := findScan(tasks[0]).Properties["partitions"]; ok {
+		t.Fatalf("o task do LIMIT deveria ler as partições da tabela em ordem")
+	}
+}
+
+func TestCollectFragmentsPushesPartialAggregate(t *testing.T) {
+	build := func(partial bool) (*query.PlanNode, *query.PlanNode, *query.PlanNode) {
+		scan := query.NewPlanNode(query.PlanNodeScan)
+		scan.Properties["table"] = "events"
+		filter := query.NewPlanNode(query.PlanNodeFilter)
+		filter.AddChild(scan)
+		project := query.NewPlanNode(query.PlanNodeProject)
+		project.AddChild(filter)
+		local := query.NewPlanNode(query.PlanNodeAggregate)
+		local.Properties["stage"] = "LOCAL"
+		local.Properties["partial"] = partial
+		local.AddChild(project)
+		exchange := query.NewPlanNode(query.PlanNodeExchange)
+		exchange.AddChild(local)
+		global := query.NewPlanNode(query.PlanNodeAggregate)
+		global.Properties["stage"] = "GLOBAL"
+		global.AddChild(exchange)
+		root := query.NewPlanNode(query.PlanNodeRoot)
+		root.AddChild(global)
+		return root, local, filter
+	}
+
+	root, local, _ := build(true)
+	if fragments := collectFragments(root); len(fragments) != 1 || fragments[0] != local {
+		t.Fatalf("o AGGREGATE LOCAL deveria ser o fragmento dos workers: %v", fragments)
+	}
+	root, _, filter := build(false)
+	if fragments := collectFragments(root); len(fragments) != 1 || fragments[0] != filter {
+		t.Fatalf("sem partial os workers só filtram: %v", fragments)
+	}
+}
+
+func TestCollectFragmentsPushesPartialTopN(t *testing.T) {
+	build := func(partial bool) (*query.PlanNode, *query.PlanNode, *query.PlanNode) {
+		scan := query.NewPlanNode(query.PlanNodeScan)
+		scan.Properties["table"] = "events"
+		filter := query.NewPlanNode(query.PlanNodeFilter)
+		filter.AddChild(scan)
+		project := query.NewPlanNode(query.PlanNodeProject)
+		project.AddChild(filter)
+		top := query.NewPlanNode(query.PlanNodeTopN)
+		top.Properties["count"] = int64(10)
+		top.Properties["partial"] = partial
+		top.AddChild(project)
+		root := query.NewPlanNode(query.PlanNodeRoot)
+		root.AddChild(top)
+		return root, top, filter
+	}
+
+	root, top, _ := build(true)
+	if fragments := collectFragments(root); len(fragments) != 1 || fragments[0] != top {
+		t.Fatalf("o TOPN parcial deveria ser o fragmento dos workers: %v", fragments)
+	}
+	root, _, filter := build(false)
+	if fragments := collectFragments(root); len(fragments) != 1 || fragments[0] != filter {
+		t.Fatalf("sem partial os workers só filtram: %v", fragments)
+	}
+}
+
+func TestCollectFragmentsPushesPartialLimit(t *testing.T) {
+	build := func(partial bool) (*query.PlanNode, *query.PlanNode, *query.PlanNode) {
+		scan := query.NewPlanNode(query.PlanNodeScan)
+		scan.Properties["table"] = "events"
+		project := query.NewPlanNode(query.PlanNodeProject)
+		project.AddChild(scan)
+		limit := query.NewPlanNode(query.PlanNodeLimit)
+		limit.Properties["count"] = int64(20)
+		limit.Properties["partial"] = partial
+		limit.AddChild(project)
+		root := query.NewPlanNode(query.PlanNodeRoot)
+		root.AddChild(limit)
+		return root, limit, scan
+	}
+
+	root, limit, _ := build(true)
+	if fragments := collectFragments(root); len(fragments) != 1 || fragments[0] != limit {
+		t.Fatalf("o LIMIT parcial deveria ser o fragmento dos workers: %v", fragments)
+	}
+	root, _, scan := build(false)
+	if fragments := collectFragments(root); len(fragments) != 1 || fragments[0] != scan {
+		t.Fatalf("sem partial os workers só leem: %v", fragments)
+	}
+}
+
+func TestCoordinatorHandsOffBatchesAndForgetsQueries(t *testing.T) {
+	root := query.NewPlanNode(query.PlanNodeRoot)
+	root.AddChild(query.NewPlanNode(query.PlanNodeScan))
+	col := columnar.NewColumn("id", columnar.TypeInt)
+	_ = col.Append(columnar.NewIntValue(1))
+
+	coord := NewCoordinator()
+	coord.Register(NewLocalWorker("w1", func(req TaskRequest) TaskResult {
+		return TaskResult{Rows: 1, Batches: []*executor.Batch{{Columns: map[string]*columnar.Column{"id": col}, RowCount: 1}}}
+	}))
+	id, err := coord.Submit(&query.PhysicalPlan{Root: root})
+	if err != nil {
+		t.Fatalf("submit falhou: %v", err)
+	}
+	if err := coord.Wait(id); err != nil {
+		t.Fatalf("query falhou: %v", err)
+	}
+	if batches, err := coord.TakeBatches(id); err != nil || len(batches) != 1 {
+		t.Fatalf("esperava 1 batch, obteve %d (%v)", len(batches), err)
+	}
+	// os batches entregues não ficam no estado da query
+	if batches, _ := coord.TakeBatches(id); len(batches) != 0 {
+		t.Fatalf("os batches deveriam ser entregues uma única vez")
+	}
+	if results, _ := coord.QueryResults(id); len(results) != 1 || results[0].Batches != nil || results[0].Rows != 1 {
+		t.Fatalf("o resumo dos tasks deveria continuar sem os batches: %+v", results)
+	}
+
+	if err := coord.Forget(id); err != nil {
+		t.Fatalf("forget falhou: %v", err)
+	}
+	if status, err := coord.QueryStatus(id); err != nil || status != StatusExpired {
+		t.Fatalf("query descartada deveria aparecer como EXPIRED: %q (%v)", status, err)
+	}
+	if _, err := coord.QueryPlan(id); err == nil {
+		t.Fatalf("o plano da query descartada não deveria continuar disponível")
+	}
+	if _, err := coord.QueryStatus("q-9999"); err == nil {
+		t.Fatalf("query nunca enviada não deveria aparecer como EXPIRED")
+	}
+}
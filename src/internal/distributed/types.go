@@ -1,8 +1,10 @@
 package distributed
 
 import (
+	"errors"
 	"time"
 
+	"github.com/Jonatan852/distributed-query-processing/internal/executor"
 	"github.com/Jonatan852/distributed-query-processing/pkg/query"
 )
 
@@ -14,6 +16,8 @@ const (
 	StatusRunning QueryStatus = "RUNNING"
 	StatusSuccess QueryStatus = "SUCCESS"
 	StatusFailed  QueryStatus = "FAILED"
+	// StatusExpired é o status de uma query já descartada por Coordinator.Forget.
+	StatusExpired QueryStatus = "EXPIRED"
 )
 
 // TaskRequest contém a fatia do plano que um worker deve executar.
@@ -23,13 +27,67 @@ type TaskRequest struct {
 	Fragment *query.PlanNode
 }
 
-// TaskResult descreve métricas e possíveis erros de um task executado pelo worker.
+// ErrorCodeMemoryLimit marca, em TaskResult.ErrorCode, tasks que falharam por
+// falta de memória (executor.ErrMemoryLimitExceeded).
+const ErrorCodeMemoryLimit = "MEMORY_LIMIT_EXCEEDED"
+
+// TaskResult descreve métricas, dados produzidos e possíveis erros de um task executado pelo worker.
+// No JSON os batches trafegam no formato binário de EncodeBatches (ver wire.go).
+// Stats traz as métricas dos operadores do fragmento por ID do nó do plano; o
+// coordinator as soma em PlanNode.Stats. ErrorCode classifica o erro para que
+// o tipo sobreviva ao transporte (ver Err).
 type TaskResult struct {
-	TaskID   string        `json:"taskId"`
-	WorkerID string        `json:"workerId"`
-	Rows     int           `json:"rows"`
-	Duration time.Duration `json:"duration"`
-	Error    string        `json:"error,omitempty"`
+	TaskID    string                      `json:"taskId"`
+	WorkerID  string                      `json:"workerId"`
+	Rows      int                         `json:"rows"`
+	Duration  time.Duration               `json:"duration"`
+	Error     string                      `json:"error,omitempty"`
+	ErrorCode string                      `json:"errorCode,omitempty"`
+	Stats     map[string]map[string]int64 `json:"stats,omitempty"`
+	Batches   []*executor.Batch           `json:"-"`
+}
+
+// Summary devolve uma cópia do resultado sem os batches, para exibição de status.
+func (r TaskResult) Summary() TaskResult {
+	r.Batches = nil
+	return r
+}
+
+// SetError grava a mensagem e o código do erro.
+func (r *TaskResult) SetError(err error) {
+	r.Error = err.Error()
+	r.ErrorCode = ErrorCode(err)
+}
+
+// Err reconstrói o erro do task: errors.Is(err, executor.ErrMemoryLimitExceeded)
+// vale para tasks com ErrorCodeMemoryLimit.
+func (r TaskResult) Err() error {
+	if r.Error == "" {
+		return nil
+	}
+	return &taskError{message: r.Error, code: r.ErrorCode}
+}
+
+// ErrorCode classifica err para TaskResult.ErrorCode e para o status da query;
+// erros sem classificação devolvem "".
+func ErrorCode(err error) string {
+	if errors.Is(err, executor.ErrMemoryLimitExceeded) {
+		return ErrorCodeMemoryLimit
+	}
+	return ""
+}
+
+type taskError struct {
+	message string
+	code    string
+}
+
+func (e *taskError) Error() string {
+	return e.message
+}
+
+func (e *taskError) Is(target error) bool {
+	return e.code == ErrorCodeMemoryLimit && target == executor.ErrMemoryLimitExceeded
 }
 
 // WorkerClient representa um worker conectado ao coordinator.
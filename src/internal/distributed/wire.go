@@ -0,0 +1,147 @@
+package distributed
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/Jonatan852/distributed-query-processing/internal/executor"
+)
+
+// batchWireMagic identifica a versão do formato binário de batches.
+var batchWireMagic = []byte("DQB3")
+
+// taskResultWire é a representação JSON de TaskResult: os batches trafegam como
+// um único blob binário colunar (base64 no JSON) em vez de arrays JSON por valor.
+type taskResultWire struct {
+	TaskID    string                      `json:"taskId"`
+	WorkerID  string                      `json:"workerId"`
+	Rows      int                         `json:"rows"`
+	Duration  int64                       `json:"duration"`
+	Error     string                      `json:"error,omitempty"`
+	ErrorCode string                      `json:"errorCode,omitempty"`
+	Stats     map[string]map[string]int64 `json:"stats,omitempty"`
+	Batches   []byte                      `json:"batches,omitempty"`
+}
+
+// MarshalJSON codifica os batches no formato binário compacto.
+func (r TaskResult) MarshalJSON() ([]byte, error) {
+	wire := taskResultWire{
+		TaskID:    r.TaskID,
+		WorkerID:  r.WorkerID,
+		Rows:      r.Rows,
+		Duration:  int64(r.Duration),
+		Error:     r.Error,
+		ErrorCode: r.ErrorCode,
+		Stats:     r.Stats,
+	}
+	if len(r.Batches) > 0 {
+		payload, err := EncodeBatches(r.Batches)
+		if err != nil {
+			return nil, err
+		}
+		wire.Batches = payload
+	}
+	return json.Marshal(wire)
+}
+
+// UnmarshalJSON decodifica o formato gerado por MarshalJSON.
+func (r *TaskResult) UnmarshalJSON(data []byte) error {
+	var wire taskResultWire
+	if err := json.Unmarshal(data, &wire); err != nil {
+		return err
+	}
+	*r = TaskResult{
+		TaskID:    wire.TaskID,
+		WorkerID:  wire.WorkerID,
+		Rows:      wire.Rows,
+		Duration:  time.Duration(wire.Duration),
+		Error:     wire.Error,
+		ErrorCode: wire.ErrorCode,
+		Stats:     wire.Stats,
+	}
+	if len(wire.Batches) > 0 {
+		batches, err := DecodeBatches(wire.Batches)
+		if err != nil {
+			return err
+		}
+		r.Batches = batches
+	}
+	return nil
+}
+
+// AssembleResult valida os batches recebidos de um worker e recalcula a contagem
+// de linhas a partir deles, descartando batches vazios.
+func AssembleResult(result *TaskResult) error {
+	if result.Error != "" {
+		result.Batches = nil
+		return nil
+	}
+	if len(result.Batches) == 0 {
+		return nil
+	}
+	assembled := make([]*executor.Batch, 0, len(result.Batches))
+	rows := 0
+	for idx, batch := range result.Batches {
+		if batch == nil || batch.RowCount == 0 {
+			continue
+		}
+		for name, col := range batch.Columns {
+			if col == nil || col.Records() != batch.RowCount {
+				return fmt.Errorf("batch %d: coluna %s inconsistente com %d linhas", idx, name, batch.RowCount)
+			}
+		}
+		rows += batch.RowCount
+		assembled = append(assembled, batch)
+	}
+	result.Batches = assembled
+	result.Rows = rows
+	return nil
+}
+
+// EncodeBatches serializa batches no formato binário colunar de
+// executor.EncodeBatch, precedidos da versão do formato e da quantidade.
+func EncodeBatches(batches []*executor.Batch) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Write(batchWireMagic)
+	buf.Write(binary.AppendUvarint(nil, uint64(len(batches))))
+	for _, batch := range batches {
+		if err := executor.EncodeBatch(&buf, batch); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// DecodeBatches reconstrói os batches gerados por EncodeBatches.
+func DecodeBatches(data []byte) ([]*executor.Batch, error) {
+	if !bytes.HasPrefix(data, batchWireMagic) {
+		return nil, errors.New("payload de batches com formato desconhecido")
+	}
+	payload := data[len(batchWireMagic):]
+	decoder := executor.NewBatchDecoder(bytes.NewReader(payload), int64(len(payload)))
+	count, err := decoder.ReadUvarint()
+	if err != nil {
+		return nil, err
+	}
+	// cada batch ocupa ao menos três bytes (linhas, meta e colunas)
+	if count > uint64(decoder.Remaining()/3) {
+		return nil, fmt.Errorf("payload com %d batches em %d bytes", count, decoder.Remaining())
+	}
+	batches := make([]*executor.Batch, 0, count)
+	for i := uint64(0); i < count; i++ {
+		batch, err := decoder.Decode()
+		if err == io.EOF {
+			return nil, fmt.Errorf("batch %d: %w", i, io.ErrUnexpectedEOF)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("batch %d: %w", i, err)
+		}
+		batches = append(batches, batch)
+	}
+	return batches, nil
+}
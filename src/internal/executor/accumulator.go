@@ -0,0 +1,815 @@
+package executor
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/Jonatan852/distributed-query-processing/pkg/columnar"
+)
+
+// Accumulator calcula uma agregação valor a valor. Além de acumular, o estado
+// pode ser serializado (State) e combinado com o estado de outro acumulador da
+// mesma função (Merge, MergeState), o que permite agregar em duas fases: os
+// workers acumulam suas partições (stage LOCAL) e o coordinator combina os
+// estados parciais antes de finalizar (stage GLOBAL).
+//
+// NULLs são ignorados e, com distinct, cada valor é acumulado uma única vez.
+type Accumulator struct {
+	fn       AggregateFunc
+	distinct bool
+	params   []columnar.Value
+	acc      aggAccumulator
+}
+
+// NewAccumulator cria o acumulador da função informada. params são os
+// argumentos constantes depois do valor agregado, como o número de quantis de
+// APPROX_QUANTILES ou o separador de STRING_AGG.
+func NewAccumulator(fn AggregateFunc, distinct bool, params ...columnar.Value) (*Accumulator, error) {
+	inner, err := newAccumulator(fn, params)
+	if err != nil {
+		return nil, err
+	}
+	acc := &Accumulator{fn: fn, distinct: distinct, params: params, acc: inner}
+	if distinct {
+		acc.acc = &distinctAccumulator{acc: inner, values: map[string]columnar.Value{}}
+	}
+	return acc, nil
+}
+
+// Add acumula o valor.
+func (a *Accumulator) Add(value columnar.Value) error {
+	if value.IsNull() {
+		return nil
+	}
+	return a.acc.accumulate(value)
+}
+
+// Merge combina o estado de other, que precisa ser da mesma função.
+func (a *Accumulator) Merge(other *Accumulator) error {
+	if other.fn != a.fn || other.distinct != a.distinct {
+		return fmt.Errorf("estado parcial de %s não pode ser combinado com %s", other.fn, a.fn)
+	}
+	return a.acc.merge(other.acc)
+}
+
+// State serializa o estado parcial.
+func (a *Accumulator) State() []byte {
+	return a.acc.appendState(nil)
+}
+
+// MergeState combina um estado serializado por State.
+func (a *Accumulator) MergeState(data []byte) error {
+	partial, err := NewAccumulator(a.fn, a.distinct, a.params...)
+	if err != nil {
+		return err
+	}
+	r := &stateReader{data: data}
+	partial.acc.readState(r)
+	if err := r.finish(); err != nil {
+		return fmt.Errorf("estado parcial de %s inválido: %w", a.fn, err)
+	}
+	return a.acc.merge(partial.acc)
+}
+
+// Result devolve o valor final da agregação. Agregações que produzem listas
+// (ReturnsList) devolvem NULL aqui; o resultado delas vem de Values.
+func (a *Accumulator) Result() columnar.Value {
+	return a.acc.result()
+}
+
+// Values devolve o resultado das agregações que produzem listas (ARRAY_AGG,
+// APPROX_QUANTILES); nil quando nenhum valor foi acumulado.
+func (a *Accumulator) Values() []columnar.Value {
+	if list, ok := a.acc.(listAccumulator); ok {
+		return list.list()
+	}
+	return nil
+}
+
+// aggAccumulator é o estado de uma medida. NULLs nunca chegam aos acumuladores
+// (são descartados em Accumulator.Add) e merge só recebe estados do mesmo tipo.
+type aggAccumulator interface {
+	accumulate(value columnar.Value) error
+	merge(other aggAccumulator) error
+	result() columnar.Value
+	appendState(buf []byte) []byte
+	readState(r *stateReader)
+}
+
+// listAccumulator é implementado pelos acumuladores cujo resultado é uma lista.
+type listAccumulator interface {
+	list() []columnar.Value
+}
+
+func newAccumulator(fn AggregateFunc, params []columnar.Value) (aggAccumulator, error) {
+	switch fn {
+	case AggregateCount:
+		return &countAccumulator{}, nil
+	case AggregateSum:
+		return &sumAccumulator{}, nil
+	case AggregateAvg:
+		return newAvgAccumulator(), nil
+	case AggregateMin:
+		return &extremeAccumulator{}, nil
+	case AggregateMax:
+		return &extremeAccumulator{max: true}, nil
+	case AggregateStddev, AggregateStddevSamp, AggregateStddevPop,
+		AggregateVariance, AggregateVarSamp, AggregateVarPop:
+		return &varianceAccumulator{fn: fn}, nil
+	case AggregateApproxCountDistinct:
+		return newHLLAccumulator(), nil
+	case AggregateApproxQuantiles:
+		return newQuantilesAccumulator(params)
+	case AggregatePercentileApprox:
+		return newPercentileAccumulator(params)
+	case AggregateAnyValue:
+		return &anyValueAccumulator{}, nil
+	case AggregateArrayAgg:
+		return &arrayAccumulator{}, nil
+	case AggregateStringAgg:
+		return newStringAggAccumulator(params)
+	default:
+		return nil, fmt.Errorf("agregação %s não suportada", fn)
+	}
+}
+
+// countAccumulator conta valores não nulos de qualquer tipo.
+type countAccumulator struct {
+	count int64
+}
+
+func (a *countAccumulator) accumulate(columnar.Value) error {
+	a.count++
+	return nil
+}
+
+func (a *countAccumulator) merge(other aggAccumulator) error {
+	a.count += other.(*countAccumulator).count
+	return nil
+}
+
+func (a *countAccumulator) result() columnar.Value {
+	return columnar.NewIntValue(a.count)
+}
+
+func (a *countAccumulator) appendState(buf []byte) []byte {
+	return binary.AppendVarint(buf, a.count)
+}
+
+func (a *countAccumulator) readState(r *stateReader) {
+	a.count = r.varint()
+}
+
+// sumAccumulator soma no tipo da entrada: INT em int64 (estourar o limite é
+// erro), DECIMAL de forma exata e FLOAT em float64. Misturar tipos promove a
+// soma (INT -> DECIMAL -> FLOAT). Sem valores o resultado é NULL, como no SQL.
+type sumAccumulator struct {
+	count   int64
+	kind    sumKind
+	integer int64
+	decimal columnar.Decimal
+	float   float64
+	// widen troca o estouro pela soma em FLOAT (usado por AVG, cujo
+	// resultado já é FLOAT)
+	widen bool
+}
+
+// sumKind é o tipo da soma, em ordem de promoção.
+type sumKind byte
+
+const (
+	sumEmpty sumKind = iota
+	sumInt
+	sumDecimal
+	sumFloat
+)
+
+func kindOf(typ columnar.DataType) (sumKind, bool) {
+	switch typ {
+	case columnar.TypeInt:
+		return sumInt, true
+	case columnar.TypeDecimal:
+		return sumDecimal, true
+	case columnar.TypeFloat:
+		return sumFloat, true
+	default:
+		return sumEmpty, false
+	}
+}
+
+func (a *sumAccumulator) accumulate(value columnar.Value) error {
+	if err := a.add(value); err != nil {
+		return err
+	}
+	a.count++
+	return nil
+}
+
+// add soma o valor sem contá-lo.
+func (a *sumAccumulator) add(value columnar.Value) error {
+	kind, ok := kindOf(value.Type)
+	if !ok {
+		return fmt.Errorf("SUM/AVG suportam apenas INT, DECIMAL e FLOAT, recebeu %s", value.Type)
+	}
+	a.promote(kind)
+	switch a.kind {
+	case sumInt:
+		v, _ := value.AsInt()
+		sum := a.integer + v
+		if (v > 0 && sum < a.integer) || (v < 0 && sum > a.integer) {
+			if !a.widen {
+				return fmt.Errorf("SUM excede o limite de INT (%d + %d)", a.integer, v)
+			}
+			a.promote(sumFloat)
+			a.float += float64(v)
+			return nil
+		}
+		a.integer = sum
+	case sumDecimal:
+		sum, err := a.decimal.Add(decimalValue(value))
+		if err != nil {
+			if !a.widen {
+				return fmt.Errorf("SUM excede o limite de DECIMAL: %w", err)
+			}
+			a.promote(sumFloat)
+			a.float += floatValue(value)
+			return nil
+		}
+		a.decimal = sum
+	default:
+		a.float += floatValue(value)
+	}
+	return nil
+}
+
+// promote converte a soma acumulada para kind quando kind é mais largo.
+func (a *sumAccumulator) promote(kind sumKind) {
+	if kind <= a.kind {
+		return
+	}
+	if a.kind != sumEmpty {
+		current := a.value()
+		if kind == sumDecimal {
+			a.decimal = decimalValue(current)
+		} else {
+			a.float = floatValue(current)
+		}
+	}
+	a.kind = kind
+}
+
+// value devolve a soma acumulada no seu tipo atual.
+func (a *sumAccumulator) value() columnar.Value {
+	switch a.kind {
+	case sumInt:
+		return columnar.NewIntValue(a.integer)
+	case sumDecimal:
+		return columnar.NewDecimalValue(a.decimal)
+	case sumFloat:
+		return columnar.NewFloatValue(a.float)
+	default:
+		return columnar.NewNullValue(columnar.TypeFloat)
+	}
+}
+
+func (a *sumAccumulator) merge(other aggAccumulator) error {
+	return a.mergeSum(other.(*sumAccumulator))
+}
+
+func (a *sumAccumulator) mergeSum(other *sumAccumulator) error {
+	if other.count == 0 {
+		return nil
+	}
+	if err := a.add(other.value()); err != nil {
+		return err
+	}
+	a.count += other.count
+	return nil
+}
+
+func (a *sumAccumulator) result() columnar.Value {
+	if a.count == 0 {
+		return columnar.NewNullValue(columnar.TypeFloat)
+	}
+	return a.value()
+}
+
+func (a *sumAccumulator) appendState(buf []byte) []byte {
+	buf = binary.AppendVarint(buf, a.count)
+	buf = append(buf, byte(a.kind))
+	switch a.kind {
+	case sumInt:
+		buf = binary.AppendVarint(buf, a.integer)
+	case sumDecimal:
+		buf = binary.AppendVarint(buf, a.decimal.Unscaled)
+		buf = binary.AppendVarint(buf, int64(a.decimal.Scale))
+	case sumFloat:
+		buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(a.float))
+	}
+	return buf
+}
+
+func (a *sumAccumulator) readState(r *stateReader) {
+	a.count = r.varint()
+	a.kind = sumKind(r.byte())
+	switch a.kind {
+	case sumEmpty:
+	case sumInt:
+		a.integer = r.varint()
+	case sumDecimal:
+		a.decimal = columnar.NewDecimal(r.varint(), int32(r.varint()))
+	case sumFloat:
+		a.float = r.float()
+	default:
+		r.invalid("tipo de soma %d desconhecido", a.kind)
+	}
+}
+
+// avgAccumulator tem o mesmo estado parcial de SUM (soma e contagem); a média
+// só é calculada no fim, pois médias parciais não podem ser combinadas. O
+// resultado é sempre FLOAT.
+type avgAccumulator struct {
+	sumAccumulator
+}
+
+func newAvgAccumulator() *avgAccumulator {
+	return &avgAccumulator{sumAccumulator{widen: true}}
+}
+
+func (a *avgAccumulator) merge(other aggAccumulator) error {
+	return a.mergeSum(&other.(*avgAccumulator).sumAccumulator)
+}
+
+func (a *avgAccumulator) result() columnar.Value {
+	if a.count == 0 {
+		return columnar.NewNullValue(columnar.TypeFloat)
+	}
+	return columnar.NewFloatValue(floatValue(a.value()) / float64(a.count))
+}
+
+// extremeAccumulator guarda o menor (ou o maior, com max) valor visto, no tipo
+// original: números, strings, bools, datas e decimais. A ordem é a de
+// columnar.Compare.
+type extremeAccumulator struct {
+	max   bool
+	value columnar.Value
+}
+
+func (a *extremeAccumulator) accumulate(value columnar.Value) error {
+	if value.Type == columnar.TypeStruct {
+		return fmt.Errorf("MIN/MAX não suportam STRUCT")
+	}
+	if a.value.IsNull() {
+		a.value = value
+		return nil
+	}
+	order, err := columnar.Compare(value, a.value)
+	if err != nil {
+		return fmt.Errorf("MIN/MAX: %w", err)
+	}
+	if (a.max && order > 0) || (!a.max && order < 0) {
+		a.value = value
+	}
+	return nil
+}
+
+func (a *extremeAccumulator) merge(other aggAccumulator) error {
+	if o := other.(*extremeAccumulator); !o.value.IsNull() {
+		return a.accumulate(o.value)
+	}
+	return nil
+}
+
+func (a *extremeAccumulator) result() columnar.Value {
+	if a.value.IsNull() {
+		return columnar.NewNullValue(columnar.TypeFloat)
+	}
+	return a.value
+}
+
+func (a *extremeAccumulator) appendState(buf []byte) []byte {
+	if a.value.IsNull() {
+		return append(buf, 0)
+	}
+	return appendStateValue(append(buf, 1), a.value)
+}
+
+func (a *extremeAccumulator) readState(r *stateReader) {
+	if r.byte() == 1 {
+		a.value = r.value()
+	}
+}
+
+// varianceAccumulator calcula variância e desvio padrão pelo método de
+// Welford; o estado (contagem, média e soma dos quadrados dos desvios) é
+// combinado com a fórmula de Chan. STDDEV e VARIANCE são amostrais.
+type varianceAccumulator struct {
+	fn    AggregateFunc
+	count int64
+	mean  float64
+	m2    float64
+}
+
+func (a *varianceAccumulator) accumulate(value columnar.Value) error {
+	if _, ok := kindOf(value.Type); !ok {
+		return fmt.Errorf("%s suporta apenas INT, DECIMAL e FLOAT, recebeu %s", a.fn, value.Type)
+	}
+	x := floatValue(value)
+	a.count++
+	delta := x - a.mean
+	a.mean += delta / float64(a.count)
+	a.m2 += delta * (x - a.mean)
+	return nil
+}
+
+func (a *varianceAccumulator) merge(other aggAccumulator) error {
+	o := other.(*varianceAccumulator)
+	if o.count == 0 {
+		return nil
+	}
+	if a.count == 0 {
+		a.count, a.mean, a.m2 = o.count, o.mean, o.m2
+		return nil
+	}
+	count := float64(a.count + o.count)
+	delta := o.mean - a.mean
+	a.m2 += o.m2 + delta*delta*float64(a.count)*float64(o.count)/count
+	a.mean += delta * float64(o.count) / count
+	a.count += o.count
+	return nil
+}
+
+func (a *varianceAccumulator) result() columnar.Value {
+	population := a.fn == AggregateStddevPop || a.fn == AggregateVarPop
+	divisor := float64(a.count - 1)
+	if population {
+		divisor = float64(a.count)
+	}
+	if divisor <= 0 {
+		// a variância amostral de um único valor é indefinida
+		return columnar.NewNullValue(columnar.TypeFloat)
+	}
+	variance := a.m2 / divisor
+	switch a.fn {
+	case AggregateStddev, AggregateStddevSamp, AggregateStddevPop:
+		return columnar.NewFloatValue(math.Sqrt(variance))
+	default:
+		return columnar.NewFloatValue(variance)
+	}
+}
+
+func (a *varianceAccumulator) appendState(buf []byte) []byte {
+	buf = binary.AppendVarint(buf, a.count)
+	buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(a.mean))
+	return binary.LittleEndian.AppendUint64(buf, math.Float64bits(a.m2))
+}
+
+func (a *varianceAccumulator) readState(r *stateReader) {
+	a.count = r.varint()
+	a.mean = r.float()
+	a.m2 = r.float()
+}
+
+// anyValueAccumulator guarda o primeiro valor visto; combinar estados mantém o
+// valor já escolhido.
+type anyValueAccumulator struct {
+	value columnar.Value
+}
+
+func (a *anyValueAccumulator) accumulate(value columnar.Value) error {
+	if a.value.IsNull() {
+		a.value = value
+	}
+	return nil
+}
+
+func (a *anyValueAccumulator) merge(other aggAccumulator) error {
+	return a.accumulate(other.(*anyValueAccumulator).value)
+}
+
+func (a *anyValueAccumulator) result() columnar.Value {
+	if a.value.IsNull() {
+		return columnar.NewNullValue(columnar.TypeFloat)
+	}
+	return a.value
+}
+
+func (a *anyValueAccumulator) appendState(buf []byte) []byte {
+	if a.value.IsNull() {
+		return append(buf, 0)
+	}
+	return appendStateValue(append(buf, 1), a.value)
+}
+
+func (a *anyValueAccumulator) readState(r *stateReader) {
+	if r.byte() == 1 {
+		a.value = r.value()
+	}
+}
+
+// arrayAccumulator junta os valores na ordem em que chegam; estados parciais
+// são concatenados.
+type arrayAccumulator struct {
+	items []columnar.Value
+}
+
+func (a *arrayAccumulator) accumulate(value columnar.Value) error {
+	if value.Type == columnar.TypeStruct {
+		return fmt.Errorf("ARRAY_AGG não suporta STRUCT")
+	}
+	a.items = append(a.items, value)
+	return nil
+}
+
+func (a *arrayAccumulator) merge(other aggAccumulator) error {
+	a.items = append(a.items, other.(*arrayAccumulator).items...)
+	return nil
+}
+
+func (a *arrayAccumulator) result() columnar.Value {
+	return columnar.NewNullValue(columnar.TypeString)
+}
+
+func (a *arrayAccumulator) list() []columnar.Value {
+	if len(a.items) == 0 {
+		return nil
+	}
+	return append([]columnar.Value(nil), a.items...)
+}
+
+func (a *arrayAccumulator) appendState(buf []byte) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(a.items)))
+	for _, item := range a.items {
+		buf = appendStateValue(buf, item)
+	}
+	return buf
+}
+
+func (a *arrayAccumulator) readState(r *stateReader) {
+	count := r.uvarint()
+	for i := uint64(0); i < count && r.err == nil; i++ {
+		a.items = append(a.items, r.value())
+	}
+}
+
+// stringAggAccumulator concatena strings com o separador informado (vírgula
+// por padrão).
+type stringAggAccumulator struct {
+	separator string
+	parts     []string
+}
+
+func newStringAggAccumulator(params []columnar.Value) (*stringAggAccumulator, error) {
+	acc := &stringAggAccumulator{separator: ","}
+	if len(params) > 0 {
+		separator, err := params[0].AsString()
+		if err != nil || params[0].Type != columnar.TypeString {
+			return nil, fmt.Errorf("STRING_AGG espera um separador STRING como segundo argumento")
+		}
+		acc.separator = separator
+	}
+	return acc, nil
+}
+
+func (a *stringAggAccumulator) accumulate(value columnar.Value) error {
+	if value.Type != columnar.TypeString {
+		return fmt.Errorf("STRING_AGG suporta apenas STRING, recebeu %s", value.Type)
+	}
+	s, _ := value.AsString()
+	a.parts = append(a.parts, s)
+	return nil
+}
+
+func (a *stringAggAccumulator) merge(other aggAccumulator) error {
+	a.parts = append(a.parts, other.(*stringAggAccumulator).parts...)
+	return nil
+}
+
+func (a *stringAggAccumulator) result() columnar.Value {
+	if len(a.parts) == 0 {
+		return columnar.NewNullValue(columnar.TypeString)
+	}
+	return columnar.NewStringValue(strings.Join(a.parts, a.separator))
+}
+
+func (a *stringAggAccumulator) appendState(buf []byte) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(a.parts)))
+	for _, part := range a.parts {
+		buf = appendStateString(buf, part)
+	}
+	return buf
+}
+
+func (a *stringAggAccumulator) readState(r *stateReader) {
+	count := r.uvarint()
+	for i := uint64(0); i < count && r.err == nil; i++ {
+		a.parts = append(a.parts, r.string())
+	}
+}
+
+// distinctAccumulator guarda o conjunto exato de valores distintos e aplica a
+// função a cada valor novo; unir dois conjuntos acumula só o que faltava.
+type distinctAccumulator struct {
+	acc    aggAccumulator
+	values map[string]columnar.Value
+}
+
+func (a *distinctAccumulator) accumulate(value columnar.Value) error {
+	key := distinctKey(value)
+	if _, ok := a.values[key]; ok {
+		return nil
+	}
+	if err := a.acc.accumulate(value); err != nil {
+		return err
+	}
+	a.values[key] = value
+	return nil
+}
+
+func (a *distinctAccumulator) merge(other aggAccumulator) error {
+	o := other.(*distinctAccumulator)
+	for _, key := range o.sortedKeys() {
+		if err := a.accumulate(o.values[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *distinctAccumulator) result() columnar.Value {
+	return a.acc.result()
+}
+
+func (a *distinctAccumulator) list() []columnar.Value {
+	if list, ok := a.acc.(listAccumulator); ok {
+		return list.list()
+	}
+	return nil
+}
+
+func (a *distinctAccumulator) appendState(buf []byte) []byte {
+	keys := a.sortedKeys()
+	buf = binary.AppendUvarint(buf, uint64(len(keys)))
+	for _, key := range keys {
+		buf = appendStateValue(buf, a.values[key])
+	}
+	return buf
+}
+
+func (a *distinctAccumulator) readState(r *stateReader) {
+	count := r.uvarint()
+	for i := uint64(0); i < count && r.err == nil; i++ {
+		value := r.value()
+		if r.err != nil {
+			return
+		}
+		if err := a.accumulate(value); err != nil {
+			r.err = err
+		}
+	}
+}
+
+func (a *distinctAccumulator) sortedKeys() []string {
+	keys := make([]string, 0, len(a.values))
+	for key := range a.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func distinctKey(value columnar.Value) string {
+	return fmt.Sprintf("%d:%s", value.Type, value.String())
+}
+
+func floatValue(value columnar.Value) float64 {
+	switch value.Type {
+	case columnar.TypeInt:
+		i, _ := value.AsInt()
+		return float64(i)
+	case columnar.TypeDecimal:
+		d, _ := value.AsDecimal()
+		return d.Float64()
+	default:
+		f, _ := value.AsFloat()
+		return f
+	}
+}
+
+func decimalValue(value columnar.Value) columnar.Decimal {
+	if value.Type == columnar.TypeInt {
+		i, _ := value.AsInt()
+		return columnar.NewDecimal(i, 0)
+	}
+	d, _ := value.AsDecimal()
+	return d
+}
+
+// appendStateValue grava o tipo e a forma textual do valor, que
+// columnar.ParseValue lê de volta sem perda.
+func appendStateValue(buf []byte, value columnar.Value) []byte {
+	buf = append(buf, byte(value.Type))
+	return appendStateString(buf, value.String())
+}
+
+func appendStateString(buf []byte, s string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+// stateReader decodifica estados parciais; o primeiro erro interrompe a
+// leitura e é devolvido por finish.
+type stateReader struct {
+	data []byte
+	err  error
+}
+
+func (r *stateReader) fail() {
+	r.invalid("estado truncado")
+}
+
+func (r *stateReader) invalid(format string, args ...interface{}) {
+	if r.err == nil {
+		r.err = fmt.Errorf(format, args...)
+	}
+}
+
+func (r *stateReader) byte() byte {
+	if r.err != nil || len(r.data) == 0 {
+		r.fail()
+		return 0
+	}
+	b := r.data[0]
+	r.data = r.data[1:]
+	return b
+}
+
+func (r *stateReader) varint() int64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(r.data)
+	if n <= 0 {
+		r.fail()
+		return 0
+	}
+	r.data = r.data[n:]
+	return v
+}
+
+func (r *stateReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.data)
+	if n <= 0 {
+		r.fail()
+		return 0
+	}
+	r.data = r.data[n:]
+	return v
+}
+
+func (r *stateReader) float() float64 {
+	if r.err != nil || len(r.data) < 8 {
+		r.fail()
+		return 0
+	}
+	v := math.Float64frombits(binary.LittleEndian.Uint64(r.data))
+	r.data = r.data[8:]
+	return v
+}
+
+func (r *stateReader) string() string {
+	length := r.uvarint()
+	if r.err != nil || uint64(len(r.data)) < length {
+		r.fail()
+		return ""
+	}
+	s := string(r.data[:length])
+	r.data = r.data[length:]
+	return s
+}
+
+func (r *stateReader) value() columnar.Value {
+	dt := columnar.DataType(r.byte())
+	text := r.string()
+	if r.err != nil {
+		return columnar.Value{}
+	}
+	value, err := columnar.ParseValue(dt, text)
+	if err != nil {
+		r.err = err
+	}
+	return value
+}
+
+func (r *stateReader) finish() error {
+	if r.err == nil && len(r.data) > 0 {
+		return fmt.Errorf("%d byte(s) sobrando no estado", len(r.data))
+	}
+	return r.err
+}
@@ -1,7 +1,9 @@
 package executor
 
 import (
+	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/Jonatan852/distributed-query-processing/pkg/columnar"
@@ -16,45 +18,206 @@ const (
 	AggregateMin   AggregateFunc = "MIN"
 	AggregateMax   AggregateFunc = "MAX"
 	AggregateAvg   AggregateFunc = "AVG"
+
+	// Agregações estatísticas: STDDEV e VARIANCE são amostrais, como
+	// STDDEV_SAMP e VAR_SAMP.
+	AggregateStddev     AggregateFunc = "STDDEV"
+	AggregateStddevSamp AggregateFunc = "STDDEV_SAMP"
+	AggregateStddevPop  AggregateFunc = "STDDEV_POP"
+	AggregateVariance   AggregateFunc = "VARIANCE"
+	AggregateVarSamp    AggregateFunc = "VAR_SAMP"
+	AggregateVarPop     AggregateFunc = "VAR_POP"
+
+	// Agregações aproximadas, calculadas com sketches de tamanho fixo
+	// (HyperLogLog e t-digest).
+	AggregateApproxCountDistinct AggregateFunc = "APPROX_COUNT_DISTINCT"
+	AggregateApproxQuantiles     AggregateFunc = "APPROX_QUANTILES"
+	AggregatePercentileApprox    AggregateFunc = "PERCENTILE_APPROX"
+
+	AggregateAnyValue  AggregateFunc = "ANY_VALUE"
+	AggregateArrayAgg  AggregateFunc = "ARRAY_AGG"
+	AggregateStringAgg AggregateFunc = "STRING_AGG"
 )
 
-// AggregateSpec descreve cada medida calculada.
+// ReturnsList indica se a agregação produz uma lista por grupo; o resultado
+// vira um campo repetido e vem de Accumulator.Values.
+func ReturnsList(fn AggregateFunc) bool {
+	return fn == AggregateArrayAgg || fn == AggregateApproxQuantiles
+}
+
+// AggregateStage define o que o AggregateExecutor recebe e devolve.
+type AggregateStage int
+
+const (
+	// AggregateComplete agrega linhas e devolve os resultados finais.
+	AggregateComplete AggregateStage = iota
+	// AggregatePartial agrega linhas e devolve o estado serializado de cada
+	// medida em uma coluna STRING (stage LOCAL, nos workers).
+	AggregatePartial
+	// AggregateFinal combina os estados produzidos por AggregatePartial e
+	// devolve os resultados finais (stage GLOBAL).
+	AggregateFinal
+)
+
+// MetaAggregate marca, em Batch.Meta, batches com estados parciais
+// (MetaAggregate=AggregatePartialMeta) que ainda precisam ser combinados.
+const (
+	MetaAggregate        = "aggregate"
+	AggregatePartialMeta = "partial"
+)
+
+// IsPartialAggregate indica se o batch traz estados parciais de agregação.
+func IsPartialAggregate(batch *Batch) bool {
+	return batch != nil && batch.Meta[MetaAggregate] == AggregatePartialMeta
+}
+
+// AggregateSpec descreve cada medida calculada. Distinct descarta valores
+// repetidos antes de acumular (COUNT(DISTINCT x)). Value, quando presente,
+// substitui a leitura de Column (argumentos calculados, como SUM(a * b)); no
+// stage final Column é a coluna com os estados parciais. Params são os
+// argumentos constantes da função (NewAccumulator).
 type AggregateSpec struct {
-	Func   AggregateFunc
-	Column string
-	Alias  string
+	Func     AggregateFunc
+	Column   string
+	Alias    string
+	Distinct bool
+	Value    ValueFunc
+	Params   []columnar.Value
+}
+
+func (s AggregateSpec) outputName() string {
+	if s.Alias != "" {
+		return s.Alias
+	}
+	return fmt.Sprintf("%s(%s)", s.Func, s.Column)
+}
+
+// GroupKey é uma chave de agrupamento: Value calcula a chave a partir da
+// linha; sem Value, a coluna Name é lida diretamente. Name nomeia a coluna
+// de saída.
+type GroupKey struct {
+	Name  string
+	Value ValueFunc
 }
 
-// AggregateExecutor processa todos os batches em memória e devolve um único resultado.
+// AggregateExecutor agrupa as linhas em uma tabela hash e devolve um batch com
+// os grupos. Com HashConfig o estado é limitado: ao passar de MemoryLimit, os
+// grupos já em memória continuam sendo atualizados e as linhas de grupos novos
+// são gravadas em partições pelo hash da chave; cada partição é agregada
+// depois por um executor próprio (recursivamente, se ainda não couber) e sai
+// em um batch seguinte.
 type AggregateExecutor struct {
 	child      Executor
-	groupKeys  []string
+	stage      AggregateStage
+	groupKeys  []GroupKey
 	aggregates []AggregateSpec
+	config     HashConfig
+	level      int
+	stats      *SpillStats
 	result     *Batch
 	emitted    bool
+
+	spilled   *spillPartitions
+	partition int
+	current   *AggregateExecutor
+	// reserved é o que os grupos em memória ocupam em config.Memory
+	reserved int64
 }
 
+// NewAggregateExecutor agrega as linhas do child pelas colunas informadas.
 func NewAggregateExecutor(child Executor, groupKeys []string, specs []AggregateSpec) *AggregateExecutor {
+	keys := make([]GroupKey, 0, len(groupKeys))
+	for _, name := range groupKeys {
+		keys = append(keys, GroupKey{Name: name})
+	}
+	return NewStagedAggregateExecutor(child, AggregateComplete, keys, specs)
+}
+
+// NewStagedAggregateExecutor cria o executor de um stage da agregação em duas
+// fases. No stage final as chaves são lidas pelo nome e Column de cada spec
+// aponta para a coluna de estados produzida pelo stage parcial.
+func NewStagedAggregateExecutor(child Executor, stage AggregateStage, groupKeys []GroupKey, specs []AggregateSpec) *AggregateExecutor {
+	return NewExternalAggregateExecutor(child, stage, groupKeys, specs, HashConfig{})
+}
+
+// NewExternalAggregateExecutor cria uma agregação que respeita
+// config.MemoryLimit gravando partições em config.SpillDir.
+func NewExternalAggregateExecutor(child Executor, stage AggregateStage, groupKeys []GroupKey, specs []AggregateSpec, config HashConfig) *AggregateExecutor {
 	return &AggregateExecutor{
 		child:      child,
+		stage:      stage,
 		groupKeys:  groupKeys,
 		aggregates: specs,
+		config:     config,
+		stats:      &SpillStats{},
 	}
 }
 
 func (a *AggregateExecutor) Next() (*Batch, error) {
-	if a.emitted {
-		return nil, ErrNoMoreBatches
+	if !a.emitted {
+		if err := a.compute(); err != nil {
+			return nil, err
+		}
+		a.emitted = true
+		if a.result.RowCount > 0 || a.spilled == nil {
+			return a.result, nil
+		}
 	}
-	if err := a.compute(); err != nil {
-		return nil, err
+	return a.nextPartition()
+}
+
+// Stats devolve as métricas de spill, somando as partições reprocessadas.
+func (a *AggregateExecutor) Stats() map[string]int64 {
+	return a.stats.hashStats()
+}
+
+// nextPartition agrega, em ordem, as partições gravadas em disco.
+func (a *AggregateExecutor) nextPartition() (*Batch, error) {
+	for a.spilled != nil {
+		if a.current != nil {
+			batch, err := a.current.Next()
+			if err == nil && batch.RowCount == 0 {
+				continue
+			}
+			if err != ErrNoMoreBatches {
+				return batch, err
+			}
+			err = a.current.Close()
+			a.current = nil
+			if err != nil {
+				return nil, err
+			}
+		}
+		if a.partition >= spillFanout {
+			break
+		}
+		partition := a.partition
+		a.partition++
+		if a.spilled.empty(partition) {
+			continue
+		}
+		a.current = &AggregateExecutor{
+			child:      a.spilled.scan(partition),
+			stage:      a.stage,
+			groupKeys:  a.groupKeys,
+			aggregates: a.aggregates,
+			config:     a.config,
+			level:      a.level + 1,
+			stats:      a.stats,
+		}
 	}
-	a.emitted = true
-	return a.result, nil
+	return nil, ErrNoMoreBatches
 }
 
 func (a *AggregateExecutor) compute() error {
 	state := map[string]*aggState{}
+	// order preserva a ordem de criação dos grupos na saída
+	var order []*aggState
+	spill := a.config.spills(a.level)
+	canSpill := a.config.canSpill(a.level)
+	var used int64
+	// os grupos viram o batch de resultado, que passa a ser do consumidor
+	defer a.release()
 	for {
 		batch, err := a.child.Next()
 		if err != nil {
@@ -63,21 +226,80 @@ func (a *AggregateExecutor) compute() error {
 			}
 			return err
 		}
+		if hasRepeated(batch) {
+			// as linhas não podem ser separadas em partições
+			if a.spilled != nil {
+				return fmt.Errorf("executor: agregação com spill recebeu colunas repetidas")
+			}
+			spill, canSpill = false, false
+		}
+		// spilled[p] são as linhas do batch de grupos novos, gravadas na partição p
+		var spilled [][]int
 		row := batchRow{batch: batch}
 		for i := 0; i < batch.RowCount; i++ {
 			row.index = i
-			key := a.buildKey(row)
-			if _, ok := state[key]; !ok {
-				state[key] = newAggState(a.groupKeys, a.aggregates)
-				state[key].setGroupValues(row)
+			values, key, err := a.groupValues(row)
+			if err != nil {
+				return err
+			}
+			entry, ok := state[key]
+			if !ok && a.spilled == nil {
+				size := int64(len(key)) + aggGroupOverhead(len(a.aggregates))
+				for _, value := range values {
+					size += valueBytes(value)
+				}
+				if err := a.reserve(size, canSpill); err != nil {
+					return err
+				}
+				if a.spilled == nil {
+					used += size
+				}
+			}
+			if !ok && a.spilled != nil {
+				if spilled == nil {
+					spilled = make([][]int, spillFanout)
+				}
+				partition := partitionOf(key, a.level)
+				spilled[partition] = append(spilled[partition], i)
+				continue
+			}
+			if !ok {
+				if entry, err = newAggState(values, a.aggregates); err != nil {
+					return err
+				}
+				state[key] = entry
+				order = append(order, entry)
+			}
+			var grown int64
+			if a.stage == AggregateFinal {
+				grown, err = entry.merge(row)
+			} else {
+				grown, err = entry.accumulate(row)
+			}
+			if err != nil {
+				return err
 			}
-			if err := state[key].accumulate(row); err != nil {
+			if err := a.reserve(grown, canSpill && a.spilled == nil); err != nil {
 				return err
 			}
+			used += grown
+		}
+		if spilled != nil {
+			if err := a.spilled.writeRows(batch, spilled); err != nil {
+				return err
+			}
+		}
+		if spill && a.spilled == nil && used > a.config.MemoryLimit {
+			a.startSpill()
+		}
+	}
+	if a.spilled != nil {
+		if err := a.spilled.finish(); err != nil {
+			return err
 		}
 	}
 
-	if len(state) == 0 {
+	if len(order) == 0 {
 		a.result = &Batch{
 			Columns:  map[string]*columnar.Column{},
 			RowCount: 0,
@@ -86,190 +308,349 @@ func (a *AggregateExecutor) compute() error {
 	}
 
 	columns := map[string]*columnar.Column{}
-	for _, entry := range state {
-		for name, value := range entry.groupValues {
-			if _, ok := columns[name]; !ok {
-				typ := value.Type
-				if typ == 0 {
-					typ = columnar.TypeString
-				}
-				columns[name] = columnar.NewColumn(name, typ)
+	for idx, key := range a.groupKeys {
+		// TypeInt é o zero de DataType: o tipo vem do primeiro valor não nulo
+		typ := columnar.TypeString
+		for _, entry := range order {
+			if value := entry.groupValues[idx]; !value.IsNull() {
+				typ = value.Type
+				break
 			}
 		}
-		break
+		columns[key.Name] = columnar.NewColumn(key.Name, typ)
 	}
-	for _, spec := range a.aggregates {
-		name := spec.Alias
-		if name == "" {
-			name = fmt.Sprintf("%s(%s)", spec.Func, spec.Column)
+	for _, entry := range order {
+		for idx, key := range a.groupKeys {
+			_ = addColumnData(columns[key.Name], entry.groupValues[idx])
 		}
-		columns[name] = columnar.NewColumn(name, columnType(spec.Func))
 	}
-
-	for _, entry := range state {
-		for name, value := range entry.groupValues {
-			if _, ok := columns[name]; !ok {
-				columns[name] = columnar.NewColumn(name, value.Type)
+	for idx, spec := range a.aggregates {
+		if a.stage != AggregatePartial && ReturnsList(spec.Func) {
+			lists := make([][]columnar.Value, 0, len(order))
+			for _, entry := range order {
+				lists = append(lists, entry.aggregates[idx].Values())
 			}
-			_ = addColumnData(columns[name], value)
+			col, err := listColumn(spec, lists)
+			if err != nil {
+				return err
+			}
+			columns[spec.outputName()] = col
+			continue
 		}
-		for idx, spec := range a.aggregates {
-			val := entry.aggregates[idx].finalize(spec.Func)
-			name := spec.Alias
-			if name == "" {
-				name = fmt.Sprintf("%s(%s)", spec.Func, spec.Column)
+		values := make([]columnar.Value, 0, len(order))
+		for _, entry := range order {
+			if a.stage == AggregatePartial {
+				values = append(values, columnar.NewStringValue(string(entry.aggregates[idx].State())))
+			} else {
+				values = append(values, entry.aggregates[idx].Result())
 			}
-			_ = addColumnData(columns[name], val)
 		}
+		col, err := resultColumn(spec, values)
+		if err != nil {
+			return err
+		}
+		columns[spec.outputName()] = col
 	}
 
 	a.result = &Batch{
 		Columns:  columns,
-		RowCount: len(state),
+		RowCount: len(order),
+	}
+	if a.stage == AggregatePartial {
+		a.result.Meta = map[string]string{MetaAggregate: AggregatePartialMeta}
 	}
 	return nil
 }
 
-func (a *AggregateExecutor) buildKey(row batchRow) string {
+// groupValues calcula as chaves da linha e o identificador do seu grupo.
+// Colunas ausentes contam como NULL.
+func (a *AggregateExecutor) groupValues(row batchRow) ([]columnar.Value, string, error) {
 	if len(a.groupKeys) == 0 {
-		return "__all__"
+		return nil, "__all__", nil
 	}
-	values := make([]string, 0, len(a.groupKeys))
+	values := make([]columnar.Value, 0, len(a.groupKeys))
+	var b strings.Builder
 	for _, key := range a.groupKeys {
-		val, err := row.Value(key)
-		if err != nil {
-			values = append(values, "")
+		var val columnar.Value
+		if key.Value != nil {
+			var err error
+			if val, err = key.Value(row); err != nil {
+				return nil, "", err
+			}
+		} else if v, err := row.Value(key.Name); err == nil {
+			val = v
+		}
+		values = append(values, val)
+		if val.IsNull() {
+			// NULLs formam um único grupo, distinto da string "NULL"
+			b.WriteString("-;")
 			continue
 		}
-		values = append(values, val.String())
+		// o tamanho antes do texto impede que ("a|b", "c") e ("a", "b|c")
+		// caiam no mesmo grupo
+		text := val.String()
+		b.WriteString(strconv.Itoa(len(text)))
+		b.WriteByte(':')
+		b.WriteString(text)
 	}
-	return strings.Join(values, "|")
+	return values, b.String(), nil
 }
 
 func (a *AggregateExecutor) Close() error {
-	return a.child.Close()
+	var errs []error
+	if a.current != nil {
+		errs = append(errs, a.current.Close())
+		a.current = nil
+	}
+	if a.spilled != nil {
+		errs = append(errs, a.spilled.remove())
+		a.spilled = nil
+	}
+	errs = append(errs, a.child.Close())
+	return errors.Join(errs...)
+}
+
+// reserve reserva bytes em config.Memory. Sem espaço, com canSpill, os grupos
+// novos passam a ir para partições em disco; caso contrário a agregação falha.
+func (a *AggregateExecutor) reserve(bytes int64, canSpill bool) error {
+	if err := a.config.Memory.Reserve(bytes); err != nil {
+		if !canSpill {
+			return err
+		}
+		a.startSpill()
+		return nil
+	}
+	a.reserved += bytes
+	return nil
+}
+
+func (a *AggregateExecutor) startSpill() {
+	if a.spilled == nil {
+		a.spilled = newSpillPartitions(a.config.SpillDir, "aggregate-*.part", a.stats)
+	}
+}
+
+func (a *AggregateExecutor) release() {
+	a.config.Memory.Release(a.reserved)
+	a.reserved = 0
+}
+
+// aggGroupOverhead estima os bytes de um grupo além da chave e dos valores
+// (entrada no mapa e acumuladores vazios).
+func aggGroupOverhead(specs int) int64 {
+	return 96 + 64*int64(specs)
+}
+
+// growingState indica se o estado da medida cresce com os valores recebidos
+// (DISTINCT e agregações que guardam os valores); os demais têm tamanho fixo.
+func growingState(spec AggregateSpec) bool {
+	return spec.Distinct || ReturnsList(spec.Func) || spec.Func == AggregateStringAgg
 }
 
 type aggState struct {
-	groupKeys   []string
-	groupValues map[string]columnar.Value
-	aggregates  []aggAccumulator
+	groupValues []columnar.Value
+	aggregates  []*Accumulator
 	specs       []AggregateSpec
 }
 
-func newAggState(keys []string, specs []AggregateSpec) *aggState {
-	accs := make([]aggAccumulator, len(specs))
+func newAggState(values []columnar.Value, specs []AggregateSpec) (*aggState, error) {
+	accs := make([]*Accumulator, len(specs))
 	for i, spec := range specs {
-		accs[i] = newAccumulator(spec.Func)
+		acc, err := NewAccumulator(spec.Func, spec.Distinct, spec.Params...)
+		if err != nil {
+			return nil, err
+		}
+		accs[i] = acc
 	}
 	return &aggState{
-		groupKeys:   keys,
-		groupValues: map[string]columnar.Value{},
+		groupValues: values,
 		aggregates:  accs,
 		specs:       specs,
-	}
-}
-
-func (s *aggState) setGroupValues(row batchRow) {
-	for _, key := range s.groupKeys {
-		val, err := row.Value(key)
-		if err != nil {
-			s.groupValues[key] = columnar.Value{}
-			continue
-		}
-		s.groupValues[key] = val
-	}
+	}, nil
 }
 
-func (s *aggState) accumulate(row batchRow) error {
+// accumulate soma a linha às medidas e devolve quantos bytes (estimados) os
+// estados cresceram.
+func (s *aggState) accumulate(row batchRow) (int64, error) {
+	var grown int64
 	for idx, spec := range s.specs {
 		var val columnar.Value
-		if spec.Func == AggregateCount && spec.Column == "*" {
+		var err error
+		switch {
+		case spec.Value != nil:
+			val, err = spec.Value(row)
+		case spec.Func == AggregateCount && spec.Column == "*":
 			val = columnar.NewIntValue(1)
-		} else {
-			var err error
+		default:
 			val, err = row.Value(spec.Column)
-			if err != nil {
-				return err
-			}
 		}
-		if err := s.aggregates[idx].accumulate(val); err != nil {
-			return err
+		if err != nil {
+			return 0, err
+		}
+		// COUNT(col), SUM, AVG, MIN e MAX ignoram NULL (Accumulator.Add)
+		if err := s.aggregates[idx].Add(val); err != nil {
+			return 0, err
+		}
+		if !val.IsNull() && growingState(spec) {
+			grown += valueBytes(val)
 		}
 	}
-	return nil
+	return grown, nil
 }
 
-type aggAccumulator interface {
-	accumulate(value columnar.Value) error
-	finalize(fn AggregateFunc) columnar.Value
+// merge combina os estados parciais da linha, um por coluna Column das specs,
+// e devolve quantos bytes (estimados) os estados cresceram.
+func (s *aggState) merge(row batchRow) (int64, error) {
+	var grown int64
+	for idx, spec := range s.specs {
+		val, err := row.Value(spec.Column)
+		if err != nil {
+			return 0, err
+		}
+		if val.IsNull() {
+			continue
+		}
+		data, err := val.AsString()
+		if err != nil {
+			return 0, fmt.Errorf("estado parcial de %s: %w", spec.Column, err)
+		}
+		if err := s.aggregates[idx].MergeState([]byte(data)); err != nil {
+			return 0, err
+		}
+		if growingState(spec) {
+			grown += int64(len(data))
+		}
+	}
+	return grown, nil
 }
 
-type numericAccumulator struct {
-	count int64
-	sum   float64
-	min   *float64
-	max   *float64
+// AggregateValues aplica a agregação a uma lista de valores já materializada,
+// como as entradas repetidas de um registro em WITHIN RECORD. NULLs são
+// ignorados, como em aggState.accumulate.
+func AggregateValues(fn AggregateFunc, values []columnar.Value) (columnar.Value, error) {
+	if ReturnsList(fn) {
+		return columnar.Value{}, fmt.Errorf("%s produz uma lista e não pode ser usada aqui", fn)
+	}
+	acc, err := NewAccumulator(fn, false)
+	if err != nil {
+		return columnar.Value{}, err
+	}
+	for _, value := range values {
+		if err := acc.Add(value); err != nil {
+			return columnar.Value{}, err
+		}
+	}
+	return acc.Result(), nil
 }
 
-func newAccumulator(fn AggregateFunc) aggAccumulator {
-	return &numericAccumulator{}
+// ResultType informa o tipo do resultado da agregação sobre valores do tipo
+// input: COUNT e APPROX_COUNT_DISTINCT devolvem INT, SUM preserva INT e
+// DECIMAL, MIN/MAX, ANY_VALUE e ARRAY_AGG preservam o tipo da entrada,
+// STRING_AGG devolve STRING e as demais, FLOAT. Para agregações que produzem
+// listas o tipo é o dos elementos.
+func ResultType(fn AggregateFunc, input columnar.DataType) columnar.DataType {
+	switch fn {
+	case AggregateCount, AggregateApproxCountDistinct:
+		return columnar.TypeInt
+	case AggregateSum:
+		if input == columnar.TypeInt || input == columnar.TypeDecimal {
+			return input
+		}
+		return columnar.TypeFloat
+	case AggregateMin, AggregateMax, AggregateAnyValue, AggregateArrayAgg:
+		return input
+	case AggregateStringAgg:
+		return columnar.TypeString
+	default:
+		return columnar.TypeFloat
+	}
 }
 
-func (a *numericAccumulator) accumulate(value columnar.Value) error {
-	var v float64
-	switch value.Type {
-	case columnar.TypeInt:
-		i, _ := value.AsInt()
-		v = float64(i)
-	case columnar.TypeFloat:
-		f, _ := value.AsFloat()
-		v = f
-	default:
-		return fmt.Errorf("agregador suporta apenas INT/FLOAT")
+// resultColumn monta a coluna de uma medida. O tipo vem dos próprios
+// resultados; grupos cujas somas foram promovidas (INT em um grupo, FLOAT em
+// outro) são convertidos para o tipo numérico mais largo.
+func resultColumn(spec AggregateSpec, values []columnar.Value) (*columnar.Column, error) {
+	typ, found := columnar.DataType(0), false
+	for _, value := range values {
+		switch {
+		case value.IsNull() || (found && value.Type == typ):
+		case !found:
+			typ, found = value.Type, true
+		default:
+			widest, ok := widerNumeric(typ, value.Type)
+			if !ok {
+				return nil, fmt.Errorf("%s: resultados com tipos incompatíveis (%s e %s)", spec.outputName(), typ, value.Type)
+			}
+			typ = widest
+		}
 	}
-	a.count++
-	a.sum += v
-	if a.min == nil || v < *a.min {
-		a.min = &v
+	if !found {
+		typ = ResultType(spec.Func, columnar.TypeFloat)
 	}
-	if a.max == nil || v > *a.max {
-		a.max = &v
+	col := columnar.NewColumn(spec.outputName(), typ)
+	for _, value := range values {
+		if !value.IsNull() && value.Type != typ {
+			if typ == columnar.TypeDecimal {
+				value = columnar.NewDecimalValue(decimalValue(value))
+			} else {
+				value = columnar.NewFloatValue(floatValue(value))
+			}
+		}
+		if err := addColumnData(col, value); err != nil {
+			return nil, err
+		}
 	}
-	return nil
+	return col, nil
 }
 
-func (a *numericAccumulator) finalize(fn AggregateFunc) columnar.Value {
-	switch fn {
-	case AggregateCount:
-		return columnar.NewIntValue(a.count)
-	case AggregateSum:
-		return columnar.NewFloatValue(a.sum)
-	case AggregateAvg:
-		if a.count == 0 {
-			return columnar.NewFloatValue(0)
-		}
-		return columnar.NewFloatValue(a.sum / float64(a.count))
-	case AggregateMin:
-		if a.min == nil {
-			return columnar.NewFloatValue(0)
-		}
-		return columnar.NewFloatValue(*a.min)
-	case AggregateMax:
-		if a.max == nil {
-			return columnar.NewFloatValue(0)
-		}
-		return columnar.NewFloatValue(*a.max)
-	default:
-		return columnar.NewFloatValue(0)
+// listColumn monta a coluna repetida de uma agregação que produz listas: cada
+// grupo é um registro e listas vazias viram um registro com uma entrada NULL.
+func listColumn(spec AggregateSpec, lists [][]columnar.Value) (*columnar.Column, error) {
+	typ := ResultType(spec.Func, columnar.TypeString)
+	for _, list := range lists {
+		if len(list) > 0 {
+			typ = list[0].Type
+			break
+		}
+	}
+	col := columnar.NewColumn(spec.outputName(), typ)
+	col.RepetitionLevels = []uint8{}
+	col.DefinitionLevels = []uint8{}
+	for _, list := range lists {
+		if len(list) == 0 {
+			col.RepetitionLevels = append(col.RepetitionLevels, 0)
+			col.DefinitionLevels = append(col.DefinitionLevels, 0)
+			if err := col.AppendNull(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		for i, value := range list {
+			if value.Type != typ {
+				return nil, fmt.Errorf("%s: elementos com tipos incompatíveis (%s e %s)", spec.outputName(), typ, value.Type)
+			}
+			level := uint8(1)
+			if i == 0 {
+				level = 0
+			}
+			col.RepetitionLevels = append(col.RepetitionLevels, level)
+			col.DefinitionLevels = append(col.DefinitionLevels, 1)
+			if err := col.Append(value); err != nil {
+				return nil, err
+			}
+		}
 	}
+	return col, nil
 }
 
-func columnType(fn AggregateFunc) columnar.DataType {
-	switch fn {
-	case AggregateCount:
-		return columnar.TypeInt
-	default:
-		return columnar.TypeFloat
+func widerNumeric(a, b columnar.DataType) (columnar.DataType, bool) {
+	kindA, okA := kindOf(a)
+	kindB, okB := kindOf(b)
+	if !okA || !okB {
+		return 0, false
+	}
+	if kindA > kindB {
+		return a, true
 	}
+	return b, true
 }
@@ -0,0 +1,407 @@
+package executor
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+
+	"github.com/Jonatan852/distributed-query-processing/pkg/columnar"
+)
+
+// Flags por coluna, gravadas logo após o número de entradas.
+const (
+	wireHasNulls       byte = 1
+	wireHasRepetitions byte = 2
+	wireHasDefinitions byte = 4
+)
+
+// EncodeBatch acrescenta o batch a buf no formato binário colunar usado no
+// protocolo entre workers e coordinator e nos arquivos de spill: inteiros (e
+// TIMESTAMP/DATE) em zigzag varint, decimais como valor sem escala mais escala,
+// floats em 8 bytes, strings com prefixo de tamanho e booleanos empacotados em
+// bits. Colunas com NULL levam o bitmap de nulos (também em bits) antes dos
+// valores.
+func EncodeBatch(buf *bytes.Buffer, batch *Batch) error {
+	if batch == nil {
+		batch = &Batch{}
+	}
+	writeUvarint(buf, uint64(batch.RowCount))
+
+	metaKeys := sortedKeys(batch.Meta)
+	writeUvarint(buf, uint64(len(metaKeys)))
+	for _, key := range metaKeys {
+		writeString(buf, key)
+		writeString(buf, batch.Meta[key])
+	}
+
+	names := make([]string, 0, len(batch.Columns))
+	for name := range batch.Columns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	writeUvarint(buf, uint64(len(names)))
+	for _, name := range names {
+		if err := encodeColumn(buf, name, batch.Columns[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func encodeColumn(buf *bytes.Buffer, name string, col *columnar.Column) error {
+	if col == nil {
+		return fmt.Errorf("coluna %s vazia", name)
+	}
+	writeString(buf, name)
+	writeString(buf, col.Name)
+	writeUvarint(buf, uint64(col.Type))
+	writeUvarint(buf, uint64(col.Len()))
+	var flags byte
+	if col.NullBitmap != nil {
+		flags |= wireHasNulls
+	}
+	if col.RepetitionLevels != nil {
+		flags |= wireHasRepetitions
+	}
+	if col.DefinitionLevels != nil {
+		flags |= wireHasDefinitions
+	}
+	buf.WriteByte(flags)
+	if col.NullBitmap != nil {
+		nulls := make([]bool, col.Len())
+		copy(nulls, col.NullBitmap)
+		buf.Write(packBits(nulls))
+	}
+	// níveis de campos aninhados (ver columnar/nested.go), um byte por entrada
+	buf.Write(col.RepetitionLevels)
+	buf.Write(col.DefinitionLevels)
+	switch col.Type {
+	case columnar.TypeInt, columnar.TypeTimestamp, columnar.TypeDate:
+		for _, v := range col.IntData {
+			writeVarint(buf, v)
+		}
+	case columnar.TypeDecimal:
+		for _, v := range col.DecimalData {
+			writeVarint(buf, v.Unscaled)
+			writeVarint(buf, int64(v.Scale))
+		}
+	case columnar.TypeFloat:
+		var scratch [8]byte
+		for _, v := range col.FloatData {
+			binary.LittleEndian.PutUint64(scratch[:], math.Float64bits(v))
+			buf.Write(scratch[:])
+		}
+	case columnar.TypeString:
+		for _, v := range col.StringData {
+			writeString(buf, v)
+		}
+	case columnar.TypeBool:
+		buf.Write(packBits(col.BoolData))
+	default:
+		return fmt.Errorf("coluna %s: tipo %s não suportado no protocolo", name, col.Type)
+	}
+	return nil
+}
+
+// errCorruptBatch indica um payload truncado ou com tamanhos impossíveis.
+var errCorruptBatch = errors.New("executor: batch corrompido")
+
+// BatchDecoder lê em sequência os batches gravados por EncodeBatch em um
+// payload de tamanho conhecido. Todo tamanho lido do payload é conferido
+// contra o número de linhas e os bytes que ainda restam antes de alocar, de
+// modo que um payload truncado ou corrompido gera erro em vez de panic ou de
+// alocações gigantes.
+type BatchDecoder struct {
+	r         *bufio.Reader
+	remaining uint64
+}
+
+// NewBatchDecoder lê até size bytes de r.
+func NewBatchDecoder(r io.Reader, size int64) *BatchDecoder {
+	if size < 0 {
+		size = 0
+	}
+	return &BatchDecoder{r: bufio.NewReader(r), remaining: uint64(size)}
+}
+
+// Remaining devolve os bytes ainda não lidos do payload.
+func (d *BatchDecoder) Remaining() int64 {
+	return int64(d.remaining)
+}
+
+// ReadByte faz do decoder um io.ByteReader para binary.ReadUvarint.
+func (d *BatchDecoder) ReadByte() (byte, error) {
+	if d.remaining == 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	b, err := d.r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	d.remaining--
+	return b, nil
+}
+
+// ReadUvarint lê um inteiro sem sinal do payload (ex.: a contagem de batches
+// de distributed.EncodeBatches).
+func (d *BatchDecoder) ReadUvarint() (uint64, error) {
+	return binary.ReadUvarint(d)
+}
+
+// need confirma que o payload ainda tem n bytes.
+func (d *BatchDecoder) need(n uint64) error {
+	if n > d.remaining {
+		return fmt.Errorf("%w: %d bytes esperados, %d restantes", errCorruptBatch, n, d.remaining)
+	}
+	return nil
+}
+
+func (d *BatchDecoder) readFull(data []byte) error {
+	if err := d.need(uint64(len(data))); err != nil {
+		return err
+	}
+	if _, err := io.ReadFull(d.r, data); err != nil {
+		return err
+	}
+	d.remaining -= uint64(len(data))
+	return nil
+}
+
+// Decode lê o próximo batch; io.EOF indica que o payload acabou.
+func (d *BatchDecoder) Decode() (*Batch, error) {
+	if d.remaining == 0 {
+		return nil, io.EOF
+	}
+	rowCount, err := d.ReadUvarint()
+	if err != nil {
+		return nil, err
+	}
+	if rowCount > math.MaxInt32 {
+		return nil, fmt.Errorf("%w: %d linhas", errCorruptBatch, rowCount)
+	}
+	batch := &Batch{
+		Columns:  map[string]*columnar.Column{},
+		RowCount: int(rowCount),
+	}
+	metaCount, err := d.ReadUvarint()
+	if err != nil {
+		return nil, err
+	}
+	// cada entrada tem ao menos os dois prefixos de tamanho
+	if metaCount > d.remaining/2 {
+		return nil, fmt.Errorf("%w: %d entradas de meta", errCorruptBatch, metaCount)
+	}
+	if metaCount > 0 {
+		batch.Meta = make(map[string]string, metaCount)
+	}
+	for i := uint64(0); i < metaCount; i++ {
+		key, err := d.readString()
+		if err != nil {
+			return nil, err
+		}
+		value, err := d.readString()
+		if err != nil {
+			return nil, err
+		}
+		batch.Meta[key] = value
+	}
+	colCount, err := d.ReadUvarint()
+	if err != nil {
+		return nil, err
+	}
+	for i := uint64(0); i < colCount; i++ {
+		key, col, err := d.decodeColumn(rowCount)
+		if err != nil {
+			return nil, err
+		}
+		batch.Columns[key] = col
+	}
+	return batch, nil
+}
+
+func (d *BatchDecoder) decodeColumn(rowCount uint64) (string, *columnar.Column, error) {
+	key, err := d.readString()
+	if err != nil {
+		return "", nil, err
+	}
+	name, err := d.readString()
+	if err != nil {
+		return "", nil, err
+	}
+	typ, err := d.ReadUvarint()
+	if err != nil {
+		return "", nil, err
+	}
+	length, err := d.ReadUvarint()
+	if err != nil {
+		return "", nil, err
+	}
+	col := columnar.NewColumn(name, columnar.DataType(typ))
+	flags, err := d.ReadByte()
+	if err != nil {
+		return "", nil, err
+	}
+	// só colunas com campos repetidos têm mais entradas que linhas; elas
+	// gravam um byte de nível por entrada, conferido abaixo
+	if flags&wireHasRepetitions == 0 && length > rowCount {
+		return "", nil, fmt.Errorf("%w: coluna %s com %d entradas em %d linhas", errCorruptBatch, key, length, rowCount)
+	}
+	if length > math.MaxInt32 {
+		return "", nil, fmt.Errorf("%w: coluna %s com %d entradas", errCorruptBatch, key, length)
+	}
+	if flags&wireHasNulls != 0 {
+		if col.NullBitmap, err = d.readBits(length); err != nil {
+			return "", nil, err
+		}
+	}
+	if flags&wireHasRepetitions != 0 {
+		if col.RepetitionLevels, err = d.readLevels(length); err != nil {
+			return "", nil, err
+		}
+	}
+	if flags&wireHasDefinitions != 0 {
+		if col.DefinitionLevels, err = d.readLevels(length); err != nil {
+			return "", nil, err
+		}
+	}
+	switch col.Type {
+	case columnar.TypeInt, columnar.TypeTimestamp, columnar.TypeDate:
+		// varints ocupam ao menos um byte
+		if err := d.need(length); err != nil {
+			return "", nil, err
+		}
+		col.IntData = make([]int64, length)
+		for i := range col.IntData {
+			if col.IntData[i], err = binary.ReadVarint(d); err != nil {
+				return "", nil, err
+			}
+		}
+	case columnar.TypeDecimal:
+		if err := d.need(2 * length); err != nil {
+			return "", nil, err
+		}
+		col.DecimalData = make([]columnar.Decimal, length)
+		for i := range col.DecimalData {
+			unscaled, err := binary.ReadVarint(d)
+			if err != nil {
+				return "", nil, err
+			}
+			scale, err := binary.ReadVarint(d)
+			if err != nil {
+				return "", nil, err
+			}
+			col.DecimalData[i] = columnar.NewDecimal(unscaled, int32(scale))
+		}
+	case columnar.TypeFloat:
+		if err := d.need(8 * length); err != nil {
+			return "", nil, err
+		}
+		col.FloatData = make([]float64, length)
+		var scratch [8]byte
+		for i := range col.FloatData {
+			if err := d.readFull(scratch[:]); err != nil {
+				return "", nil, err
+			}
+			col.FloatData[i] = math.Float64frombits(binary.LittleEndian.Uint64(scratch[:]))
+		}
+	case columnar.TypeString:
+		if err := d.need(length); err != nil {
+			return "", nil, err
+		}
+		col.StringData = make([]string, length)
+		for i := range col.StringData {
+			if col.StringData[i], err = d.readString(); err != nil {
+				return "", nil, err
+			}
+		}
+	case columnar.TypeBool:
+		if col.BoolData, err = d.readBits(length); err != nil {
+			return "", nil, err
+		}
+	default:
+		return "", nil, fmt.Errorf("coluna %s: tipo %d desconhecido", key, typ)
+	}
+	return key, col, nil
+}
+
+func (d *BatchDecoder) readLevels(length uint64) ([]uint8, error) {
+	if err := d.need(length); err != nil {
+		return nil, err
+	}
+	levels := make([]uint8, length)
+	if err := d.readFull(levels); err != nil {
+		return nil, err
+	}
+	return levels, nil
+}
+
+func (d *BatchDecoder) readBits(length uint64) ([]bool, error) {
+	if err := d.need((length + 7) / 8); err != nil {
+		return nil, err
+	}
+	packed := make([]byte, (length+7)/8)
+	if err := d.readFull(packed); err != nil {
+		return nil, err
+	}
+	values := make([]bool, length)
+	for i := range values {
+		values[i] = packed[i/8]&(1<<(i%8)) != 0
+	}
+	return values, nil
+}
+
+func (d *BatchDecoder) readString() (string, error) {
+	length, err := d.ReadUvarint()
+	if err != nil {
+		return "", err
+	}
+	if err := d.need(length); err != nil {
+		return "", err
+	}
+	data := make([]byte, length)
+	if err := d.readFull(data); err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func packBits(values []bool) []byte {
+	packed := make([]byte, (len(values)+7)/8)
+	for i, v := range values {
+		if v {
+			packed[i/8] |= 1 << (i % 8)
+		}
+	}
+	return packed
+}
+
+func writeUvarint(buf *bytes.Buffer, v uint64) {
+	var scratch [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(scratch[:], v)
+	buf.Write(scratch[:n])
+}
+
+func writeVarint(buf *bytes.Buffer, v int64) {
+	var scratch [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(scratch[:], v)
+	buf.Write(scratch[:n])
+}
+
+func writeString(buf *bytes.Buffer, s string) {
+	writeUvarint(buf, uint64(len(s)))
+	buf.WriteString(s)
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
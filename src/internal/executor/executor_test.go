@@ -1,6 +1,11 @@
 package executor
 
 import (
+	"errors"
+	"math"
+	"os"
+	"sort"
+	"strings"
 	"testing"
 
 	"github.com/Jonatan852/distributed-query-processing/internal/storage"
@@ -68,3 +73,801 @@ func TestScanFilterAggregate(t *testing.T) {
 		t.Fatalf("esperava 3 linhas filtradas, obteve %d", total)
 	}
 }
+
+func TestAggregatesSkipNulls(t *testing.T) {
+	amount := columnar.NewColumn("amount", columnar.TypeFloat)
+	for _, v := range []columnar.Value{
+		columnar.NewFloatValue(2),
+		columnar.NewNullValue(columnar.TypeFloat),
+		columnar.NewFloatValue(4),
+	} {
+		_ = amount.Append(v)
+	}
+	fake := fakeScanner{batches: []storage.RecordBatch{{
+		Table:    "events",
+		Columns:  map[string]*columnar.Column{"amount": amount},
+		RowCount: amount.Len(),
+	}}}
+	agg := NewAggregateExecutor(NewScanExecutor(fake, "events", storage.ScanOptions{}), nil, []AggregateSpec{
+		{Func: AggregateCount, Column: "*", Alias: "rows"},
+		{Func: AggregateCount, Column: "amount", Alias: "amounts"},
+		{Func: AggregateAvg, Column: "amount", Alias: "avg_amount"},
+	})
+	result, err := agg.Next()
+	if err != nil {
+		t.Fatalf("aggregate falhou: %v", err)
+	}
+	rows, _ := result.Columns["rows"].Get(0)
+	amounts, _ := result.Columns["amounts"].Get(0)
+	avg, _ := result.Columns["avg_amount"].Get(0)
+	if rows.Data != int64(3) || amounts.Data != int64(2) || avg.Data != 3.0 {
+		t.Fatalf("esperava COUNT(*)=3, COUNT(amount)=2, AVG=3; obteve %v, %v, %v", rows, amounts, avg)
+	}
+}
+
+func TestPartialAggregateMerge(t *testing.T) {
+	partition := func(countries []string, users []int64, amounts []float64) *AggregateExecutor {
+		country := columnar.NewColumn("country", columnar.TypeString)
+		user := columnar.NewColumn("user_id", columnar.TypeInt)
+		amount := columnar.NewColumn("amount", columnar.TypeFloat)
+		for i := range countries {
+			_ = country.Append(columnar.NewStringValue(countries[i]))
+			_ = user.Append(columnar.NewIntValue(users[i]))
+			_ = amount.Append(columnar.NewFloatValue(amounts[i]))
+		}
+		fake := fakeScanner{batches: []storage.RecordBatch{{
+			Table:    "events",
+			Columns:  map[string]*columnar.Column{"country": country, "user_id": user, "amount": amount},
+			RowCount: country.Len(),
+		}}}
+		return NewStagedAggregateExecutor(NewScanExecutor(fake, "events", storage.ScanOptions{}), AggregatePartial,
+			[]GroupKey{{Name: "country"}},
+			[]AggregateSpec{
+				{Func: AggregateAvg, Column: "amount", Alias: "avg"},
+				{Func: AggregateCount, Column: "user_id", Alias: "users", Distinct: true},
+			})
+	}
+	// cada "worker" vê só a sua partição: médias e contagens distintas
+	// parciais não podem ser simplesmente somadas
+	workers := []*AggregateExecutor{
+		partition([]string{"BR", "BR"}, []int64{1, 2}, []float64{1, 2}),
+		partition([]string{"BR", "US"}, []int64{1, 3}, []float64{6, 4}),
+	}
+	var partials []storage.RecordBatch
+	for _, worker := range workers {
+		batch, err := worker.Next()
+		if err != nil {
+			t.Fatalf("stage parcial falhou: %v", err)
+		}
+		if !IsPartialAggregate(batch) || batch.Columns["avg"].Type != columnar.TypeString {
+			t.Fatalf("stage parcial deveria devolver estados: %+v", batch)
+		}
+		partials = append(partials, storage.RecordBatch{Columns: batch.Columns, RowCount: batch.RowCount})
+	}
+
+	final := NewStagedAggregateExecutor(NewScanExecutor(fakeScanner{batches: partials}, "partials", storage.ScanOptions{}), AggregateFinal,
+		[]GroupKey{{Name: "country"}},
+		[]AggregateSpec{
+			{Func: AggregateAvg, Column: "avg", Alias: "avg"},
+			{Func: AggregateCount, Column: "users", Alias: "users", Distinct: true},
+		})
+	result, err := final.Next()
+	if err != nil {
+		t.Fatalf("stage final falhou: %v", err)
+	}
+	if IsPartialAggregate(result) || result.RowCount != 2 {
+		t.Fatalf("esperava 2 grupos finais, obteve %+v", result)
+	}
+	got := map[string][2]interface{}{}
+	for i := 0; i < result.RowCount; i++ {
+		country, _ := result.Columns["country"].Get(i)
+		avg, _ := result.Columns["avg"].Get(i)
+		users, _ := result.Columns["users"].Get(i)
+		got[country.String()] = [2]interface{}{avg.Data, users.Data}
+	}
+	if got["BR"] != [2]interface{}{3.0, int64(2)} || got["US"] != [2]interface{}{4.0, int64(1)} {
+		t.Fatalf("merge dos estados incorreto: %v", got)
+	}
+
+	acc, err := NewAccumulator(AggregateSum, false)
+	if err != nil {
+		t.Fatalf("acumulador: %v", err)
+	}
+	if err := acc.MergeState([]byte{0x01}); err == nil {
+		t.Fatalf("estado truncado deveria falhar")
+	}
+}
+
+func TestTypedAggregates(t *testing.T) {
+	aggregate := func(fn AggregateFunc, values ...columnar.Value) (columnar.Value, error) {
+		t.Helper()
+		// metade dos valores passa por um estado parcial, como nos workers
+		whole, err := NewAccumulator(fn, false)
+		if err != nil {
+			t.Fatalf("acumulador %s: %v", fn, err)
+		}
+		part, _ := NewAccumulator(fn, false)
+		for i, value := range values {
+			target := whole
+			if i%2 == 1 {
+				target = part
+			}
+			if err := target.Add(value); err != nil {
+				return columnar.Value{}, err
+			}
+		}
+		if err := whole.MergeState(part.State()); err != nil {
+			return columnar.Value{}, err
+		}
+		return whole.Result(), nil
+	}
+
+	big := int64(1) << 53
+	got, err := aggregate(AggregateSum, columnar.NewIntValue(big), columnar.NewIntValue(1), columnar.NewIntValue(2))
+	if err != nil || got.Type != columnar.TypeInt || got.Data != big+3 {
+		t.Fatalf("SUM de INT deveria ser exato: %v (%v)", got, err)
+	}
+	if _, err := aggregate(AggregateSum, columnar.NewIntValue(math.MaxInt64), columnar.NewIntValue(1)); err == nil || !strings.Contains(err.Error(), "limite de INT") {
+		t.Fatalf("estouro de INT deveria falhar: %v", err)
+	}
+	got, err = aggregate(AggregateAvg, columnar.NewIntValue(math.MaxInt64), columnar.NewIntValue(math.MaxInt64))
+	if err != nil || got.Data != float64(math.MaxInt64) {
+		t.Fatalf("AVG deveria promover a soma para FLOAT: %v (%v)", got, err)
+	}
+	got, err = aggregate(AggregateSum, columnar.NewIntValue(1), columnar.NewFloatValue(0.5))
+	if err != nil || got.Type != columnar.TypeFloat || got.Data != 1.5 {
+		t.Fatalf("INT com FLOAT deveria somar em FLOAT: %v (%v)", got, err)
+	}
+	got, err = aggregate(AggregateSum, columnar.NewDecimalValue(columnar.NewDecimal(110, 2)), columnar.NewIntValue(2))
+	if err != nil || got.Type != columnar.TypeDecimal || got.String() != "3.10" {
+		t.Fatalf("SUM de DECIMAL deveria ser exato: %v (%v)", got, err)
+	}
+	got, err = aggregate(AggregateMin, columnar.NewStringValue("view"), columnar.NewStringValue("buy"), columnar.NewStringValue("click"))
+	if err != nil || got.Data != "buy" {
+		t.Fatalf("MIN de STRING incorreto: %v (%v)", got, err)
+	}
+	got, err = aggregate(AggregateMax, columnar.NewBoolValue(false), columnar.NewBoolValue(true))
+	if err != nil || got.Data != true {
+		t.Fatalf("MAX de BOOL incorreto: %v (%v)", got, err)
+	}
+	if _, err := aggregate(AggregateMax, columnar.NewStringValue("a"), columnar.NewIntValue(1)); err == nil {
+		t.Fatalf("MAX com tipos incompatíveis deveria falhar")
+	}
+
+	user := columnar.NewColumn("user_id", columnar.TypeInt)
+	kind := columnar.NewColumn("event_type", columnar.TypeString)
+	for i, name := range []string{"view", "click", "buy", "view"} {
+		_ = user.Append(columnar.NewIntValue(int64(i % 2)))
+		_ = kind.Append(columnar.NewStringValue(name))
+	}
+	fake := fakeScanner{batches: []storage.RecordBatch{{
+		Table:    "events",
+		Columns:  map[string]*columnar.Column{"user_id": user, "event_type": kind},
+		RowCount: user.Len(),
+	}}}
+	agg := NewAggregateExecutor(NewScanExecutor(fake, "events", storage.ScanOptions{}), []string{"user_id"}, []AggregateSpec{
+		{Func: AggregateSum, Column: "user_id", Alias: "users"},
+		{Func: AggregateMin, Column: "event_type", Alias: "first"},
+	})
+	result, err := agg.Next()
+	if err != nil {
+		t.Fatalf("aggregate falhou: %v", err)
+	}
+	for name, want := range map[string]columnar.DataType{"user_id": columnar.TypeInt, "users": columnar.TypeInt, "first": columnar.TypeString} {
+		if col := result.Columns[name]; col.Type != want || col.Len() != 2 {
+			t.Fatalf("coluna %s deveria ser %s com 2 linhas, obteve %s com %d", name, want, col.Type, col.Len())
+		}
+	}
+	first, _ := result.Columns["first"].Get(0)
+	if first.Data != "buy" {
+		t.Fatalf("MIN(event_type) do usuário 0 deveria ser buy, obteve %v", first)
+	}
+}
+
+func TestStatisticalAggregates(t *testing.T) {
+	// aggregate divide os valores entre dois acumuladores e combina o estado
+	// serializado do segundo no primeiro, como os stages LOCAL e GLOBAL
+	aggregate := func(fn AggregateFunc, params []columnar.Value, values ...columnar.Value) *Accumulator {
+		t.Helper()
+		whole, err := NewAccumulator(fn, false, params...)
+		if err != nil {
+			t.Fatalf("acumulador %s: %v", fn, err)
+		}
+		part, _ := NewAccumulator(fn, false, params...)
+		for i, value := range values {
+			target := whole
+			if i%2 == 1 {
+				target = part
+			}
+			if err := target.Add(value); err != nil {
+				t.Fatalf("%s: %v", fn, err)
+			}
+		}
+		if err := whole.MergeState(part.State()); err != nil {
+			t.Fatalf("%s: merge falhou: %v", fn, err)
+		}
+		return whole
+	}
+	ints := func(from, to int) []columnar.Value {
+		values := make([]columnar.Value, 0, to-from+1)
+		for i := from; i <= to; i++ {
+			values = append(values, columnar.NewIntValue(int64(i)))
+		}
+		return values
+	}
+	near := func(got columnar.Value, want, tolerance float64) bool {
+		f, err := got.AsFloat()
+		return err == nil && math.Abs(f-want) <= tolerance
+	}
+
+	sample := []columnar.Value{}
+	for _, v := range []int64{2, 4, 4, 4, 5, 5, 7, 9} {
+		sample = append(sample, columnar.NewIntValue(v))
+	}
+	if got := aggregate(AggregateStddevPop, nil, sample...).Result(); !near(got, 2, 1e-9) {
+		t.Fatalf("STDDEV_POP incorreto: %v", got)
+	}
+	if got := aggregate(AggregateVariance, nil, sample...).Result(); !near(got, 32.0/7, 1e-9) {
+		t.Fatalf("VARIANCE amostral incorreta: %v", got)
+	}
+	if got := aggregate(AggregateStddev, nil, sample[0]).Result(); !got.IsNull() {
+		t.Fatalf("STDDEV de um único valor deveria ser NULL: %v", got)
+	}
+
+	// metade dos valores aparece nas duas partições
+	distinct := append(ints(1, 10000), ints(1, 5000)...)
+	if got := aggregate(AggregateApproxCountDistinct, nil, distinct...).Result(); got.Type != columnar.TypeInt || !near(columnar.NewFloatValue(float64(got.Data.(int64))), 10000, 300) {
+		t.Fatalf("APPROX_COUNT_DISTINCT longe de 10000: %v", got)
+	}
+	if got := aggregate(AggregateApproxCountDistinct, nil, ints(1, 3)...).Result(); got.Data != int64(3) {
+		t.Fatalf("APPROX_COUNT_DISTINCT de poucos valores deveria ser exato: %v", got)
+	}
+
+	half := []columnar.Value{columnar.NewFloatValue(0.5)}
+	if got := aggregate(AggregatePercentileApprox, half, ints(1, 10001)...).Result(); !near(got, 5001, 50) {
+		t.Fatalf("mediana aproximada longe de 5001: %v", got)
+	}
+	quantiles := aggregate(AggregateApproxQuantiles, []columnar.Value{columnar.NewIntValue(4)}, ints(0, 100)...)
+	bounds := quantiles.Values()
+	if len(bounds) != 5 || bounds[0].Data != 0.0 || bounds[4].Data != 100.0 || !near(bounds[2], 50, 1) {
+		t.Fatalf("APPROX_QUANTILES incorreto: %v", bounds)
+	}
+	if !quantiles.Result().IsNull() {
+		t.Fatalf("agregações com listas devolvem o resultado em Values")
+	}
+	if _, err := NewAccumulator(AggregateApproxQuantiles, false); err == nil {
+		t.Fatalf("APPROX_QUANTILES sem o número de quantis deveria falhar")
+	}
+	if _, err := NewAccumulator(AggregatePercentileApprox, false, columnar.NewFloatValue(1.5)); err == nil {
+		t.Fatalf("percentil fora de [0, 1] deveria falhar")
+	}
+
+	words := []columnar.Value{columnar.NewStringValue("a"), columnar.NewStringValue("b"), columnar.NewStringValue("c")}
+	if got := aggregate(AggregateStringAgg, []columnar.Value{columnar.NewStringValue(";")}, words...).Result(); got.Data != "a;c;b" {
+		t.Fatalf("STRING_AGG incorreto: %v", got)
+	}
+	if got := aggregate(AggregateAnyValue, nil, words...).Result(); got.Data != "a" {
+		t.Fatalf("ANY_VALUE deveria manter o primeiro valor: %v", got)
+	}
+
+	// ARRAY_AGG sai como campo repetido, um registro por grupo
+	user := columnar.NewColumn("user_id", columnar.TypeInt)
+	kind := columnar.NewColumn("event_type", columnar.TypeString)
+	for i, name := range []string{"view", "click", "buy"} {
+		_ = user.Append(columnar.NewIntValue(int64(i % 2)))
+		_ = kind.Append(columnar.NewStringValue(name))
+	}
+	_ = user.Append(columnar.NewIntValue(2))
+	_ = kind.AppendNull()
+	fake := fakeScanner{batches: []storage.RecordBatch{{
+		Table:    "events",
+		Columns:  map[string]*columnar.Column{"user_id": user, "event_type": kind},
+		RowCount: user.Len(),
+	}}}
+	agg := NewAggregateExecutor(NewScanExecutor(fake, "events", storage.ScanOptions{}), []string{"user_id"}, []AggregateSpec{
+		{Func: AggregateArrayAgg, Column: "event_type", Alias: "kinds"},
+	})
+	result, err := agg.Next()
+	if err != nil {
+		t.Fatalf("aggregate falhou: %v", err)
+	}
+	kinds := result.Columns["kinds"]
+	if result.RowCount != 3 || kinds.Records() != 3 || kinds.Len() != 4 || !kinds.IsNull(3) {
+		t.Fatalf("ARRAY_AGG deveria ter 3 registros e 4 entradas: %+v", kinds)
+	}
+	if offsets := kinds.RecordOffsets(); offsets[1] != 2 {
+		t.Fatalf("o usuário 0 deveria ter 2 eventos: %v", offsets)
+	}
+}
+
+func TestHashJoin(t *testing.T) {
+	// events(user_id INT, country) x users(id, country, name): a chave composta
+	// casa id e país; o user 9 não existe e o user 3 não tem eventos
+	events := func() Executor {
+		user := columnar.NewColumn("user_id", columnar.TypeInt)
+		country := columnar.NewColumn("country", columnar.TypeString)
+		for i, id := range []columnar.Value{
+			columnar.NewIntValue(1), columnar.NewIntValue(1), columnar.NewIntValue(9), columnar.NewNullValue(columnar.TypeInt),
+		} {
+			_ = user.Append(id)
+			_ = country.Append(columnar.NewStringValue([]string{"BR", "US", "BR", "BR"}[i]))
+		}
+		return NewScanExecutor(fakeScanner{batches: []storage.RecordBatch{{
+			Columns:  map[string]*columnar.Column{"user_id": user, "country": country},
+			RowCount: user.Len(),
+		}}}, "events", storage.ScanOptions{})
+	}
+	users := func() Executor {
+		// id em FLOAT: 1.0 precisa casar com o INT 1
+		id := columnar.NewColumn("id", columnar.TypeFloat)
+		country := columnar.NewColumn("country", columnar.TypeString)
+		name := columnar.NewColumn("name", columnar.TypeString)
+		for i, n := range []string{"ana", "bia", "caio"} {
+			_ = id.Append(columnar.NewFloatValue([]float64{1, 1, 3}[i]))
+			_ = country.Append(columnar.NewStringValue([]string{"BR", "AR", "BR"}[i]))
+			_ = name.Append(columnar.NewStringValue(n))
+		}
+		return NewScanExecutor(fakeScanner{batches: []storage.RecordBatch{{
+			Columns:  map[string]*columnar.Column{"id": id, "country": country, "name": name},
+			RowCount: id.Len(),
+		}}}, "users", storage.ScanOptions{})
+	}
+	run := func(typ JoinType) []string {
+		t.Helper()
+		join := NewHashJoinExecutor(events(), users(), JoinCondition{
+			Type:         typ,
+			LeftColumns:  []string{"user_id", "country"},
+			RightColumns: []string{"id", "country"},
+			LeftAlias:    "e",
+			RightAlias:   "u",
+		})
+		var rows []string
+		for {
+			batch, err := join.Next()
+			if err == ErrNoMoreBatches {
+				break
+			}
+			if err != nil {
+				t.Fatalf("%s JOIN falhou: %v", typ, err)
+			}
+			for i := 0; i < batch.RowCount; i++ {
+				user, _ := batch.Columns["e.user_id"].Get(i)
+				row := user.String()
+				if name, ok := batch.Columns["u.name"]; ok {
+					value, _ := name.Get(i)
+					row += "/" + value.String()
+				}
+				rows = append(rows, row)
+			}
+		}
+		if _, err := join.Next(); err != ErrNoMoreBatches {
+			t.Fatalf("%s JOIN deveria continuar em ErrNoMoreBatches, obteve %v", typ, err)
+		}
+		sort.Strings(rows)
+		return rows
+	}
+	cases := map[JoinType]string{
+		JoinTypeInner:    "1/ana",
+		JoinTypeLeft:     "1/NULL,1/ana,9/NULL,NULL/NULL",
+		JoinTypeRight:    "1/ana,NULL/bia,NULL/caio",
+		JoinTypeFull:     "1/NULL,1/ana,9/NULL,NULL/NULL,NULL/bia,NULL/caio",
+		JoinTypeLeftSemi: "1",
+		JoinTypeLeftAnti: "1,9,NULL",
+	}
+	for typ, want := range cases {
+		if got := strings.Join(run(typ), ","); got != want {
+			t.Fatalf("%s JOIN: esperava %s, obteve %s", typ, want, got)
+		}
+	}
+
+	// o país como Filter em vez de chave dá o mesmo resultado: pares
+	// rejeitados não contam como par no LEFT JOIN
+	filtered := NewHashJoinExecutor(events(), users(), JoinCondition{
+		Type:         JoinTypeLeft,
+		LeftColumns:  []string{"user_id"},
+		RightColumns: []string{"id"},
+		LeftAlias:    "e",
+		RightAlias:   "u",
+		Filter: func(row RowView) (bool, error) {
+			left, err := row.Value("e.country")
+			if err != nil {
+				return false, err
+			}
+			right, err := row.Value("u.country")
+			if err != nil {
+				return false, err
+			}
+			return left.String() == right.String(), nil
+		},
+	})
+	var rows []string
+	for {
+		batch, err := filtered.Next()
+		if err == ErrNoMoreBatches {
+			break
+		}
+		if err != nil {
+			t.Fatalf("join com Filter falhou: %v", err)
+		}
+		for i := 0; i < batch.RowCount; i++ {
+			user, _ := batch.Columns["e.user_id"].Get(i)
+			name, _ := batch.Columns["u.name"].Get(i)
+			rows = append(rows, user.String()+"/"+name.String())
+		}
+	}
+	sort.Strings(rows)
+	if got := strings.Join(rows, ","); got != cases[JoinTypeLeft] {
+		t.Fatalf("join com Filter: esperava %s, obteve %s", cases[JoinTypeLeft], got)
+	}
+
+	// sem aliases, "country" existe dos dois lados
+	join := NewHashJoinExecutor(events(), users(), JoinCondition{LeftColumns: []string{"user_id"}, RightColumns: []string{"id"}})
+	if _, err := join.Next(); err == nil || !strings.Contains(err.Error(), "dos dois lados") {
+		t.Fatalf("esperava erro de coluna duplicada, obteve %v", err)
+	}
+
+	for _, pair := range [][2][]columnar.Value{
+		{{columnar.NewIntValue(1)}, {columnar.NewStringValue("1")}},
+		{{columnar.NewStringValue("ab"), columnar.NewStringValue("c")}, {columnar.NewStringValue("a"), columnar.NewStringValue("bc")}},
+	} {
+		left, _ := HashKey(pair[0])
+		right, _ := HashKey(pair[1])
+		if left == right {
+			t.Fatalf("%v e %v não deveriam ter a mesma chave", pair[0], pair[1])
+		}
+	}
+	decimal, _ := HashKey([]columnar.Value{columnar.NewDecimalValue(columnar.NewDecimal(150, 2))})
+	float, _ := HashKey([]columnar.Value{columnar.NewFloatValue(1.5)})
+	if decimal != float {
+		t.Fatalf("1.50 e 1.5 deveriam ter a mesma chave: %q, %q", decimal, float)
+	}
+}
+
+func TestExternalSort(t *testing.T) {
+	// 20 batches de 50 linhas: amount com repetições e NULLs, seq desempata
+	var batches []storage.RecordBatch
+	for b := 0; b < 20; b++ {
+		amount := columnar.NewColumn("amount", columnar.TypeInt)
+		seq := columnar.NewColumn("seq", columnar.TypeInt)
+		for i := 0; i < 50; i++ {
+			n := b*50 + i
+			if n%37 == 0 {
+				_ = amount.Append(columnar.NewNullValue(columnar.TypeInt))
+			} else {
+				_ = amount.Append(columnar.NewIntValue(int64((n * 7919) % 101)))
+			}
+			_ = seq.Append(columnar.NewIntValue(int64(n)))
+		}
+		batches = append(batches, storage.RecordBatch{
+			Columns:  map[string]*columnar.Column{"amount": amount, "seq": seq},
+			RowCount: amount.Len(),
+		})
+	}
+	keys := []SortKey{{Column: "amount", Ascending: false}, {Column: "seq", Ascending: true}}
+	drain := func(sorter *SortExecutor) []string {
+		t.Helper()
+		var rows []string
+		for {
+			batch, err := sorter.Next()
+			if err == ErrNoMoreBatches {
+				break
+			}
+			if err != nil {
+				t.Fatalf("sort falhou: %v", err)
+			}
+			if batch.RowCount > 64 {
+				t.Fatalf("batch com %d linhas, maior que BatchSize", batch.RowCount)
+			}
+			for i := 0; i < batch.RowCount; i++ {
+				amount, _ := batch.Columns["amount"].Get(i)
+				seq, _ := batch.Columns["seq"].Get(i)
+				rows = append(rows, amount.String()+"/"+seq.String())
+			}
+		}
+		return rows
+	}
+
+	memory := NewSortExecutor(NewScanExecutor(fakeScanner{batches: batches}, "events", storage.ScanOptions{}), keys, 64)
+	want := drain(memory)
+	if len(want) != 1000 || want[0] != "NULL/0" || !strings.HasPrefix(want[len(want)-1], "0/") {
+		t.Fatalf("ordenação em memória inesperada: %d linhas, %s ... %s", len(want), want[0], want[len(want)-1])
+	}
+
+	dir := t.TempDir()
+	external := NewExternalSortExecutor(NewScanExecutor(fakeScanner{batches: batches}, "events", storage.ScanOptions{}), keys,
+		SortConfig{BatchSize: 64, MemoryLimit: 8 << 10, SpillDir: dir})
+	got := drain(external)
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("sort externo divergiu do sort em memória")
+	}
+	stats := external.Stats()
+	if stats["spilledRuns"] < 2 || stats["spilledRows"] == 0 || stats["spilledBytes"] == 0 {
+		t.Fatalf("esperava runs gravados em disco, obteve %v", stats)
+	}
+	if err := external.Close(); err != nil {
+		t.Fatalf("close falhou: %v", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Fatalf("runs não foram apagados: %d arquivos", len(entries))
+	}
+}
+
+func TestTopN(t *testing.T) {
+	// mesmos dados do sort externo: o top-N tem que bater com o começo do sort
+	var batches []storage.RecordBatch
+	for b := 0; b < 10; b++ {
+		amount := columnar.NewColumn("amount", columnar.TypeInt)
+		seq := columnar.NewColumn("seq", columnar.TypeInt)
+		for i := 0; i < 30; i++ {
+			n := b*30 + i
+			if n%41 == 0 {
+				_ = amount.Append(columnar.NewNullValue(columnar.TypeInt))
+			} else {
+				_ = amount.Append(columnar.NewIntValue(int64((n * 7919) % 23)))
+			}
+			_ = seq.Append(columnar.NewIntValue(int64(n)))
+		}
+		batches = append(batches, storage.RecordBatch{
+			Columns:  map[string]*columnar.Column{"amount": amount, "seq": seq},
+			RowCount: amount.Len(),
+		})
+	}
+	collect := func(exec Executor) []string {
+		t.Helper()
+		var rows []string
+		for {
+			batch, err := exec.Next()
+			if err == ErrNoMoreBatches {
+				break
+			}
+			if err != nil {
+				t.Fatalf("execução falhou: %v", err)
+			}
+			for i := 0; i < batch.RowCount; i++ {
+				amount, _ := batch.Columns["amount"].Get(i)
+				seq, _ := batch.Columns["seq"].Get(i)
+				rows = append(rows, amount.String()+"/"+seq.String())
+			}
+		}
+		return rows
+	}
+
+	// só amount: os empates mostram se a ordem de chegada é preservada
+	for _, ascending := range []bool{true, false} {
+		keys := []SortKey{{Column: "amount", Ascending: ascending}}
+		want := collect(NewSortExecutor(NewScanExecutor(fakeScanner{batches: batches}, "events", storage.ScanOptions{}), keys, 1024))
+		for _, count := range []int64{0, 1, 7, 50, 1000} {
+			top := NewTopNExecutor(NewScanExecutor(fakeScanner{batches: batches}, "events", storage.ScanOptions{}), keys, count, 16)
+			got := collect(top)
+			limit := int(count)
+			if limit > len(want) {
+				limit = len(want)
+			}
+			if strings.Join(got, ",") != strings.Join(want[:limit], ",") {
+				t.Fatalf("top %d (asc=%v) divergiu do sort:\n%v\n%v", count, ascending, got, want[:limit])
+			}
+		}
+	}
+}
+
+func TestSpillingHashOperators(t *testing.T) {
+	// 2000 eventos de 600 usuários (alguns NULL) e 700 usuários, 50 duplicados
+	var events, users []storage.RecordBatch
+	for b := 0; b < 10; b++ {
+		user := columnar.NewColumn("user_id", columnar.TypeInt)
+		amount := columnar.NewColumn("amount", columnar.TypeInt)
+		for i := 0; i < 200; i++ {
+			n := b*200 + i
+			if n%97 == 0 {
+				_ = user.Append(columnar.NewNullValue(columnar.TypeInt))
+			} else {
+				_ = user.Append(columnar.NewIntValue(int64((n * 7919) % 600)))
+			}
+			_ = amount.Append(columnar.NewIntValue(int64(n % 13)))
+		}
+		events = append(events, storage.RecordBatch{
+			Columns:  map[string]*columnar.Column{"user_id": user, "amount": amount},
+			RowCount: user.Len(),
+		})
+	}
+	for b := 0; b < 7; b++ {
+		id := columnar.NewColumn("id", columnar.TypeInt)
+		name := columnar.NewColumn("name", columnar.TypeString)
+		for i := 0; i < 100; i++ {
+			n := b*100 + i
+			_ = id.Append(columnar.NewIntValue(int64(100 + n%650)))
+			_ = name.Append(columnar.NewStringValue("user-" + columnar.NewIntValue(int64(n)).String()))
+		}
+		users = append(users, storage.RecordBatch{
+			Columns:  map[string]*columnar.Column{"id": id, "name": name},
+			RowCount: id.Len(),
+		})
+	}
+	scan := func(batches []storage.RecordBatch) Executor {
+		return NewScanExecutor(fakeScanner{batches: batches}, "t", storage.ScanOptions{})
+	}
+	drain := func(exec Executor, columns ...string) []string {
+		t.Helper()
+		var rows []string
+		for {
+			batch, err := exec.Next()
+			if err == ErrNoMoreBatches {
+				break
+			}
+			if err != nil {
+				t.Fatalf("execução falhou: %v", err)
+			}
+			for i := 0; i < batch.RowCount; i++ {
+				var parts []string
+				for _, name := range columns {
+					value, err := batch.Columns[name].Get(i)
+					if err != nil {
+						t.Fatalf("coluna %s: %v", name, err)
+					}
+					parts = append(parts, value.String())
+				}
+				rows = append(rows, strings.Join(parts, "/"))
+			}
+		}
+		sort.Strings(rows)
+		return rows
+	}
+	checkSpilled := func(name string, exec interface {
+		Executor
+		StatsReporter
+	}, dir string) {
+		t.Helper()
+		if stats := exec.Stats(); stats["spilledPartitions"] == 0 || stats["spilledRows"] == 0 || stats["spilledBytes"] == 0 {
+			t.Fatalf("%s deveria ter gravado partições: %v", name, stats)
+		}
+		if err := exec.Close(); err != nil {
+			t.Fatalf("%s: close falhou: %v", name, err)
+		}
+		if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+			t.Fatalf("%s: partições não foram apagadas: %d arquivos", name, len(entries))
+		}
+	}
+
+	keys := []GroupKey{{Name: "user_id"}}
+	specs := []AggregateSpec{
+		{Func: AggregateCount, Column: "*", Alias: "total"},
+		{Func: AggregateSum, Column: "amount", Alias: "sum"},
+		{Func: AggregateCount, Column: "amount", Alias: "distinct", Distinct: true},
+	}
+	columns := []string{"user_id", "total", "sum", "distinct"}
+	want := drain(NewStagedAggregateExecutor(scan(events), AggregateComplete, keys, specs), columns...)
+	if len(want) != 601 {
+		t.Fatalf("esperava 600 usuários e o grupo NULL, obteve %d", len(want))
+	}
+	dir := t.TempDir()
+	aggregate := NewExternalAggregateExecutor(scan(events), AggregateComplete, keys, specs, HashConfig{MemoryLimit: 8 << 10, SpillDir: dir})
+	if got := drain(aggregate, columns...); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("agregação com spill divergiu da agregação em memória")
+	}
+	checkSpilled("agregação", aggregate, dir)
+
+	for _, typ := range []JoinType{JoinTypeInner, JoinTypeLeft, JoinTypeRight, JoinTypeFull, JoinTypeLeftSemi, JoinTypeLeftAnti} {
+		cond := JoinCondition{Type: typ, LeftColumns: []string{"user_id"}, RightColumns: []string{"id"}, LeftAlias: "e", RightAlias: "u"}
+		columns := []string{"e.user_id", "e.amount", "u.name"}
+		if typ == JoinTypeLeftSemi || typ == JoinTypeLeftAnti {
+			columns = columns[:2]
+		}
+		want := drain(NewHashJoinExecutor(scan(events), scan(users), cond), columns...)
+		dir := t.TempDir()
+		join := NewExternalHashJoinExecutor(scan(events), scan(users), cond, HashConfig{MemoryLimit: 4 << 10, SpillDir: dir})
+		if got := drain(join, columns...); strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Fatalf("%s JOIN com spill divergiu do join em memória: %d e %d linhas", typ, len(got), len(want))
+		}
+		checkSpilled(string(typ)+" JOIN", join, dir)
+	}
+}
+
+func TestMemoryTracker(t *testing.T) {
+	process := NewMemoryTracker("processo", 100)
+	first := process.Child("query q-1", 80)
+	second := process.Child("query q-2", 0)
+	if err := first.Reserve(60); err != nil {
+		t.Fatalf("reserva dentro do limite falhou: %v", err)
+	}
+	// o limite da query vale antes do processo
+	err := first.Reserve(30)
+	var limitErr *MemoryLimitError
+	if !errors.Is(err, ErrMemoryLimitExceeded) || !errors.As(err, &limitErr) || limitErr.Tracker != "query q-1" {
+		t.Fatalf("esperava o limite da query, obteve %v", err)
+	}
+	// o processo limita a soma das queries e a reserva recusada não fica em nenhum nível
+	if err := second.Reserve(50); !errors.As(err, &limitErr) || limitErr.Tracker != "processo" {
+		t.Fatalf("esperava o limite do processo, obteve %v", err)
+	}
+	if second.Used() != 0 || process.Used() != 60 {
+		t.Fatalf("reservas inconsistentes: query %d, processo %d", second.Used(), process.Used())
+	}
+	first.Release(60)
+	if process.Used() != 0 || process.Peak() != 60 {
+		t.Fatalf("esperava uso 0 e pico 60, obteve %d e %d", process.Used(), process.Peak())
+	}
+	// os usos simultâneos de Shared dividem o mesmo filho até o último release
+	task1, release1 := process.Shared("query q-3", 40)
+	task2, release2 := process.Shared("query q-3", 40)
+	if task1 != task2 {
+		t.Fatalf("usos simultâneos da mesma query deveriam dividir o tracker")
+	}
+	if err := task1.Reserve(30); err != nil {
+		t.Fatalf("reserva dentro do limite falhou: %v", err)
+	}
+	if err := task2.Reserve(20); !errors.As(err, &limitErr) || limitErr.Tracker != "query q-3" {
+		t.Fatalf("esperava o limite compartilhado da query, obteve %v", err)
+	}
+	task1.Release(30)
+	release1()
+	release2()
+	if task3, release3 := process.Shared("query q-3", 40); task3 == task1 {
+		t.Fatalf("o tracker deveria ser descartado depois do último release")
+	} else {
+		release3()
+	}
+	var none *MemoryTracker
+	if err := none.Reserve(1 << 40); err != nil {
+		t.Fatalf("tracker nil não deveria limitar: %v", err)
+	}
+
+	// operadores: com SpillDir o orçamento esgotado vira spill, sem ele vira erro
+	var batches []storage.RecordBatch
+	for b := 0; b < 8; b++ {
+		user := columnar.NewColumn("user_id", columnar.TypeInt)
+		for i := 0; i < 100; i++ {
+			_ = user.Append(columnar.NewIntValue(int64(b*100 + i)))
+		}
+		batches = append(batches, storage.RecordBatch{Columns: map[string]*columnar.Column{"user_id": user}, RowCount: user.Len()})
+	}
+	scan := func() Executor {
+		return NewScanExecutor(fakeScanner{batches: batches}, "events", storage.ScanOptions{})
+	}
+	keys := []SortKey{{Column: "user_id", Ascending: false}}
+	groups := []GroupKey{{Name: "user_id"}}
+	counts := []AggregateSpec{{Func: AggregateCount, Column: "*", Alias: "total"}}
+	join := JoinCondition{LeftColumns: []string{"user_id"}, RightColumns: []string{"user_id"}, LeftAlias: "l", RightAlias: "r"}
+	operators := map[string]func(memory *MemoryTracker, dir string) Executor{
+		"sort": func(memory *MemoryTracker, dir string) Executor {
+			return NewExternalSortExecutor(scan(), keys, SortConfig{SpillDir: dir, Memory: memory})
+		},
+		"agregação": func(memory *MemoryTracker, dir string) Executor {
+			return NewExternalAggregateExecutor(scan(), AggregateComplete, groups, counts, HashConfig{SpillDir: dir, Memory: memory})
+		},
+		"join": func(memory *MemoryTracker, dir string) Executor {
+			return NewExternalHashJoinExecutor(scan(), scan(), join, HashConfig{SpillDir: dir, Memory: memory})
+		},
+	}
+	for name, build := range operators {
+		memory := NewMemoryTracker("query", 8<<10)
+		exec := build(memory, t.TempDir())
+		rows := 0
+		for {
+			batch, err := exec.Next()
+			if err == ErrNoMoreBatches {
+				break
+			}
+			if err != nil {
+				t.Fatalf("%s com spill falhou: %v", name, err)
+			}
+			rows += batch.RowCount
+		}
+		if rows != 800 {
+			t.Fatalf("%s com spill devolveu %d linhas", name, rows)
+		}
+		if err := exec.Close(); err != nil {
+			t.Fatalf("%s: close falhou: %v", name, err)
+		}
+		if memory.Used() != 0 || memory.Peak() == 0 {
+			t.Fatalf("%s deveria reservar e devolver tudo: uso %d, pico %d", name, memory.Used(), memory.Peak())
+		}
+
+		exec = build(NewMemoryTracker("query", 8<<10), "")
+		for err = nil; err == nil; _, err = exec.Next() {
+		}
+		if !errors.Is(err, ErrMemoryLimitExceeded) {
+			t.Fatalf("%s sem spill deveria falhar por memória, obteve %v", name, err)
+		}
+		_ = exec.Close()
+	}
+}
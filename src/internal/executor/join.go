@@ -1,7 +1,12 @@
 package executor
 
 import (
+	"errors"
 	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/Jonatan852/distributed-query-processing/pkg/columnar"
 )
@@ -11,45 +16,125 @@ type JoinType string
 
 const (
 	JoinTypeInner JoinType = "INNER"
+	JoinTypeLeft  JoinType = "LEFT"
+	JoinTypeRight JoinType = "RIGHT"
+	JoinTypeFull  JoinType = "FULL"
+	// JoinTypeLeftSemi devolve as linhas da esquerda que têm ao menos um par
+	// na direita (IN/EXISTS); JoinTypeLeftAnti, as que não têm nenhum (NOT
+	// EXISTS). Só as colunas da esquerda aparecem na saída.
+	JoinTypeLeftSemi JoinType = "LEFT SEMI"
+	JoinTypeLeftAnti JoinType = "LEFT ANTI"
 )
 
-// JoinCondition define colunas de comparação (colunas devem estar presentes nos batches).
+// JoinCondition define o join: cada LeftColumns[i] é comparada com
+// RightColumns[i] (chave composta) e Type vazio equivale a INNER. Com
+// LeftAlias/RightAlias as colunas de saída de cada lado se chamam
+// alias.coluna; sem alias o nome é mantido, e um nome presente nos dois lados
+// é erro. Filter, quando presente, é a parte da condição que não é igualdade
+// de colunas (ON a.x = b.y AND a.z > b.w): cada par com a mesma chave só casa
+// se Filter aceitar a linha combinada, lida pelos nomes de saída.
 type JoinCondition struct {
-	LeftColumn  string
-	RightColumn string
+	Type         JoinType
+	LeftColumns  []string
+	RightColumns []string
+	LeftAlias    string
+	RightAlias   string
+	Filter       Predicate
 }
 
-// HashJoinExecutor realiza um hash join simples em memória.
+// HashJoinExecutor realiza um hash join em memória: a tabela hash é montada
+// com o lado direito (em geral o menor, como uma dimensão) e o esquerdo é lido
+// em streaming. NULL nunca casa com nada; as linhas sem par de um lado externo
+// saem com NULLs nas colunas do outro lado. Para completar esse lado, o tipo
+// das colunas vem dos batches lidos: um lado sem nenhum batch não gera colunas.
+//
+// Com HashConfig, um lado direito que passa de MemoryLimit faz o join virar um
+// grace hash join: os dois lados são divididos pelo hash da chave em partições
+// gravadas em disco, e cada par de partições é juntado por um executor próprio
+// (recursivamente, se a partição da direita ainda não couber).
 type HashJoinExecutor struct {
-	left       Executor
-	right      Executor
-	condition  JoinCondition
-	hashTable  map[string][]map[string]columnar.Value
-	leftSchema map[string]columnar.DataType
+	left      Executor
+	right     Executor
+	condition JoinCondition
+	config    HashConfig
+	level     int
+	stats     *SpillStats
+
+	built bool
+	done  bool
+	// rows guarda as linhas da direita na ordem de rightCols e matched marca
+	// as que encontraram par (RIGHT/FULL)
+	rows      [][]columnar.Value
+	matched   []bool
+	hashTable map[string][]int
+	leftCols  []joinColumn
+	rightCols []joinColumn
+
+	// partições do grace hash join, na mesma numeração dos dois lados
+	leftSpill  *spillPartitions
+	rightSpill *spillPartitions
+	partition  int
+	current    *HashJoinExecutor
+	// reserved é o que a tabela hash ocupa em config.Memory
+	reserved int64
+}
+
+type joinColumn struct {
+	name   string
+	output string
+	typ    columnar.DataType
 }
 
 func NewHashJoinExecutor(left, right Executor, cond JoinCondition) *HashJoinExecutor {
+	return NewExternalHashJoinExecutor(left, right, cond, HashConfig{})
+}
+
+// NewExternalHashJoinExecutor cria um join que respeita config.MemoryLimit
+// gravando partições em config.SpillDir.
+func NewExternalHashJoinExecutor(left, right Executor, cond JoinCondition, config HashConfig) *HashJoinExecutor {
+	if cond.Type == "" {
+		cond.Type = JoinTypeInner
+	}
 	return &HashJoinExecutor{
-		left:       left,
-		right:      right,
-		condition:  cond,
-		hashTable:  map[string][]map[string]columnar.Value{},
-		leftSchema: map[string]columnar.DataType{},
+		left:      left,
+		right:     right,
+		condition: cond,
+		config:    config,
+		stats:     &SpillStats{},
 	}
 }
 
 func (j *HashJoinExecutor) Next() (*Batch, error) {
-	if j.hashTable == nil {
+	if !j.built {
 		if err := j.buildHashTable(); err != nil {
 			return nil, err
 		}
+		j.built = true
+		if j.rightSpill != nil {
+			if err := j.partitionLeft(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if j.rightSpill != nil {
+		return j.nextPartition()
+	}
+	if j.done {
+		return nil, ErrNoMoreBatches
 	}
 	for {
-		rightBatch, err := j.right.Next()
+		leftBatch, err := j.left.Next()
+		if err == ErrNoMoreBatches {
+			j.done = true
+			return j.unmatched()
+		}
+		if err != nil {
+			return nil, err
+		}
+		result, err := j.probe(leftBatch)
 		if err != nil {
 			return nil, err
 		}
-		result := j.probe(rightBatch)
 		if result.RowCount > 0 {
 			return result, nil
 		}
@@ -57,71 +142,533 @@ func (j *HashJoinExecutor) Next() (*Batch, error) {
 }
 
 func (j *HashJoinExecutor) buildHashTable() error {
-	j.hashTable = map[string][]map[string]columnar.Value{}
+	cond := j.condition
+	switch cond.Type {
+	case JoinTypeInner, JoinTypeLeft, JoinTypeRight, JoinTypeFull, JoinTypeLeftSemi, JoinTypeLeftAnti:
+	default:
+		return fmt.Errorf("executor: tipo de join %s não suportado", cond.Type)
+	}
+	if len(cond.LeftColumns) == 0 || len(cond.LeftColumns) != len(cond.RightColumns) {
+		return fmt.Errorf("executor: o join precisa do mesmo número (> 0) de colunas de cada lado, recebeu %d e %d", len(cond.LeftColumns), len(cond.RightColumns))
+	}
+	j.hashTable = map[string][]int{}
+	spill := j.config.spills(j.level)
+	canSpill := j.config.canSpill(j.level)
+	var used int64
 	for {
-		leftBatch, err := j.left.Next()
+		rightBatch, err := j.right.Next()
 		if err != nil {
 			if err == ErrNoMoreBatches {
 				break
 			}
 			return err
 		}
-		row := batchRow{batch: leftBatch}
-		for i := 0; i < leftBatch.RowCount; i++ {
+		if j.rightCols == nil {
+			j.rightCols = joinColumns(rightBatch, cond.RightAlias)
+		}
+		if j.rightSpill != nil {
+			if err := j.spillBatch(j.rightSpill, rightBatch, cond.RightColumns); err != nil {
+				return err
+			}
+			continue
+		}
+		row := batchRow{batch: rightBatch}
+		for i := 0; i < rightBatch.RowCount; i++ {
 			row.index = i
-			key, err := row.Value(j.condition.LeftColumn)
+			key, ok, err := rowKey(row, cond.RightColumns)
 			if err != nil {
 				return err
 			}
-			record := map[string]columnar.Value{}
-			for name := range leftBatch.Columns {
-				value, _ := row.Value(name)
-				record[name] = value
-				j.leftSchema[name] = value.Type
+			if !ok {
+				// NULL = NULL não é verdadeiro: a linha nunca casa, mas ainda
+				// sai no RIGHT/FULL
+				if cond.Type == JoinTypeRight || cond.Type == JoinTypeFull {
+					j.rows = append(j.rows, rowValues(row, j.rightCols))
+				}
+				continue
+			}
+			values := rowValues(row, j.rightCols)
+			size := int64(len(key)) + joinRowOverhead(len(values))
+			for _, value := range values {
+				size += valueBytes(value)
 			}
-			j.hashTable[key.String()] = append(j.hashTable[key.String()], record)
+			if err := j.config.Memory.Reserve(size); err != nil {
+				if !canSpill {
+					return err
+				}
+				// sem orçamento: o restante da direita vai para partições
+				if err := j.spillRows(); err != nil {
+					return err
+				}
+				rest := make([]int, 0, rightBatch.RowCount-i)
+				for r := i; r < rightBatch.RowCount; r++ {
+					rest = append(rest, r)
+				}
+				remaining, err := takeRows(rightBatch, rest)
+				if err != nil {
+					return err
+				}
+				if err := j.spillBatch(j.rightSpill, remaining, cond.RightColumns); err != nil {
+					return err
+				}
+				break
+			}
+			j.reserved += size
+			j.hashTable[key] = append(j.hashTable[key], len(j.rows))
+			j.rows = append(j.rows, values)
+			used += size
 		}
+		if spill && j.rightSpill == nil && used > j.config.MemoryLimit {
+			if err := j.spillRows(); err != nil {
+				return err
+			}
+		}
+	}
+	if j.rightSpill != nil {
+		return j.rightSpill.finish()
 	}
+	j.matched = make([]bool, len(j.rows))
 	return nil
 }
 
-func (j *HashJoinExecutor) probe(batch *Batch) *Batch {
-	result := &Batch{
-		Columns:  map[string]*columnar.Column{},
-		RowCount: 0,
+// spillRows passa o join para o modo grace: as linhas da direita já em
+// memória vão para as partições e a tabela hash é descartada.
+func (j *HashJoinExecutor) spillRows() error {
+	j.rightSpill = newSpillPartitions(j.config.SpillDir, "join-build-*.part", j.stats)
+	keys := make([]int, len(j.condition.RightColumns))
+	for k, name := range j.condition.RightColumns {
+		keys[k] = -1
+		for i, col := range j.rightCols {
+			if col.name == name {
+				keys[k] = i
+			}
+		}
+	}
+	parts := make([]*Batch, spillFanout)
+	for _, values := range j.rows {
+		// linhas com chave NULL nunca casam; ficam na partição 0
+		partition := 0
+		key := make([]columnar.Value, len(keys))
+		for k, index := range keys {
+			if index >= 0 {
+				key[k] = values[index]
+			}
+		}
+		if text, ok := HashKey(key); ok {
+			partition = partitionOf(text, j.level)
+		}
+		if parts[partition] == nil {
+			parts[partition] = &Batch{Columns: map[string]*columnar.Column{}}
+			for _, col := range j.rightCols {
+				parts[partition].Columns[col.name] = columnar.NewColumn(col.name, col.typ)
+			}
+		}
+		part := parts[partition]
+		for i, col := range j.rightCols {
+			if err := addColumnData(part.Columns[col.name], values[i]); err != nil {
+				return err
+			}
+		}
+		part.RowCount++
 	}
-	for name, typ := range j.leftSchema {
-		result.Columns[name] = columnar.NewColumn(name, typ)
+	for partition, part := range parts {
+		if part == nil {
+			continue
+		}
+		if err := j.rightSpill.write(partition, part); err != nil {
+			return err
+		}
+	}
+	j.rows, j.hashTable = nil, nil
+	j.config.Memory.Release(j.reserved)
+	j.reserved = 0
+	return nil
+}
+
+// partitionLeft grava todo o lado esquerdo nas partições correspondentes às
+// da direita.
+func (j *HashJoinExecutor) partitionLeft() error {
+	j.leftSpill = newSpillPartitions(j.config.SpillDir, "join-probe-*.part", j.stats)
+	for {
+		batch, err := j.left.Next()
+		if err == ErrNoMoreBatches {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if j.leftCols == nil {
+			j.leftCols = joinColumns(batch, j.condition.LeftAlias)
+		}
+		if err := j.spillBatch(j.leftSpill, batch, j.condition.LeftColumns); err != nil {
+			return err
+		}
 	}
-	for name, col := range batch.Columns {
-		outputName := fmt.Sprintf("right.%s", name)
-		result.Columns[outputName] = columnar.NewColumn(outputName, col.Type)
+	return j.leftSpill.finish()
+}
+
+// spillBatch distribui as linhas do batch pelo hash das colunas de junção.
+func (j *HashJoinExecutor) spillBatch(spill *spillPartitions, batch *Batch, columns []string) error {
+	if hasRepeated(batch) {
+		return fmt.Errorf("executor: join com spill recebeu colunas repetidas")
 	}
+	rows := make([][]int, spillFanout)
 	row := batchRow{batch: batch}
 	for i := 0; i < batch.RowCount; i++ {
 		row.index = i
-		key, err := row.Value(j.condition.RightColumn)
+		key, ok, err := rowKey(row, columns)
 		if err != nil {
+			return err
+		}
+		partition := 0
+		if ok {
+			partition = partitionOf(key, j.level)
+		}
+		rows[partition] = append(rows[partition], i)
+	}
+	return spill.writeRows(batch, rows)
+}
+
+// nextPartition junta, em ordem, cada par de partições. As colunas dos dois
+// lados são herdadas para que todas as partições gerem o mesmo schema.
+func (j *HashJoinExecutor) nextPartition() (*Batch, error) {
+	for {
+		if j.current != nil {
+			batch, err := j.current.Next()
+			if err != ErrNoMoreBatches {
+				return batch, err
+			}
+			err = j.current.Close()
+			j.current = nil
+			if err != nil {
+				return nil, err
+			}
+		}
+		if j.partition >= spillFanout {
+			return nil, ErrNoMoreBatches
+		}
+		partition := j.partition
+		j.partition++
+		if j.skipPartition(partition) {
 			continue
 		}
-		matches := j.hashTable[key.String()]
-		for _, match := range matches {
-			for name, val := range match {
-				_ = addColumnData(result.Columns[name], val)
+		j.current = &HashJoinExecutor{
+			left:      j.leftSpill.scan(partition),
+			right:     j.rightSpill.scan(partition),
+			condition: j.condition,
+			config:    j.config,
+			level:     j.level + 1,
+			stats:     j.stats,
+			leftCols:  j.leftCols,
+			rightCols: j.rightCols,
+		}
+	}
+}
+
+// skipPartition indica se o par de partições não pode produzir linhas.
+func (j *HashJoinExecutor) skipPartition(partition int) bool {
+	leftEmpty, rightEmpty := j.leftSpill.empty(partition), j.rightSpill.empty(partition)
+	switch j.condition.Type {
+	case JoinTypeRight:
+		return rightEmpty
+	case JoinTypeFull:
+		return leftEmpty && rightEmpty
+	case JoinTypeLeft, JoinTypeLeftAnti:
+		return leftEmpty
+	default:
+		return leftEmpty || rightEmpty
+	}
+}
+
+// Stats devolve as métricas de spill, somando as partições reprocessadas.
+func (j *HashJoinExecutor) Stats() map[string]int64 {
+	return j.stats.hashStats()
+}
+
+func (j *HashJoinExecutor) probe(batch *Batch) (*Batch, error) {
+	cond := j.condition
+	if j.leftCols == nil {
+		j.leftCols = joinColumns(batch, cond.LeftAlias)
+	}
+	result, err := j.newResult()
+	if err != nil {
+		return nil, err
+	}
+	row := batchRow{batch: batch}
+	for i := 0; i < batch.RowCount; i++ {
+		row.index = i
+		key, ok, err := rowKey(row, cond.LeftColumns)
+		if err != nil {
+			return nil, err
+		}
+		var matches []int
+		if ok {
+			matches = j.hashTable[key]
+		}
+		left := rowValues(row, j.leftCols)
+		if cond.Filter != nil && len(matches) > 0 {
+			if matches, err = j.filter(left, matches); err != nil {
+				return nil, err
 			}
-			for name := range batch.Columns {
-				val, _ := row.Value(name)
-				_ = addColumnData(result.Columns["right."+name], val)
+		}
+		switch cond.Type {
+		case JoinTypeLeftSemi, JoinTypeLeftAnti:
+			if (len(matches) > 0) == (cond.Type == JoinTypeLeftSemi) {
+				if err := j.emit(result, left, nil); err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+		for _, index := range matches {
+			j.matched[index] = true
+			if err := j.emit(result, left, j.rows[index]); err != nil {
+				return nil, err
+			}
+		}
+		if len(matches) == 0 && (cond.Type == JoinTypeLeft || cond.Type == JoinTypeFull) {
+			if err := j.emit(result, left, nil); err != nil {
+				return nil, err
 			}
-			result.RowCount++
 		}
 	}
-	return result
+	return result, nil
 }
 
-func (j *HashJoinExecutor) Close() error {
-	if err := j.left.Close(); err != nil {
+// filter mantém os pares candidatos aceitos por condition.Filter.
+func (j *HashJoinExecutor) filter(left []columnar.Value, candidates []int) ([]int, error) {
+	var kept []int
+	for _, index := range candidates {
+		pass, err := j.condition.Filter(pairRow{join: j, left: left, right: j.rows[index]})
+		if err != nil {
+			return nil, err
+		}
+		if pass {
+			kept = append(kept, index)
+		}
+	}
+	return kept, nil
+}
+
+// pairRow é a linha combinada de um par candidato, vista por Filter.
+type pairRow struct {
+	join        *HashJoinExecutor
+	left, right []columnar.Value
+}
+
+func (p pairRow) Value(column string) (columnar.Value, error) {
+	for i, col := range p.join.leftCols {
+		if col.output == column {
+			return p.left[i], nil
+		}
+	}
+	for i, col := range p.join.rightCols {
+		if col.output == column {
+			return p.right[i], nil
+		}
+	}
+	return columnar.Value{}, fmt.Errorf("coluna %s não encontrada", column)
+}
+
+// unmatched devolve, em RIGHT/FULL, as linhas da direita que não encontraram
+// par; nos demais tipos o fluxo termina.
+func (j *HashJoinExecutor) unmatched() (*Batch, error) {
+	if j.condition.Type != JoinTypeRight && j.condition.Type != JoinTypeFull {
+		return nil, ErrNoMoreBatches
+	}
+	result, err := j.newResult()
+	if err != nil {
+		return nil, err
+	}
+	for index, values := range j.rows {
+		if j.matched[index] {
+			continue
+		}
+		if err := j.emit(result, nil, values); err != nil {
+			return nil, err
+		}
+	}
+	if result.RowCount == 0 {
+		return nil, ErrNoMoreBatches
+	}
+	return result, nil
+}
+
+func (j *HashJoinExecutor) newResult() (*Batch, error) {
+	result := &Batch{Columns: map[string]*columnar.Column{}}
+	columns := j.leftCols
+	if j.condition.Type != JoinTypeLeftSemi && j.condition.Type != JoinTypeLeftAnti {
+		columns = append(append([]joinColumn{}, j.leftCols...), j.rightCols...)
+	}
+	for _, col := range columns {
+		if _, ok := result.Columns[col.output]; ok {
+			return nil, fmt.Errorf("executor: coluna %s aparece dos dois lados do join; informe LeftAlias/RightAlias", col.output)
+		}
+		result.Columns[col.output] = columnar.NewColumn(col.output, col.typ)
+	}
+	return result, nil
+}
+
+// emit acrescenta uma linha ao resultado; lado nil vira NULLs.
+func (j *HashJoinExecutor) emit(result *Batch, left, right []columnar.Value) error {
+	if err := appendSide(result, j.leftCols, left); err != nil {
 		return err
 	}
-	return j.right.Close()
+	if j.condition.Type != JoinTypeLeftSemi && j.condition.Type != JoinTypeLeftAnti {
+		if err := appendSide(result, j.rightCols, right); err != nil {
+			return err
+		}
+	}
+	result.RowCount++
+	return nil
+}
+
+func appendSide(result *Batch, columns []joinColumn, values []columnar.Value) error {
+	for i, col := range columns {
+		value := columnar.NewNullValue(col.typ)
+		if values != nil {
+			value = values[i]
+		}
+		if err := addColumnData(result.Columns[col.output], value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (j *HashJoinExecutor) Close() error {
+	var errs []error
+	if j.current != nil {
+		errs = append(errs, j.current.Close())
+		j.current = nil
+	}
+	for _, spill := range []*spillPartitions{j.leftSpill, j.rightSpill} {
+		if spill != nil {
+			errs = append(errs, spill.remove())
+		}
+	}
+	j.leftSpill, j.rightSpill = nil, nil
+	j.rows, j.hashTable = nil, nil
+	j.config.Memory.Release(j.reserved)
+	j.reserved = 0
+	errs = append(errs, j.left.Close(), j.right.Close())
+	return errors.Join(errs...)
+}
+
+// joinRowOverhead estima os bytes que a tabela hash mantém por linha da
+// direita além dos valores.
+func joinRowOverhead(columns int) int64 {
+	return 64 + 16*int64(columns)
+}
+
+// joinColumns fixa, a partir do primeiro batch de um lado, a ordem, o tipo e
+// o nome de saída das colunas.
+func joinColumns(batch *Batch, alias string) []joinColumn {
+	names := make([]string, 0, len(batch.Columns))
+	for name := range batch.Columns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	columns := make([]joinColumn, len(names))
+	for i, name := range names {
+		output := name
+		if alias != "" {
+			output = alias + "." + name
+		}
+		columns[i] = joinColumn{name: name, output: output, typ: batch.Columns[name].Type}
+	}
+	return columns
+}
+
+func rowValues(row batchRow, columns []joinColumn) []columnar.Value {
+	values := make([]columnar.Value, len(columns))
+	for i, col := range columns {
+		value, err := row.Value(col.name)
+		if err != nil {
+			// batch sem a coluna: o lado não tem o mesmo schema em todos os batches
+			value = columnar.NewNullValue(col.typ)
+		}
+		values[i] = value
+	}
+	return values
+}
+
+func rowKey(row batchRow, columns []string) (string, bool, error) {
+	values := make([]columnar.Value, len(columns))
+	for i, name := range columns {
+		value, err := row.Value(name)
+		if err != nil {
+			return "", false, err
+		}
+		values[i] = value
+	}
+	key, ok := HashKey(values)
+	return key, ok, nil
+}
+
+// HashKey codifica uma chave (possivelmente composta) de join ou de
+// agrupamento. Valores iguais pela comparação SQL geram a mesma chave: INT,
+// FLOAT e DECIMAL com o mesmo valor numérico (1, 1.0, 1.00) e TIMESTAMP/DATE
+// no mesmo instante. Tipos incomparáveis nunca colidem (INT 1 e STRING "1").
+// ok é false quando algum valor é NULL, que não casa com nada.
+func HashKey(values []columnar.Value) (string, bool) {
+	var b strings.Builder
+	for _, value := range values {
+		if value.IsNull() {
+			return "", false
+		}
+		var tag byte
+		var text string
+		switch value.Type {
+		case columnar.TypeInt:
+			i, _ := value.AsInt()
+			tag, text = 'n', strconv.FormatInt(i, 10)
+		case columnar.TypeFloat:
+			f, _ := value.AsFloat()
+			tag, text = 'n', floatKey(f)
+		case columnar.TypeDecimal:
+			d, _ := value.AsDecimal()
+			tag, text = 'n', decimalKey(d)
+		case columnar.TypeTimestamp, columnar.TypeDate:
+			t, _ := value.AsTime()
+			tag, text = 't', strconv.FormatInt(columnar.TimestampMicros(t), 10)
+		case columnar.TypeString:
+			tag, text = 's', value.String()
+		case columnar.TypeBool:
+			tag, text = 'b', value.String()
+		default:
+			tag, text = '?', fmt.Sprintf("%d:%s", value.Type, value.String())
+		}
+		// o tamanho antes do texto evita colisões entre chaves compostas
+		b.WriteByte(tag)
+		b.WriteString(strconv.Itoa(len(text)))
+		b.WriteByte(':')
+		b.WriteString(text)
+	}
+	return b.String(), true
+}
+
+// floatKey usa a mesma forma de INT e DECIMAL para floats inteiros (1.0 vira
+// "1") e a menor representação exata nos demais casos.
+func floatKey(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case f == math.Trunc(f) && math.Abs(f) < 1<<63:
+		return strconv.FormatInt(int64(f), 10)
+	default:
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+}
+
+// decimalKey remove os zeros à direita da parte fracionária (1.50 vira "1.5").
+func decimalKey(d columnar.Decimal) string {
+	text := d.String()
+	if strings.Contains(text, ".") {
+		text = strings.TrimRight(strings.TrimRight(text, "0"), ".")
+	}
+	if text == "-0" {
+		return "0"
+	}
+	return text
 }
@@ -0,0 +1,50 @@
+package executor
+
+import "github.com/Jonatan852/distributed-query-processing/pkg/columnar"
+
+// LimitExecutor repassa no máximo count linhas do filho e encerra o fluxo.
+type LimitExecutor struct {
+	child     Executor
+	remaining int64
+}
+
+func NewLimitExecutor(child Executor, count int64) *LimitExecutor {
+	if count < 0 {
+		count = 0
+	}
+	return &LimitExecutor{child: child, remaining: count}
+}
+
+func (l *LimitExecutor) Next() (*Batch, error) {
+	if l.remaining <= 0 {
+		return nil, ErrNoMoreBatches
+	}
+	batch, err := l.child.Next()
+	if err != nil {
+		return nil, err
+	}
+	if int64(batch.RowCount) <= l.remaining {
+		l.remaining -= int64(batch.RowCount)
+		return batch, nil
+	}
+	keep := int(l.remaining)
+	l.remaining = 0
+	return sliceBatch(batch, 0, keep), nil
+}
+
+func (l *LimitExecutor) Close() error {
+	return l.child.Close()
+}
+
+func sliceBatch(batch *Batch, start, end int) *Batch {
+	result := &Batch{
+		Columns:  make(map[string]*columnar.Column, len(batch.Columns)),
+		RowCount: end - start,
+		Meta:     batch.Meta,
+	}
+	for name, col := range batch.Columns {
+		slice, _ := col.Slice(start, end)
+		result.Columns[name] = slice
+	}
+	return result
+}
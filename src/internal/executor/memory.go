@@ -0,0 +1,164 @@
+package executor
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrMemoryLimitExceeded é a causa comum dos erros de MemoryTracker.Reserve;
+// use errors.Is para reconhecê-la.
+var ErrMemoryLimitExceeded = errors.New("executor: limite de memória excedido")
+
+// MemoryLimitError informa qual orçamento foi excedido e por quanto.
+type MemoryLimitError struct {
+	Tracker   string
+	Limit     int64
+	Used      int64
+	Requested int64
+}
+
+func (e *MemoryLimitError) Error() string {
+	return fmt.Sprintf("executor: limite de memória de %s excedido (limite %d bytes, em uso %d, pedido %d)", e.Tracker, e.Limit, e.Used, e.Requested)
+}
+
+func (e *MemoryLimitError) Is(target error) bool {
+	return target == ErrMemoryLimitExceeded
+}
+
+// MemoryTracker contabiliza a memória (estimada) de uma query ou do processo.
+// Cada reserva também é feita nos trackers acima (query → processo) e falha se
+// qualquer um deles passar do limite; limit <= 0 não limita aquele nível. Um
+// tracker nil aceita tudo, o que permite usar os operadores sem orçamento.
+type MemoryTracker struct {
+	name   string
+	limit  int64
+	parent *MemoryTracker
+
+	mu   sync.Mutex
+	used int64
+	peak int64
+	// shared são os filhos criados por Shared que ainda estão em uso
+	shared map[string]*sharedTracker
+}
+
+type sharedTracker struct {
+	tracker *MemoryTracker
+	users   int
+}
+
+// NewMemoryTracker cria um tracker raiz (em geral o do processo).
+func NewMemoryTracker(name string, limit int64) *MemoryTracker {
+	return &MemoryTracker{name: name, limit: limit}
+}
+
+// Child cria um tracker cujas reservas também contam neste; em um tracker nil
+// o filho é uma raiz.
+func (t *MemoryTracker) Child(name string, limit int64) *MemoryTracker {
+	return &MemoryTracker{name: name, limit: limit, parent: t}
+}
+
+// Shared devolve o filho name deste tracker, criando-o com limit se ele ainda
+// não estiver em uso, para que usos concorrentes (os tasks de uma mesma query
+// no worker) dividam um único orçamento. Cada chamada deve terminar com
+// release; o filho é descartado quando o último uso termina. Em um tracker
+// nil cada chamada recebe uma raiz própria.
+func (t *MemoryTracker) Shared(name string, limit int64) (*MemoryTracker, func()) {
+	if t == nil {
+		return NewMemoryTracker(name, limit), func() {}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	entry, ok := t.shared[name]
+	if !ok {
+		if t.shared == nil {
+			t.shared = map[string]*sharedTracker{}
+		}
+		entry = &sharedTracker{tracker: t.Child(name, limit)}
+		t.shared[name] = entry
+	}
+	entry.users++
+	var once sync.Once
+	return entry.tracker, func() {
+		once.Do(func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			if entry.users--; entry.users == 0 {
+				delete(t.shared, name)
+			}
+		})
+	}
+}
+
+// Reserve reserva bytes em todos os níveis ou em nenhum.
+func (t *MemoryTracker) Reserve(bytes int64) error {
+	if t == nil || bytes <= 0 {
+		return nil
+	}
+	t.mu.Lock()
+	if t.limit > 0 && t.used+bytes > t.limit {
+		err := &MemoryLimitError{Tracker: t.name, Limit: t.limit, Used: t.used, Requested: bytes}
+		t.mu.Unlock()
+		return err
+	}
+	t.used += bytes
+	t.mu.Unlock()
+	if err := t.parent.Reserve(bytes); err != nil {
+		t.mu.Lock()
+		t.used -= bytes
+		t.mu.Unlock()
+		return err
+	}
+	t.mu.Lock()
+	if t.used > t.peak {
+		t.peak = t.used
+	}
+	t.mu.Unlock()
+	return nil
+}
+
+// Release devolve bytes reservados.
+func (t *MemoryTracker) Release(bytes int64) {
+	if t == nil || bytes <= 0 {
+		return
+	}
+	t.mu.Lock()
+	t.used -= bytes
+	t.mu.Unlock()
+	t.parent.Release(bytes)
+}
+
+// Used devolve os bytes reservados no momento.
+func (t *MemoryTracker) Used() int64 {
+	if t == nil {
+		return 0
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.used
+}
+
+// Peak devolve o maior valor de Used já observado.
+func (t *MemoryTracker) Peak() int64 {
+	if t == nil {
+		return 0
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.peak
+}
+
+// BatchBytes estima a memória ocupada pelos dados do batch; é a medida usada
+// nas reservas de MemoryTracker.
+func BatchBytes(batch *Batch) int64 {
+	var total int64
+	for _, col := range batch.Columns {
+		total += int64(len(col.IntData))*8 + int64(len(col.FloatData))*8 + int64(len(col.DecimalData))*16
+		total += int64(len(col.BoolData)) + int64(len(col.NullBitmap))
+		total += int64(len(col.RepetitionLevels)) + int64(len(col.DefinitionLevels))
+		for _, s := range col.StringData {
+			total += 16 + int64(len(s))
+		}
+	}
+	return total
+}
@@ -1,6 +1,8 @@
 package executor
 
 import (
+	"io"
+
 	"github.com/Jonatan852/distributed-query-processing/internal/storage"
 	"github.com/Jonatan852/distributed-query-processing/pkg/columnar"
 )
@@ -10,15 +12,35 @@ type StorageScanner interface {
 	Scan(table string, opts storage.ScanOptions) ([]storage.RecordBatch, error)
 }
 
-// ScanExecutor lê batches colunares do storage.
+// Chaves de Batch.Meta preenchidas pelo scan. MetaAlias é gravado pelo
+// worker com o alias da tabela na query, para que o coordinator saiba a que
+// lado de um join cada batch pertence.
+const (
+	MetaTable     = "table"
+	MetaPartition = "partition"
+	MetaAlias     = "alias"
+)
+
+// StreamingScanner é implementado por engines que leem a tabela partição a
+// partição (storage.Engine); com ele o ScanExecutor só abre as partições que o
+// consumidor chega a pedir.
+type StreamingScanner interface {
+	OpenScan(table string, opts storage.ScanOptions) (*storage.Scanner, error)
+}
+
+// ScanExecutor lê batches colunares do storage. Com um StreamingScanner os
+// batches são puxados sob demanda, de modo que um LIMIT acima dele encerra a
+// leitura; senão a tabela é lida de uma vez no primeiro Next.
 type ScanExecutor struct {
 	engine  StorageScanner
 	table   string
 	options storage.ScanOptions
 
-	batches []storage.RecordBatch
-	index   int
-	loaded  bool
+	scanner    *storage.Scanner
+	batches    []storage.RecordBatch
+	index      int
+	loaded     bool
+	partitions map[string]struct{}
 }
 
 func NewScanExecutor(engine StorageScanner, table string, opts storage.ScanOptions) *ScanExecutor {
@@ -33,6 +55,15 @@ func (s *ScanExecutor) load() error {
 	if s.loaded {
 		return nil
 	}
+	if streaming, ok := s.engine.(StreamingScanner); ok {
+		scanner, err := streaming.OpenScan(s.table, s.options)
+		if err != nil {
+			return err
+		}
+		s.scanner = scanner
+		s.loaded = true
+		return nil
+	}
 	batches, err := s.engine.Scan(s.table, s.options)
 	if err != nil {
 		return err
@@ -42,15 +73,35 @@ func (s *ScanExecutor) load() error {
 	return nil
 }
 
-func (s *ScanExecutor) Next() (*Batch, error) {
-	if err := s.load(); err != nil {
-		return nil, err
+// nextRecord devolve o próximo batch do storage ou ErrNoMoreBatches.
+func (s *ScanExecutor) nextRecord() (storage.RecordBatch, error) {
+	if s.scanner != nil {
+		record, err := s.scanner.Next()
+		if err == io.EOF {
+			return storage.RecordBatch{}, ErrNoMoreBatches
+		}
+		return record, err
 	}
 	if s.index >= len(s.batches) {
-		return nil, ErrNoMoreBatches
+		return storage.RecordBatch{}, ErrNoMoreBatches
 	}
 	record := s.batches[s.index]
 	s.index++
+	if s.partitions == nil {
+		s.partitions = map[string]struct{}{}
+	}
+	s.partitions[record.Partition] = struct{}{}
+	return record, nil
+}
+
+func (s *ScanExecutor) Next() (*Batch, error) {
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	record, err := s.nextRecord()
+	if err != nil {
+		return nil, err
+	}
 	columns := make(map[string]*columnar.Column, len(record.Columns))
 	for name, col := range record.Columns {
 		columns[name] = cloneColumn(col)
@@ -59,13 +110,26 @@ func (s *ScanExecutor) Next() (*Batch, error) {
 		Columns:  columns,
 		RowCount: record.RowCount,
 		Meta: map[string]string{
-			"table":     record.Table,
-			"partition": record.Partition,
+			MetaTable:     record.Table,
+			MetaPartition: record.Partition,
 		},
 	}, nil
 }
 
+// Stats informa quantas partições o scan leu (partitionsRead); sem
+// StreamingScanner contam as partições dos batches já devolvidos.
+func (s *ScanExecutor) Stats() map[string]int64 {
+	read := int64(len(s.partitions))
+	if s.scanner != nil {
+		read = int64(s.scanner.PartitionsRead())
+	}
+	return map[string]int64{"partitionsRead": read}
+}
+
 func (s *ScanExecutor) Close() error {
 	s.batches = nil
+	if s.scanner != nil {
+		return s.scanner.Close()
+	}
 	return nil
 }
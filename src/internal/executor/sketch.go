@@ -0,0 +1,392 @@
+package executor
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/bits"
+	"sort"
+
+	"github.com/Jonatan852/distributed-query-processing/pkg/columnar"
+)
+
+// Sketches das agregações aproximadas. Os dois têm tamanho limitado,
+// independente do número de linhas, e estados combináveis: o worker envia o
+// sketch da sua partição e o coordinator une os sketches recebidos.
+
+// hllPrecision define 2^12 registradores, com erro padrão de ~1,6%.
+const hllPrecision = 12
+
+// hllAccumulator estima COUNT(DISTINCT x) com HyperLogLog. Cada valor é
+// resumido por um hash de 64 bits: os primeiros hllPrecision bits escolhem o
+// registrador, que guarda a maior posição do primeiro bit 1 no restante.
+type hllAccumulator struct {
+	registers []uint8
+}
+
+func newHLLAccumulator() *hllAccumulator {
+	return &hllAccumulator{registers: make([]uint8, 1<<hllPrecision)}
+}
+
+func (a *hllAccumulator) accumulate(value columnar.Value) error {
+	hash := hashValue(value)
+	index := hash >> (64 - hllPrecision)
+	// o bit sentinela limita a contagem quando o restante do hash é zero
+	rank := uint8(bits.LeadingZeros64(hash<<hllPrecision|1<<(hllPrecision-1))) + 1
+	if rank > a.registers[index] {
+		a.registers[index] = rank
+	}
+	return nil
+}
+
+func (a *hllAccumulator) merge(other aggAccumulator) error {
+	for i, rank := range other.(*hllAccumulator).registers {
+		if rank > a.registers[i] {
+			a.registers[i] = rank
+		}
+	}
+	return nil
+}
+
+// result usa o estimador de Ertl ("New cardinality estimation algorithms for
+// HyperLogLog sketches", 2017), que dispensa a troca para contagem linear e as
+// tabelas de correção de viés: o histograma dos registradores é corrigido nas
+// duas pontas por sigma (registradores vazios) e tau (saturados).
+func (a *hllAccumulator) result() columnar.Value {
+	const q = 64 - hllPrecision
+	m := float64(len(a.registers))
+	var histogram [q + 2]float64
+	for _, rank := range a.registers {
+		histogram[rank]++
+	}
+	z := m * hllTau(1-histogram[q+1]/m)
+	for k := q; k >= 1; k-- {
+		z = 0.5 * (z + histogram[k])
+	}
+	z += m * hllSigma(histogram[0]/m)
+	estimate := m * m / (2 * math.Ln2 * z)
+	return columnar.NewIntValue(int64(math.Round(estimate)))
+}
+
+func hllSigma(x float64) float64 {
+	if x == 1 {
+		return math.Inf(1)
+	}
+	y, z := 1.0, x
+	for {
+		x *= x
+		previous := z
+		z += x * y
+		y += y
+		if z == previous {
+			return z
+		}
+	}
+}
+
+func hllTau(x float64) float64 {
+	if x == 0 || x == 1 {
+		return 0
+	}
+	y, z := 1.0, 1-x
+	for {
+		x = math.Sqrt(x)
+		previous := z
+		y *= 0.5
+		z -= (1 - x) * (1 - x) * y
+		if z == previous {
+			return z / 3
+		}
+	}
+}
+
+// appendState grava só os registradores ocupados (índice e valor), já que
+// grupos pequenos deixam quase todos vazios.
+func (a *hllAccumulator) appendState(buf []byte) []byte {
+	used := 0
+	for _, rank := range a.registers {
+		if rank > 0 {
+			used++
+		}
+	}
+	buf = binary.AppendUvarint(buf, uint64(used))
+	for i, rank := range a.registers {
+		if rank > 0 {
+			buf = binary.AppendUvarint(buf, uint64(i))
+			buf = append(buf, rank)
+		}
+	}
+	return buf
+}
+
+func (a *hllAccumulator) readState(r *stateReader) {
+	used := r.uvarint()
+	for i := uint64(0); i < used && r.err == nil; i++ {
+		index := r.uvarint()
+		rank := r.byte()
+		if r.err != nil {
+			return
+		}
+		if index >= uint64(len(a.registers)) || rank > 64-hllPrecision+1 {
+			r.invalid("registrador HyperLogLog inválido (%d=%d)", index, rank)
+			return
+		}
+		a.registers[index] = rank
+	}
+}
+
+// hashValue combina FNV-1a com o finalizador do splitmix64, que espalha os
+// bits altos usados para escolher o registrador.
+func hashValue(value columnar.Value) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(distinctKey(value)))
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// digestCompression controla o número de centroides do t-digest (~2x o valor):
+// mais centroides, quantis mais precisos.
+const digestCompression = 100
+
+type centroid struct {
+	mean  float64
+	count float64
+}
+
+// tdigest resume a distribuição em centroides pequenos nas caudas e maiores no
+// meio, o que mantém os quantis extremos precisos. Valores novos ficam em
+// pending até a próxima compressão.
+type tdigest struct {
+	centroids []centroid
+	pending   []float64
+	count     float64
+	min, max  float64
+}
+
+func (d *tdigest) add(x float64) {
+	if d.count == 0 || x < d.min {
+		d.min = x
+	}
+	if d.count == 0 || x > d.max {
+		d.max = x
+	}
+	d.count++
+	d.pending = append(d.pending, x)
+	if len(d.pending) >= 8*digestCompression {
+		d.compress()
+	}
+}
+
+func (d *tdigest) merge(other *tdigest) {
+	if other.count == 0 {
+		return
+	}
+	if d.count == 0 || other.min < d.min {
+		d.min = other.min
+	}
+	if d.count == 0 || other.max > d.max {
+		d.max = other.max
+	}
+	d.count += other.count
+	d.centroids = append(d.centroids, other.centroids...)
+	for _, x := range other.pending {
+		d.centroids = append(d.centroids, centroid{mean: x, count: 1})
+	}
+	d.compress()
+}
+
+// compress junta centroides vizinhos enquanto o tamanho permitido pela função
+// de escala k1 (proporcional a q(1-q)) não é excedido.
+func (d *tdigest) compress() {
+	all := d.centroids
+	for _, x := range d.pending {
+		all = append(all, centroid{mean: x, count: 1})
+	}
+	d.pending = d.pending[:0]
+	if len(all) == 0 {
+		return
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].mean < all[j].mean })
+	total := 0.0
+	for _, c := range all {
+		total += c.count
+	}
+	merged := make([]centroid, 0, 2*digestCompression)
+	current := all[0]
+	seen := 0.0
+	for _, c := range all[1:] {
+		q := (seen + current.count + c.count/2) / total
+		if current.count+c.count <= 4*total*q*(1-q)/digestCompression {
+			current.mean += (c.mean - current.mean) * c.count / (current.count + c.count)
+			current.count += c.count
+			continue
+		}
+		seen += current.count
+		merged = append(merged, current)
+		current = c
+	}
+	d.centroids = append(merged, current)
+}
+
+// quantile interpola entre os centros dos centroides; os extremos usam min e
+// max exatos.
+func (d *tdigest) quantile(q float64) float64 {
+	d.compress()
+	switch {
+	case q <= 0 || len(d.centroids) == 0:
+		return d.min
+	case q >= 1:
+		return d.max
+	}
+	target := q * d.count
+	seen := 0.0
+	prevMean, prevCenter := d.min, 0.0
+	for _, c := range d.centroids {
+		center := seen + c.count/2
+		if target < center {
+			if center == prevCenter {
+				return c.mean
+			}
+			return prevMean + (c.mean-prevMean)*(target-prevCenter)/(center-prevCenter)
+		}
+		seen += c.count
+		prevMean, prevCenter = c.mean, center
+	}
+	if d.count == prevCenter {
+		return d.max
+	}
+	return prevMean + (d.max-prevMean)*(target-prevCenter)/(d.count-prevCenter)
+}
+
+func (d *tdigest) appendState(buf []byte) []byte {
+	d.compress()
+	buf = binary.AppendUvarint(buf, uint64(len(d.centroids)))
+	for _, c := range d.centroids {
+		buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(c.mean))
+		buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(c.count))
+	}
+	buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(d.min))
+	return binary.LittleEndian.AppendUint64(buf, math.Float64bits(d.max))
+}
+
+func (d *tdigest) readState(r *stateReader) {
+	count := r.uvarint()
+	for i := uint64(0); i < count && r.err == nil; i++ {
+		c := centroid{mean: r.float(), count: r.float()}
+		if c.count <= 0 {
+			r.invalid("centroide com peso %v", c.count)
+			return
+		}
+		d.centroids = append(d.centroids, c)
+		d.count += c.count
+	}
+	d.min = r.float()
+	d.max = r.float()
+}
+
+// quantileAccumulator é a base de APPROX_QUANTILES e PERCENTILE_APPROX.
+type quantileAccumulator struct {
+	fn     AggregateFunc
+	digest tdigest
+}
+
+func (a *quantileAccumulator) accumulate(value columnar.Value) error {
+	if _, ok := kindOf(value.Type); !ok {
+		return fmt.Errorf("%s suporta apenas INT, DECIMAL e FLOAT, recebeu %s", a.fn, value.Type)
+	}
+	a.digest.add(floatValue(value))
+	return nil
+}
+
+func (a *quantileAccumulator) mergeDigest(other *quantileAccumulator) error {
+	a.digest.merge(&other.digest)
+	return nil
+}
+
+func (a *quantileAccumulator) appendState(buf []byte) []byte {
+	return a.digest.appendState(buf)
+}
+
+func (a *quantileAccumulator) readState(r *stateReader) {
+	a.digest.readState(r)
+}
+
+// quantilesAccumulator implementa APPROX_QUANTILES(x, n): devolve os n+1
+// limites que dividem os valores em n partes, do mínimo ao máximo.
+type quantilesAccumulator struct {
+	quantileAccumulator
+	buckets int64
+}
+
+func newQuantilesAccumulator(params []columnar.Value) (*quantilesAccumulator, error) {
+	if len(params) != 1 || params[0].Type != columnar.TypeInt {
+		return nil, fmt.Errorf("APPROX_QUANTILES espera o número de quantis (INT) como segundo argumento")
+	}
+	buckets, _ := params[0].AsInt()
+	if buckets < 1 || buckets > 1000 {
+		return nil, fmt.Errorf("APPROX_QUANTILES: número de quantis deve estar entre 1 e 1000, recebeu %d", buckets)
+	}
+	return &quantilesAccumulator{
+		quantileAccumulator: quantileAccumulator{fn: AggregateApproxQuantiles},
+		buckets:             buckets,
+	}, nil
+}
+
+func (a *quantilesAccumulator) merge(other aggAccumulator) error {
+	return a.mergeDigest(&other.(*quantilesAccumulator).quantileAccumulator)
+}
+
+func (a *quantilesAccumulator) result() columnar.Value {
+	return columnar.NewNullValue(columnar.TypeFloat)
+}
+
+func (a *quantilesAccumulator) list() []columnar.Value {
+	if a.digest.count == 0 {
+		return nil
+	}
+	out := make([]columnar.Value, 0, a.buckets+1)
+	for i := int64(0); i <= a.buckets; i++ {
+		out = append(out, columnar.NewFloatValue(a.digest.quantile(float64(i)/float64(a.buckets))))
+	}
+	return out
+}
+
+// percentileAccumulator implementa PERCENTILE_APPROX(x, p), com p entre 0 e 1.
+type percentileAccumulator struct {
+	quantileAccumulator
+	percentile float64
+}
+
+func newPercentileAccumulator(params []columnar.Value) (*percentileAccumulator, error) {
+	if len(params) != 1 {
+		return nil, fmt.Errorf("PERCENTILE_APPROX espera o percentil como segundo argumento")
+	}
+	if _, ok := kindOf(params[0].Type); !ok || params[0].IsNull() {
+		return nil, fmt.Errorf("PERCENTILE_APPROX: percentil deve ser numérico, recebeu %s", params[0].Type)
+	}
+	p := floatValue(params[0])
+	if p < 0 || p > 1 {
+		return nil, fmt.Errorf("PERCENTILE_APPROX: percentil deve estar entre 0 e 1, recebeu %v", p)
+	}
+	return &percentileAccumulator{
+		quantileAccumulator: quantileAccumulator{fn: AggregatePercentileApprox},
+		percentile:          p,
+	}, nil
+}
+
+func (a *percentileAccumulator) merge(other aggAccumulator) error {
+	return a.mergeDigest(&other.(*percentileAccumulator).quantileAccumulator)
+}
+
+func (a *percentileAccumulator) result() columnar.Value {
+	if a.digest.count == 0 {
+		return columnar.NewNullValue(columnar.TypeFloat)
+	}
+	return columnar.NewFloatValue(a.digest.quantile(a.percentile))
+}
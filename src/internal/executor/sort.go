@@ -1,168 +1,583 @@
 package executor
 
 import (
+	"bufio"
+	"bytes"
+	"container/heap"
+	"errors"
+	"fmt"
+	"io"
+	"os"
 	"sort"
 
 	"github.com/Jonatan852/distributed-query-processing/pkg/columnar"
 )
 
-// SortKey define cada coluna usada na ordenação.
+// SortKey define cada chave da ordenação. Value, quando presente, calcula a
+// chave a partir da linha (ORDER BY sobre expressões) no lugar de Column.
 type SortKey struct {
 	Column    string
 	Ascending bool
+	Value     ValueFunc
 }
 
-// SortExecutor agrega todas as linhas em memória e ordena antes de devolver batches.
+// SortConfig ajusta o SortExecutor. Com MemoryLimit > 0 e SpillDir informado o
+// sort é externo: quando os batches acumulados passam de MemoryLimit bytes
+// (estimados), eles são ordenados e gravados como um run em SpillDir, e no fim
+// os runs são intercalados (k-way merge). Sem isso tudo é ordenado em memória.
+// Memory, quando presente, recebe as reservas do buffer: se o orçamento da
+// query acabar, o buffer vai para disco (com SpillDir) ou o sort falha com
+// ErrMemoryLimitExceeded.
+type SortConfig struct {
+	BatchSize   int
+	MemoryLimit int64
+	SpillDir    string
+	Memory      *MemoryTracker
+}
+
+// SortExecutor acumula as linhas do filho (em forma colunar) e as devolve
+// ordenadas em batches de BatchSize linhas.
 type SortExecutor struct {
-	child     Executor
-	keys      []SortKey
-	buffer    *Batch
-	emitted   bool
-	batchSize int
+	child  Executor
+	keys   []SortKey
+	config SortConfig
+
+	loaded bool
+	// columns é a união das colunas vistas, na ordem de chegada; batches sem
+	// alguma delas completam com NULL
+	columns []sortColumn
+	indexes map[string]int
+	buffer  []*Batch
+	used    int64
+	// reserved é o que o buffer ocupa em config.Memory
+	reserved int64
+
+	memory *sortRun
+	runs   []*spillRun
+	merger *runMerger
+	stats  SpillStats
+}
+
+type sortColumn struct {
+	name string
+	typ  columnar.DataType
 }
 
 func NewSortExecutor(child Executor, keys []SortKey, batchSize int) *SortExecutor {
-	if batchSize <= 0 {
-		batchSize = 1024
+	return NewExternalSortExecutor(child, keys, SortConfig{BatchSize: batchSize})
+}
+
+// NewExternalSortExecutor cria um sort que respeita config.MemoryLimit
+// gravando runs ordenados em config.SpillDir.
+func NewExternalSortExecutor(child Executor, keys []SortKey, config SortConfig) *SortExecutor {
+	if config.BatchSize <= 0 {
+		config.BatchSize = 1024
 	}
 	return &SortExecutor{
-		child:     child,
-		keys:      keys,
-		batchSize: batchSize,
+		child:   child,
+		keys:    keys,
+		config:  config,
+		indexes: map[string]int{},
 	}
 }
 
 func (s *SortExecutor) Next() (*Batch, error) {
-	if s.buffer == nil {
-		if err := s.loadAndSort(); err != nil {
+	if !s.loaded {
+		if err := s.load(); err != nil {
 			return nil, err
 		}
+		s.loaded = true
 	}
-	if s.buffer.RowCount == 0 {
-		return nil, ErrNoMoreBatches
-	}
-	rowsToEmit := min(s.batchSize, s.buffer.RowCount)
-	result := &Batch{
-		Columns:  map[string]*columnar.Column{},
-		RowCount: rowsToEmit,
+	if s.merger != nil {
+		return s.merger.next()
 	}
-	for name, col := range s.buffer.Columns {
-		slice, _ := col.Slice(0, rowsToEmit)
-		result.Columns[name] = slice
+	if s.memory == nil || s.memory.done() {
+		return nil, ErrNoMoreBatches
 	}
-	// Remove linhas emitidas
-	for name, col := range s.buffer.Columns {
-		remaining, _ := col.Slice(rowsToEmit, col.Len())
-		s.buffer.Columns[name] = remaining
+	return s.memory.next(s.config.BatchSize)
+}
+
+// Stats devolve as métricas de spill, publicadas em PlanNode.Stats.
+func (s *SortExecutor) Stats() map[string]int64 {
+	return map[string]int64{
+		"spilledRuns":  s.stats.SpilledFiles,
+		"spilledRows":  s.stats.SpilledRows,
+		"spilledBytes": s.stats.SpilledBytes,
 	}
-	s.buffer.RowCount -= rowsToEmit
-	return result, nil
 }
 
-func (s *SortExecutor) loadAndSort() error {
-	rows := []map[string]columnar.Value{}
+func (s *SortExecutor) load() error {
+	spill := s.config.MemoryLimit > 0 && s.config.SpillDir != ""
+	var err error
 	for {
-		batch, err := s.child.Next()
+		var batch *Batch
+		batch, err = s.child.Next()
 		if err != nil {
 			if err == ErrNoMoreBatches {
 				break
 			}
 			return err
 		}
-		row := batchRow{batch: batch}
-		for i := 0; i < batch.RowCount; i++ {
-			row.index = i
-			record := map[string]columnar.Value{}
-			for name := range batch.Columns {
-				val, _ := row.Value(name)
-				record[name] = val
+		if batch.RowCount == 0 {
+			continue
+		}
+		s.addColumns(batch)
+		bytes := BatchBytes(batch) + int64(batch.RowCount)*sortRowOverhead(len(s.keys))
+		if err := s.reserve(bytes); err != nil {
+			return err
+		}
+		s.buffer = append(s.buffer, batch)
+		s.used += bytes
+		if spill && s.used > s.config.MemoryLimit {
+			if err := s.spill(); err != nil {
+				return err
 			}
-			rows = append(rows, record)
 		}
 	}
-	sort.Slice(rows, func(i, j int) bool {
-		for _, key := range s.keys {
-			left := rows[i][key.Column]
-			right := rows[j][key.Column]
-			comp := compare(left, right)
-			if comp == 0 {
-				continue
-			}
-			if key.Ascending {
-				return comp < 0
+	if s.memory, err = s.sortBuffer(); err != nil {
+		return err
+	}
+	if len(s.runs) == 0 {
+		return nil
+	}
+	// o que sobrou em memória entra no merge como mais um run
+	sources := make([]runSource, 0, len(s.runs)+1)
+	for _, run := range s.runs {
+		if err := run.open(); err != nil {
+			return err
+		}
+		sources = append(sources, run)
+	}
+	sources = append(sources, memorySource{run: s.memory, size: s.config.BatchSize})
+	merger, err := newRunMerger(s, sources)
+	if err != nil {
+		return err
+	}
+	s.merger = merger
+	return nil
+}
+
+func (s *SortExecutor) addColumns(batch *Batch) {
+	names := make([]string, 0, len(batch.Columns))
+	for name := range batch.Columns {
+		if _, ok := s.indexes[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		s.indexes[name] = len(s.columns)
+		s.columns = append(s.columns, sortColumn{name: name, typ: batch.Columns[name].Type})
+	}
+}
+
+// sortBuffer ordena as linhas acumuladas sem copiá-las: só as referências
+// (batch, linha) e os valores das chaves são movidos.
+func (s *SortExecutor) sortBuffer() (*sortRun, error) {
+	run := &sortRun{sorter: s, batches: s.buffer}
+	for b, batch := range s.buffer {
+		for i := 0; i < batch.RowCount; i++ {
+			keys, err := sortKeyValues(s.keys, batch, i)
+			if err != nil {
+				return nil, err
 			}
-			return comp > 0
+			run.rows = append(run.rows, sortRow{batch: b, index: i, keys: keys})
 		}
-		return false
+	}
+	sort.SliceStable(run.rows, func(i, j int) bool {
+		return s.less(run.rows[i].keys, run.rows[j].keys)
 	})
+	s.buffer = nil
+	s.used = 0
+	return run, nil
+}
 
-	if len(rows) == 0 {
-		s.buffer = &Batch{Columns: map[string]*columnar.Column{}, RowCount: 0}
-		return nil
+// reserve reserva bytes em config.Memory; sem espaço, grava o buffer em disco
+// e tenta de novo.
+func (s *SortExecutor) reserve(bytes int64) error {
+	err := s.config.Memory.Reserve(bytes)
+	if err != nil && s.config.SpillDir != "" && len(s.buffer) > 0 {
+		if err = s.spill(); err == nil {
+			err = s.config.Memory.Reserve(bytes)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	s.reserved += bytes
+	return nil
+}
+
+// spill ordena o buffer e grava o run em um arquivo temporário.
+func (s *SortExecutor) spill() error {
+	run, err := s.sortBuffer()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.config.SpillDir, 0o755); err != nil {
+		return err
 	}
-	columns := map[string]*columnar.Column{}
-	for name, val := range rows[0] {
-		columns[name] = columnar.NewColumn(name, val.Type)
+	file, err := os.CreateTemp(s.config.SpillDir, "sort-*.run")
+	if err != nil {
+		return err
 	}
-	for _, row := range rows {
-		for name, val := range row {
-			_ = addColumnData(columns[name], val)
+	spilled := &spillRun{path: file.Name()}
+	// registrado antes de gravar para que Close apague o arquivo mesmo se a
+	// gravação falhar
+	s.runs = append(s.runs, spilled)
+	writer := bufio.NewWriter(file)
+	var buf bytes.Buffer
+	for !run.done() {
+		batch, err := run.next(s.config.BatchSize)
+		if err != nil {
+			file.Close()
+			return err
+		}
+		buf.Reset()
+		if err := EncodeBatch(&buf, batch); err != nil {
+			file.Close()
+			return err
+		}
+		if _, err := writer.Write(buf.Bytes()); err != nil {
+			file.Close()
+			return err
 		}
+		s.stats.SpilledRows += int64(batch.RowCount)
+		s.stats.SpilledBytes += int64(buf.Len())
 	}
-	s.buffer = &Batch{
-		Columns:  columns,
-		RowCount: len(rows),
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	s.stats.SpilledFiles++
+	s.config.Memory.Release(s.reserved)
+	s.reserved = 0
+	return file.Close()
+}
+
+func (s *SortExecutor) less(left, right []columnar.Value) bool {
+	return lessKeys(s.keys, left, right)
+}
+
+// lessKeys indica se a linha com as chaves left vem antes de right.
+func lessKeys(keys []SortKey, left, right []columnar.Value) bool {
+	for k, key := range keys {
+		comp := compare(left[k], right[k])
+		if comp == 0 {
+			continue
+		}
+		if key.Ascending {
+			return comp < 0
+		}
+		return comp > 0
+	}
+	return false
+}
+
+func (s *SortExecutor) newBatch() *Batch {
+	result := &Batch{Columns: make(map[string]*columnar.Column, len(s.columns))}
+	for _, col := range s.columns {
+		result.Columns[col.name] = columnar.NewColumn(col.name, col.typ)
+	}
+	return result
+}
+
+// appendRow copia a linha index de batch para result.
+func (s *SortExecutor) appendRow(result, batch *Batch, index int) error {
+	for _, col := range s.columns {
+		value := columnar.NewNullValue(col.typ)
+		if source, ok := batch.Columns[col.name]; ok {
+			var err error
+			if value, err = source.Get(index); err != nil {
+				return err
+			}
+		}
+		if err := addColumnData(result.Columns[col.name], value); err != nil {
+			return err
+		}
 	}
+	result.RowCount++
 	return nil
 }
 
 func (s *SortExecutor) Close() error {
-	return s.child.Close()
+	var errs []error
+	if s.merger != nil {
+		errs = append(errs, s.merger.close())
+	}
+	for _, run := range s.runs {
+		errs = append(errs, run.remove())
+	}
+	s.runs, s.buffer, s.memory, s.merger = nil, nil, nil, nil
+	s.config.Memory.Release(s.reserved)
+	s.reserved = 0
+	errs = append(errs, s.child.Close())
+	return errors.Join(errs...)
+}
+
+// sortRun são as linhas em memória já ordenadas; next devolve a próxima fatia.
+type sortRun struct {
+	sorter  *SortExecutor
+	batches []*Batch
+	rows    []sortRow
+	pos     int
+}
+
+type sortRow struct {
+	batch int
+	index int
+	keys  []columnar.Value
 }
 
+func (r *sortRun) done() bool {
+	return r.pos >= len(r.rows)
+}
+
+func (r *sortRun) next(size int) (*Batch, error) {
+	result := r.sorter.newBatch()
+	for ; r.pos < len(r.rows) && result.RowCount < size; r.pos++ {
+		row := r.rows[r.pos]
+		if err := r.sorter.appendRow(result, r.batches[row.batch], row.index); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// runSource entrega os batches de um run ordenado, em ordem.
+type runSource interface {
+	next() (*Batch, error)
+	close() error
+}
+
+type memorySource struct {
+	run  *sortRun
+	size int
+}
+
+func (m memorySource) next() (*Batch, error) {
+	if m.run.done() {
+		return nil, ErrNoMoreBatches
+	}
+	return m.run.next(m.size)
+}
+
+func (m memorySource) close() error {
+	return nil
+}
+
+// spillRun é um run gravado em disco com EncodeBatch.
+type spillRun struct {
+	path   string
+	file   *os.File
+	reader *BatchDecoder
+}
+
+func (r *spillRun) open() error {
+	file, err := os.Open(r.path)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	r.file = file
+	r.reader = NewBatchDecoder(file, info.Size())
+	return nil
+}
+
+func (r *spillRun) next() (*Batch, error) {
+	batch, err := r.reader.Decode()
+	if err == io.EOF {
+		return nil, ErrNoMoreBatches
+	}
+	if err != nil {
+		return nil, fmt.Errorf("executor: run %s corrompido: %w", r.path, err)
+	}
+	return batch, nil
+}
+
+func (r *spillRun) close() error {
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file, r.reader = nil, nil
+	return err
+}
+
+// remove fecha e apaga o arquivo do run.
+func (r *spillRun) remove() error {
+	closeErr := r.close()
+	if err := os.Remove(r.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return closeErr
+}
+
+// runMerger intercala os runs com um heap das linhas correntes de cada um.
+type runMerger struct {
+	sorter  *SortExecutor
+	cursors []*runCursor
+	heap    cursorHeap
+}
+
+type runCursor struct {
+	// order desempata chaves iguais pela ordem dos runs (sort estável)
+	order  int
+	source runSource
+	batch  *Batch
+	index  int
+	keys   []columnar.Value
+}
+
+func newRunMerger(sorter *SortExecutor, sources []runSource) (*runMerger, error) {
+	m := &runMerger{sorter: sorter}
+	for i, source := range sources {
+		cursor := &runCursor{order: i, source: source, index: -1}
+		m.cursors = append(m.cursors, cursor)
+		ok, err := m.advance(cursor)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			m.heap.cursors = append(m.heap.cursors, cursor)
+		}
+	}
+	m.heap.less = sorter.less
+	heap.Init(&m.heap)
+	return m, nil
+}
+
+// advance move o cursor para a próxima linha, lendo outro batch do run quando
+// o atual acaba; false indica run esgotado.
+func (m *runMerger) advance(cursor *runCursor) (bool, error) {
+	cursor.index++
+	for cursor.batch == nil || cursor.index >= cursor.batch.RowCount {
+		batch, err := cursor.source.next()
+		if err == ErrNoMoreBatches {
+			cursor.batch = nil
+			return false, cursor.source.close()
+		}
+		if err != nil {
+			return false, err
+		}
+		cursor.batch, cursor.index = batch, 0
+	}
+	keys, err := sortKeyValues(m.sorter.keys, cursor.batch, cursor.index)
+	if err != nil {
+		return false, err
+	}
+	cursor.keys = keys
+	return true, nil
+}
+
+func (m *runMerger) next() (*Batch, error) {
+	if m.heap.Len() == 0 {
+		return nil, ErrNoMoreBatches
+	}
+	result := m.sorter.newBatch()
+	for m.heap.Len() > 0 && result.RowCount < m.sorter.config.BatchSize {
+		cursor := m.heap.cursors[0]
+		if err := m.sorter.appendRow(result, cursor.batch, cursor.index); err != nil {
+			return nil, err
+		}
+		ok, err := m.advance(cursor)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			heap.Fix(&m.heap, 0)
+		} else {
+			heap.Pop(&m.heap)
+		}
+	}
+	return result, nil
+}
+
+func (m *runMerger) close() error {
+	var errs []error
+	for _, cursor := range m.cursors {
+		errs = append(errs, cursor.source.close())
+	}
+	return errors.Join(errs...)
+}
+
+type cursorHeap struct {
+	cursors []*runCursor
+	less    func(left, right []columnar.Value) bool
+}
+
+func (h cursorHeap) Len() int { return len(h.cursors) }
+
+func (h cursorHeap) Less(i, j int) bool {
+	left, right := h.cursors[i], h.cursors[j]
+	if h.less(left.keys, right.keys) {
+		return true
+	}
+	if h.less(right.keys, left.keys) {
+		return false
+	}
+	return left.order < right.order
+}
+
+func (h cursorHeap) Swap(i, j int) { h.cursors[i], h.cursors[j] = h.cursors[j], h.cursors[i] }
+
+func (h *cursorHeap) Push(x any) { h.cursors = append(h.cursors, x.(*runCursor)) }
+
+func (h *cursorHeap) Pop() any {
+	last := h.cursors[len(h.cursors)-1]
+	h.cursors = h.cursors[:len(h.cursors)-1]
+	return last
+}
+
+// sortKeyValues calcula as chaves da linha index; coluna ausente vale NULL.
+func sortKeyValues(keys []SortKey, batch *Batch, index int) ([]columnar.Value, error) {
+	values := make([]columnar.Value, len(keys))
+	for k, key := range keys {
+		if key.Value != nil {
+			value, err := key.Value(batchRow{batch: batch, index: index})
+			if err != nil {
+				return nil, err
+			}
+			values[k] = value
+			continue
+		}
+		if col, ok := batch.Columns[key.Column]; ok {
+			value, err := col.Get(index)
+			if err != nil {
+				return nil, err
+			}
+			values[k] = value
+		}
+	}
+	return values, nil
+}
+
+// sortRowOverhead estima os bytes que o sort mantém por linha além dos dados
+// (referência e valores das chaves).
+func sortRowOverhead(keys int) int64 {
+	return 24 + 32*int64(keys)
+}
+
+// compare ordena valores comparáveis (ver columnar.Compare); NULL fica depois de qualquer valor
+// (NULLS LAST em ordem ascendente).
 func compare(left, right columnar.Value) int {
-	switch left.Type {
-	case columnar.TypeInt:
-		l, _ := left.AsInt()
-		r, _ := right.AsInt()
+	if left.IsNull() || right.IsNull() {
 		switch {
-		case l < r:
-			return -1
-		case l > r:
-			return 1
-		default:
+		case left.IsNull() && right.IsNull():
 			return 0
-		}
-	case columnar.TypeFloat:
-		l, _ := left.AsFloat()
-		r, _ := right.AsFloat()
-		switch {
-		case l < r:
-			return -1
-		case l > r:
+		case left.IsNull():
 			return 1
 		default:
-			return 0
-		}
-	case columnar.TypeString:
-		l, _ := left.AsString()
-		r, _ := right.AsString()
-		switch {
-		case l < r:
 			return -1
-		case l > r:
-			return 1
-		default:
-			return 0
 		}
-	default:
-		return 0
 	}
-}
-
-func min(a, b int) int {
-	if a < b {
-		return a
+	order, err := columnar.Compare(left, right)
+	if err != nil {
+		return 0
 	}
-	return b
+	return order
 }
@@ -0,0 +1,244 @@
+package executor
+
+import (
+	"bufio"
+	"bytes"
+	"hash/fnv"
+	"os"
+	"strconv"
+
+	"github.com/Jonatan852/distributed-query-processing/pkg/columnar"
+)
+
+const (
+	// spillFanout é o número de partições em que um operador de hash divide o
+	// estado ao passar do limite de memória.
+	spillFanout = 16
+	// maxSpillDepth limita o reparticionamento recursivo: uma partição que
+	// continua grande nesse nível (ex.: uma única chave muito frequente) é
+	// processada em memória.
+	maxSpillDepth = 4
+)
+
+// HashConfig ajusta os operadores de hash (agregação e join). Com
+// MemoryLimit > 0 e SpillDir informado, o estado que passa de MemoryLimit
+// bytes (estimados) é dividido pelo hash da chave em partições gravadas em
+// SpillDir, processadas uma a uma no fim (grace hash). Sem isso tudo fica em
+// memória. Memory, quando presente, recebe as reservas do estado: se o
+// orçamento da query acabar o operador também passa a gravar partições (com
+// SpillDir) ou falha com ErrMemoryLimitExceeded.
+type HashConfig struct {
+	MemoryLimit int64
+	SpillDir    string
+	Memory      *MemoryTracker
+}
+
+// spills indica se o operador grava partições ao passar de MemoryLimit.
+func (c HashConfig) spills(level int) bool {
+	return c.MemoryLimit > 0 && c.canSpill(level)
+}
+
+// canSpill indica se o operador pode gravar partições quando Memory recusa
+// uma reserva.
+func (c HashConfig) canSpill(level int) bool {
+	return c.SpillDir != "" && level < maxSpillDepth
+}
+
+// SpillStats mede o que um operador gravou em disco.
+type SpillStats struct {
+	SpilledFiles int64
+	SpilledRows  int64
+	SpilledBytes int64
+}
+
+func (s *SpillStats) hashStats() map[string]int64 {
+	return map[string]int64{
+		"spilledPartitions": s.SpilledFiles,
+		"spilledRows":       s.SpilledRows,
+		"spilledBytes":      s.SpilledBytes,
+	}
+}
+
+// partitionOf escolhe a partição da chave; o nível entra no hash para que uma
+// partição reprocessada se divida de outra forma.
+func partitionOf(key string, level int) int {
+	h := fnv.New64a()
+	h.Write([]byte(strconv.Itoa(level)))
+	h.Write([]byte{0})
+	h.Write([]byte(key))
+	return int(h.Sum64() % spillFanout)
+}
+
+// spillPartitions grava batches em até spillFanout arquivos temporários, um
+// por partição, criados sob demanda.
+type spillPartitions struct {
+	dir     string
+	pattern string
+	stats   *SpillStats
+	runs    []*spillRun
+	files   []*os.File
+	writers []*bufio.Writer
+	buf     bytes.Buffer
+}
+
+func newSpillPartitions(dir, pattern string, stats *SpillStats) *spillPartitions {
+	return &spillPartitions{
+		dir:     dir,
+		pattern: pattern,
+		stats:   stats,
+		runs:    make([]*spillRun, spillFanout),
+		files:   make([]*os.File, spillFanout),
+		writers: make([]*bufio.Writer, spillFanout),
+	}
+}
+
+// write acrescenta o batch ao arquivo da partição.
+func (p *spillPartitions) write(partition int, batch *Batch) error {
+	if batch.RowCount == 0 {
+		return nil
+	}
+	if p.writers[partition] == nil {
+		if err := os.MkdirAll(p.dir, 0o755); err != nil {
+			return err
+		}
+		file, err := os.CreateTemp(p.dir, p.pattern)
+		if err != nil {
+			return err
+		}
+		p.runs[partition] = &spillRun{path: file.Name()}
+		p.files[partition] = file
+		p.writers[partition] = bufio.NewWriter(file)
+		p.stats.SpilledFiles++
+	}
+	p.buf.Reset()
+	if err := EncodeBatch(&p.buf, batch); err != nil {
+		return err
+	}
+	if _, err := p.writers[partition].Write(p.buf.Bytes()); err != nil {
+		return err
+	}
+	p.stats.SpilledRows += int64(batch.RowCount)
+	p.stats.SpilledBytes += int64(p.buf.Len())
+	return nil
+}
+
+// writeRows distribui as linhas do batch: rows[p] são as posições que vão
+// para a partição p.
+func (p *spillPartitions) writeRows(batch *Batch, rows [][]int) error {
+	for partition, indexes := range rows {
+		if len(indexes) == 0 {
+			continue
+		}
+		part, err := takeRows(batch, indexes)
+		if err != nil {
+			return err
+		}
+		if err := p.write(partition, part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// finish descarrega e fecha os arquivos; depois disso as partições podem ser
+// lidas com scan.
+func (p *spillPartitions) finish() error {
+	for i, writer := range p.writers {
+		if writer == nil {
+			continue
+		}
+		err := writer.Flush()
+		if closeErr := p.files[i].Close(); err == nil {
+			err = closeErr
+		}
+		p.writers[i], p.files[i] = nil, nil
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scan lê a partição como um executor que apaga o arquivo ao ser fechado; uma
+// partição sem linhas não devolve nenhum batch.
+func (p *spillPartitions) scan(partition int) *spillScan {
+	return &spillScan{run: p.runs[partition]}
+}
+
+func (p *spillPartitions) empty(partition int) bool {
+	return p.runs[partition] == nil
+}
+
+// remove fecha e apaga todos os arquivos que ainda existirem.
+func (p *spillPartitions) remove() error {
+	var first error
+	for i, run := range p.runs {
+		if run == nil {
+			continue
+		}
+		if p.files[i] != nil {
+			p.files[i].Close()
+			p.writers[i], p.files[i] = nil, nil
+		}
+		if err := run.remove(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// spillScan devolve os batches de uma partição gravada.
+type spillScan struct {
+	run *spillRun
+}
+
+func (s *spillScan) Next() (*Batch, error) {
+	if s.run == nil {
+		return nil, ErrNoMoreBatches
+	}
+	if s.run.reader == nil {
+		if err := s.run.open(); err != nil {
+			return nil, err
+		}
+	}
+	return s.run.next()
+}
+
+func (s *spillScan) Close() error {
+	if s.run == nil {
+		return nil
+	}
+	return s.run.remove()
+}
+
+// takeRows copia as linhas indexes do batch (colunas sem campos repetidos).
+func takeRows(batch *Batch, indexes []int) (*Batch, error) {
+	result := &Batch{Columns: make(map[string]*columnar.Column, len(batch.Columns)), RowCount: len(indexes), Meta: batch.Meta}
+	for name, col := range batch.Columns {
+		taken, err := col.Take(indexes)
+		if err != nil {
+			return nil, err
+		}
+		result.Columns[name] = taken
+	}
+	return result, nil
+}
+
+// hasRepeated indica se alguma coluna do batch tem mais entradas que linhas;
+// essas linhas não podem ser redistribuídas entre partições.
+func hasRepeated(batch *Batch) bool {
+	for _, col := range batch.Columns {
+		if col.RepetitionLevels != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// valueBytes estima a memória de um valor guardado pelos operadores.
+func valueBytes(value columnar.Value) int64 {
+	if s, ok := value.Data.(string); ok {
+		return 32 + int64(len(s))
+	}
+	return 32
+}
@@ -0,0 +1,188 @@
+package executor
+
+import (
+	"container/heap"
+	"sort"
+
+	"github.com/Jonatan852/distributed-query-processing/pkg/columnar"
+)
+
+// TopNExecutor devolve as count primeiras linhas do filho na ordem de keys
+// (ORDER BY ... LIMIT) guardando no máximo count linhas: um heap mantém as
+// melhores linhas vistas com a pior no topo, que é trocada quando chega uma
+// linha melhor. Em empates fica a linha que chegou antes, como no sort estável.
+type TopNExecutor struct {
+	child     Executor
+	keys      []SortKey
+	count     int64
+	batchSize int
+
+	loaded  bool
+	columns []sortColumn
+	indexes map[string]int
+	heap    topNHeap
+	rows    []*topNRow
+	pos     int
+}
+
+type topNRow struct {
+	keys []columnar.Value
+	// values segue a ordem de columns no momento em que a linha entrou
+	values []columnar.Value
+	seq    int64
+}
+
+func NewTopNExecutor(child Executor, keys []SortKey, count int64, batchSize int) *TopNExecutor {
+	if batchSize <= 0 {
+		batchSize = 1024
+	}
+	return &TopNExecutor{
+		child:     child,
+		keys:      keys,
+		count:     count,
+		batchSize: batchSize,
+		indexes:   map[string]int{},
+		heap:      topNHeap{keys: keys},
+	}
+}
+
+func (t *TopNExecutor) Next() (*Batch, error) {
+	if !t.loaded {
+		if err := t.load(); err != nil {
+			return nil, err
+		}
+		t.loaded = true
+	}
+	if t.pos >= len(t.rows) {
+		return nil, ErrNoMoreBatches
+	}
+	result := &Batch{Columns: make(map[string]*columnar.Column, len(t.columns))}
+	for _, col := range t.columns {
+		result.Columns[col.name] = columnar.NewColumn(col.name, col.typ)
+	}
+	for ; t.pos < len(t.rows) && result.RowCount < t.batchSize; t.pos++ {
+		row := t.rows[t.pos]
+		for i, col := range t.columns {
+			value := columnar.NewNullValue(col.typ)
+			if i < len(row.values) {
+				value = row.values[i]
+			}
+			if err := addColumnData(result.Columns[col.name], value); err != nil {
+				return nil, err
+			}
+		}
+		result.RowCount++
+	}
+	return result, nil
+}
+
+func (t *TopNExecutor) load() error {
+	if t.count <= 0 {
+		return nil
+	}
+	var seq int64
+	for {
+		batch, err := t.child.Next()
+		if err != nil {
+			if err == ErrNoMoreBatches {
+				break
+			}
+			return err
+		}
+		t.addColumns(batch)
+		for i := 0; i < batch.RowCount; i++ {
+			keys, err := sortKeyValues(t.keys, batch, i)
+			if err != nil {
+				return err
+			}
+			row := &topNRow{keys: keys, seq: seq}
+			seq++
+			full := int64(t.heap.Len()) >= t.count
+			if full && !t.heap.worse(t.heap.rows[0], row) {
+				continue
+			}
+			if row.values, err = t.rowValues(batch, i); err != nil {
+				return err
+			}
+			if full {
+				t.heap.rows[0] = row
+				heap.Fix(&t.heap, 0)
+			} else {
+				heap.Push(&t.heap, row)
+			}
+		}
+	}
+	t.rows = t.heap.rows
+	t.heap.rows = nil
+	sort.Slice(t.rows, func(i, j int) bool {
+		return t.heap.worse(t.rows[j], t.rows[i])
+	})
+	return nil
+}
+
+func (t *TopNExecutor) addColumns(batch *Batch) {
+	names := make([]string, 0, len(batch.Columns))
+	for name := range batch.Columns {
+		if _, ok := t.indexes[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		t.indexes[name] = len(t.columns)
+		t.columns = append(t.columns, sortColumn{name: name, typ: batch.Columns[name].Type})
+	}
+}
+
+func (t *TopNExecutor) rowValues(batch *Batch, index int) ([]columnar.Value, error) {
+	values := make([]columnar.Value, len(t.columns))
+	for i, col := range t.columns {
+		source, ok := batch.Columns[col.name]
+		if !ok {
+			values[i] = columnar.NewNullValue(col.typ)
+			continue
+		}
+		value, err := source.Get(index)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+func (t *TopNExecutor) Close() error {
+	t.rows, t.heap.rows = nil, nil
+	return t.child.Close()
+}
+
+// topNHeap é um heap com a pior linha (a última na ordem final) no topo.
+type topNHeap struct {
+	keys []SortKey
+	rows []*topNRow
+}
+
+// worse indica se a vem depois de b na saída.
+func (h topNHeap) worse(a, b *topNRow) bool {
+	if lessKeys(h.keys, b.keys, a.keys) {
+		return true
+	}
+	if lessKeys(h.keys, a.keys, b.keys) {
+		return false
+	}
+	return a.seq > b.seq
+}
+
+func (h topNHeap) Len() int { return len(h.rows) }
+
+func (h topNHeap) Less(i, j int) bool { return h.worse(h.rows[i], h.rows[j]) }
+
+func (h topNHeap) Swap(i, j int) { h.rows[i], h.rows[j] = h.rows[j], h.rows[i] }
+
+func (h *topNHeap) Push(x any) { h.rows = append(h.rows, x.(*topNRow)) }
+
+func (h *topNHeap) Pop() any {
+	last := h.rows[len(h.rows)-1]
+	h.rows = h.rows[:len(h.rows)-1]
+	return last
+}
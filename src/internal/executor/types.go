@@ -23,6 +23,12 @@ type Executor interface {
 	Close() error
 }
 
+// StatsReporter é implementado por operadores que medem a própria execução
+// (ex.: o spill do sort); os valores são publicados em PlanNode.Stats.
+type StatsReporter interface {
+	Stats() map[string]int64
+}
+
 // RowView permite ler valores durante filtros/joins.
 type RowView interface {
 	Value(column string) (columnar.Value, error)
@@ -31,6 +37,9 @@ type RowView interface {
 // Predicate avalia se uma linha deve ser mantida.
 type Predicate func(RowView) (bool, error)
 
+// ValueFunc calcula um valor a partir da linha (ex.: expressão compilada).
+type ValueFunc func(RowView) (columnar.Value, error)
+
 func cloneColumn(col *columnar.Column) *columnar.Column {
 	if col == nil {
 		return nil
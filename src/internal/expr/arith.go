@@ -0,0 +1,253 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/Jonatan852/distributed-query-processing/pkg/columnar"
+	"github.com/Jonatan852/distributed-query-processing/pkg/query"
+)
+
+// divisionScale é o número de casas extras de uma divisão entre DECIMALs
+const divisionScale = 6
+
+func isArithmetic(op string) bool {
+	switch op {
+	case "+", "-", "*", "/", "%", "DIV", "MOD":
+		return true
+	}
+	return false
+}
+
+func compileArithmetic(op string, e query.BinaryExpr) (Evaluator, error) {
+	left, err := Compile(e.Left)
+	if err != nil {
+		return nil, err
+	}
+	right, err := Compile(e.Right)
+	if err != nil {
+		return nil, err
+	}
+	return func(row Row) (columnar.Value, error) {
+		l, err := left(row)
+		if err != nil {
+			return columnar.Value{}, err
+		}
+		r, err := right(row)
+		if err != nil {
+			return columnar.Value{}, err
+		}
+		return Arithmetic(op, l, r)
+	}, nil
+}
+
+// Arithmetic aplica o operador aos dois valores. INT com INT resulta em INT
+// (exceto "/", que sempre divide em FLOAT; DIV é a divisão inteira), qualquer
+// lado FLOAT promove para FLOAT e DECIMAL com INT ou DECIMAL fica exato. "+"
+// entre STRINGs concatena. NULL em qualquer lado resulta em NULL.
+func Arithmetic(op string, left, right columnar.Value) (columnar.Value, error) {
+	if left.IsNull() || right.IsNull() {
+		return columnar.Value{}, nil
+	}
+	if op == "MOD" {
+		op = "%"
+	}
+	switch {
+	case left.Type == columnar.TypeString && right.Type == columnar.TypeString && op == "+":
+		return columnar.NewStringValue(left.Data.(string) + right.Data.(string)), nil
+	case !isNumber(left.Type) || !isNumber(right.Type):
+		return columnar.Value{}, fmt.Errorf("operador %s não suportado entre %s e %s", op, left.Type, right.Type)
+	case left.Type == columnar.TypeFloat || right.Type == columnar.TypeFloat || op == "/" && left.Type == columnar.TypeInt && right.Type == columnar.TypeInt:
+		return floatArithmetic(op, asFloat(left), asFloat(right))
+	case left.Type == columnar.TypeDecimal || right.Type == columnar.TypeDecimal:
+		return decimalArithmetic(op, asDecimal(left), asDecimal(right))
+	default:
+		return intArithmetic(op, left.Data.(int64), right.Data.(int64))
+	}
+}
+
+func intArithmetic(op string, l, r int64) (columnar.Value, error) {
+	var result int64
+	switch op {
+	case "+":
+		result = l + r
+		if (result > l) != (r > 0) {
+			return columnar.Value{}, errIntOverflow(op)
+		}
+	case "-":
+		result = l - r
+		if (result < l) != (r > 0) {
+			return columnar.Value{}, errIntOverflow(op)
+		}
+	case "*":
+		if l != 0 && r != 0 {
+			result = l * r
+			if result/r != l || (l == -1 && r == math.MinInt64) || (r == -1 && l == math.MinInt64) {
+				return columnar.Value{}, errIntOverflow(op)
+			}
+		}
+	case "DIV", "%":
+		if r == 0 {
+			return columnar.Value{}, fmt.Errorf("divisão por zero")
+		}
+		if op == "%" {
+			result = l % r
+		} else if l == math.MinInt64 && r == -1 {
+			return columnar.Value{}, errIntOverflow(op)
+		} else {
+			result = l / r
+		}
+	default:
+		return columnar.Value{}, fmt.Errorf("operador %s não suportado", op)
+	}
+	return columnar.NewIntValue(result), nil
+}
+
+func floatArithmetic(op string, l, r float64) (columnar.Value, error) {
+	switch op {
+	case "+":
+		return columnar.NewFloatValue(l + r), nil
+	case "-":
+		return columnar.NewFloatValue(l - r), nil
+	case "*":
+		return columnar.NewFloatValue(l * r), nil
+	case "/", "%", "DIV":
+		if r == 0 {
+			return columnar.Value{}, fmt.Errorf("divisão por zero")
+		}
+		switch op {
+		case "%":
+			return columnar.NewFloatValue(math.Mod(l, r)), nil
+		case "DIV":
+			quotient := math.Trunc(l / r)
+			if quotient > math.MaxInt64 || quotient < math.MinInt64 {
+				return columnar.Value{}, errIntOverflow(op)
+			}
+			return columnar.NewIntValue(int64(quotient)), nil
+		}
+		return columnar.NewFloatValue(l / r), nil
+	default:
+		return columnar.Value{}, fmt.Errorf("operador %s não suportado", op)
+	}
+}
+
+func decimalArithmetic(op string, l, r columnar.Decimal) (columnar.Value, error) {
+	var (
+		result columnar.Decimal
+		err    error
+	)
+	switch op {
+	case "+":
+		result, err = l.Add(r)
+	case "-":
+		result, err = l.Sub(r)
+	case "*":
+		result, err = l.Mul(r)
+	case "/":
+		if r.Unscaled == 0 {
+			return columnar.Value{}, fmt.Errorf("divisão por zero")
+		}
+		result, err = l.Quo(r, min(max(l.Scale, r.Scale)+divisionScale, columnar.MaxDecimalScale))
+	case "DIV":
+		if r.Unscaled == 0 {
+			return columnar.Value{}, fmt.Errorf("divisão por zero")
+		}
+		// descontado o resto, a divisão é exata
+		if result, err = l.Mod(r); err == nil {
+			if result, err = l.Sub(result); err == nil {
+				result, err = result.Quo(r, 0)
+			}
+		}
+		if err == nil {
+			return columnar.NewIntValue(result.Unscaled), nil
+		}
+	case "%":
+		if r.Unscaled == 0 {
+			return columnar.Value{}, fmt.Errorf("divisão por zero")
+		}
+		result, err = l.Mod(r)
+	default:
+		return columnar.Value{}, fmt.Errorf("operador %s não suportado", op)
+	}
+	if err != nil {
+		return columnar.Value{}, fmt.Errorf("operador %s: %w", op, err)
+	}
+	return columnar.NewDecimalValue(result), nil
+}
+
+// compileNegate compila o menos unário; NULL continua NULL.
+func compileNegate(e query.UnaryExpr) (Evaluator, error) {
+	inner, err := Compile(e.Expr)
+	if err != nil {
+		return nil, err
+	}
+	return func(row Row) (columnar.Value, error) {
+		value, err := inner(row)
+		if err != nil || value.IsNull() {
+			return value, err
+		}
+		switch value.Type {
+		case columnar.TypeInt:
+			i := value.Data.(int64)
+			if i == math.MinInt64 {
+				return columnar.Value{}, errIntOverflow("-")
+			}
+			return columnar.NewIntValue(-i), nil
+		case columnar.TypeFloat:
+			return columnar.NewFloatValue(-value.Data.(float64)), nil
+		case columnar.TypeDecimal:
+			d, err := value.Data.(columnar.Decimal).Neg()
+			if err != nil {
+				return columnar.Value{}, err
+			}
+			return columnar.NewDecimalValue(d), nil
+		default:
+			return columnar.Value{}, fmt.Errorf("menos unário não suportado para %s", value.Type)
+		}
+	}, nil
+}
+
+// compileBoolean avalia uma condição como valor BOOL (UNKNOWN vira NULL),
+// permitindo projeções como SELECT value > 10 AS alto.
+func compileBoolean(e query.Expression) (Evaluator, error) {
+	cond, err := compileCondition(e)
+	if err != nil {
+		return nil, err
+	}
+	return func(row Row) (columnar.Value, error) {
+		t, err := cond(row)
+		if err != nil {
+			return columnar.Value{}, err
+		}
+		if t == truthUnknown {
+			return columnar.NewNullValue(columnar.TypeBool), nil
+		}
+		return columnar.NewBoolValue(t == truthTrue), nil
+	}, nil
+}
+
+func isNumber(dt columnar.DataType) bool {
+	return dt == columnar.TypeInt || dt == columnar.TypeFloat || dt == columnar.TypeDecimal
+}
+
+func asFloat(v columnar.Value) float64 {
+	switch v.Type {
+	case columnar.TypeInt:
+		return float64(v.Data.(int64))
+	case columnar.TypeDecimal:
+		return v.Data.(columnar.Decimal).Float64()
+	default:
+		return v.Data.(float64)
+	}
+}
+
+func asDecimal(v columnar.Value) columnar.Decimal {
+	if v.Type == columnar.TypeInt {
+		return columnar.NewDecimal(v.Data.(int64), 0)
+	}
+	return v.Data.(columnar.Decimal)
+}
+
+func errIntOverflow(op string) error {
+	return fmt.Errorf("overflow de INT no operador %s", op)
+}
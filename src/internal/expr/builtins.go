@@ -0,0 +1,401 @@
+package expr
+
+import (
+	"math"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Jonatan852/distributed-query-processing/pkg/columnar"
+)
+
+// Biblioteca inicial de funções. As agregações só são registradas aqui para
+// que planner e runner as reconheçam; o cálculo fica no executor.
+func init() {
+	for _, name := range []string{
+		"COUNT", "SUM", "MIN", "MAX", "AVG",
+		"STDDEV", "STDDEV_SAMP", "STDDEV_POP", "VARIANCE", "VAR_SAMP", "VAR_POP",
+		"APPROX_COUNT_DISTINCT", "ANY_VALUE", "ARRAY_AGG",
+	} {
+		RegisterFunction(Function{Name: name, Kind: FunctionAggregate, MinArgs: 1, MaxArgs: 1})
+	}
+	// o segundo argumento é um parâmetro constante
+	RegisterFunction(Function{Name: "APPROX_QUANTILES", Kind: FunctionAggregate, MinArgs: 2, MaxArgs: 2})
+	RegisterFunction(Function{Name: "PERCENTILE_APPROX", Kind: FunctionAggregate, MinArgs: 2, MaxArgs: 2})
+	RegisterFunction(Function{Name: "STRING_AGG", Kind: FunctionAggregate, MinArgs: 1, MaxArgs: 2})
+
+	// texto
+	RegisterFunction(Function{Name: "LOWER", MinArgs: 1, MaxArgs: 1, Eval: stringFunc("LOWER", strings.ToLower)})
+	RegisterFunction(Function{Name: "UPPER", MinArgs: 1, MaxArgs: 1, Eval: stringFunc("UPPER", strings.ToUpper)})
+	RegisterFunction(Function{Name: "TRIM", MinArgs: 1, MaxArgs: 1, Eval: stringFunc("TRIM", strings.TrimSpace)})
+	RegisterFunction(Function{Name: "LTRIM", MinArgs: 1, MaxArgs: 1, Eval: stringFunc("LTRIM", func(s string) string {
+		return strings.TrimLeft(s, " \t\r\n")
+	})})
+	RegisterFunction(Function{Name: "RTRIM", MinArgs: 1, MaxArgs: 1, Eval: stringFunc("RTRIM", func(s string) string {
+		return strings.TrimRight(s, " \t\r\n")
+	})})
+	RegisterFunction(Function{Name: "LENGTH", MinArgs: 1, MaxArgs: 1, Eval: length("LENGTH")})
+	RegisterFunction(Function{Name: "CHAR_LENGTH", MinArgs: 1, MaxArgs: 1, Eval: length("CHAR_LENGTH")})
+	RegisterFunction(Function{Name: "SUBSTR", MinArgs: 2, MaxArgs: 3, Eval: substr("SUBSTR")})
+	RegisterFunction(Function{Name: "SUBSTRING", MinArgs: 2, MaxArgs: 3, Eval: substr("SUBSTRING")})
+	RegisterFunction(Function{Name: "CONCAT", MinArgs: 1, MaxArgs: Variadic, Eval: concat})
+
+	// matemática
+	RegisterFunction(Function{Name: "ABS", MinArgs: 1, MaxArgs: 1, Eval: abs})
+	RegisterFunction(Function{Name: "ROUND", MinArgs: 1, MaxArgs: 2, Eval: round})
+	RegisterFunction(Function{Name: "FLOOR", MinArgs: 1, MaxArgs: 1, Eval: floorCeil("FLOOR", math.Floor)})
+	RegisterFunction(Function{Name: "CEIL", MinArgs: 1, MaxArgs: 1, Eval: floorCeil("CEIL", math.Ceil)})
+	RegisterFunction(Function{Name: "CEILING", MinArgs: 1, MaxArgs: 1, Eval: floorCeil("CEILING", math.Ceil)})
+	RegisterFunction(Function{Name: "MOD", MinArgs: 2, MaxArgs: 2, Eval: func(args []columnar.Value) (columnar.Value, error) {
+		return Arithmetic("%", args[0], args[1])
+	}})
+
+	// condicionais
+	RegisterFunction(Function{Name: "COALESCE", MinArgs: 1, MaxArgs: Variadic, NullSafe: true, Eval: coalesce})
+	RegisterFunction(Function{Name: "NULLIF", MinArgs: 2, MaxArgs: 2, NullSafe: true, Eval: nullIf})
+	RegisterFunction(Function{Name: "IF", MinArgs: 3, MaxArgs: 3, NullSafe: true, Eval: ifFunc})
+
+	// datas
+	for name, unit := range map[string]string{
+		"YEAR": "year", "QUARTER": "quarter", "MONTH": "month", "DAY": "day",
+		"HOUR": "hour", "MINUTE": "minute", "SECOND": "second",
+	} {
+		RegisterFunction(Function{Name: name, MinArgs: 1, MaxArgs: 1, Eval: datePartOf(name, unit)})
+	}
+	RegisterFunction(Function{Name: "DATE_PART", MinArgs: 2, MaxArgs: 2, Eval: datePart})
+	RegisterFunction(Function{Name: "DATE_TRUNC", MinArgs: 2, MaxArgs: 2, Eval: dateTrunc})
+	RegisterFunction(Function{Name: "DATE", MinArgs: 1, MaxArgs: 1, Eval: toDate})
+}
+
+func stringFunc(name string, fn func(string) string) ScalarFunc {
+	return func(args []columnar.Value) (columnar.Value, error) {
+		if args[0].Type != columnar.TypeString {
+			return columnar.Value{}, argumentError(name, 1, "STRING", args[0])
+		}
+		return columnar.NewStringValue(fn(args[0].Data.(string))), nil
+	}
+}
+
+// length conta caracteres, não bytes.
+func length(name string) ScalarFunc {
+	return func(args []columnar.Value) (columnar.Value, error) {
+		if args[0].Type != columnar.TypeString {
+			return columnar.Value{}, argumentError(name, 1, "STRING", args[0])
+		}
+		return columnar.NewIntValue(int64(utf8.RuneCountInString(args[0].Data.(string)))), nil
+	}
+}
+
+// substr segue o MySQL: posições começam em 1, posição negativa conta a partir
+// do fim e posição 0 resulta em texto vazio.
+func substr(name string) ScalarFunc {
+	return func(args []columnar.Value) (columnar.Value, error) {
+		if args[0].Type != columnar.TypeString {
+			return columnar.Value{}, argumentError(name, 1, "STRING", args[0])
+		}
+		if args[1].Type != columnar.TypeInt {
+			return columnar.Value{}, argumentError(name, 2, "INT", args[1])
+		}
+		runes := []rune(args[0].Data.(string))
+		start := args[1].Data.(int64)
+		switch {
+		case start > 0:
+			start--
+		case start < 0:
+			start += int64(len(runes))
+		default:
+			return columnar.NewStringValue(""), nil
+		}
+		if start < 0 || start >= int64(len(runes)) {
+			return columnar.NewStringValue(""), nil
+		}
+		end := int64(len(runes))
+		if len(args) == 3 {
+			if args[2].Type != columnar.TypeInt {
+				return columnar.Value{}, argumentError(name, 3, "INT", args[2])
+			}
+			count := args[2].Data.(int64)
+			if count <= 0 {
+				return columnar.NewStringValue(""), nil
+			}
+			end = min(end, start+count)
+		}
+		return columnar.NewStringValue(string(runes[start:end])), nil
+	}
+}
+
+// concat converte argumentos não textuais com a mesma formatação de String.
+func concat(args []columnar.Value) (columnar.Value, error) {
+	var b strings.Builder
+	for _, arg := range args {
+		b.WriteString(arg.String())
+	}
+	return columnar.NewStringValue(b.String()), nil
+}
+
+func abs(args []columnar.Value) (columnar.Value, error) {
+	v := args[0]
+	switch v.Type {
+	case columnar.TypeInt:
+		i := v.Data.(int64)
+		if i == math.MinInt64 {
+			return columnar.Value{}, errIntOverflow("ABS")
+		}
+		if i < 0 {
+			i = -i
+		}
+		return columnar.NewIntValue(i), nil
+	case columnar.TypeFloat:
+		return columnar.NewFloatValue(math.Abs(v.Data.(float64))), nil
+	case columnar.TypeDecimal:
+		d := v.Data.(columnar.Decimal)
+		if d.Unscaled < 0 {
+			negated, err := d.Neg()
+			if err != nil {
+				return columnar.Value{}, err
+			}
+			d = negated
+		}
+		return columnar.NewDecimalValue(d), nil
+	default:
+		return columnar.Value{}, argumentError("ABS", 1, "numérico", v)
+	}
+}
+
+// round arredonda metade para longe do zero; casas negativas arredondam
+// dezenas, centenas... (apenas INT e FLOAT).
+func round(args []columnar.Value) (columnar.Value, error) {
+	var places int64
+	if len(args) == 2 {
+		if args[1].Type != columnar.TypeInt {
+			return columnar.Value{}, argumentError("ROUND", 2, "INT", args[1])
+		}
+		places = args[1].Data.(int64)
+	}
+	v := args[0]
+	switch v.Type {
+	case columnar.TypeInt:
+		if places >= 0 {
+			return v, nil
+		}
+		if places < -18 {
+			return columnar.NewIntValue(0), nil
+		}
+		unit := int64(math.Pow10(int(-places)))
+		i := v.Data.(int64)
+		rounded := i / unit * unit
+		if rem := i % unit; rem*2 >= unit {
+			rounded += unit
+		} else if rem*2 <= -unit {
+			rounded -= unit
+		}
+		return columnar.NewIntValue(rounded), nil
+	case columnar.TypeFloat:
+		scale := math.Pow10(int(places))
+		return columnar.NewFloatValue(math.Round(v.Data.(float64)*scale) / scale), nil
+	case columnar.TypeDecimal:
+		if places < 0 || places > columnar.MaxDecimalScale {
+			return columnar.Value{}, argumentError("ROUND", 2, "INT entre 0 e 18 para DECIMAL", args[1])
+		}
+		d, err := v.Data.(columnar.Decimal).Rescale(int32(places))
+		if err != nil {
+			return columnar.Value{}, err
+		}
+		return columnar.NewDecimalValue(d), nil
+	default:
+		return columnar.Value{}, argumentError("ROUND", 1, "numérico", v)
+	}
+}
+
+// floorCeil mantém o tipo do argumento; DECIMAL perde as casas.
+func floorCeil(name string, fn func(float64) float64) ScalarFunc {
+	ceil := name != "FLOOR"
+	return func(args []columnar.Value) (columnar.Value, error) {
+		v := args[0]
+		switch v.Type {
+		case columnar.TypeInt:
+			return v, nil
+		case columnar.TypeFloat:
+			return columnar.NewFloatValue(fn(v.Data.(float64))), nil
+		case columnar.TypeDecimal:
+			d := v.Data.(columnar.Decimal)
+			unit := int64(math.Pow10(int(d.Scale)))
+			q, rem := d.Unscaled/unit, d.Unscaled%unit
+			if ceil && rem > 0 {
+				q++
+			} else if !ceil && rem < 0 {
+				q--
+			}
+			return columnar.NewDecimalValue(columnar.NewDecimal(q, 0)), nil
+		default:
+			return columnar.Value{}, argumentError(name, 1, "numérico", v)
+		}
+	}
+}
+
+func coalesce(args []columnar.Value) (columnar.Value, error) {
+	for _, arg := range args {
+		if !arg.IsNull() {
+			return arg, nil
+		}
+	}
+	return columnar.Value{}, nil
+}
+
+func nullIf(args []columnar.Value) (columnar.Value, error) {
+	if args[0].IsNull() || args[1].IsNull() {
+		return args[0], nil
+	}
+	cmp, err := Compare(args[0], args[1])
+	if err != nil {
+		return columnar.Value{}, err
+	}
+	if cmp == 0 {
+		return columnar.NewNullValue(args[0].Type), nil
+	}
+	return args[0], nil
+}
+
+// ifFunc devolve o segundo argumento quando a condição é TRUE e o terceiro
+// quando é FALSE ou NULL. Os dois ramos são avaliados.
+func ifFunc(args []columnar.Value) (columnar.Value, error) {
+	cond := args[0]
+	if cond.IsNull() {
+		return args[2], nil
+	}
+	if cond.Type != columnar.TypeBool {
+		return columnar.Value{}, argumentError("IF", 1, "BOOL", cond)
+	}
+	if cond.Data.(bool) {
+		return args[1], nil
+	}
+	return args[2], nil
+}
+
+func temporalArg(name string, position int, v columnar.Value) (time.Time, error) {
+	if v.Type != columnar.TypeTimestamp && v.Type != columnar.TypeDate {
+		return time.Time{}, argumentError(name, position, "TIMESTAMP ou DATE", v)
+	}
+	return v.Data.(time.Time), nil
+}
+
+func unitArg(name string, v columnar.Value) (string, error) {
+	if v.Type != columnar.TypeString {
+		return "", argumentError(name, 1, "STRING com a unidade", v)
+	}
+	return strings.ToLower(strings.TrimSpace(v.Data.(string))), nil
+}
+
+func datePartOf(name, unit string) ScalarFunc {
+	return func(args []columnar.Value) (columnar.Value, error) {
+		t, err := temporalArg(name, 1, args[0])
+		if err != nil {
+			return columnar.Value{}, err
+		}
+		part, _ := extractPart(unit, t)
+		return columnar.NewIntValue(part), nil
+	}
+}
+
+// datePart implementa DATE_PART('unidade', t); os instantes estão em UTC.
+func datePart(args []columnar.Value) (columnar.Value, error) {
+	unit, err := unitArg("DATE_PART", args[0])
+	if err != nil {
+		return columnar.Value{}, err
+	}
+	t, err := temporalArg("DATE_PART", 2, args[1])
+	if err != nil {
+		return columnar.Value{}, err
+	}
+	part, ok := extractPart(unit, t)
+	if !ok {
+		return columnar.Value{}, errUnknownUnit("DATE_PART", unit)
+	}
+	return columnar.NewIntValue(part), nil
+}
+
+func extractPart(unit string, t time.Time) (int64, bool) {
+	switch unit {
+	case "year":
+		return int64(t.Year()), true
+	case "quarter":
+		return int64(t.Month()-1)/3 + 1, true
+	case "month":
+		return int64(t.Month()), true
+	case "week":
+		_, week := t.ISOWeek()
+		return int64(week), true
+	case "day":
+		return int64(t.Day()), true
+	case "dow":
+		// 0 = domingo
+		return int64(t.Weekday()), true
+	case "doy":
+		return int64(t.YearDay()), true
+	case "hour":
+		return int64(t.Hour()), true
+	case "minute":
+		return int64(t.Minute()), true
+	case "second":
+		return int64(t.Second()), true
+	case "epoch":
+		return t.Unix(), true
+	}
+	return 0, false
+}
+
+// dateTrunc implementa DATE_TRUNC('unidade', t), preservando o tipo de t.
+// Semanas começam na segunda-feira.
+func dateTrunc(args []columnar.Value) (columnar.Value, error) {
+	unit, err := unitArg("DATE_TRUNC", args[0])
+	if err != nil {
+		return columnar.Value{}, err
+	}
+	t, err := temporalArg("DATE_TRUNC", 2, args[1])
+	if err != nil {
+		return columnar.Value{}, err
+	}
+	year, month, day := t.Date()
+	var truncated time.Time
+	switch unit {
+	case "year":
+		truncated = time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+	case "quarter":
+		truncated = time.Date(year, (month-1)/3*3+1, 1, 0, 0, 0, 0, time.UTC)
+	case "month":
+		truncated = time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+	case "week":
+		offset := (int(t.Weekday()) + 6) % 7
+		truncated = time.Date(year, month, day-offset, 0, 0, 0, 0, time.UTC)
+	case "day":
+		truncated = time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	case "hour", "minute", "second":
+		durations := map[string]time.Duration{"hour": time.Hour, "minute": time.Minute, "second": time.Second}
+		truncated = t.Truncate(durations[unit])
+	default:
+		return columnar.Value{}, errUnknownUnit("DATE_TRUNC", unit)
+	}
+	if args[1].Type == columnar.TypeDate {
+		return columnar.NewDateValue(truncated), nil
+	}
+	return columnar.NewTimestampValue(truncated), nil
+}
+
+// toDate converte TIMESTAMP (dia em UTC) ou texto ISO para DATE.
+func toDate(args []columnar.Value) (columnar.Value, error) {
+	v := args[0]
+	switch v.Type {
+	case columnar.TypeDate:
+		return v, nil
+	case columnar.TypeTimestamp:
+		return columnar.NewDateValue(v.Data.(time.Time)), nil
+	case columnar.TypeString:
+		return columnar.ParseValue(columnar.TypeDate, v.Data.(string))
+	default:
+		return columnar.Value{}, argumentError("DATE", 1, "TIMESTAMP, DATE ou STRING", v)
+	}
+}
+
+func errUnknownUnit(name, unit string) error {
+	return argumentErrorf(name, "unidade %q desconhecida (use year, quarter, month, week, day, hour, minute ou second)", unit)
+}
@@ -0,0 +1,416 @@
+package expr
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Jonatan852/distributed-query-processing/internal/storage"
+	"github.com/Jonatan852/distributed-query-processing/pkg/columnar"
+	"github.com/Jonatan852/distributed-query-processing/pkg/query"
+)
+
+// Evaluator é uma expressão escalar compilada.
+type Evaluator func(Row) (columnar.Value, error)
+
+// Predicate é uma expressão booleana compilada.
+type Predicate func(Row) (bool, error)
+
+// Compile transforma a expressão em closures: operadores e literais são
+// resolvidos uma única vez, e não a cada linha avaliada.
+func Compile(e query.Expression) (Evaluator, error) {
+	switch e := e.(type) {
+	case query.ColumnRef:
+		return func(row Row) (columnar.Value, error) {
+			return row.Column(e)
+		}, nil
+	case query.Literal:
+		value := e.Value
+		return func(Row) (columnar.Value, error) {
+			return value, nil
+		}, nil
+	case query.NullLiteral:
+		// NULL literal não tem tipo: Data nil basta para IsNull
+		return func(Row) (columnar.Value, error) {
+			return columnar.Value{}, nil
+		}, nil
+	case query.BinaryExpr:
+		if op := strings.ToUpper(e.Operator); isArithmetic(op) {
+			return compileArithmetic(op, e)
+		}
+		return compileBoolean(e)
+	case query.UnaryExpr:
+		switch e.Operator {
+		case "-":
+			return compileNegate(e)
+		case "+":
+			return Compile(e.Expr)
+		}
+		return compileBoolean(e)
+	case query.BetweenExpr, query.InExpr:
+		return compileBoolean(e)
+	case query.FunctionCall:
+		return compileFunction(e)
+	default:
+		return nil, fmt.Errorf("expressão %T não suportada", e)
+	}
+}
+
+// truth é o resultado de uma condição na lógica de três valores do SQL:
+// comparações envolvendo NULL resultam em unknown.
+type truth int8
+
+const (
+	truthFalse truth = iota
+	truthTrue
+	truthUnknown
+)
+
+func truthOf(b bool) truth {
+	if b {
+		return truthTrue
+	}
+	return truthFalse
+}
+
+func (t truth) not() truth {
+	switch t {
+	case truthTrue:
+		return truthFalse
+	case truthFalse:
+		return truthTrue
+	default:
+		return truthUnknown
+	}
+}
+
+// and segue a tabela do SQL: FALSE domina, depois UNKNOWN.
+func (t truth) and(other truth) truth {
+	if t == truthFalse || other == truthFalse {
+		return truthFalse
+	}
+	if t == truthUnknown || other == truthUnknown {
+		return truthUnknown
+	}
+	return truthTrue
+}
+
+type condition func(Row) (truth, error)
+
+// CompilePredicate compila uma expressão booleana; expressões nulas viram um
+// predicado sempre verdadeiro. A avaliação segue a lógica de três valores e a
+// linha só passa quando a condição é TRUE (UNKNOWN descarta, como no WHERE).
+func CompilePredicate(e query.Expression) (Predicate, error) {
+	if e == nil {
+		return func(Row) (bool, error) { return true, nil }, nil
+	}
+	cond, err := compileCondition(e)
+	if err != nil {
+		return nil, err
+	}
+	return func(row Row) (bool, error) {
+		t, err := cond(row)
+		return t == truthTrue, err
+	}, nil
+}
+
+func compileCondition(e query.Expression) (condition, error) {
+	switch e := e.(type) {
+	case query.BinaryExpr:
+		op := strings.ToUpper(e.Operator)
+		switch op {
+		case "AND", "OR":
+			left, err := compileCondition(e.Left)
+			if err != nil {
+				return nil, err
+			}
+			right, err := compileCondition(e.Right)
+			if err != nil {
+				return nil, err
+			}
+			// AND para no primeiro falso, OR no primeiro verdadeiro
+			shortCircuit := truthOf(op == "OR")
+			return func(row Row) (truth, error) {
+				l, err := left(row)
+				if err != nil {
+					return truthFalse, err
+				}
+				if l == shortCircuit {
+					return l, nil
+				}
+				r, err := right(row)
+				if err != nil {
+					return truthFalse, err
+				}
+				if op == "OR" {
+					return l.not().and(r.not()).not(), nil
+				}
+				return l.and(r), nil
+			}, nil
+		case "IS", "IS NOT":
+			// IS compara sem propagar NULL: x IS NULL, x IS TRUE...
+			left, err := Compile(e.Left)
+			if err != nil {
+				return nil, err
+			}
+			right, err := Compile(e.Right)
+			if err != nil {
+				return nil, err
+			}
+			negate := op == "IS NOT"
+			return func(row Row) (truth, error) {
+				l, err := left(row)
+				if err != nil {
+					return truthFalse, err
+				}
+				r, err := right(row)
+				if err != nil {
+					return truthFalse, err
+				}
+				same := l.IsNull() && r.IsNull()
+				if !l.IsNull() && !r.IsNull() {
+					cmp, err := Compare(l, r)
+					if err != nil {
+						return truthFalse, err
+					}
+					same = cmp == 0
+				}
+				return truthOf(same != negate), nil
+			}, nil
+		default:
+			if isArithmetic(op) {
+				// aritmética como condição: o resultado precisa ser BOOL
+				return valueCondition(e)
+			}
+			test, err := comparator(e.Operator)
+			if err != nil {
+				return nil, err
+			}
+			left, err := Compile(e.Left)
+			if err != nil {
+				return nil, err
+			}
+			right, err := Compile(e.Right)
+			if err != nil {
+				return nil, err
+			}
+			return func(row Row) (truth, error) {
+				l, err := left(row)
+				if err != nil {
+					return truthFalse, err
+				}
+				r, err := right(row)
+				if err != nil {
+					return truthFalse, err
+				}
+				return compareTruth(l, r, test)
+			}, nil
+		}
+	case query.BetweenExpr:
+		value, err := Compile(e.Expr)
+		if err != nil {
+			return nil, err
+		}
+		lower, err := Compile(e.Lower)
+		if err != nil {
+			return nil, err
+		}
+		upper, err := Compile(e.Upper)
+		if err != nil {
+			return nil, err
+		}
+		not := e.Not
+		atLeast := func(cmp int) bool { return cmp >= 0 }
+		atMost := func(cmp int) bool { return cmp <= 0 }
+		return func(row Row) (truth, error) {
+			val, err := value(row)
+			if err != nil {
+				return truthFalse, err
+			}
+			low, err := lower(row)
+			if err != nil {
+				return truthFalse, err
+			}
+			high, err := upper(row)
+			if err != nil {
+				return truthFalse, err
+			}
+			aboveLow, err := compareTruth(val, low, atLeast)
+			if err != nil {
+				return truthFalse, err
+			}
+			belowHigh, err := compareTruth(val, high, atMost)
+			if err != nil {
+				return truthFalse, err
+			}
+			inside := aboveLow.and(belowHigh)
+			if not {
+				return inside.not(), nil
+			}
+			return inside, nil
+		}, nil
+	case query.InExpr:
+		value, err := Compile(e.Expr)
+		if err != nil {
+			return nil, err
+		}
+		list := make([]Evaluator, 0, len(e.List))
+		for _, item := range e.List {
+			compiled, err := Compile(item)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, compiled)
+		}
+		not := e.Not
+		return func(row Row) (truth, error) {
+			val, err := value(row)
+			if err != nil {
+				return truthFalse, err
+			}
+			if val.IsNull() {
+				return truthUnknown, nil
+			}
+			// sem correspondência, um NULL na lista torna o resultado UNKNOWN
+			result := truthFalse
+			for _, item := range list {
+				candidate, err := item(row)
+				if err != nil {
+					return truthFalse, err
+				}
+				if candidate.IsNull() {
+					result = truthUnknown
+					continue
+				}
+				cmp, err := Compare(val, candidate)
+				if err != nil {
+					return truthFalse, err
+				}
+				if cmp == 0 {
+					result = truthTrue
+					break
+				}
+			}
+			if not {
+				return result.not(), nil
+			}
+			return result, nil
+		}, nil
+	case query.UnaryExpr:
+		if !strings.EqualFold(e.Operator, "NOT") {
+			return valueCondition(e)
+		}
+		inner, err := compileCondition(e.Expr)
+		if err != nil {
+			return nil, err
+		}
+		return func(row Row) (truth, error) {
+			val, err := inner(row)
+			return val.not(), err
+		}, nil
+	default:
+		return valueCondition(e)
+	}
+}
+
+// valueCondition avalia a expressão como valor e interpreta o resultado como
+// booleano (NULL vira UNKNOWN).
+func valueCondition(e query.Expression) (condition, error) {
+	value, err := Compile(e)
+	if err != nil {
+		return nil, err
+	}
+	return func(row Row) (truth, error) {
+		val, err := value(row)
+		if err != nil {
+			return truthFalse, err
+		}
+		if val.IsNull() {
+			return truthUnknown, nil
+		}
+		b, err := valueToBool(val)
+		return truthOf(b), err
+	}, nil
+}
+
+// compareTruth aplica o comparador; qualquer lado NULL resulta em UNKNOWN.
+func compareTruth(left, right columnar.Value, test func(int) bool) (truth, error) {
+	if left.IsNull() || right.IsNull() {
+		return truthUnknown, nil
+	}
+	cmp, err := Compare(left, right)
+	if err != nil {
+		return truthFalse, err
+	}
+	return truthOf(test(cmp)), nil
+}
+
+// ScanFilter compila a expressão como storage.FilterFunc, permitindo que o
+// predicado seja avaliado dentro do loop de scan. Expressões nulas não filtram.
+func ScanFilter(e query.Expression) (storage.FilterFunc, error) {
+	if e == nil {
+		return nil, nil
+	}
+	predicate, err := CompilePredicate(e)
+	if err != nil {
+		return nil, err
+	}
+	return func(row storage.RowView) (bool, error) {
+		return predicate(FromReader(row))
+	}, nil
+}
+
+// ReferencedColumns lista, sem repetição, os nomes das colunas lidas pela
+// expressão (qualificadores de tabela são ignorados).
+func ReferencedColumns(e query.Expression) []string {
+	var names []string
+	seen := map[string]struct{}{}
+	var walk func(query.Expression)
+	walk = func(e query.Expression) {
+		switch e := e.(type) {
+		case query.ColumnRef:
+			if _, ok := seen[e.Name]; !ok {
+				seen[e.Name] = struct{}{}
+				names = append(names, e.Name)
+			}
+		case query.BinaryExpr:
+			walk(e.Left)
+			walk(e.Right)
+		case query.UnaryExpr:
+			walk(e.Expr)
+		case query.BetweenExpr:
+			walk(e.Expr)
+			walk(e.Lower)
+			walk(e.Upper)
+		case query.InExpr:
+			walk(e.Expr)
+			for _, item := range e.List {
+				walk(item)
+			}
+		case query.FunctionCall:
+			for _, arg := range e.Args {
+				walk(arg)
+			}
+		}
+	}
+	walk(e)
+	return names
+}
+
+func comparator(op string) (func(int) bool, error) {
+	switch op {
+	case "=", "==":
+		return func(cmp int) bool { return cmp == 0 }, nil
+	case "!=", "<>":
+		return func(cmp int) bool { return cmp != 0 }, nil
+	case "<":
+		return func(cmp int) bool { return cmp < 0 }, nil
+	case "<=":
+		return func(cmp int) bool { return cmp <= 0 }, nil
+	case ">":
+		return func(cmp int) bool { return cmp > 0 }, nil
+	case ">=":
+		return func(cmp int) bool { return cmp >= 0 }, nil
+	default:
+		return nil, fmt.Errorf("operador %s não suportado", op)
+	}
+}
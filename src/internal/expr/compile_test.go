@@ -0,0 +1,308 @@
+package expr
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Jonatan852/distributed-query-processing/internal/storage"
+	"github.com/Jonatan852/distributed-query-processing/pkg/columnar"
+	"github.com/Jonatan852/distributed-query-processing/pkg/query"
+)
+
+type mapRow map[string]columnar.Value
+
+func (m mapRow) Value(column string) (columnar.Value, error) {
+	return m[column], nil
+}
+
+func TestCompilePredicate(t *testing.T) {
+	// country IN ('BR', 'AR') AND NOT (value BETWEEN 10 AND 20) OR user_id = 7
+	where := query.BinaryExpr{
+		Left: query.BinaryExpr{
+			Left: query.InExpr{
+				Expr: query.ColumnRef{Name: "country"},
+				List: []query.Expression{
+					query.Literal{Value: columnar.NewStringValue("BR")},
+					query.Literal{Value: columnar.NewStringValue("AR")},
+				},
+			},
+			Operator: "AND",
+			Right: query.UnaryExpr{Operator: "NOT", Expr: query.BetweenExpr{
+				Expr:  query.ColumnRef{Name: "value"},
+				Lower: query.Literal{Value: columnar.NewIntValue(10)},
+				Upper: query.Literal{Value: columnar.NewIntValue(20)},
+			}},
+		},
+		Operator: "OR",
+		Right: query.BinaryExpr{
+			Left:     query.ColumnRef{Name: "user_id"},
+			Operator: "=",
+			Right:    query.Literal{Value: columnar.NewIntValue(7)},
+		},
+	}
+	filter, err := ScanFilter(where)
+	if err != nil {
+		t.Fatalf("erro compilando filtro: %v", err)
+	}
+	cases := []struct {
+		row  mapRow
+		want bool
+	}{
+		{mapRow{"country": columnar.NewStringValue("BR"), "value": columnar.NewFloatValue(25), "user_id": columnar.NewIntValue(1)}, true},
+		{mapRow{"country": columnar.NewStringValue("BR"), "value": columnar.NewFloatValue(15), "user_id": columnar.NewIntValue(1)}, false},
+		{mapRow{"country": columnar.NewStringValue("US"), "value": columnar.NewFloatValue(5), "user_id": columnar.NewIntValue(7)}, true},
+		{mapRow{"country": columnar.NewStringValue("US"), "value": columnar.NewFloatValue(5), "user_id": columnar.NewIntValue(8)}, false},
+	}
+	for idx, tc := range cases {
+		got, err := filter(tc.row)
+		if err != nil {
+			t.Fatalf("caso %d: erro avaliando: %v", idx, err)
+		}
+		if got != tc.want {
+			t.Fatalf("caso %d: esperava %v, obteve %v", idx, tc.want, got)
+		}
+	}
+
+	if _, err := CompilePredicate(query.BinaryExpr{Left: query.ColumnRef{Name: "a"}, Operator: "LIKE", Right: query.Literal{Value: columnar.NewStringValue("x")}}); err == nil {
+		t.Fatalf("esperava erro de compilação para operador não suportado")
+	}
+}
+
+func TestPredicatesUseThreeValuedLogic(t *testing.T) {
+	row := mapRow{"country": columnar.NewNullValue(columnar.TypeString), "value": columnar.NewIntValue(5)}
+	country := query.ColumnRef{Name: "country"}
+	br := query.Literal{Value: columnar.NewStringValue("BR")}
+	cases := []struct {
+		name string
+		expr query.Expression
+		want bool
+	}{
+		{"comparação com NULL", query.BinaryExpr{Left: country, Operator: "=", Right: br}, false},
+		{"NOT de UNKNOWN continua UNKNOWN", query.UnaryExpr{Operator: "NOT", Expr: query.BinaryExpr{Left: country, Operator: "=", Right: br}}, false},
+		{"IS NULL", query.BinaryExpr{Left: country, Operator: "IS", Right: query.NullLiteral{}}, true},
+		{"IS NOT NULL", query.BinaryExpr{Left: query.ColumnRef{Name: "value"}, Operator: "IS NOT", Right: query.NullLiteral{}}, true},
+		{"UNKNOWN OR TRUE", query.BinaryExpr{
+			Left:     query.BinaryExpr{Left: country, Operator: "=", Right: br},
+			Operator: "OR",
+			Right:    query.BinaryExpr{Left: query.ColumnRef{Name: "value"}, Operator: ">", Right: query.Literal{Value: columnar.NewIntValue(1)}},
+		}, true},
+		{"NOT IN com NULL na lista", query.InExpr{
+			Expr: query.ColumnRef{Name: "value"},
+			List: []query.Expression{query.Literal{Value: columnar.NewIntValue(1)}, query.NullLiteral{}},
+			Not:  true,
+		}, false},
+	}
+	for _, tc := range cases {
+		got, err := EvalBool(tc.expr, FromReader(row))
+		if err != nil {
+			t.Fatalf("%s: erro avaliando: %v", tc.name, err)
+		}
+		if got != tc.want {
+			t.Fatalf("%s: esperava %v, obteve %v", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestTemporalAndDecimalComparisons(t *testing.T) {
+	ts, err := columnar.ParseValue(columnar.TypeTimestamp, "2025-01-01T12:00:00Z")
+	if err != nil {
+		t.Fatalf("timestamp inválido: %v", err)
+	}
+	row := mapRow{"ts": ts, "amount": columnar.NewDecimalValue(columnar.NewDecimal(1250, 2))}
+	tsCol := query.ColumnRef{Name: "ts"}
+	amount := query.ColumnRef{Name: "amount"}
+	cases := []struct {
+		name string
+		expr query.Expression
+		want bool
+	}{
+		{"timestamp contra string com fuso", query.BinaryExpr{Left: tsCol, Operator: "=", Right: query.Literal{Value: columnar.NewStringValue("2025-01-01T09:00:00-03:00")}}, true},
+		{"timestamp contra date", query.BinaryExpr{Left: tsCol, Operator: ">", Right: query.Literal{Value: columnar.NewDateValue(ts.Data.(time.Time))}}, true},
+		{"decimal contra int", query.BinaryExpr{Left: amount, Operator: ">", Right: query.Literal{Value: columnar.NewIntValue(12)}}, true},
+		{"decimal de escala diferente", query.BinaryExpr{Left: amount, Operator: "=", Right: query.Literal{Value: columnar.NewDecimalValue(columnar.NewDecimal(125, 1))}}, true},
+		{"decimal contra float", query.BetweenExpr{Expr: amount, Lower: query.Literal{Value: columnar.NewFloatValue(12.4)}, Upper: query.Literal{Value: columnar.NewFloatValue(12.6)}}, true},
+	}
+	for _, tc := range cases {
+		got, err := EvalBool(tc.expr, FromReader(row))
+		if err != nil {
+			t.Fatalf("%s: erro avaliando: %v", tc.name, err)
+		}
+		if got != tc.want {
+			t.Fatalf("%s: esperava %v, obteve %v", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestPruningPredicates(t *testing.T) {
+	where := query.BinaryExpr{
+		Left: query.BinaryExpr{
+			Left:     query.Literal{Value: columnar.NewIntValue(10)},
+			Operator: "<",
+			Right:    query.ColumnRef{Name: "USER_ID"},
+		},
+		Operator: "AND",
+		Right: query.BinaryExpr{
+			// != não serve para poda e deve ser ignorado
+			Left:     query.ColumnRef{Name: "country"},
+			Operator: "!=",
+			Right:    query.Literal{Value: columnar.NewStringValue("BR")},
+		},
+	}
+	preds := PruningPredicates(where, func(col query.ColumnRef) (string, bool) {
+		return "user_id", col.Name == "USER_ID"
+	})
+	if len(preds) != 1 {
+		t.Fatalf("esperava 1 predicado de poda, obteve %v", preds)
+	}
+	if preds[0].Column != "user_id" || preds[0].Operator != storage.PruneGreater {
+		t.Fatalf("predicado inesperado: %v", preds[0])
+	}
+}
+
+func TestArithmeticExpressions(t *testing.T) {
+	row := FromReader(mapRow{
+		"qty":    columnar.NewIntValue(7),
+		"price":  columnar.NewFloatValue(2.5),
+		"amount": columnar.NewDecimalValue(columnar.NewDecimal(1050, 2)),
+		"name":   columnar.NewStringValue("ab"),
+		"none":   columnar.NewNullValue(columnar.TypeInt),
+	})
+	col := func(name string) query.Expression { return query.ColumnRef{Name: name} }
+	lit := func(v columnar.Value) query.Expression { return query.Literal{Value: v} }
+	bin := func(l query.Expression, op string, r query.Expression) query.Expression {
+		return query.BinaryExpr{Left: l, Operator: op, Right: r}
+	}
+	cases := []struct {
+		expr query.Expression
+		want string
+		typ  columnar.DataType
+	}{
+		{bin(col("qty"), "+", lit(columnar.NewIntValue(3))), "10", columnar.TypeInt},
+		{bin(col("qty"), "%", lit(columnar.NewIntValue(4))), "3", columnar.TypeInt},
+		{bin(col("qty"), "div", lit(columnar.NewIntValue(2))), "3", columnar.TypeInt},
+		{bin(col("qty"), "/", lit(columnar.NewIntValue(2))), "3.5", columnar.TypeFloat},
+		{bin(col("qty"), "*", col("price")), "17.5", columnar.TypeFloat},
+		{bin(col("amount"), "*", col("qty")), "73.50", columnar.TypeDecimal},
+		{bin(col("amount"), "-", lit(columnar.NewDecimalValue(columnar.NewDecimal(5, 3)))), "10.495", columnar.TypeDecimal},
+		{bin(col("name"), "+", lit(columnar.NewStringValue("c"))), "abc", columnar.TypeString},
+		{query.UnaryExpr{Operator: "-", Expr: col("qty")}, "-7", columnar.TypeInt},
+		{bin(bin(col("qty"), "-", lit(columnar.NewIntValue(2))), ">", lit(columnar.NewIntValue(4))), "true", columnar.TypeBool},
+	}
+	for idx, tc := range cases {
+		got, err := Eval(tc.expr, row)
+		if err != nil {
+			t.Fatalf("caso %d (%s): %v", idx, tc.expr, err)
+		}
+		if got.Type != tc.typ || got.String() != tc.want {
+			t.Fatalf("caso %d (%s): esperava %s %s, obteve %s %s", idx, tc.expr, tc.typ, tc.want, got.Type, got)
+		}
+	}
+
+	if got, err := Eval(bin(col("none"), "+", lit(columnar.NewIntValue(1))), row); err != nil || !got.IsNull() {
+		t.Fatalf("NULL deveria se propagar: %v %v", got, err)
+	}
+	if _, err := Eval(bin(col("qty"), "/", lit(columnar.NewIntValue(0))), row); err == nil {
+		t.Fatalf("divisão por zero deveria falhar")
+	}
+	if _, err := Eval(bin(col("name"), "*", col("qty")), row); err == nil {
+		t.Fatalf("STRING * INT deveria falhar")
+	}
+	// (qty * price) > 15 no WHERE
+	pass, err := EvalBool(bin(bin(col("qty"), "*", col("price")), ">", lit(columnar.NewIntValue(15))), row)
+	if err != nil || !pass {
+		t.Fatalf("predicado aritmético deveria passar: %v %v", pass, err)
+	}
+}
+
+func TestScalarFunctions(t *testing.T) {
+	ts, _ := columnar.ParseTimestamp("2024-05-17T13:45:30Z")
+	row := FromReader(mapRow{
+		"name":   columnar.NewStringValue("  Ágata  "),
+		"qty":    columnar.NewIntValue(-7),
+		"price":  columnar.NewFloatValue(2.345),
+		"amount": columnar.NewDecimalValue(columnar.NewDecimal(-1055, 2)),
+		"ts":     columnar.NewTimestampValue(ts),
+		"day":    columnar.NewDateValue(ts),
+		"none":   columnar.NewNullValue(columnar.TypeString),
+	})
+	col := func(name string) query.Expression { return query.ColumnRef{Name: name} }
+	str := func(s string) query.Expression { return query.Literal{Value: columnar.NewStringValue(s)} }
+	num := func(i int64) query.Expression { return query.Literal{Value: columnar.NewIntValue(i)} }
+	call := func(name string, args ...query.Expression) query.Expression {
+		return query.FunctionCall{Name: name, Args: args}
+	}
+	cases := []struct {
+		expr query.Expression
+		want string
+		typ  columnar.DataType
+	}{
+		{call("upper", call("TRIM", col("name"))), "ÁGATA", columnar.TypeString},
+		{call("LENGTH", col("name")), "9", columnar.TypeInt},
+		{call("SUBSTR", call("TRIM", col("name")), num(2), num(3)), "gat", columnar.TypeString},
+		{call("SUBSTRING", str("abcdef"), num(-2)), "ef", columnar.TypeString},
+		{call("CONCAT", str("q="), col("qty")), "q=-7", columnar.TypeString},
+		{call("ABS", col("qty")), "7", columnar.TypeInt},
+		{call("ABS", col("amount")), "10.55", columnar.TypeDecimal},
+		{call("ROUND", col("price"), num(2)), "2.35", columnar.TypeFloat},
+		{call("ROUND", col("amount"), num(1)), "-10.6", columnar.TypeDecimal},
+		{call("ROUND", num(1250), num(-2)), "1300", columnar.TypeInt},
+		{call("FLOOR", col("amount")), "-11", columnar.TypeDecimal},
+		{call("CEIL", col("price")), "3", columnar.TypeFloat},
+		{call("COALESCE", col("none"), str("x")), "x", columnar.TypeString},
+		{call("NULLIF", col("qty"), num(0)), "-7", columnar.TypeInt},
+		{call("IF", query.BinaryExpr{Left: col("qty"), Operator: "<", Right: num(0)}, str("neg"), str("pos")), "neg", columnar.TypeString},
+		{call("IF", col("none"), num(1), num(2)), "2", columnar.TypeInt},
+		{call("YEAR", col("ts")), "2024", columnar.TypeInt},
+		{call("QUARTER", col("day")), "2", columnar.TypeInt},
+		{call("DATE_PART", str("hour"), col("ts")), "13", columnar.TypeInt},
+		{call("DATE_TRUNC", str("month"), col("ts")), "2024-05-01T00:00:00Z", columnar.TypeTimestamp},
+		{call("DATE_TRUNC", str("week"), col("day")), "2024-05-13", columnar.TypeDate},
+		{call("DATE", col("ts")), "2024-05-17", columnar.TypeDate},
+		{call("MOD", col("qty"), num(4)), "-3", columnar.TypeInt},
+	}
+	for idx, tc := range cases {
+		got, err := Eval(tc.expr, row)
+		if err != nil {
+			t.Fatalf("caso %d (%s): %v", idx, tc.expr, err)
+		}
+		if got.Type != tc.typ || got.String() != tc.want {
+			t.Fatalf("caso %d (%s): esperava %s %s, obteve %s %s", idx, tc.expr, tc.typ, tc.want, got.Type, got)
+		}
+	}
+
+	for _, e := range []query.Expression{call("UPPER", col("none")), call("NULLIF", num(3), num(3))} {
+		if got, err := Eval(e, row); err != nil || !got.IsNull() {
+			t.Fatalf("%s deveria resultar em NULL: %v %v", e, got, err)
+		}
+	}
+	// WHERE LOWER(TRIM(name)) = 'ágata'
+	pass, err := EvalBool(query.BinaryExpr{Left: call("LOWER", call("TRIM", col("name"))), Operator: "=", Right: str("ágata")}, row)
+	if err != nil || !pass {
+		t.Fatalf("predicado com função deveria passar: %v %v", pass, err)
+	}
+
+	failures := []struct {
+		expr query.Expression
+		want string
+	}{
+		{call("NOPE", col("qty")), "desconhecida"},
+		{call("LOWER"), "espera 1 argumento(s), recebeu 0"},
+		{call("SUBSTR", str("a")), "espera de 2 a 3 argumentos"},
+		{call("COALESCE"), "ao menos 1"},
+		{call("UPPER", col("qty")), "argumento 1 deve ser STRING, recebeu INT"},
+		{call("YEAR", col("name")), "TIMESTAMP ou DATE"},
+		{call("DATE_TRUNC", str("decade"), col("ts")), "unidade \"decade\""},
+		{call("SUM", col("qty")), "função agregada SUM"},
+		{query.FunctionCall{Name: "LOWER", Args: []query.Expression{col("name")}, Distinct: true}, "DISTINCT"},
+	}
+	for _, tc := range failures {
+		_, err := Eval(tc.expr, row)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Fatalf("%s: esperava erro com %q, obteve %v", tc.expr, tc.want, err)
+		}
+	}
+	if !IsAggregate(query.FunctionCall{Name: "count"}) || IsAggregate(query.FunctionCall{Name: "LOWER"}) {
+		t.Fatalf("registro deveria distinguir agregações de funções escalares")
+	}
+}
@@ -0,0 +1,82 @@
+package expr
+
+import (
+	"fmt"
+
+	"github.com/Jonatan852/distributed-query-processing/pkg/columnar"
+	"github.com/Jonatan852/distributed-query-processing/pkg/query"
+)
+
+// Row resolve referências de coluna durante a avaliação de expressões.
+type Row interface {
+	Column(ref query.ColumnRef) (columnar.Value, error)
+}
+
+// ValueReader é o contrato de leitura usado por executor.RowView e storage.RowView.
+type ValueReader interface {
+	Value(column string) (columnar.Value, error)
+}
+
+// FromReader adapta um ValueReader (colunas sem qualificador de tabela) para Row.
+// O qualificador é ignorado: fragmentos executados nos workers leem uma única tabela.
+func FromReader(reader ValueReader) Row {
+	return readerRow{reader: reader}
+}
+
+type readerRow struct {
+	reader ValueReader
+}
+
+func (r readerRow) Column(ref query.ColumnRef) (columnar.Value, error) {
+	return r.reader.Value(ref.Name)
+}
+
+// EvalBool avalia uma expressão booleana; expressões nulas são consideradas verdadeiras.
+// Para avaliar a mesma expressão em muitas linhas prefira CompilePredicate.
+func EvalBool(e query.Expression, row Row) (bool, error) {
+	predicate, err := CompilePredicate(e)
+	if err != nil {
+		return false, err
+	}
+	return predicate(row)
+}
+
+// Eval calcula o valor escalar de uma expressão para a linha informada.
+func Eval(e query.Expression, row Row) (columnar.Value, error) {
+	value, err := Compile(e)
+	if err != nil {
+		return columnar.Value{}, err
+	}
+	return value(row)
+}
+
+// Compare compara dois valores escalares, promovendo INT para FLOAT quando necessário
+// (ver columnar.Compare para DECIMAL e tipos temporais).
+// Para ordenação, NULL é igual a NULL e maior que qualquer outro valor; predicados
+// tratam NULL antes de comparar.
+func Compare(left, right columnar.Value) (int, error) {
+	if left.IsNull() || right.IsNull() {
+		switch {
+		case left.IsNull() && right.IsNull():
+			return 0, nil
+		case left.IsNull():
+			return 1, nil
+		default:
+			return -1, nil
+		}
+	}
+	cmp, err := columnar.Compare(left, right)
+	if err != nil {
+		return 0, fmt.Errorf("tipos incompatíveis (%v vs %v)", left.Type, right.Type)
+	}
+	return cmp, nil
+}
+
+func valueToBool(value columnar.Value) (bool, error) {
+	switch value.Type {
+	case columnar.TypeBool:
+		return value.AsBool()
+	default:
+		return false, fmt.Errorf("valor %v não pode ser interpretado como boolean", value.Type)
+	}
+}
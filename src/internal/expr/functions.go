@@ -0,0 +1,180 @@
+package expr
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Jonatan852/distributed-query-processing/pkg/columnar"
+	"github.com/Jonatan852/distributed-query-processing/pkg/query"
+)
+
+// FunctionKind distingue funções escalares (uma saída por linha) de
+// agregações (uma saída por grupo).
+type FunctionKind int
+
+const (
+	FunctionScalar FunctionKind = iota
+	FunctionAggregate
+)
+
+// Variadic marca MaxArgs de funções sem limite de argumentos.
+const Variadic = -1
+
+// ScalarFunc calcula o resultado a partir dos argumentos já avaliados.
+type ScalarFunc func(args []columnar.Value) (columnar.Value, error)
+
+// Function descreve uma entrada do registro de funções.
+type Function struct {
+	Name    string
+	Kind    FunctionKind
+	MinArgs int
+	MaxArgs int
+	// NullSafe indica que a função trata NULLs por conta própria (COALESCE,
+	// IF...); nas demais qualquer argumento NULL resulta em NULL sem chamar Eval.
+	NullSafe bool
+	Eval     ScalarFunc
+}
+
+var functions = map[string]Function{}
+
+// RegisterFunction adiciona (ou substitui) uma função no registro; o nome é
+// normalizado para maiúsculas.
+func RegisterFunction(fn Function) {
+	fn.Name = strings.ToUpper(fn.Name)
+	functions[fn.Name] = fn
+}
+
+// LookupFunction procura a função pelo nome, sem diferenciar maiúsculas.
+func LookupFunction(name string) (Function, bool) {
+	fn, ok := functions[strings.ToUpper(name)]
+	return fn, ok
+}
+
+// FunctionNames lista as funções registradas do tipo informado, em ordem
+// alfabética.
+func FunctionNames(kind FunctionKind) []string {
+	var names []string
+	for name, fn := range functions {
+		if fn.Kind == kind {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// IsAggregate indica se a chamada agrega linhas. Agregações WITHIN RECORD são
+// calculadas dentro de cada linha e não contam.
+func IsAggregate(call query.FunctionCall) bool {
+	if call.WithinRecord {
+		return false
+	}
+	fn, ok := LookupFunction(call.Name)
+	return ok && fn.Kind == FunctionAggregate
+}
+
+// ContainsAggregate indica se a expressão contém alguma agregação, mesmo
+// dentro de outras expressões (SUM(x) * 2).
+func ContainsAggregate(e query.Expression) bool {
+	switch e := e.(type) {
+	case query.FunctionCall:
+		if IsAggregate(e) {
+			return true
+		}
+		for _, arg := range e.Args {
+			if ContainsAggregate(arg) {
+				return true
+			}
+		}
+	case query.BinaryExpr:
+		return ContainsAggregate(e.Left) || ContainsAggregate(e.Right)
+	case query.UnaryExpr:
+		return ContainsAggregate(e.Expr)
+	case query.BetweenExpr:
+		return ContainsAggregate(e.Expr) || ContainsAggregate(e.Lower) || ContainsAggregate(e.Upper)
+	case query.InExpr:
+		if ContainsAggregate(e.Expr) {
+			return true
+		}
+		for _, item := range e.List {
+			if ContainsAggregate(item) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkArity valida o número de argumentos da chamada.
+func (f Function) checkArity(count int) error {
+	switch {
+	case f.MaxArgs == Variadic && count < f.MinArgs:
+		return fmt.Errorf("função %s espera ao menos %d argumento(s), recebeu %d", f.Name, f.MinArgs, count)
+	case f.MaxArgs != Variadic && (count < f.MinArgs || count > f.MaxArgs):
+		if f.MinArgs == f.MaxArgs {
+			return fmt.Errorf("função %s espera %d argumento(s), recebeu %d", f.Name, f.MinArgs, count)
+		}
+		return fmt.Errorf("função %s espera de %d a %d argumentos, recebeu %d", f.Name, f.MinArgs, f.MaxArgs, count)
+	}
+	return nil
+}
+
+// CheckCall valida a chamada contra o registro: a função precisa existir,
+// receber o número certo de argumentos e DISTINCT só vale para agregações.
+func CheckCall(call query.FunctionCall) (Function, error) {
+	fn, ok := LookupFunction(call.Name)
+	if !ok {
+		return Function{}, fmt.Errorf("função %s desconhecida", call.Name)
+	}
+	if call.Distinct && fn.Kind != FunctionAggregate {
+		return Function{}, fmt.Errorf("DISTINCT só é permitido em funções agregadas (%s)", fn.Name)
+	}
+	if err := fn.checkArity(len(call.Args)); err != nil {
+		return Function{}, err
+	}
+	return fn, nil
+}
+
+// compileFunction compila uma chamada de função escalar: nome e aridade são
+// verificados uma vez, os tipos dos argumentos a cada linha.
+func compileFunction(call query.FunctionCall) (Evaluator, error) {
+	fn, err := CheckCall(call)
+	if err != nil {
+		return nil, err
+	}
+	if fn.Kind == FunctionAggregate || call.WithinRecord {
+		return nil, fmt.Errorf("função agregada %s não pode ser usada em expressão escalar", fn.Name)
+	}
+	args := make([]Evaluator, 0, len(call.Args))
+	for _, arg := range call.Args {
+		compiled, err := Compile(arg)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, compiled)
+	}
+	return func(row Row) (columnar.Value, error) {
+		values := make([]columnar.Value, len(args))
+		for i, arg := range args {
+			value, err := arg(row)
+			if err != nil {
+				return columnar.Value{}, err
+			}
+			if value.IsNull() && !fn.NullSafe {
+				return columnar.Value{}, nil
+			}
+			values[i] = value
+		}
+		return fn.Eval(values)
+	}, nil
+}
+
+// argumentError descreve um argumento de tipo inválido.
+func argumentError(name string, position int, expected string, got columnar.Value) error {
+	return fmt.Errorf("função %s: argumento %d deve ser %s, recebeu %s", name, position, expected, got.Type)
+}
+
+func argumentErrorf(name, format string, args ...interface{}) error {
+	return fmt.Errorf("função %s: %s", name, fmt.Sprintf(format, args...))
+}
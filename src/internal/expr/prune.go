@@ -0,0 +1,127 @@
+package expr
+
+import (
+	"strings"
+
+	"github.com/Jonatan852/distributed-query-processing/internal/storage"
+	"github.com/Jonatan852/distributed-query-processing/pkg/columnar"
+	"github.com/Jonatan852/distributed-query-processing/pkg/query"
+)
+
+// ColumnResolver traduz uma referência de coluna para o nome físico usado nas
+// estatísticas das partições; ok=false descarta o predicado.
+type ColumnResolver func(query.ColumnRef) (string, bool)
+
+// PruningPredicates extrai dos conjuntos (AND) da expressão os predicados
+// "coluna op constante" (=, <, <=, >, >=, BETWEEN, IN) que podem ser avaliados
+// contra min/max das partições. Os demais conjuntos são ignorados: a poda é
+// conservadora e o filtro completo continua sendo aplicado no scan.
+func PruningPredicates(e query.Expression, resolve ColumnResolver) []storage.ColumnPredicate {
+	if resolve == nil {
+		resolve = func(col query.ColumnRef) (string, bool) { return col.Name, true }
+	}
+	var result []storage.ColumnPredicate
+	for _, conjunct := range conjuncts(e) {
+		pred, ok := pruningPredicate(conjunct)
+		if !ok {
+			continue
+		}
+		column, ok := resolve(pred.col)
+		if !ok {
+			continue
+		}
+		result = append(result, storage.ColumnPredicate{Column: column, Operator: pred.op, Values: pred.values})
+	}
+	return result
+}
+
+type columnCondition struct {
+	col    query.ColumnRef
+	op     string
+	values []columnar.Value
+}
+
+func pruningPredicate(e query.Expression) (columnCondition, bool) {
+	switch e := e.(type) {
+	case query.BinaryExpr:
+		op := comparisonOperator(e.Operator)
+		col, colOK := e.Left.(query.ColumnRef)
+		lit, litOK := e.Right.(query.Literal)
+		if !colOK || !litOK {
+			// literal à esquerda: 10 < x equivale a x > 10
+			col, colOK = e.Right.(query.ColumnRef)
+			lit, litOK = e.Left.(query.Literal)
+			op = flipComparison(e.Operator)
+		}
+		if !colOK || !litOK || op == "" {
+			return columnCondition{}, false
+		}
+		return columnCondition{col: col, op: op, values: []columnar.Value{lit.Value}}, true
+	case query.BetweenExpr:
+		col, colOK := e.Expr.(query.ColumnRef)
+		lower, lowOK := e.Lower.(query.Literal)
+		upper, upOK := e.Upper.(query.Literal)
+		if e.Not || !colOK || !lowOK || !upOK {
+			return columnCondition{}, false
+		}
+		return columnCondition{col: col, op: storage.PruneBetween, values: []columnar.Value{lower.Value, upper.Value}}, true
+	case query.InExpr:
+		col, colOK := e.Expr.(query.ColumnRef)
+		if e.Not || !colOK {
+			return columnCondition{}, false
+		}
+		values := make([]columnar.Value, 0, len(e.List))
+		for _, item := range e.List {
+			lit, ok := item.(query.Literal)
+			if !ok {
+				return columnCondition{}, false
+			}
+			values = append(values, lit.Value)
+		}
+		return columnCondition{col: col, op: storage.PruneIn, values: values}, true
+	default:
+		return columnCondition{}, false
+	}
+}
+
+// comparisonOperator normaliza os operadores que servem para poda; devolve vazio
+// para os demais (!=, AND, OR...).
+func comparisonOperator(op string) string {
+	switch op {
+	case "=", "==":
+		return storage.PruneEqual
+	case "<", "<=", ">", ">=":
+		return op
+	default:
+		return ""
+	}
+}
+
+// flipComparison inverte o operador quando os operandos trocam de lado; devolve
+// vazio para operadores que não servem para poda.
+func flipComparison(op string) string {
+	switch op {
+	case "=", "==":
+		return storage.PruneEqual
+	case "<":
+		return storage.PruneGreater
+	case "<=":
+		return storage.PruneGreaterEqual
+	case ">":
+		return storage.PruneLess
+	case ">=":
+		return storage.PruneLessEqual
+	default:
+		return ""
+	}
+}
+
+func conjuncts(e query.Expression) []query.Expression {
+	if e == nil {
+		return nil
+	}
+	if bin, ok := e.(query.BinaryExpr); ok && strings.EqualFold(bin.Operator, "AND") {
+		return append(conjuncts(bin.Left), conjuncts(bin.Right)...)
+	}
+	return []query.Expression{e}
+}
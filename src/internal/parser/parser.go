@@ -12,7 +12,7 @@ import (
 
 // Parse converts a SQL string into a SelectStatement AST using sqlparser.
 func Parse(sql string) (*query.SelectStatement, error) {
-	stmt, err := sqlparser.Parse(sql)
+	stmt, err := sqlparser.Parse(rewriteWithinRecord(rewriteFieldPaths(rewriteTypedLiterals(sql))))
 	if err != nil {
 		return nil, fmt.Errorf("erro ao parsear SQL: %w", err)
 	}
@@ -64,6 +64,15 @@ func convertSelect(stmt *sqlparser.Select) (*query.SelectStatement, error) {
 		result.GroupBy = groupBy
 	}
 
+	// Converter HAVING
+	if stmt.Having != nil {
+		having, err := convertExpr(stmt.Having.Expr)
+		if err != nil {
+			return nil, err
+		}
+		result.Having = having
+	}
+
 	// Converter ORDER BY
 	if stmt.OrderBy != nil {
 		orderBy, err := convertOrderBy(stmt.OrderBy)
@@ -336,11 +345,25 @@ func convertExpr(expr sqlparser.Expr) (query.Expression, error) {
 		}, nil
 
 	case *sqlparser.FuncExpr:
+		// Literal tipado reescrito por rewriteTypedLiterals: TIMESTAMP('...')
+		if literal, ok, err := convertTypedLiteral(e); ok {
+			return literal, err
+		}
+		// Agregação WITHIN RECORD reescrita por rewriteWithinRecord
+		if strings.EqualFold(e.Name.String(), "within_record") {
+			return convertWithinRecord(e)
+		}
 		// Chamada de função
 		name := e.Name.String()
 		args := make([]query.Expression, 0, len(e.Exprs))
 		for _, arg := range e.Exprs {
-			if argExpr, ok := arg.(sqlparser.Expr); ok {
+			if aliased, ok := arg.(*sqlparser.AliasedExpr); ok {
+				converted, err := convertExpr(aliased.Expr)
+				if err != nil {
+					return nil, err
+				}
+				args = append(args, converted)
+			} else if argExpr, ok := arg.(sqlparser.Expr); ok {
 				converted, err := convertExpr(argExpr)
 				if err != nil {
 					return nil, err
@@ -369,6 +392,22 @@ func convertExpr(expr sqlparser.Expr) (query.Expression, error) {
 		if err != nil {
 			return nil, err
 		}
+		if e.Operator == sqlparser.InStr || e.Operator == sqlparser.NotInStr {
+			// IN (lista) - o lado direito é uma tupla de valores
+			tuple, ok := e.Right.(sqlparser.ValTuple)
+			if !ok {
+				return nil, fmt.Errorf("IN suporta apenas listas de valores")
+			}
+			list, err := convertExprs(tuple)
+			if err != nil {
+				return nil, err
+			}
+			return query.InExpr{
+				Expr: left,
+				List: list,
+				Not:  e.Operator == sqlparser.NotInStr,
+			}, nil
+		}
 		right, err := convertExpr(e.Right)
 		if err != nil {
 			return nil, err
@@ -463,6 +502,22 @@ func convertExpr(expr sqlparser.Expr) (query.Expression, error) {
 		// Parênteses - apenas converter o conteúdo
 		return convertExpr(e.Expr)
 
+	case *sqlparser.SubstrExpr:
+		// SUBSTR/SUBSTRING têm nó próprio no sqlparser (só aceita coluna
+		// como primeiro argumento)
+		args := []query.Expression{}
+		for _, arg := range []sqlparser.Expr{e.Name, e.From, e.To} {
+			if arg == nil {
+				continue
+			}
+			converted, err := convertExpr(arg)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, converted)
+		}
+		return query.FunctionCall{Name: "SUBSTR", Args: args}, nil
+
 	default:
 		return nil, fmt.Errorf("tipo de expressão não suportado: %T", expr)
 	}
@@ -499,3 +554,228 @@ func convertLiteral(val *sqlparser.SQLVal) (query.Expression, error) {
 		return nil, fmt.Errorf("tipo de literal não suportado: %v", val.Type)
 	}
 }
+
+// typedLiteralTypes são os prefixos aceitos em literais como TIMESTAMP '...'
+var typedLiteralTypes = map[string]columnar.DataType{
+	"TIMESTAMP": columnar.TypeTimestamp,
+	"DATE":      columnar.TypeDate,
+	"DECIMAL":   columnar.TypeDecimal,
+}
+
+// rewriteTypedLiterals troca TIMESTAMP '...' (e DATE/DECIMAL) por
+// TIMESTAMP('...'), forma que o sqlparser aceita como chamada de função.
+// Texto dentro de strings e identificadores entre crases é preservado.
+func rewriteTypedLiterals(sql string) string {
+	var out strings.Builder
+	for i := 0; i < len(sql); {
+		ch := sql[i]
+		switch {
+		case ch == '\'' || ch == '"' || ch == '`':
+			end := quotedEnd(sql, i)
+			out.WriteString(sql[i:end])
+			i = end
+		case isIdentByte(ch):
+			start := i
+			for i < len(sql) && isIdentByte(sql[i]) {
+				i++
+			}
+			word := sql[start:i]
+			out.WriteString(word)
+			if _, ok := typedLiteralTypes[strings.ToUpper(word)]; !ok || (start > 0 && sql[start-1] == '.') {
+				continue
+			}
+			next := skipSpaces(sql, i)
+			if next < len(sql) && sql[next] == '\'' {
+				end := quotedEnd(sql, next)
+				out.WriteString("(" + sql[next:end] + ")")
+				i = end
+			}
+		default:
+			out.WriteByte(ch)
+			i++
+		}
+	}
+	return out.String()
+}
+
+// rewriteFieldPaths envolve em crases caminhos com três ou mais segmentos
+// (payload.device.os ou e.payload.device), que o sqlparser não aceita como
+// coluna. O caminho vira um único identificador resolvido pelo planner.
+func rewriteFieldPaths(sql string) string {
+	var out strings.Builder
+	for i := 0; i < len(sql); {
+		ch := sql[i]
+		switch {
+		case ch == '\'' || ch == '"' || ch == '`':
+			end := quotedEnd(sql, i)
+			out.WriteString(sql[i:end])
+			i = end
+		case isIdentByte(ch):
+			start := i
+			segments := 0
+			for {
+				for i < len(sql) && isIdentByte(sql[i]) {
+					i++
+				}
+				segments++
+				if i+1 < len(sql) && sql[i] == '.' && isIdentByte(sql[i+1]) {
+					i++
+					continue
+				}
+				break
+			}
+			path := sql[start:i]
+			if segments >= 3 && (ch < '0' || ch > '9') {
+				path = "`" + path + "`"
+			}
+			out.WriteString(path)
+		default:
+			out.WriteByte(ch)
+			i++
+		}
+	}
+	return out.String()
+}
+
+// rewriteWithinRecord troca FUNC(...) WITHIN RECORD por
+// within_record(FUNC(...)), já que o sqlparser não conhece a cláusula.
+func rewriteWithinRecord(sql string) string {
+	var out strings.Builder
+	// início (na saída) de cada parêntese aberto por uma chamada, ou -1
+	var calls []int
+	lastCall, lastCallEnd := -1, -1
+	wordStart, wordEnd := -1, -1
+	for i := 0; i < len(sql); {
+		ch := sql[i]
+		switch {
+		case ch == '\'' || ch == '"' || ch == '`':
+			end := quotedEnd(sql, i)
+			out.WriteString(sql[i:end])
+			i = end
+		case isIdentByte(ch):
+			start := i
+			for i < len(sql) && isIdentByte(sql[i]) {
+				i++
+			}
+			word := sql[start:i]
+			if strings.EqualFold(word, "WITHIN") && lastCall >= 0 && trimmedLen(out.String()) == lastCallEnd {
+				next := skipSpaces(sql, i)
+				end := next
+				for end < len(sql) && isIdentByte(sql[end]) {
+					end++
+				}
+				if end > next && strings.EqualFold(sql[next:end], "RECORD") {
+					current := out.String()
+					call := current[lastCall:lastCallEnd]
+					out.Reset()
+					out.WriteString(current[:lastCall] + "within_record(" + call + ")" + current[lastCallEnd:])
+					lastCall, lastCallEnd = -1, -1
+					i = end
+					continue
+				}
+			}
+			wordStart = out.Len()
+			out.WriteString(word)
+			wordEnd = out.Len()
+		case ch == '(':
+			if wordEnd >= 0 && trimmedLen(out.String()) == wordEnd {
+				calls = append(calls, wordStart)
+			} else {
+				calls = append(calls, -1)
+			}
+			out.WriteByte(ch)
+			i++
+		case ch == ')':
+			out.WriteByte(ch)
+			i++
+			lastCall = -1
+			if len(calls) > 0 {
+				lastCall = calls[len(calls)-1]
+				calls = calls[:len(calls)-1]
+			}
+			lastCallEnd = out.Len()
+		default:
+			out.WriteByte(ch)
+			i++
+		}
+	}
+	return out.String()
+}
+
+func skipSpaces(sql string, i int) int {
+	for i < len(sql) && (sql[i] == ' ' || sql[i] == '\t' || sql[i] == '\n' || sql[i] == '\r') {
+		i++
+	}
+	return i
+}
+
+func trimmedLen(s string) int {
+	return len(strings.TrimRight(s, " \t\n\r"))
+}
+
+// quotedEnd retorna a posição logo após o fechamento do texto que começa em
+// start, tratando aspas duplicadas e escapes com barra invertida.
+func quotedEnd(sql string, start int) int {
+	quote := sql[start]
+	for i := start + 1; i < len(sql); i++ {
+		switch sql[i] {
+		case '\\':
+			if quote != '`' {
+				i++
+			}
+		case quote:
+			if i+1 < len(sql) && sql[i+1] == quote {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return len(sql)
+}
+
+func isIdentByte(ch byte) bool {
+	return ch == '_' || ch >= '0' && ch <= '9' || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z'
+}
+
+// convertWithinRecord converte within_record(FUNC(...)) na chamada FUNC
+// marcada como WITHIN RECORD.
+func convertWithinRecord(e *sqlparser.FuncExpr) (query.Expression, error) {
+	if len(e.Exprs) == 1 {
+		if aliased, ok := e.Exprs[0].(*sqlparser.AliasedExpr); ok {
+			if inner, ok := aliased.Expr.(*sqlparser.FuncExpr); ok {
+				converted, err := convertExpr(inner)
+				if err != nil {
+					return nil, err
+				}
+				if call, ok := converted.(query.FunctionCall); ok {
+					call.WithinRecord = true
+					return call, nil
+				}
+			}
+		}
+	}
+	return nil, fmt.Errorf("WITHIN RECORD exige uma função de agregação")
+}
+
+// convertTypedLiteral converte TIMESTAMP('...'), DATE('...') e DECIMAL('...')
+// com um único argumento string em literal do tipo correspondente.
+func convertTypedLiteral(e *sqlparser.FuncExpr) (query.Expression, bool, error) {
+	dt, ok := typedLiteralTypes[strings.ToUpper(e.Name.String())]
+	if !ok || e.Distinct || !e.Qualifier.IsEmpty() || len(e.Exprs) != 1 {
+		return nil, false, nil
+	}
+	aliased, ok := e.Exprs[0].(*sqlparser.AliasedExpr)
+	if !ok {
+		return nil, false, nil
+	}
+	val, ok := aliased.Expr.(*sqlparser.SQLVal)
+	if !ok || val.Type != sqlparser.StrVal {
+		return nil, false, nil
+	}
+	value, err := columnar.ParseValue(dt, string(val.Val))
+	if err != nil {
+		return nil, true, fmt.Errorf("literal %s inválido: %w", dt, err)
+	}
+	return query.Literal{Value: value}, true, nil
+}
@@ -2,7 +2,9 @@ package parser
 
 import (
 	"testing"
+	"time"
 
+	"github.com/Jonatan852/distributed-query-processing/pkg/columnar"
 	"github.com/Jonatan852/distributed-query-processing/pkg/query"
 )
 
@@ -13,6 +15,7 @@ func TestParseSelectStatement(t *testing.T) {
 		LEFT JOIN users u ON e.user_id = u.id
 		WHERE e.ts >= '2025-01-01' AND u.country <> 'BR'
 		GROUP BY e.user_id, u.country
+		HAVING COUNT(*) > 1
 		ORDER BY total DESC
 		LIMIT 100
 	`
@@ -46,6 +49,13 @@ func TestParseSelectStatement(t *testing.T) {
 	if len(stmt.GroupBy) != 2 {
 		t.Fatalf("expected two GROUP BY expressions")
 	}
+	having, ok := stmt.Having.(query.BinaryExpr)
+	if !ok || having.Operator != ">" {
+		t.Fatalf("unexpected HAVING clause %+v", stmt.Having)
+	}
+	if fn, ok := having.Left.(query.FunctionCall); !ok || fn.Name != "COUNT" {
+		t.Fatalf("expected COUNT in HAVING, got %+v", having.Left)
+	}
 	if len(stmt.OrderBy) != 1 || stmt.OrderBy[0].Direction != query.SortDesc {
 		t.Fatalf("unexpected ORDER BY content")
 	}
@@ -73,3 +83,81 @@ func TestParseSimpleSelect(t *testing.T) {
 		t.Fatalf("expected table 'events', got %s", stmt.From[0].Name)
 	}
 }
+
+func TestParseInList(t *testing.T) {
+	stmt, err := Parse("SELECT * FROM events WHERE country IN ('BR', 'US') AND user_id NOT IN (1, 2)")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	where, ok := stmt.Where.(query.BinaryExpr)
+	if !ok {
+		t.Fatalf("expected AND expression, got %T", stmt.Where)
+	}
+	in, ok := where.Left.(query.InExpr)
+	if !ok || in.Not || len(in.List) != 2 {
+		t.Fatalf("expected IN with 2 items, got %+v", where.Left)
+	}
+	notIn, ok := where.Right.(query.InExpr)
+	if !ok || !notIn.Not || len(notIn.List) != 2 {
+		t.Fatalf("expected NOT IN with 2 items, got %+v", where.Right)
+	}
+}
+
+func TestParseTypedLiterals(t *testing.T) {
+	stmt, err := Parse("SELECT * FROM events WHERE ts >= TIMESTAMP '2025-01-01 10:00:00-03:00' AND day = DATE '2025-01-01' AND amount > DECIMAL '12.50' AND note = 'DATE ''x'''")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	var literals []columnar.Value
+	var collect func(query.Expression)
+	collect = func(expr query.Expression) {
+		switch e := expr.(type) {
+		case query.BinaryExpr:
+			collect(e.Left)
+			collect(e.Right)
+		case query.Literal:
+			literals = append(literals, e.Value)
+		}
+	}
+	collect(stmt.Where)
+	if len(literals) != 4 {
+		t.Fatalf("expected 4 literals, got %+v", literals)
+	}
+	ts, err := literals[0].AsTime()
+	if err != nil || literals[0].Type != columnar.TypeTimestamp || !ts.Equal(time.Date(2025, 1, 1, 13, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected timestamp literal %+v", literals[0])
+	}
+	if literals[1].Type != columnar.TypeDate || literals[1].String() != "2025-01-01" {
+		t.Fatalf("unexpected date literal %+v", literals[1])
+	}
+	if literals[2].Type != columnar.TypeDecimal || literals[2].String() != "12.50" {
+		t.Fatalf("unexpected decimal literal %+v", literals[2])
+	}
+	if literals[3].Type != columnar.TypeString || literals[3].String() != "DATE 'x'" {
+		t.Fatalf("string literal was rewritten: %+v", literals[3])
+	}
+}
+
+func TestParseNestedFieldPaths(t *testing.T) {
+	stmt, err := Parse("SELECT e.payload.device.os, payload.device, SUM(scores.value) WITHIN RECORD AS total FROM events e WHERE payload.device.os = 'a.b.c'")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if col, ok := stmt.Columns[0].Expr.(query.ColumnRef); !ok || col.Table != "" || col.Name != "e.payload.device.os" {
+		t.Fatalf("unexpected path %+v", stmt.Columns[0].Expr)
+	}
+	if col, ok := stmt.Columns[1].Expr.(query.ColumnRef); !ok || col.Table != "payload" || col.Name != "device" {
+		t.Fatalf("unexpected two-segment path %+v", stmt.Columns[1].Expr)
+	}
+	fn, ok := stmt.Columns[2].Expr.(query.FunctionCall)
+	if !ok || !fn.WithinRecord || fn.Name != "SUM" || stmt.Columns[2].Alias != "total" {
+		t.Fatalf("expected SUM ... WITHIN RECORD, got %+v", stmt.Columns[2])
+	}
+	if col, ok := fn.Args[0].(query.ColumnRef); !ok || col.Table != "scores" || col.Name != "value" {
+		t.Fatalf("unexpected aggregate argument %+v", fn.Args[0])
+	}
+	where, ok := stmt.Where.(query.BinaryExpr)
+	if !ok || where.Left.(query.ColumnRef).Name != "payload.device.os" || where.Right.(query.Literal).Value.String() != "a.b.c" {
+		t.Fatalf("unexpected WHERE %v", stmt.Where)
+	}
+}
@@ -191,6 +191,7 @@ var keywords = map[string]struct{}{
 	"WHERE":    {},
 	"GROUP":    {},
 	"BY":       {},
+	"HAVING":   {},
 	"ORDER":    {},
 	"LIMIT":    {},
 	"AS":       {},
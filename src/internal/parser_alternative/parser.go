@@ -110,6 +110,14 @@ func (p *parser) parseSelect() (*query.SelectStatement, error) {
 		stmt.GroupBy = groupExprs
 	}
 
+	if p.consumeKeyword("HAVING") {
+		expr, err := p.parseExpression(0)
+		if err != nil {
+			return nil, err
+		}
+		stmt.Having = expr
+	}
+
 	if p.consumeKeyword("ORDER") {
 		if err := p.expectKeyword("BY"); err != nil {
 			return nil, err
@@ -380,6 +388,12 @@ func (p *parser) parseExpression(precedence int) (query.Expression, error) {
 			p.peek.typ == tokenKeyword && p.peek.literal == "BETWEEN":
 			p.nextToken() // consume NOT
 			left, err = p.parseBetween(left, true)
+		case p.cur.typ == tokenKeyword && p.cur.literal == "IN":
+			left, err = p.parseIn(left, false)
+		case p.cur.typ == tokenKeyword && p.cur.literal == "NOT" &&
+			p.peek.typ == tokenKeyword && p.peek.literal == "IN":
+			p.nextToken() // consume NOT
+			left, err = p.parseIn(left, true)
 		default:
 			left, err = p.parseInfix(left)
 		}
@@ -458,15 +472,47 @@ func (p *parser) parseIdentifierExpression() (query.Expression, error) {
 		if p.cur.typ == tokenLParen {
 			return p.parseFunctionCall(first + "." + second)
 		}
-		return query.ColumnRef{Table: first, Name: second}, nil
+		if p.cur.typ != tokenDot {
+			return query.ColumnRef{Table: first, Name: second}, nil
+		}
+		// nested field path (payload.device.os): kept whole and resolved
+		// against the table schema by the planner
+		path := []string{first, second}
+		for p.cur.typ == tokenDot {
+			p.nextToken()
+			if p.cur.typ != tokenIdent {
+				return nil, fmt.Errorf("expected field name after dot")
+			}
+			path = append(path, p.cur.literal)
+			p.nextToken()
+		}
+		return query.ColumnRef{Name: strings.Join(path, ".")}, nil
 	}
 
 	if p.cur.typ == tokenLParen {
 		return p.parseFunctionCall(first)
 	}
+	if p.cur.typ == tokenString {
+		if dt, ok := typedLiteralTypes[strings.ToUpper(first)]; ok {
+			// typed literal: TIMESTAMP '2024-01-01 10:00:00-03:00'
+			value, err := columnar.ParseValue(dt, p.cur.literal)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s literal: %w", dt, err)
+			}
+			p.nextToken()
+			return query.Literal{Value: value}, nil
+		}
+	}
 	return query.ColumnRef{Name: first}, nil
 }
 
+// typedLiteralTypes maps the type prefixes accepted before a string literal.
+var typedLiteralTypes = map[string]columnar.DataType{
+	"TIMESTAMP": columnar.TypeTimestamp,
+	"DATE":      columnar.TypeDate,
+	"DECIMAL":   columnar.TypeDecimal,
+}
+
 func (p *parser) parseFunctionCall(name string) (query.Expression, error) {
 	// current token is '('
 	if _, err := p.expect(tokenLParen); err != nil {
@@ -496,6 +542,13 @@ func (p *parser) parseFunctionCall(name string) (query.Expression, error) {
 	if _, err := p.expect(tokenRParen); err != nil {
 		return nil, err
 	}
+	if p.cur.typ == tokenIdent && strings.EqualFold(p.cur.literal, "WITHIN") &&
+		p.peek.typ == tokenIdent && strings.EqualFold(p.peek.literal, "RECORD") {
+		// aggregate over the repeated entries of each record
+		p.nextToken()
+		p.nextToken()
+		fn.WithinRecord = true
+	}
 	return fn, nil
 }
 
@@ -518,8 +571,8 @@ func (p *parser) parseNumberLiteral() (query.Expression, error) {
 
 func (p *parser) currentPrecedence() int {
 	if p.cur.typ == tokenKeyword {
-		if p.cur.literal == "NOT" && p.peek.typ == tokenKeyword && p.peek.literal == "BETWEEN" {
-			return keywordPrecedence["BETWEEN"]
+		if p.cur.literal == "NOT" && p.peek.typ == tokenKeyword && (p.peek.literal == "BETWEEN" || p.peek.literal == "IN") {
+			return keywordPrecedence[p.peek.literal]
 		}
 		if prec, ok := keywordPrecedence[p.cur.literal]; ok {
 			return prec
@@ -558,6 +611,21 @@ func (p *parser) parseBetween(left query.Expression, not bool) (query.Expression
 	}, nil
 }
 
+func (p *parser) parseIn(left query.Expression, not bool) (query.Expression, error) {
+	p.nextToken() // consume IN
+	if _, err := p.expect(tokenLParen); err != nil {
+		return nil, err
+	}
+	list, err := p.parseExpressionList()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(tokenRParen); err != nil {
+		return nil, err
+	}
+	return query.InExpr{Expr: left, List: list, Not: not}, nil
+}
+
 func (p *parser) parseInfix(left query.Expression) (query.Expression, error) {
 	switch {
 	case p.cur.typ == tokenKeyword && (p.cur.literal == "AND" || p.cur.literal == "OR"):
@@ -633,6 +701,7 @@ var keywordPrecedence = map[string]int{
 	"OR":      10,
 	"AND":     20,
 	"BETWEEN": 25,
+	"IN":      25,
 	"IS":      25,
 }
 
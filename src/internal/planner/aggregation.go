@@ -0,0 +1,348 @@
+package planner
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Jonatan852/distributed-query-processing/internal/executor"
+	"github.com/Jonatan852/distributed-query-processing/internal/expr"
+	"github.com/Jonatan852/distributed-query-processing/internal/storage"
+	"github.com/Jonatan852/distributed-query-processing/pkg/columnar"
+	"github.com/Jonatan852/distributed-query-processing/pkg/query"
+)
+
+// Aggregation descreve como uma query agrupada é calculada. As expressões do
+// GROUP BY e as agregações distintas são numeradas: a linha de cada grupo
+// expõe a chave i como GroupColumn(i) e o resultado (ou o estado parcial) da
+// agregação i como AggregateColumn(i). SELECT, HAVING e ORDER BY são
+// reescritos para ler essas colunas, de modo que o stage LOCAL (workers) e o
+// GLOBAL (coordinator) concordam sobre o layout sem trocar nomes de expressões.
+type Aggregation struct {
+	// GroupBy já tem os aliases do SELECT resolvidos.
+	GroupBy    []query.Expression
+	Aggregates []query.FunctionCall
+
+	// Columns mantém como alias a chave de saída original de cada item.
+	Columns []query.SelectItem
+	Having  query.Expression
+	// OrderBy preserva referências a aliases do SELECT, resolvidas na projeção.
+	OrderBy []query.OrderExpression
+}
+
+// GroupColumn nomeia a coluna da i-ésima chave de agrupamento.
+func GroupColumn(i int) string {
+	return fmt.Sprintf("#group%d", i)
+}
+
+// AggregateColumn nomeia a coluna da i-ésima agregação.
+func AggregateColumn(i int) string {
+	return fmt.Sprintf("#agg%d", i)
+}
+
+// NeedsAggregation indica se a query agrupa linhas; funções escalares e
+// agregações WITHIN RECORD (calculadas dentro de cada linha) não contam.
+func NeedsAggregation(stmt *query.SelectStatement) bool {
+	if len(stmt.GroupBy) > 0 || stmt.Having != nil {
+		return true
+	}
+	for _, item := range stmt.Columns {
+		if item.Expr != nil && expr.ContainsAggregate(item.Expr) {
+			return true
+		}
+	}
+	for _, item := range stmt.OrderBy {
+		if expr.ContainsAggregate(item.Expr) {
+			return true
+		}
+	}
+	return false
+}
+
+// AnalyzeAggregation valida a query agrupada e monta o seu layout. Colunas
+// fora de agregações precisam estar no GROUP BY; GROUP BY e HAVING aceitam
+// aliases do SELECT que não sejam colunas das tabelas do FROM.
+func AnalyzeAggregation(stmt *query.SelectStatement, metadata MetadataProvider) (*Aggregation, error) {
+	tables, err := fromSchemas(stmt, metadata)
+	if err != nil {
+		return nil, err
+	}
+	isColumn := func(name string) bool {
+		for _, table := range tables {
+			if _, _, ok := table.schema.Field(name); ok {
+				return true
+			}
+		}
+		return false
+	}
+	aliases := map[string]query.Expression{}
+	for _, item := range stmt.Columns {
+		if item.Wildcard != nil {
+			return nil, fmt.Errorf("* não pode ser usado com GROUP BY ou agregações")
+		}
+		if item.Alias != "" {
+			aliases[strings.ToLower(item.Alias)] = item.Expr
+		}
+	}
+	resolveAlias := func(e query.Expression) (query.Expression, bool, error) {
+		col, ok := e.(query.ColumnRef)
+		if !ok || col.Table != "" || isColumn(col.Name) {
+			return nil, false, nil
+		}
+		target, ok := aliases[strings.ToLower(col.Name)]
+		return target, ok, nil
+	}
+
+	a := &Aggregation{}
+	for _, e := range stmt.GroupBy {
+		resolved, err := transformExpression(e, resolveAlias)
+		if err != nil {
+			return nil, err
+		}
+		if expr.ContainsAggregate(resolved) {
+			return nil, fmt.Errorf("agregações não são permitidas no GROUP BY (%s)", e)
+		}
+		a.GroupBy = append(a.GroupBy, resolved)
+	}
+
+	seen := map[string]int{}
+	strict := func(e query.Expression) (query.Expression, bool, error) {
+		for i, key := range a.GroupBy {
+			if sameExpression(e, key) {
+				return query.ColumnRef{Name: GroupColumn(i)}, true, nil
+			}
+		}
+		switch e := e.(type) {
+		case query.FunctionCall:
+			if !expr.IsAggregate(e) {
+				return nil, false, nil
+			}
+			name := strings.ToUpper(e.String())
+			idx, ok := seen[name]
+			if !ok {
+				if err := checkAggregate(e); err != nil {
+					return nil, false, err
+				}
+				idx = len(a.Aggregates)
+				seen[name] = idx
+				a.Aggregates = append(a.Aggregates, e)
+			}
+			return query.ColumnRef{Name: AggregateColumn(idx)}, true, nil
+		case query.ColumnRef:
+			return nil, false, fmt.Errorf("coluna %s precisa estar no GROUP BY ou dentro de uma agregação", e)
+		}
+		return nil, false, nil
+	}
+
+	for _, item := range stmt.Columns {
+		rewritten, err := transformExpression(item.Expr, strict)
+		if err != nil {
+			return nil, err
+		}
+		alias := item.Alias
+		if alias == "" {
+			// a chave de saída continua sendo a expressão original
+			alias = item.Expr.String()
+			if col, ok := item.Expr.(query.ColumnRef); ok && col.Name != "" {
+				alias = col.Name
+			}
+		}
+		a.Columns = append(a.Columns, query.SelectItem{Expr: rewritten, Alias: alias})
+	}
+	if stmt.Having != nil {
+		having, err := transformExpression(stmt.Having, resolveAlias)
+		if err != nil {
+			return nil, err
+		}
+		if a.Having, err = transformExpression(having, strict); err != nil {
+			return nil, err
+		}
+	}
+	for _, item := range stmt.OrderBy {
+		if col, ok := item.Expr.(query.ColumnRef); ok && col.Table == "" && aliases[strings.ToLower(col.Name)] != nil {
+			a.OrderBy = append(a.OrderBy, item)
+			continue
+		}
+		rewritten, err := transformExpression(item.Expr, strict)
+		if err != nil {
+			return nil, err
+		}
+		item.Expr = rewritten
+		a.OrderBy = append(a.OrderBy, item)
+	}
+	return a, nil
+}
+
+// checkAggregate valida a chamada: * só vale em COUNT(*), agregações não
+// podem ser aninhadas e os parâmetros precisam ser constantes aceitas pela
+// função.
+func checkAggregate(call query.FunctionCall) error {
+	if _, err := expr.CheckCall(call); err != nil {
+		return err
+	}
+	params, err := AggregateParams(call)
+	if err != nil {
+		return err
+	}
+	if _, err := executor.NewAccumulator(executor.AggregateFunc(strings.ToUpper(call.Name)), call.Distinct, params...); err != nil {
+		return err
+	}
+	if _, ok := AggregateArgument(call).(query.Wildcard); ok {
+		if !strings.EqualFold(call.Name, "COUNT") || call.Distinct {
+			return fmt.Errorf("* só é permitido em COUNT(*)")
+		}
+		return nil
+	}
+	for _, arg := range call.Args {
+		if expr.ContainsAggregate(arg) {
+			return fmt.Errorf("agregações não podem ser aninhadas (%s)", call)
+		}
+	}
+	return nil
+}
+
+// AggregateArgument devolve o valor acumulado pela chamada, sempre o
+// primeiro argumento.
+func AggregateArgument(call query.FunctionCall) query.Expression {
+	if len(call.Args) == 0 {
+		return nil
+	}
+	return call.Args[0]
+}
+
+// AggregateParams avalia os demais argumentos, que são parâmetros constantes
+// da agregação: APPROX_QUANTILES(x, 4), STRING_AGG(s, ';').
+func AggregateParams(call query.FunctionCall) ([]columnar.Value, error) {
+	if len(call.Args) < 2 {
+		return nil, nil
+	}
+	params := make([]columnar.Value, 0, len(call.Args)-1)
+	for _, arg := range call.Args[1:] {
+		value, err := expr.Eval(arg, constantRow{call: call})
+		if err != nil {
+			return nil, err
+		}
+		params = append(params, value)
+	}
+	return params, nil
+}
+
+// constantRow rejeita referências a colunas nos parâmetros das agregações.
+type constantRow struct {
+	call query.FunctionCall
+}
+
+func (r constantRow) Column(col query.ColumnRef) (columnar.Value, error) {
+	return columnar.Value{}, fmt.Errorf("os parâmetros de %s precisam ser constantes (%s)", strings.ToUpper(r.call.Name), col)
+}
+
+// distributable indica se o stage LOCAL pode rodar nos workers: a agregação
+// lê uma única tabela e chaves e argumentos são expressões escalares sobre
+// colunas físicas. STRUCTs e campos repetidos só existem remontados no
+// coordinator.
+func (a *Aggregation) distributable(stmt *query.SelectStatement, metadata MetadataProvider) bool {
+	if len(stmt.From) != 1 || len(stmt.From[0].Joins) > 0 {
+		return false
+	}
+	schema, err := metadata.Table(stmt.From[0].Name)
+	if err != nil {
+		return false
+	}
+	exprs := append([]query.Expression{}, a.GroupBy...)
+	for _, call := range a.Aggregates {
+		if arg := AggregateArgument(call); arg != nil {
+			if _, ok := arg.(query.Wildcard); !ok {
+				exprs = append(exprs, arg)
+			}
+		}
+	}
+	for _, e := range exprs {
+		if !flatExpression(e, schema) {
+			return false
+		}
+	}
+	return true
+}
+
+// flatExpression indica se a expressão compila e só lê colunas escalares (nem
+// STRUCT nem campos repetidos), que os executores dos workers tratam linha a
+// linha.
+func flatExpression(e query.Expression, schema storage.TableSchema) bool {
+	if _, err := expr.Compile(e); err != nil {
+		return false
+	}
+	composite := false
+	walkExpression(e, func(node query.Expression) {
+		if col, ok := node.(query.ColumnRef); ok {
+			field, path, found := schema.Field(col.Name)
+			composite = composite || (found && (field.Type == columnar.TypeStruct || schema.RepeatedPath(path)))
+		}
+	})
+	return !composite
+}
+
+// sameExpression compara expressões pela forma textual; colunas com e sem o
+// qualificador da tabela são equivalentes.
+func sameExpression(a, b query.Expression) bool {
+	colA, okA := a.(query.ColumnRef)
+	colB, okB := b.(query.ColumnRef)
+	if okA && okB {
+		return strings.EqualFold(colA.Name, colB.Name) &&
+			(colA.Table == "" || colB.Table == "" || strings.EqualFold(colA.Table, colB.Table))
+	}
+	return strings.EqualFold(a.String(), b.String())
+}
+
+// transformExpression percorre a expressão de cima para baixo; quando fn
+// devolve replaced, o nó é trocado e seus filhos não são visitados.
+func transformExpression(e query.Expression, fn func(query.Expression) (query.Expression, bool, error)) (query.Expression, error) {
+	if e == nil {
+		return nil, nil
+	}
+	replacement, replaced, err := fn(e)
+	if err != nil {
+		return nil, err
+	}
+	if replaced {
+		return replacement, nil
+	}
+	each := func(exprs []query.Expression) ([]query.Expression, error) {
+		out := make([]query.Expression, len(exprs))
+		for i, item := range exprs {
+			if out[i], err = transformExpression(item, fn); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	}
+	switch node := e.(type) {
+	case query.BinaryExpr:
+		if node.Left, err = transformExpression(node.Left, fn); err != nil {
+			return nil, err
+		}
+		node.Right, err = transformExpression(node.Right, fn)
+		return node, err
+	case query.UnaryExpr:
+		node.Expr, err = transformExpression(node.Expr, fn)
+		return node, err
+	case query.BetweenExpr:
+		if node.Expr, err = transformExpression(node.Expr, fn); err != nil {
+			return nil, err
+		}
+		if node.Lower, err = transformExpression(node.Lower, fn); err != nil {
+			return nil, err
+		}
+		node.Upper, err = transformExpression(node.Upper, fn)
+		return node, err
+	case query.InExpr:
+		if node.Expr, err = transformExpression(node.Expr, fn); err != nil {
+			return nil, err
+		}
+		node.List, err = each(node.List)
+		return node, err
+	case query.FunctionCall:
+		node.Args, err = each(node.Args)
+		return node, err
+	default:
+		return e, nil
+	}
+}
@@ -0,0 +1,86 @@
+package planner
+
+import (
+	"strings"
+
+	"github.com/Jonatan852/distributed-query-processing/internal/storage"
+	"github.com/Jonatan852/distributed-query-processing/pkg/query"
+)
+
+// RequiredColumns devolve, na ordem do schema, as colunas da tabela identificada
+// por alias que a query referencia em SELECT, WHERE, GROUP BY, HAVING, ORDER BY e nas
+// condições de JOIN. Colunas sem qualificador são atribuídas a todas as tabelas
+// que as possuem; um wildcard (* ou alias.*) seleciona o schema inteiro.
+// Colunas são as folhas físicas do schema: referenciar um STRUCT ou campo
+// repetido (payload, payload.device) lê todas as folhas abaixo dele.
+func RequiredColumns(stmt *query.SelectStatement, alias string, schema storage.TableSchema) []string {
+	if stmt == nil || len(stmt.Columns) == 0 {
+		return schema.ColumnNames()
+	}
+	matchesAlias := func(table string) bool {
+		return table == "" || strings.EqualFold(table, alias)
+	}
+	needed := map[string]struct{}{}
+	visit := func(expr query.Expression) {
+		walkExpression(expr, func(e query.Expression) {
+			if col, ok := e.(query.ColumnRef); ok && matchesAlias(col.Table) {
+				needed[strings.ToLower(col.Name)] = struct{}{}
+			}
+		})
+	}
+	for _, item := range stmt.Columns {
+		wildcard := item.Wildcard
+		if w, ok := item.Expr.(query.Wildcard); ok {
+			wildcard = &w
+		}
+		if wildcard != nil {
+			if matchesAlias(wildcard.Table) {
+				return schema.ColumnNames()
+			}
+			continue
+		}
+		visit(item.Expr)
+	}
+	visit(stmt.Where)
+	visit(stmt.Having)
+	for _, expr := range stmt.GroupBy {
+		visit(expr)
+	}
+	for _, item := range stmt.OrderBy {
+		visit(item.Expr)
+	}
+	for _, ref := range stmt.From {
+		for _, join := range ref.Joins {
+			visit(join.Condition)
+		}
+	}
+
+	leaves := schema.ColumnNames()
+	result := make([]string, 0, len(needed))
+	for _, leaf := range leaves {
+		if referencesLeaf(needed, strings.ToLower(leaf)) {
+			result = append(result, leaf)
+		}
+	}
+	// COUNT(*) e afins não referenciam colunas, mas o scan ainda precisa de
+	// uma coluna para conhecer o número de linhas.
+	if len(result) == 0 && len(leaves) > 0 {
+		result = append(result, leaves[0])
+	}
+	return result
+}
+
+// referencesLeaf indica se a folha (ex.: payload.device.os) foi referenciada
+// diretamente ou por um de seus prefixos (payload, payload.device).
+func referencesLeaf(needed map[string]struct{}, leaf string) bool {
+	for path := leaf; ; {
+		if _, ok := needed[path]; ok {
+			return true
+		}
+		idx := strings.LastIndex(path, ".")
+		if idx < 0 {
+			return false
+		}
+		path = path[:idx]
+	}
+}
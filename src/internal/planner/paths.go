@@ -0,0 +1,254 @@
+package planner
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Jonatan852/distributed-query-processing/internal/storage"
+	"github.com/Jonatan852/distributed-query-processing/pkg/columnar"
+	"github.com/Jonatan852/distributed-query-processing/pkg/query"
+)
+
+// ResolveFieldPaths normaliza as referências a campos aninhados da query: o
+// parser entrega payload.device como ColumnRef{Table: "payload", Name:
+// "device"} e caminhos maiores como um nome único com pontos. Depois da
+// resolução, Table guarda apenas aliases do FROM e Name o caminho canônico do
+// schema (payload.device.os). A função é idempotente.
+//
+// Campos repetidos (e STRUCTs inteiros) só podem aparecer no SELECT, onde são
+// remontados por registro, ou como argumento de agregações WITHIN RECORD.
+func ResolveFieldPaths(stmt *query.SelectStatement, metadata MetadataProvider) error {
+	if stmt == nil {
+		return nil
+	}
+	tables, err := fromSchemas(stmt, metadata)
+	if err != nil {
+		return err
+	}
+	nested := false
+	for _, table := range tables {
+		nested = nested || table.schema.IsNested()
+	}
+	if !nested {
+		return nil
+	}
+	r := pathResolver{tables: tables}
+
+	for i, item := range stmt.Columns {
+		if item.Expr == nil {
+			continue
+		}
+		if stmt.Columns[i].Expr, err = r.rewrite(item.Expr, contextSelect); err != nil {
+			return err
+		}
+	}
+	if stmt.Where, err = r.rewrite(stmt.Where, "WHERE"); err != nil {
+		return err
+	}
+	for i, expr := range stmt.GroupBy {
+		if stmt.GroupBy[i], err = r.rewrite(expr, "GROUP BY"); err != nil {
+			return err
+		}
+	}
+	if stmt.Having, err = r.rewrite(stmt.Having, "HAVING"); err != nil {
+		return err
+	}
+	for i, item := range stmt.OrderBy {
+		if stmt.OrderBy[i].Expr, err = r.rewrite(item.Expr, "ORDER BY"); err != nil {
+			return err
+		}
+	}
+	for i := range stmt.From {
+		for j, join := range stmt.From[i].Joins {
+			if stmt.From[i].Joins[j].Condition, err = r.rewrite(join.Condition, "JOIN"); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// contextSelect marca a projeção, único lugar onde campos repetidos e STRUCTs
+// podem ser referenciados diretamente.
+const contextSelect = "SELECT"
+
+type aliasedSchema struct {
+	alias  string
+	schema storage.TableSchema
+}
+
+type pathResolver struct {
+	tables []aliasedSchema
+}
+
+func fromSchemas(stmt *query.SelectStatement, metadata MetadataProvider) ([]aliasedSchema, error) {
+	var tables []aliasedSchema
+	add := func(name, alias string) error {
+		schema, err := metadata.Table(name)
+		if err != nil {
+			return err
+		}
+		if alias == "" {
+			alias = name
+		}
+		tables = append(tables, aliasedSchema{alias: alias, schema: schema})
+		return nil
+	}
+	for _, ref := range stmt.From {
+		if err := add(ref.Name, ref.Alias); err != nil {
+			return nil, err
+		}
+		for _, join := range ref.Joins {
+			if err := add(join.Table, join.Alias); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return tables, nil
+}
+
+// rewrite devolve a expressão com as referências resolvidas. context indica a
+// cláusula, usada para validar o uso de campos repetidos.
+func (r pathResolver) rewrite(expr query.Expression, context string) (query.Expression, error) {
+	switch e := expr.(type) {
+	case nil:
+		return nil, nil
+	case query.ColumnRef:
+		return r.column(e, context)
+	case query.BinaryExpr:
+		left, err := r.rewrite(e.Left, nested(context))
+		if err != nil {
+			return nil, err
+		}
+		right, err := r.rewrite(e.Right, nested(context))
+		if err != nil {
+			return nil, err
+		}
+		e.Left, e.Right = left, right
+		return e, nil
+	case query.UnaryExpr:
+		inner, err := r.rewrite(e.Expr, nested(context))
+		if err != nil {
+			return nil, err
+		}
+		e.Expr = inner
+		return e, nil
+	case query.BetweenExpr:
+		var err error
+		if e.Expr, err = r.rewrite(e.Expr, nested(context)); err != nil {
+			return nil, err
+		}
+		if e.Lower, err = r.rewrite(e.Lower, nested(context)); err != nil {
+			return nil, err
+		}
+		if e.Upper, err = r.rewrite(e.Upper, nested(context)); err != nil {
+			return nil, err
+		}
+		return e, nil
+	case query.InExpr:
+		inner, err := r.rewrite(e.Expr, nested(context))
+		if err != nil {
+			return nil, err
+		}
+		list := make([]query.Expression, len(e.List))
+		for i, item := range e.List {
+			if list[i], err = r.rewrite(item, nested(context)); err != nil {
+				return nil, err
+			}
+		}
+		e.Expr, e.List = inner, list
+		return e, nil
+	case query.FunctionCall:
+		argContext := nested(context)
+		if e.WithinRecord {
+			argContext = "WITHIN RECORD"
+		}
+		args := make([]query.Expression, len(e.Args))
+		for i, arg := range e.Args {
+			var err error
+			if args[i], err = r.rewrite(arg, argContext); err != nil {
+				return nil, err
+			}
+		}
+		e.Args = args
+		return e, nil
+	default:
+		return expr, nil
+	}
+}
+
+// nested indica que a referência deixou de ser um item direto do SELECT.
+func nested(context string) string {
+	if context == contextSelect {
+		return "SELECT (expressão)"
+	}
+	return context
+}
+
+func (r pathResolver) column(col query.ColumnRef, context string) (query.Expression, error) {
+	table, path, qualified := r.split(col)
+	if table == nil {
+		return col, nil
+	}
+	field, canonical, ok := table.schema.Field(path)
+	if !ok {
+		return col, nil
+	}
+	if strings.Contains(canonical, ".") {
+		col.Name = canonical
+		col.Table = ""
+		if qualified {
+			col.Table = table.alias
+		}
+	}
+	switch context {
+	case contextSelect, "WITHIN RECORD":
+		return col, nil
+	}
+	if table.schema.RepeatedPath(canonical) {
+		return nil, fmt.Errorf("campo repetido %s só pode ser usado no SELECT ou em agregações WITHIN RECORD (%s)", canonical, context)
+	}
+	if field.Type == columnar.TypeStruct {
+		return nil, fmt.Errorf("STRUCT %s não pode ser usado em %s; referencie um de seus campos", canonical, context)
+	}
+	return col, nil
+}
+
+// split descobre a tabela e o caminho relativo a ela: o qualificador pode ser um
+// alias do FROM (qualified) ou o primeiro segmento do caminho.
+func (r pathResolver) split(col query.ColumnRef) (*aliasedSchema, string, bool) {
+	if col.Table != "" {
+		if table := r.byAlias(col.Table); table != nil {
+			return table, col.Name, true
+		}
+		table, path := r.byPath(col.Table + "." + col.Name)
+		return table, path, false
+	}
+	if idx := strings.Index(col.Name, "."); idx > 0 {
+		if table := r.byAlias(col.Name[:idx]); table != nil {
+			if _, _, ok := table.schema.Field(col.Name[idx+1:]); ok {
+				return table, col.Name[idx+1:], true
+			}
+		}
+	}
+	table, path := r.byPath(col.Name)
+	return table, path, false
+}
+
+func (r pathResolver) byAlias(alias string) *aliasedSchema {
+	for i := range r.tables {
+		if strings.EqualFold(r.tables[i].alias, alias) {
+			return &r.tables[i]
+		}
+	}
+	return nil
+}
+
+func (r pathResolver) byPath(path string) (*aliasedSchema, string) {
+	for i := range r.tables {
+		if _, _, ok := r.tables[i].schema.Field(path); ok {
+			return &r.tables[i], path
+		}
+	}
+	return nil, path
+}
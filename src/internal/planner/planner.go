@@ -4,7 +4,10 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/Jonatan852/distributed-query-processing/internal/executor"
+	"github.com/Jonatan852/distributed-query-processing/internal/expr"
 	"github.com/Jonatan852/distributed-query-processing/internal/storage"
+	"github.com/Jonatan852/distributed-query-processing/pkg/columnar"
 	"github.com/Jonatan852/distributed-query-processing/pkg/query"
 )
 
@@ -13,6 +16,13 @@ type MetadataProvider interface {
 	Table(name string) (storage.TableSchema, error)
 }
 
+// PartitionPruner é implementado por provedores que conhecem as estatísticas
+// min/max das partições (ex.: storage.Engine). Quando disponível, o planner
+// descarta partições que não podem satisfazer os predicados do SCAN.
+type PartitionPruner interface {
+	PrunePartitions(table string, preds []storage.ColumnPredicate) ([]string, int, error)
+}
+
 // Planner transforma uma AST (SelectStatement) em um plano físico distribuído.
 type Planner struct {
 	metadata MetadataProvider
@@ -31,18 +41,21 @@ func (p *Planner) Build(stmt *query.SelectStatement) (*query.PhysicalPlan, error
 	if len(stmt.From) == 0 {
 		return nil, fmt.Errorf("cláusula FROM obrigatória")
 	}
+	if err := ResolveFieldPaths(stmt, p.metadata); err != nil {
+		return nil, err
+	}
+	if err := validateFunctions(stmt); err != nil {
+		return nil, err
+	}
 
 	tablePredicates, globalPredicates := p.splitPredicates(stmt)
-	root, err := p.buildFromTree(stmt.From, tablePredicates)
+	root, err := p.buildFromTree(stmt, tablePredicates)
 	if err != nil {
 		return nil, err
 	}
 
 	if len(globalPredicates) > 0 {
-		filter := query.NewPlanNode(query.PlanNodeFilter)
-		filter.Properties["predicates"] = expressionsToStrings(globalPredicates)
-		filter.AddChild(root)
-		root = filter
+		root = buildFilterNode(root, globalPredicates)
 	}
 
 	projectionInfo := buildProjectionSpecs(stmt.Columns)
@@ -53,20 +66,33 @@ func (p *Planner) Build(stmt *query.SelectStatement) (*query.PhysicalPlan, error
 		root = project
 	}
 
-	if needsAggregation(stmt) {
-		root = p.buildAggregation(root, stmt)
+	if NeedsAggregation(stmt) {
+		aggregation, err := AnalyzeAggregation(stmt, p.metadata)
+		if err != nil {
+			return nil, err
+		}
+		root = p.buildAggregation(root, stmt, aggregation)
+		if stmt.Having != nil {
+			root = buildFilterNode(root, []query.Expression{stmt.Having})
+		}
 	}
 
-	if len(stmt.OrderBy) > 0 {
+	switch {
+	case len(stmt.OrderBy) > 0 && stmt.Limit != nil:
+		// SORT logo abaixo de LIMIT: basta guardar as primeiras linhas
+		root = p.buildTopN(root, stmt)
+	case len(stmt.OrderBy) > 0:
 		sortNode := query.NewPlanNode(query.PlanNodeSort)
 		sortNode.Properties["keys"] = orderExpressionsToSpec(stmt.OrderBy)
 		sortNode.AddChild(root)
 		root = sortNode
-	}
-
-	if stmt.Limit != nil {
+	case stmt.Limit != nil:
+		// partial libera o LIMIT para os workers: cada task para de ler
+		// partições assim que tem count linhas
 		limitNode := query.NewPlanNode(query.PlanNodeLimit)
 		limitNode.Properties["count"] = *stmt.Limit
+		_, partial := p.rowwiseTable(stmt)
+		limitNode.Properties["partial"] = partial
 		limitNode.AddChild(root)
 		root = limitNode
 	}
@@ -76,10 +102,10 @@ func (p *Planner) Build(stmt *query.SelectStatement) (*query.PhysicalPlan, error
 	return &query.PhysicalPlan{Root: final}, nil
 }
 
-func (p *Planner) buildFromTree(from []query.TableReference, tablePredicates map[string][]query.Expression) (*query.PlanNode, error) {
+func (p *Planner) buildFromTree(stmt *query.SelectStatement, tablePredicates map[string][]query.Expression) (*query.PlanNode, error) {
 	var root *query.PlanNode
-	for idx, tableRef := range from {
-		subPlan, err := p.buildTableNode(tableRef, tablePredicates)
+	for idx, tableRef := range stmt.From {
+		subPlan, err := p.buildTableNode(stmt, tableRef, tablePredicates)
 		if err != nil {
 			return nil, err
 		}
@@ -93,68 +119,112 @@ func (p *Planner) buildFromTree(from []query.TableReference, tablePredicates map
 	return root, nil
 }
 
-func (p *Planner) buildTableNode(ref query.TableReference, tablePredicates map[string][]query.Expression) (*query.PlanNode, error) {
-	schema, err := p.metadata.Table(ref.Name)
+func (p *Planner) buildTableNode(stmt *query.SelectStatement, ref query.TableReference, tablePredicates map[string][]query.Expression) (*query.PlanNode, error) {
+	root, err := p.buildScanNode(stmt, ref.Name, ref.Alias, tablePredicates)
+	if err != nil {
+		return nil, err
+	}
+	for _, join := range ref.Joins {
+		rightScan, err := p.buildScanNode(stmt, join.Table, join.Alias, tablePredicates)
+		if err != nil {
+			return nil, err
+		}
+		root = buildJoinNode(root, rightScan, join.Type, join.Condition)
+	}
+	return root, nil
+}
+
+// buildScanNode cria o SCAN de uma tabela, lendo apenas as colunas referenciadas
+// pela query, e, se houver predicados para o alias, o FILTER logo acima dele.
+func (p *Planner) buildScanNode(stmt *query.SelectStatement, table, alias string, tablePredicates map[string][]query.Expression) (*query.PlanNode, error) {
+	schema, err := p.metadata.Table(table)
 	if err != nil {
 		return nil, err
 	}
 	scan := query.NewPlanNode(query.PlanNodeScan)
-	scan.Properties["table"] = ref.Name
-	alias := ref.Alias
+	scan.Properties["table"] = table
 	if alias == "" {
-		alias = ref.Name
+		alias = table
 	}
 	scan.Properties["alias"] = alias
-	scan.Properties["columns"] = schema.ColumnNames()
+	scan.Properties["columns"] = RequiredColumns(stmt, alias, schema)
 
-	if preds, ok := tablePredicates[strings.ToLower(alias)]; ok && len(preds) > 0 {
-		filter := query.NewPlanNode(query.PlanNodeFilter)
-		filter.Properties["predicates"] = expressionsToStrings(preds)
-		filter.AddChild(scan)
-		scan = filter
+	preds := tablePredicates[strings.ToLower(alias)]
+	prune := expr.PruningPredicates(combineConjuncts(preds), func(col query.ColumnRef) (string, bool) {
+		column, ok := schema.ColumnByName(col.Name)
+		return column.Name, ok
+	})
+	if err := p.prunePartitions(scan, table, prune); err != nil {
+		return nil, err
+	}
+	if len(preds) > 0 {
+		return buildFilterNode(scan, preds), nil
 	}
+	return scan, nil
+}
 
-	root := scan
-	for _, join := range ref.Joins {
-		rightSchema, err := p.metadata.Table(join.Table)
-		if err != nil {
-			return nil, err
-		}
-		rightScan := query.NewPlanNode(query.PlanNodeScan)
-		rightScan.Properties["table"] = join.Table
-		alias := join.Alias
-		if alias == "" {
-			alias = join.Table
-		}
-		rightScan.Properties["alias"] = alias
-		rightScan.Properties["columns"] = rightSchema.ColumnNames()
-
-		if preds, ok := tablePredicates[strings.ToLower(alias)]; ok && len(preds) > 0 {
-			filter := query.NewPlanNode(query.PlanNodeFilter)
-			filter.Properties["predicates"] = expressionsToStrings(preds)
-			filter.AddChild(rightScan)
-			rightScan = filter
-		}
-		root = buildJoinNode(root, rightScan, join.Type, join.Condition)
+// prunePartitions grava os predicados de poda no SCAN e, quando o provedor de
+// metadata conhece as estatísticas, restringe Properties["partitions"] às
+// partições que podem conter linhas válidas.
+func (p *Planner) prunePartitions(scan *query.PlanNode, table string, preds []storage.ColumnPredicate) error {
+	if len(preds) > 0 {
+		scan.Properties["prune"] = preds
 	}
-	return root, nil
+	pruner, ok := p.metadata.(PartitionPruner)
+	if !ok {
+		return nil
+	}
+	kept, total, err := pruner.PrunePartitions(table, preds)
+	if err != nil {
+		return err
+	}
+	if len(preds) > 0 {
+		scan.Properties["partitions"] = kept
+	}
+	scan.Stats["partitionsTotal"] = total
+	scan.Stats["partitionsPruned"] = total - len(kept)
+	return nil
 }
 
 func (p *Planner) splitPredicates(stmt *query.SelectStatement) (map[string][]query.Expression, []query.Expression) {
+	return PushdownPredicates(stmt)
+}
+
+// PushdownPredicates separa os conjuntos do WHERE que dependem de uma única
+// tabela (indexados pelo alias em minúsculas) e podem ser avaliados no seu
+// SCAN dos que ficam para depois dos joins. Com joins, colunas sem
+// qualificador e tabelas completadas com NULL por um outer join impedem o
+// pushdown: o predicado precisa enxergar a linha já combinada.
+func PushdownPredicates(stmt *query.SelectStatement) (map[string][]query.Expression, []query.Expression) {
 	result := map[string][]query.Expression{}
 	global := []query.Expression{}
 	if stmt.Where == nil {
 		return result, global
 	}
+	// Com uma única tabela, colunas sem qualificador só podem pertencer a ela.
+	var single string
+	if len(stmt.From) == 1 && len(stmt.From[0].Joins) == 0 {
+		single = stmt.From[0].Alias
+		if single == "" {
+			single = stmt.From[0].Name
+		}
+	}
+	nullable := nullableAliases(stmt)
 	conjuncts := splitConjuncts(stmt.Where)
 	for _, predicate := range conjuncts {
 		tables := referencedTables(predicate)
-		if len(tables) == 1 {
+		if single != "" && len(tables) <= 1 {
+			alias := strings.ToLower(single)
+			result[alias] = append(result[alias], predicate)
+		} else if len(tables) == 1 && !hasUnqualifiedColumn(predicate) {
 			var alias string
 			for tbl := range tables {
 				alias = tbl
 			}
-			alias = strings.ToLower(alias)
+			if _, ok := nullable[alias]; ok {
+				global = append(global, predicate)
+				continue
+			}
 			result[alias] = append(result[alias], predicate)
 		} else {
 			global = append(global, predicate)
@@ -163,6 +233,56 @@ func (p *Planner) splitPredicates(stmt *query.SelectStatement) (map[string][]que
 	return result, global
 }
 
+// nullableAliases devolve os aliases (em minúsculas) que um outer join pode
+// completar com NULL: o lado direito de LEFT, o esquerdo de RIGHT e ambos em
+// FULL.
+func nullableAliases(stmt *query.SelectStatement) map[string]struct{} {
+	nullable := map[string]struct{}{}
+	aliasOf := func(name, alias string) string {
+		if alias == "" {
+			alias = name
+		}
+		return strings.ToLower(alias)
+	}
+	for _, ref := range stmt.From {
+		// o join só completa com NULL as tabelas da sua própria entrada do FROM
+		seen := []string{aliasOf(ref.Name, ref.Alias)}
+		for _, join := range ref.Joins {
+			right := aliasOf(join.Table, join.Alias)
+			if join.Type == query.JoinTypeLeft || join.Type == query.JoinTypeFull {
+				nullable[right] = struct{}{}
+			}
+			if join.Type == query.JoinTypeRight || join.Type == query.JoinTypeFull {
+				for _, left := range seen {
+					nullable[left] = struct{}{}
+				}
+			}
+			seen = append(seen, right)
+		}
+	}
+	return nullable
+}
+
+func hasUnqualifiedColumn(expr query.Expression) bool {
+	found := false
+	walkExpression(expr, func(e query.Expression) {
+		if col, ok := e.(query.ColumnRef); ok && col.Table == "" {
+			found = true
+		}
+	})
+	return found
+}
+
+// buildFilterNode cria um FILTER com os predicados legíveis (predicates) e a
+// expressão serializada (filter) usada pelos workers para avaliá-los.
+func buildFilterNode(child *query.PlanNode, preds []query.Expression) *query.PlanNode {
+	filter := query.NewPlanNode(query.PlanNodeFilter)
+	filter.Properties["predicates"] = expressionsToStrings(preds)
+	filter.Properties["filter"] = query.EncodeExpression(combineConjuncts(preds))
+	filter.AddChild(child)
+	return filter
+}
+
 func buildJoinNode(left, right *query.PlanNode, typ query.JoinType, cond query.Expression) *query.PlanNode {
 	joinNode := query.NewPlanNode(query.PlanNodeJoin)
 	joinNode.Properties["type"] = typ
@@ -194,6 +314,18 @@ func splitConjuncts(expr query.Expression) []query.Expression {
 	return []query.Expression{expr}
 }
 
+func combineConjuncts(exprs []query.Expression) query.Expression {
+	var result query.Expression
+	for _, expr := range exprs {
+		if result == nil {
+			result = expr
+			continue
+		}
+		result = query.BinaryExpr{Left: result, Operator: "AND", Right: expr}
+	}
+	return result
+}
+
 func referencedTables(expr query.Expression) map[string]struct{} {
 	res := map[string]struct{}{}
 	walkExpression(expr, func(e query.Expression) {
@@ -226,6 +358,11 @@ func walkExpression(expr query.Expression, fn func(query.Expression)) {
 		for _, arg := range e.Args {
 			walkExpression(arg, fn)
 		}
+	case query.InExpr:
+		walkExpression(e.Expr, fn)
+		for _, item := range e.List {
+			walkExpression(item, fn)
+		}
 	}
 }
 
@@ -256,23 +393,53 @@ func allWildcards(projections []ProjectionSpec) bool {
 	return true
 }
 
-func needsAggregation(stmt *query.SelectStatement) bool {
-	if len(stmt.GroupBy) > 0 {
-		return true
-	}
+// validateFunctions confere todas as chamadas de função contra o registro de
+// expr (nome, aridade e DISTINCT) antes de montar o plano.
+func validateFunctions(stmt *query.SelectStatement) error {
+	exprs := append([]query.Expression{stmt.Where, stmt.Having}, stmt.GroupBy...)
 	for _, item := range stmt.Columns {
-		if _, ok := item.Expr.(query.FunctionCall); ok {
-			return true
+		exprs = append(exprs, item.Expr)
+	}
+	for _, item := range stmt.OrderBy {
+		exprs = append(exprs, item.Expr)
+	}
+	for _, ref := range stmt.From {
+		for _, join := range ref.Joins {
+			exprs = append(exprs, join.Condition)
 		}
 	}
-	return false
+	var err error
+	for _, e := range exprs {
+		walkExpression(e, func(node query.Expression) {
+			if call, ok := node.(query.FunctionCall); ok && err == nil {
+				_, err = expr.CheckCall(call)
+			}
+		})
+	}
+	return err
 }
 
-func (p *Planner) buildAggregation(child *query.PlanNode, stmt *query.SelectStatement) *query.PlanNode {
+// buildAggregation monta LOCAL -> EXCHANGE -> GLOBAL. O LOCAL leva as chaves
+// e os argumentos serializados (groupBy, aggregates[].arg) para que os workers
+// calculem estados parciais; partial indica se ele pode rodar nos workers.
+func (p *Planner) buildAggregation(child *query.PlanNode, stmt *query.SelectStatement, aggregation *Aggregation) *query.PlanNode {
+	specs := aggregateSpecs(stmt, aggregation)
+	if tables, err := fromSchemas(stmt, p.metadata); err == nil {
+		for i := range specs {
+			specs[i].Type = aggregateType(aggregation.Aggregates[i], tables)
+		}
+	}
+	groupBy := make([]*query.ExpressionSpec, 0, len(aggregation.GroupBy))
+	for _, e := range aggregation.GroupBy {
+		groupBy = append(groupBy, query.EncodeExpression(e))
+	}
+
 	localAgg := query.NewPlanNode(query.PlanNodeAggregate)
 	localAgg.Properties["stage"] = "LOCAL"
-	localAgg.Properties["groupKeys"] = expressionsToStrings(stmt.GroupBy)
-	localAgg.Properties["aggregates"] = aggregateSpecs(stmt.Columns)
+	localAgg.Properties["groupKeys"] = expressionsToStrings(aggregation.GroupBy)
+	localAgg.Properties["groupBy"] = groupBy
+	localAgg.Properties["aggregates"] = specs
+	localAgg.Properties["partial"] = aggregation.distributable(stmt, p.metadata)
 	localAgg.AddChild(child)
 
 	exchange := query.NewPlanNode(query.PlanNodeExchange)
@@ -281,30 +448,150 @@ func (p *Planner) buildAggregation(child *query.PlanNode, stmt *query.SelectStat
 
 	globalAgg := query.NewPlanNode(query.PlanNodeAggregate)
 	globalAgg.Properties["stage"] = "GLOBAL"
-	globalAgg.Properties["groupKeys"] = expressionsToStrings(stmt.GroupBy)
-	globalAgg.Properties["aggregates"] = aggregateSpecs(stmt.Columns)
+	globalAgg.Properties["groupKeys"] = expressionsToStrings(aggregation.GroupBy)
+	globalAgg.Properties["aggregates"] = specs
 	globalAgg.AddChild(exchange)
 	return globalAgg
 }
 
-func aggregateSpecs(items []query.SelectItem) []AggregateSpec {
-	result := []AggregateSpec{}
-	for _, item := range items {
-		fn, ok := item.Expr.(query.FunctionCall)
-		if !ok {
-			continue
+// buildTopN troca SORT + LIMIT por um TOPN, que guarda só count linhas. Em
+// queries sobre uma tabela, sem agregação, as chaves são calculadas sobre as
+// colunas lidas: orderBy leva as expressões serializadas (aliases do SELECT
+// já substituídos) e partial libera o TOPN para os workers, de modo que cada
+// task devolve no máximo count linhas e o coordinator escolhe as finais.
+func (p *Planner) buildTopN(child *query.PlanNode, stmt *query.SelectStatement) *query.PlanNode {
+	node := query.NewPlanNode(query.PlanNodeTopN)
+	node.Properties["keys"] = orderExpressionsToSpec(stmt.OrderBy)
+	node.Properties["count"] = *stmt.Limit
+	orderBy, partial := p.topNKeys(stmt)
+	if partial {
+		node.Properties["orderBy"] = orderBy
+	}
+	node.Properties["partial"] = partial
+	node.AddChild(child)
+	return node
+}
+
+// rowwiseTable devolve o schema da única tabela da query quando os workers
+// podem cortar as linhas dela antes do coordinator: sem agregação, DISTINCT,
+// joins ou campos repetidos.
+func (p *Planner) rowwiseTable(stmt *query.SelectStatement) (storage.TableSchema, bool) {
+	if NeedsAggregation(stmt) || stmt.Distinct || len(stmt.From) != 1 || len(stmt.From[0].Joins) > 0 {
+		return storage.TableSchema{}, false
+	}
+	ref := stmt.From[0]
+	schema, err := p.metadata.Table(ref.Name)
+	if err != nil {
+		return storage.TableSchema{}, false
+	}
+	alias := ref.Alias
+	if alias == "" {
+		alias = ref.Name
+	}
+	// linhas com campos repetidos ocupam várias entradas nas colunas
+	for _, column := range RequiredColumns(stmt, alias, schema) {
+		if schema.RepeatedPath(column) {
+			return storage.TableSchema{}, false
+		}
+	}
+	return schema, true
+}
+
+// topNKeys serializa as chaves do ORDER BY para o TOPN dos workers; false
+// indica que elas dependem de algo que só existe no coordinator (agregações,
+// joins) ou de campos aninhados, que os workers não ordenam linha a linha.
+func (p *Planner) topNKeys(stmt *query.SelectStatement) ([]*query.ExpressionSpec, bool) {
+	schema, ok := p.rowwiseTable(stmt)
+	if !ok {
+		return nil, false
+	}
+	specs := make([]*query.ExpressionSpec, 0, len(stmt.OrderBy))
+	for _, item := range stmt.OrderBy {
+		key := item.Expr
+		// ORDER BY alias usa a expressão do SELECT, como no runner
+		if col, ok := key.(query.ColumnRef); ok && col.Table == "" {
+			for _, selected := range stmt.Columns {
+				if selected.Alias != "" && strings.EqualFold(selected.Alias, col.Name) {
+					key = selected.Expr
+					break
+				}
+			}
+		}
+		if !flatExpression(key, schema) {
+			return nil, false
+		}
+		specs = append(specs, query.EncodeExpression(key))
+	}
+	return specs, true
+}
+
+// aggregateSpecs descreve as agregações na ordem de Aggregation.Aggregates
+// (a mesma das colunas #aggN). O alias só é preenchido quando um item do
+// SELECT é a própria agregação.
+func aggregateSpecs(stmt *query.SelectStatement, aggregation *Aggregation) []AggregateSpec {
+	aliases := map[string]string{}
+	for _, item := range stmt.Columns {
+		if fn, ok := item.Expr.(query.FunctionCall); ok && item.Alias != "" {
+			key := strings.ToUpper(fn.String())
+			if _, exists := aliases[key]; !exists {
+				aliases[key] = item.Alias
+			}
 		}
+	}
+	result := make([]AggregateSpec, 0, len(aggregation.Aggregates))
+	for i, call := range aggregation.Aggregates {
 		spec := AggregateSpec{
-			Func:     strings.ToUpper(fn.Name),
-			Expr:     joinExpressions(fn.Args),
-			Alias:    item.Alias,
-			Distinct: fn.Distinct,
+			Func:     strings.ToUpper(call.Name),
+			Expr:     joinExpressions(call.Args),
+			Alias:    aliases[strings.ToUpper(call.String())],
+			Distinct: call.Distinct,
+			Column:   AggregateColumn(i),
+		}
+		if arg := AggregateArgument(call); arg != nil {
+			if _, ok := arg.(query.Wildcard); !ok {
+				spec.Arg = query.EncodeExpression(arg)
+			}
 		}
+		// os parâmetros já foram validados por AnalyzeAggregation
+		spec.Params, _ = AggregateParams(call)
 		result = append(result, spec)
 	}
 	return result
 }
 
+// aggregateType informa o tipo do resultado quando ele é conhecido antes da
+// execução: funções de tipo fixo (COUNT, AVG, STDDEV...) ou agregações
+// diretas sobre uma coluna do FROM. Listas são descritas como ARRAY<T>.
+func aggregateType(call query.FunctionCall, tables []aliasedSchema) string {
+	fn := executor.AggregateFunc(strings.ToUpper(call.Name))
+	typ := func(dt columnar.DataType) string {
+		if executor.ReturnsList(fn) {
+			return fmt.Sprintf("ARRAY<%s>", dt)
+		}
+		return dt.String()
+	}
+	switch fn {
+	case executor.AggregateSum, executor.AggregateMin, executor.AggregateMax,
+		executor.AggregateAnyValue, executor.AggregateArrayAgg:
+	default:
+		// o tipo não depende da entrada
+		return typ(executor.ResultType(fn, columnar.TypeFloat))
+	}
+	col, ok := AggregateArgument(call).(query.ColumnRef)
+	if !ok {
+		return ""
+	}
+	for _, table := range tables {
+		if col.Table != "" && !strings.EqualFold(col.Table, table.alias) {
+			continue
+		}
+		if field, _, found := table.schema.Field(col.Name); found && field.Type != columnar.TypeStruct {
+			return typ(executor.ResultType(fn, field.Type))
+		}
+	}
+	return ""
+}
+
 func joinExpressions(exprs []query.Expression) string {
 	strs := make([]string, 0, len(exprs))
 	for _, e := range exprs {
@@ -331,12 +618,19 @@ type ProjectionSpec struct {
 	Wildcard bool   `json:"wildcard,omitempty"`
 }
 
-// AggregateSpec explica a função agregadora escolhida.
+// AggregateSpec explica a função agregadora escolhida. Column é a coluna
+// (#aggN) com o estado parcial ou o resultado; Arg é a expressão acumulada,
+// ausente em COUNT(*); Params são os argumentos constantes seguintes; Type é
+// o tipo do resultado, quando conhecido no planejamento.
 type AggregateSpec struct {
-	Func     string `json:"func"`
-	Expr     string `json:"expr"`
-	Alias    string `json:"alias,omitempty"`
-	Distinct bool   `json:"distinct,omitempty"`
+	Func     string                `json:"func"`
+	Expr     string                `json:"expr"`
+	Alias    string                `json:"alias,omitempty"`
+	Distinct bool                  `json:"distinct,omitempty"`
+	Column   string                `json:"column,omitempty"`
+	Arg      *query.ExpressionSpec `json:"arg,omitempty"`
+	Params   []columnar.Value      `json:"params,omitempty"`
+	Type     string                `json:"type,omitempty"`
 }
 
 // SortSpec define a ordenação aplicada.
@@ -1,6 +1,8 @@
 package planner
 
 import (
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/Jonatan852/distributed-query-processing/internal/storage"
@@ -47,6 +49,11 @@ func TestPlannerBuildsPlan(t *testing.T) {
 		GroupBy: []query.Expression{
 			query.ColumnRef{Table: "e", Name: "user_id"},
 		},
+		Having: query.BinaryExpr{
+			Left:     query.FunctionCall{Name: "COUNT", Args: []query.Expression{query.Wildcard{}}},
+			Operator: ">",
+			Right:    query.Literal{Value: columnar.NewIntValue(1)},
+		},
 		OrderBy: []query.OrderExpression{
 			{Expr: query.ColumnRef{Name: "total"}, Direction: query.SortDesc},
 		},
@@ -82,4 +89,291 @@ func TestPlannerBuildsPlan(t *testing.T) {
 	if plan.Root.Children[0].Type != query.PlanNodeLimit && plan.Root.Children[0].Type != query.PlanNodeSort && plan.Root.Children[0].Type != query.PlanNodeAggregate {
 		t.Fatalf("plano parece incompleto, obtido: %s", plan.Root.Children[0].Type)
 	}
+	having := findNode(plan.Root, query.PlanNodeFilter)
+	if having == nil || having.Children[0].Type != query.PlanNodeAggregate {
+		t.Fatalf("HAVING deveria filtrar a saída da agregação")
+	}
+	if specs, ok := having.Children[0].Properties["aggregates"].([]AggregateSpec); !ok || len(specs) != 1 || specs[0].Alias != "total" || specs[0].Type != "INT" {
+		t.Fatalf("COUNT(*) do SELECT e do HAVING deveria gerar uma única medida: %+v", having.Children[0].Properties["aggregates"])
+	}
+}
+
+func TestPlannerScalarFunctions(t *testing.T) {
+	metadata := mockMetadata{tables: map[string]storage.TableSchema{
+		"events": {Name: "events", Columns: []storage.ColumnSchema{
+			{Name: "user_id", Type: columnar.TypeInt},
+			{Name: "country", Type: columnar.TypeString},
+		}},
+	}}
+	stmt := &query.SelectStatement{
+		Columns: []query.SelectItem{
+			{Expr: query.FunctionCall{Name: "UPPER", Args: []query.Expression{query.ColumnRef{Name: "country"}}}},
+		},
+		From: []query.TableReference{{Name: "events"}},
+	}
+	plan, err := New(metadata).Build(stmt)
+	if err != nil {
+		t.Fatalf("planner falhou: %v", err)
+	}
+	if findNode(plan.Root, query.PlanNodeAggregate) != nil {
+		t.Fatalf("função escalar não deveria gerar agregação")
+	}
+
+	stmt.Where = query.FunctionCall{Name: "LENGTH", Args: []query.Expression{}}
+	if _, err := New(metadata).Build(stmt); err == nil || !strings.Contains(err.Error(), "LENGTH espera 1") {
+		t.Fatalf("aridade inválida deveria falhar no planner: %v", err)
+	}
+
+	stmt.Where = nil
+	stmt.Columns = []query.SelectItem{
+		{Expr: query.FunctionCall{Name: "ARRAY_AGG", Args: []query.Expression{query.ColumnRef{Name: "user_id"}}}},
+		{Expr: query.FunctionCall{Name: "APPROX_QUANTILES", Args: []query.Expression{query.ColumnRef{Name: "user_id"}, query.Literal{Value: columnar.NewIntValue(4)}}}},
+	}
+	plan, err = New(metadata).Build(stmt)
+	if err != nil {
+		t.Fatalf("planner falhou: %v", err)
+	}
+	specs, _ := findNode(plan.Root, query.PlanNodeAggregate).Properties["aggregates"].([]AggregateSpec)
+	if len(specs) != 2 || specs[0].Type != "ARRAY<INT>" || specs[1].Type != "ARRAY<FLOAT>" || len(specs[1].Params) != 1 || specs[1].Params[0].Data != int64(4) {
+		t.Fatalf("tipos e parâmetros das agregações incorretos: %+v", specs)
+	}
+}
+
+func TestPlannerPrunesPartitions(t *testing.T) {
+	engine, err := storage.NewEngine(filepath.Join(t.TempDir(), "data"))
+	if err != nil {
+		t.Fatalf("erro criando engine: %v", err)
+	}
+	schema := storage.TableSchema{
+		Name:    "events",
+		Columns: []storage.ColumnSchema{{Name: "user_id", Type: columnar.TypeInt}},
+	}
+	if err := engine.RegisterTable(schema); err != nil {
+		t.Fatalf("erro registrando tabela: %v", err)
+	}
+	for idx, id := range []string{"p1", "p2", "p3"} {
+		rows := []storage.Row{
+			{"user_id": columnar.NewIntValue(int64(idx*10 + 1))},
+			{"user_id": columnar.NewIntValue(int64(idx*10 + 10))},
+		}
+		if _, err := engine.Ingest("events", id, rows); err != nil {
+			t.Fatalf("erro ao ingerir %s: %v", id, err)
+		}
+	}
+
+	stmt := &query.SelectStatement{
+		Columns: []query.SelectItem{{Wildcard: &query.Wildcard{}}},
+		From:    []query.TableReference{{Name: "events"}},
+		// 15 < user_id (literal à esquerda) AND user_id IN (5, 25)
+		Where: query.BinaryExpr{
+			Left: query.BinaryExpr{
+				Left:     query.Literal{Value: columnar.NewIntValue(15)},
+				Operator: "<",
+				Right:    query.ColumnRef{Name: "user_id"},
+			},
+			Operator: "AND",
+			Right: query.InExpr{
+				Expr: query.ColumnRef{Name: "user_id"},
+				List: []query.Expression{
+					query.Literal{Value: columnar.NewIntValue(5)},
+					query.Literal{Value: columnar.NewIntValue(25)},
+				},
+			},
+		},
+	}
+	plan, err := New(engine).Build(stmt)
+	if err != nil {
+		t.Fatalf("planner falhou: %v", err)
+	}
+	scan := findNode(plan.Root, query.PlanNodeScan)
+	if scan == nil {
+		t.Fatalf("plano sem SCAN")
+	}
+	if scan.Stats["partitionsTotal"] != 3 || scan.Stats["partitionsPruned"] != 2 {
+		t.Fatalf("estatísticas de poda inesperadas: %v", scan.Stats)
+	}
+	partitions, _ := scan.Properties["partitions"].([]string)
+	if len(partitions) != 1 || partitions[0] != "p3" {
+		t.Fatalf("esperava apenas p3, obteve %v", scan.Properties["partitions"])
+	}
+}
+
+func findNode(node *query.PlanNode, typ query.PlanNodeType) *query.PlanNode {
+	if node == nil {
+		return nil
+	}
+	if node.Type == typ {
+		return node
+	}
+	for _, child := range node.Children {
+		if found := findNode(child, typ); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func TestRequiredColumns(t *testing.T) {
+	events := storage.TableSchema{
+		Name: "events",
+		Columns: []storage.ColumnSchema{
+			{Name: "user_id", Type: columnar.TypeInt},
+			{Name: "value", Type: columnar.TypeFloat},
+			{Name: "country", Type: columnar.TypeString},
+			{Name: "payload", Type: columnar.TypeString},
+		},
+	}
+	users := storage.TableSchema{
+		Name: "users",
+		Columns: []storage.ColumnSchema{
+			{Name: "id", Type: columnar.TypeInt},
+			{Name: "name", Type: columnar.TypeString},
+			{Name: "country", Type: columnar.TypeString},
+		},
+	}
+	stmt := &query.SelectStatement{
+		Columns: []query.SelectItem{{Expr: query.ColumnRef{Table: "u", Name: "name"}}},
+		From: []query.TableReference{{
+			Name:  "events",
+			Alias: "e",
+			Joins: []query.JoinClause{{
+				Type:      query.JoinTypeInner,
+				Table:     "users",
+				Alias:     "u",
+				Condition: query.BinaryExpr{Left: query.ColumnRef{Table: "e", Name: "user_id"}, Operator: "=", Right: query.ColumnRef{Table: "u", Name: "id"}},
+			}},
+		}},
+		Where: query.BinaryExpr{
+			Left:     query.ColumnRef{Name: "value"},
+			Operator: ">",
+			Right:    query.Literal{Value: columnar.NewIntValue(10)},
+		},
+		OrderBy: []query.OrderExpression{{Expr: query.ColumnRef{Table: "e", Name: "country"}}},
+	}
+	if got := strings.Join(RequiredColumns(stmt, "e", events), ","); got != "user_id,value,country" {
+		t.Fatalf("colunas de events inesperadas: %s", got)
+	}
+	if got := strings.Join(RequiredColumns(stmt, "u", users), ","); got != "id,name" {
+		t.Fatalf("colunas de users inesperadas: %s", got)
+	}
+
+	countAll := &query.SelectStatement{
+		Columns: []query.SelectItem{{Expr: query.FunctionCall{Name: "COUNT", Args: []query.Expression{query.Wildcard{}}}}},
+		From:    []query.TableReference{{Name: "events"}},
+	}
+	if got := strings.Join(RequiredColumns(countAll, "events", events), ","); got != "user_id" {
+		t.Fatalf("COUNT(*) deveria ler apenas uma coluna, obteve %s", got)
+	}
+
+	star := &query.SelectStatement{
+		Columns: []query.SelectItem{{Wildcard: &query.Wildcard{Table: "e"}}},
+		From:    []query.TableReference{{Name: "events", Alias: "e"}},
+	}
+	if got := RequiredColumns(star, "e", events); len(got) != len(events.Columns) {
+		t.Fatalf("e.* deveria ler todas as colunas, obteve %v", got)
+	}
+}
+
+func TestResolveFieldPaths(t *testing.T) {
+	events := storage.TableSchema{
+		Name: "events",
+		Columns: []storage.ColumnSchema{
+			{Name: "id", Type: columnar.TypeInt},
+			{Name: "payload", Type: columnar.TypeStruct, Fields: []storage.ColumnSchema{
+				{Name: "device", Type: columnar.TypeStruct, Fields: []storage.ColumnSchema{
+					{Name: "os", Type: columnar.TypeString},
+					{Name: "model", Type: columnar.TypeString},
+				}},
+				{Name: "tags", Type: columnar.TypeString, Repeated: true},
+			}},
+		},
+	}
+	metadata := mockMetadata{tables: map[string]storage.TableSchema{"events": events}}
+	stmt := &query.SelectStatement{
+		Columns: []query.SelectItem{
+			{Expr: query.ColumnRef{Table: "payload", Name: "device"}},
+			{Expr: query.FunctionCall{Name: "COUNT", Args: []query.Expression{query.ColumnRef{Name: "e.payload.tags"}}, WithinRecord: true}},
+		},
+		From: []query.TableReference{{Name: "events", Alias: "e"}},
+		Where: query.BinaryExpr{
+			Left:     query.ColumnRef{Name: "PAYLOAD.Device.OS"},
+			Operator: "=",
+			Right:    query.Literal{Value: columnar.NewStringValue("linux")},
+		},
+	}
+	if err := ResolveFieldPaths(stmt, metadata); err != nil {
+		t.Fatalf("resolução falhou: %v", err)
+	}
+	if col := stmt.Columns[0].Expr.(query.ColumnRef); col.Table != "" || col.Name != "payload.device" {
+		t.Fatalf("caminho inesperado: %+v", col)
+	}
+	if col := stmt.Columns[1].Expr.(query.FunctionCall).Args[0].(query.ColumnRef); col.Table != "e" || col.Name != "payload.tags" {
+		t.Fatalf("argumento inesperado: %+v", col)
+	}
+	if col := stmt.Where.(query.BinaryExpr).Left.(query.ColumnRef); col.Name != "payload.device.os" {
+		t.Fatalf("caminho do WHERE não normalizado: %+v", col)
+	}
+	if got := strings.Join(RequiredColumns(stmt, "e", events), ","); got != "payload.device.os,payload.device.model,payload.tags" {
+		t.Fatalf("colunas inesperadas: %s", got)
+	}
+
+	stmt.Where = query.BinaryExpr{Left: query.ColumnRef{Name: "payload.tags"}, Operator: "=", Right: query.Literal{Value: columnar.NewStringValue("x")}}
+	if err := ResolveFieldPaths(stmt, metadata); err == nil {
+		t.Fatalf("campo repetido no WHERE deveria ser rejeitado")
+	}
+}
+
+func TestPlannerBuildsTopN(t *testing.T) {
+	metadata := mockMetadata{tables: map[string]storage.TableSchema{
+		"events": {
+			Name: "events",
+			Columns: []storage.ColumnSchema{
+				{Name: "user_id", Type: columnar.TypeInt},
+				{Name: "value", Type: columnar.TypeFloat},
+			},
+		},
+	}}
+	limit := int64(5)
+	stmt := &query.SelectStatement{
+		Columns: []query.SelectItem{
+			{Expr: query.ColumnRef{Name: "user_id"}},
+			{Expr: query.BinaryExpr{Left: query.ColumnRef{Name: "value"}, Operator: "*", Right: query.Literal{Value: columnar.NewIntValue(2)}}, Alias: "double"},
+		},
+		From:    []query.TableReference{{Name: "events"}},
+		OrderBy: []query.OrderExpression{{Expr: query.ColumnRef{Name: "double"}, Direction: query.SortDesc}},
+		Limit:   &limit,
+	}
+	plan, err := New(metadata).Build(stmt)
+	if err != nil {
+		t.Fatalf("planner falhou: %v", err)
+	}
+	if findNode(plan.Root, query.PlanNodeSort) != nil || findNode(plan.Root, query.PlanNodeLimit) != nil {
+		t.Fatalf("ORDER BY ... LIMIT deveria virar um único TOPN")
+	}
+	top := findNode(plan.Root, query.PlanNodeTopN)
+	if top == nil || top.Properties["count"] != limit || top.Properties["partial"] != true {
+		t.Fatalf("TOPN inesperado: %+v", top)
+	}
+	orderBy, _ := top.Properties["orderBy"].([]*query.ExpressionSpec)
+	if len(orderBy) != 1 {
+		t.Fatalf("esperava a expressão do alias em orderBy, obteve %v", top.Properties["orderBy"])
+	}
+	if key, err := orderBy[0].Decode(); err != nil || !strings.Contains(key.String(), "value") {
+		t.Fatalf("alias deveria ser trocado pela expressão do SELECT: %v (%v)", key, err)
+	}
+
+	// com agregação as chaves só existem no coordinator
+	stmt.Columns = []query.SelectItem{
+		{Expr: query.ColumnRef{Name: "user_id"}},
+		{Expr: query.FunctionCall{Name: "COUNT", Args: []query.Expression{query.Wildcard{}}}, Alias: "double"},
+	}
+	stmt.GroupBy = []query.Expression{query.ColumnRef{Name: "user_id"}}
+	plan, err = New(metadata).Build(stmt)
+	if err != nil {
+		t.Fatalf("planner falhou: %v", err)
+	}
+	top = findNode(plan.Root, query.PlanNodeTopN)
+	if top == nil || top.Properties["partial"] != false || top.Properties["orderBy"] != nil {
+		t.Fatalf("TOPN sobre agregação não deveria ir para os workers: %+v", top)
+	}
 }
@@ -0,0 +1,503 @@
+package fragment
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Jonatan852/distributed-query-processing/internal/distributed"
+	"github.com/Jonatan852/distributed-query-processing/internal/executor"
+	"github.com/Jonatan852/distributed-query-processing/internal/expr"
+	"github.com/Jonatan852/distributed-query-processing/internal/planner"
+	"github.com/Jonatan852/distributed-query-processing/internal/storage"
+	"github.com/Jonatan852/distributed-query-processing/pkg/columnar"
+	"github.com/Jonatan852/distributed-query-processing/pkg/query"
+)
+
+// Config ajusta a execução dos fragmentos no worker.
+type Config struct {
+	// SpillDir recebe os arquivos temporários dos operadores que passam do
+	// limite de memória (runs do sort externo, partições de agregações e
+	// joins); vazio desliga o spill.
+	SpillDir string
+	// SortMemory limita, em bytes, as linhas que um SORT mantém em memória
+	// antes de gravar um run em SpillDir.
+	SortMemory int64
+	// HashMemory limita, em bytes, o estado de uma agregação ou a tabela hash
+	// de um join antes de dividi-los em partições em SpillDir.
+	HashMemory int64
+	// Memory é o orçamento do processo; cada task reserva nele, por meio do
+	// tracker da sua query (um só para os tasks simultâneos da mesma
+	// QueryID, limitado a QueryMemory bytes), o estado dos operadores e os
+	// batches produzidos. Sem espaço os operadores gravam em SpillDir ou o
+	// task falha com executor.ErrMemoryLimitExceeded.
+	Memory      *executor.MemoryTracker
+	QueryMemory int64
+}
+
+// Execute roda o fragmento recebido pelo worker e devolve os batches produzidos.
+func Execute(engine executor.StorageScanner, req distributed.TaskRequest) distributed.TaskResult {
+	return ExecuteWithConfig(engine, req, Config{})
+}
+
+// ExecuteWithConfig é Execute com os limites de memória e o diretório de
+// spill do worker. As métricas dos operadores (executor.StatsReporter) voltam
+// em TaskResult.Stats.
+func ExecuteWithConfig(engine executor.StorageScanner, req distributed.TaskRequest, config Config) distributed.TaskResult {
+	start := time.Now()
+	result := distributed.TaskResult{TaskID: req.TaskID}
+	if req.Fragment == nil {
+		result.Error = "fragmento vazio"
+		return result
+	}
+	memory, release := config.Memory.Shared("query "+req.QueryID, config.QueryMemory)
+	defer release()
+	b := &builder{engine: engine, config: config, memory: memory}
+	root, err := b.build(req.Fragment)
+	if err != nil {
+		result.SetError(err)
+		return result
+	}
+	defer root.Close()
+	// os batches devolvidos contam no orçamento até o task terminar; depois
+	// passam para quem recebe o resultado
+	var output int64
+	defer func() { memory.Release(output) }()
+	alias := scanAlias(req.Fragment)
+	for {
+		batch, err := root.Next()
+		if err == nil {
+			size := executor.BatchBytes(batch)
+			if err = memory.Reserve(size); err == nil {
+				output += size
+			}
+		}
+		if err != nil {
+			if errors.Is(err, executor.ErrNoMoreBatches) {
+				break
+			}
+			result.SetError(err)
+			result.Batches = nil
+			return result
+		}
+		if alias != "" && !executor.IsPartialAggregate(batch) {
+			// o coordinator usa o alias para separar os lados de um join
+			if batch.Meta == nil {
+				batch.Meta = map[string]string{}
+			}
+			batch.Meta[executor.MetaAlias] = alias
+		}
+		result.Rows += batch.RowCount
+		result.Batches = append(result.Batches, batch)
+	}
+	result.Stats = b.stats()
+	result.Duration = time.Since(start)
+	return result
+}
+
+// scanAlias devolve o alias da tabela lida pelo fragmento.
+func scanAlias(node *query.PlanNode) string {
+	if node == nil {
+		return ""
+	}
+	if node.Type == query.PlanNodeScan {
+		var alias string
+		_, _ = node.DecodeProperty("alias", &alias)
+		return alias
+	}
+	for _, child := range node.Children {
+		if alias := scanAlias(child); alias != "" {
+			return alias
+		}
+	}
+	return ""
+}
+
+// Build instancia a árvore de executores correspondente ao nó do plano.
+func Build(engine executor.StorageScanner, node *query.PlanNode) (executor.Executor, error) {
+	return (&builder{engine: engine}).build(node)
+}
+
+// builder monta os executores de um fragmento e guarda os que publicam
+// métricas, por ID do nó.
+type builder struct {
+	engine    executor.StorageScanner
+	config    Config
+	memory    *executor.MemoryTracker
+	reporters map[string]executor.StatsReporter
+}
+
+func (b *builder) build(node *query.PlanNode) (executor.Executor, error) {
+	if node == nil {
+		return nil, fmt.Errorf("fragmento vazio")
+	}
+	var built executor.Executor
+	var err error
+	switch node.Type {
+	case query.PlanNodeScan:
+		built, err = b.buildScan(node, nil)
+	case query.PlanNodeFilter:
+		built, err = b.buildFilter(node)
+	case query.PlanNodeAggregate:
+		built, err = b.buildAggregate(node)
+	case query.PlanNodeSort:
+		built, err = b.buildSort(node)
+	case query.PlanNodeLimit:
+		built, err = b.buildLimit(node)
+	case query.PlanNodeTopN:
+		built, err = b.buildTopN(node)
+	default:
+		return nil, fmt.Errorf("nó %s não suportado no worker", node.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if reporter, ok := built.(executor.StatsReporter); ok {
+		if b.reporters == nil {
+			b.reporters = map[string]executor.StatsReporter{}
+		}
+		b.reporters[node.ID] = reporter
+	}
+	return built, nil
+}
+
+// stats coleta as métricas dos operadores depois da execução.
+func (b *builder) stats() map[string]map[string]int64 {
+	if len(b.reporters) == 0 {
+		return nil
+	}
+	stats := make(map[string]map[string]int64, len(b.reporters))
+	for id, reporter := range b.reporters {
+		stats[id] = reporter.Stats()
+	}
+	return stats
+}
+
+// buildScan cria o scan do nó; filter, quando presente, é compilado em
+// ScanOptions.Filter e avaliado dentro do loop do storage.
+func (b *builder) buildScan(node *query.PlanNode, filter query.Expression) (executor.Executor, error) {
+	var table string
+	if _, err := node.DecodeProperty("table", &table); err != nil {
+		return nil, err
+	}
+	if table == "" {
+		return nil, fmt.Errorf("fragmento sem tabela")
+	}
+	var opts storage.ScanOptions
+	if _, err := node.DecodeProperty("columns", &opts.Columns); err != nil {
+		return nil, err
+	}
+	if _, err := node.DecodeProperty("partitions", &opts.Partitions); err != nil {
+		return nil, err
+	}
+	found, err := node.DecodeProperty("prune", &opts.Prune)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		opts.Prune = expr.PruningPredicates(filter, nil)
+	}
+	if opts.Filter, err = expr.ScanFilter(filter); err != nil {
+		return nil, fmt.Errorf("scan %s: %w", node.ID, err)
+	}
+	opts.FilterColumns = expr.ReferencedColumns(filter)
+	return executor.NewScanExecutor(b.engine, table, opts), nil
+}
+
+func (b *builder) buildFilter(node *query.PlanNode) (executor.Executor, error) {
+	var spec query.ExpressionSpec
+	found, err := node.DecodeProperty("filter", &spec)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("filtro %s sem expressão serializada", node.ID)
+	}
+	filter, err := spec.Decode()
+	if err != nil {
+		return nil, fmt.Errorf("filtro %s: %w", node.ID, err)
+	}
+	// FILTER diretamente sobre SCAN: o predicado é empurrado para o storage.
+	if len(node.Children) == 1 && node.Children[0].Type == query.PlanNodeScan {
+		return b.buildScan(node.Children[0], filter)
+	}
+	child, err := b.buildSingleChild(node)
+	if err != nil {
+		return nil, err
+	}
+	predicate, err := expr.CompilePredicate(filter)
+	if err != nil {
+		return nil, fmt.Errorf("filtro %s: %w", node.ID, err)
+	}
+	return executor.NewFilterExecutor(child, func(row executor.RowView) (bool, error) {
+		return predicate(expr.FromReader(row))
+	}), nil
+}
+
+func (b *builder) buildAggregate(node *query.PlanNode) (executor.Executor, error) {
+	var stage string
+	if _, err := node.DecodeProperty("stage", &stage); err != nil {
+		return nil, err
+	}
+	switch stage {
+	case "LOCAL":
+		return b.buildPartialAggregate(node)
+	case "GLOBAL":
+		return b.buildFinalAggregate(node)
+	}
+	child, err := b.buildSingleChild(node)
+	if err != nil {
+		return nil, err
+	}
+	var groupKeys []string
+	if _, err := node.DecodeProperty("groupKeys", &groupKeys); err != nil {
+		return nil, err
+	}
+	var aggregates []planner.AggregateSpec
+	if _, err := node.DecodeProperty("aggregates", &aggregates); err != nil {
+		return nil, err
+	}
+	keys := make([]executor.GroupKey, 0, len(groupKeys))
+	for _, key := range groupKeys {
+		keys = append(keys, executor.GroupKey{Name: columnName(key)})
+	}
+	specs := make([]executor.AggregateSpec, 0, len(aggregates))
+	for _, agg := range aggregates {
+		specs = append(specs, executor.AggregateSpec{
+			Func:     executor.AggregateFunc(strings.ToUpper(agg.Func)),
+			Column:   columnName(agg.Expr),
+			Alias:    agg.Alias,
+			Distinct: agg.Distinct,
+			Params:   agg.Params,
+		})
+	}
+	return executor.NewExternalAggregateExecutor(child, executor.AggregateComplete, keys, specs, b.hashConfig()), nil
+}
+
+// buildPartialAggregate monta o stage LOCAL: chaves e argumentos chegam
+// serializados e o resultado são os estados parciais (#groupN, #aggN) que o
+// coordinator combina. A projeção do SELECT abaixo do LOCAL é ignorada; ela é
+// aplicada no coordinator sobre as linhas agregadas.
+func (b *builder) buildPartialAggregate(node *query.PlanNode) (executor.Executor, error) {
+	child, err := b.buildBelowProject(node)
+	if err != nil {
+		return nil, err
+	}
+	var groupBy []query.ExpressionSpec
+	if _, err := node.DecodeProperty("groupBy", &groupBy); err != nil {
+		return nil, err
+	}
+	var aggregates []planner.AggregateSpec
+	if _, err := node.DecodeProperty("aggregates", &aggregates); err != nil {
+		return nil, err
+	}
+	keys := make([]executor.GroupKey, 0, len(groupBy))
+	for i := range groupBy {
+		value, err := compileValue(node, &groupBy[i])
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, executor.GroupKey{Name: planner.GroupColumn(i), Value: value})
+	}
+	specs := make([]executor.AggregateSpec, 0, len(aggregates))
+	for i, agg := range aggregates {
+		spec := executor.AggregateSpec{
+			Func:     executor.AggregateFunc(strings.ToUpper(agg.Func)),
+			Column:   "*",
+			Alias:    stateColumn(agg, i),
+			Distinct: agg.Distinct,
+			Params:   agg.Params,
+		}
+		if agg.Arg != nil {
+			if spec.Value, err = compileValue(node, agg.Arg); err != nil {
+				return nil, err
+			}
+		}
+		specs = append(specs, spec)
+	}
+	return executor.NewExternalAggregateExecutor(child, executor.AggregatePartial, keys, specs, b.hashConfig()), nil
+}
+
+// buildFinalAggregate monta o stage GLOBAL, que combina os estados parciais
+// recebidos do LOCAL e mantém o layout #groupN/#aggN.
+func (b *builder) buildFinalAggregate(node *query.PlanNode) (executor.Executor, error) {
+	child, err := b.buildSingleChild(node)
+	if err != nil {
+		return nil, err
+	}
+	var groupKeys []string
+	if _, err := node.DecodeProperty("groupKeys", &groupKeys); err != nil {
+		return nil, err
+	}
+	var aggregates []planner.AggregateSpec
+	if _, err := node.DecodeProperty("aggregates", &aggregates); err != nil {
+		return nil, err
+	}
+	keys := make([]executor.GroupKey, 0, len(groupKeys))
+	for i := range groupKeys {
+		keys = append(keys, executor.GroupKey{Name: planner.GroupColumn(i)})
+	}
+	specs := make([]executor.AggregateSpec, 0, len(aggregates))
+	for i, agg := range aggregates {
+		column := stateColumn(agg, i)
+		specs = append(specs, executor.AggregateSpec{
+			Func:     executor.AggregateFunc(strings.ToUpper(agg.Func)),
+			Column:   column,
+			Alias:    column,
+			Distinct: agg.Distinct,
+			Params:   agg.Params,
+		})
+	}
+	return executor.NewExternalAggregateExecutor(child, executor.AggregateFinal, keys, specs, b.hashConfig()), nil
+}
+
+// stateColumn devolve a coluna #aggN da agregação; planos antigos não
+// gravavam o nome.
+func stateColumn(agg planner.AggregateSpec, index int) string {
+	if agg.Column != "" {
+		return agg.Column
+	}
+	return planner.AggregateColumn(index)
+}
+
+func compileValue(node *query.PlanNode, spec *query.ExpressionSpec) (executor.ValueFunc, error) {
+	e, err := spec.Decode()
+	if err != nil {
+		return nil, fmt.Errorf("nó %s (%s): %w", node.ID, node.Type, err)
+	}
+	eval, err := expr.Compile(e)
+	if err != nil {
+		return nil, fmt.Errorf("nó %s (%s): %w", node.ID, node.Type, err)
+	}
+	return func(row executor.RowView) (columnar.Value, error) {
+		return eval(expr.FromReader(row))
+	}, nil
+}
+
+func (b *builder) buildSort(node *query.PlanNode) (executor.Executor, error) {
+	child, err := b.buildSingleChild(node)
+	if err != nil {
+		return nil, err
+	}
+	var specs []planner.SortSpec
+	if _, err := node.DecodeProperty("keys", &specs); err != nil {
+		return nil, err
+	}
+	keys := make([]executor.SortKey, 0, len(specs))
+	for _, spec := range specs {
+		keys = append(keys, executor.SortKey{
+			Column:    columnName(spec.Expr),
+			Ascending: spec.Direction != query.SortDesc,
+		})
+	}
+	return executor.NewExternalSortExecutor(child, keys, executor.SortConfig{
+		MemoryLimit: b.config.SortMemory,
+		SpillDir:    b.config.SpillDir,
+		Memory:      b.memory,
+	}), nil
+}
+
+func (b *builder) hashConfig() executor.HashConfig {
+	return executor.HashConfig{MemoryLimit: b.config.HashMemory, SpillDir: b.config.SpillDir, Memory: b.memory}
+}
+
+// buildTopN monta o TOPN liberado para os workers: as chaves chegam
+// serializadas em orderBy e, como no stage LOCAL, a projeção abaixo dele é
+// ignorada. Sem orderBy as chaves são lidas pelo nome da coluna.
+func (b *builder) buildTopN(node *query.PlanNode) (executor.Executor, error) {
+	child, err := b.buildBelowProject(node)
+	if err != nil {
+		return nil, err
+	}
+	var specs []planner.SortSpec
+	if _, err := node.DecodeProperty("keys", &specs); err != nil {
+		return nil, err
+	}
+	var orderBy []query.ExpressionSpec
+	if _, err := node.DecodeProperty("orderBy", &orderBy); err != nil {
+		return nil, err
+	}
+	if len(orderBy) > 0 && len(orderBy) != len(specs) {
+		return nil, fmt.Errorf("topn %s: %d chaves serializadas para %d chaves", node.ID, len(orderBy), len(specs))
+	}
+	var count int64
+	found, err := node.DecodeProperty("count", &count)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("topn %s sem contagem", node.ID)
+	}
+	keys := make([]executor.SortKey, 0, len(specs))
+	for i, spec := range specs {
+		key := executor.SortKey{
+			Column:    columnName(spec.Expr),
+			Ascending: spec.Direction != query.SortDesc,
+		}
+		if len(orderBy) > 0 {
+			if key.Value, err = compileValue(node, &orderBy[i]); err != nil {
+				return nil, err
+			}
+		}
+		keys = append(keys, key)
+	}
+	return executor.NewTopNExecutor(child, keys, count, 0), nil
+}
+
+// buildLimit monta o LIMIT; o liberado para os workers (partial) ignora a
+// projeção abaixo dele, como o TOPN. O scan só lê as partições seguintes
+// enquanto o limite não foi atingido.
+func (b *builder) buildLimit(node *query.PlanNode) (executor.Executor, error) {
+	child, err := b.buildBelowProject(node)
+	if err != nil {
+		return nil, err
+	}
+	var count int64
+	found, err := node.DecodeProperty("count", &count)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("limite %s sem contagem", node.ID)
+	}
+	return executor.NewLimitExecutor(child, count), nil
+}
+
+// buildBelowProject monta o único filho do nó, pulando a projeção do SELECT
+// que o planner coloca entre ele e o fragmento.
+func (b *builder) buildBelowProject(node *query.PlanNode) (executor.Executor, error) {
+	if len(node.Children) != 1 {
+		return nil, fmt.Errorf("nó %s (%s) deve ter exatamente um filho", node.ID, node.Type)
+	}
+	input := node.Children[0]
+	if input.Type == query.PlanNodeProject {
+		if len(input.Children) != 1 {
+			return nil, fmt.Errorf("nó %s (%s) deve ter exatamente um filho", input.ID, input.Type)
+		}
+		input = input.Children[0]
+	}
+	return b.build(input)
+}
+
+func (b *builder) buildSingleChild(node *query.PlanNode) (executor.Executor, error) {
+	if len(node.Children) != 1 {
+		return nil, fmt.Errorf("nó %s (%s) deve ter exatamente um filho", node.ID, node.Type)
+	}
+	return b.build(node.Children[0])
+}
+
+// columnName remove o qualificador de tabela (e.user_id -> user_id): os batches
+// de um fragmento usam os nomes físicos das colunas. Caminhos aninhados chegam
+// entre crases (e.`payload.device.os`) e mantêm os pontos.
+func columnName(expr string) string {
+	if strings.HasSuffix(expr, "`") {
+		if idx := strings.Index(expr, "`"); idx < len(expr)-1 {
+			return expr[idx+1 : len(expr)-1]
+		}
+	}
+	if idx := strings.LastIndex(expr, "."); idx >= 0 {
+		return expr[idx+1:]
+	}
+	return expr
+}
@@ -0,0 +1,657 @@
+package fragment
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/Jonatan852/distributed-query-processing/internal/distributed"
+	"github.com/Jonatan852/distributed-query-processing/internal/executor"
+	"github.com/Jonatan852/distributed-query-processing/internal/parser"
+	"github.com/Jonatan852/distributed-query-processing/internal/planner"
+	"github.com/Jonatan852/distributed-query-processing/internal/runtime/runner"
+	"github.com/Jonatan852/distributed-query-processing/internal/storage"
+	"github.com/Jonatan852/distributed-query-processing/pkg/columnar"
+	"github.com/Jonatan852/distributed-query-processing/pkg/query"
+)
+
+func TestExecuteFilterScanFragment(t *testing.T) {
+	engine, err := storage.NewEngine(filepath.Join(t.TempDir(), "data"))
+	if err != nil {
+		t.Fatalf("erro criando engine: %v", err)
+	}
+	schema := storage.TableSchema{
+		Name: "events",
+		Columns: []storage.ColumnSchema{
+			{Name: "user_id", Type: columnar.TypeInt},
+			{Name: "country", Type: columnar.TypeString},
+		},
+	}
+	if err := engine.RegisterTable(schema); err != nil {
+		t.Fatalf("erro registrando tabela: %v", err)
+	}
+	rows := []storage.Row{
+		{"user_id": columnar.NewIntValue(1), "country": columnar.NewStringValue("BR")},
+		{"user_id": columnar.NewIntValue(2), "country": columnar.NewStringValue("US")},
+		{"user_id": columnar.NewIntValue(3), "country": columnar.NewStringValue("BR")},
+	}
+	if _, err := engine.Ingest("events", "p1", rows); err != nil {
+		t.Fatalf("erro ao ingerir dados: %v", err)
+	}
+
+	scan := query.NewPlanNode(query.PlanNodeScan)
+	scan.Properties["table"] = "events"
+	scan.Properties["columns"] = schema.ColumnNames()
+	filter := query.NewPlanNode(query.PlanNodeFilter)
+	filter.Properties["filter"] = query.EncodeExpression(query.BinaryExpr{
+		Left:     query.ColumnRef{Table: "events", Name: "country"},
+		Operator: "=",
+		Right:    query.Literal{Value: columnar.NewStringValue("BR")},
+	})
+	filter.AddChild(scan)
+
+	// Simula o caminho de um worker remoto, que recebe o fragmento via JSON.
+	data, err := json.Marshal(filter)
+	if err != nil {
+		t.Fatalf("erro serializando fragmento: %v", err)
+	}
+	var decoded query.PlanNode
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("erro desserializando fragmento: %v", err)
+	}
+
+	result := Execute(engine, distributed.TaskRequest{TaskID: "t1", Fragment: &decoded})
+	if result.Error != "" {
+		t.Fatalf("fragmento falhou: %s", result.Error)
+	}
+	if result.Rows != 2 {
+		t.Fatalf("esperava 2 linhas, obteve %d", result.Rows)
+	}
+	for _, batch := range result.Batches {
+		col := batch.Columns["country"]
+		for i := 0; i < batch.RowCount; i++ {
+			val, _ := col.Get(i)
+			if s, _ := val.AsString(); s != "BR" {
+				t.Fatalf("linha não filtrada: %s", s)
+			}
+		}
+	}
+}
+
+type recordingScanner struct {
+	opts storage.ScanOptions
+}
+
+func (r *recordingScanner) Scan(table string, opts storage.ScanOptions) ([]storage.RecordBatch, error) {
+	r.opts = opts
+	return nil, nil
+}
+
+func TestFilterIsPushedIntoScan(t *testing.T) {
+	scan := query.NewPlanNode(query.PlanNodeScan)
+	scan.Properties["table"] = "events"
+	filter := query.NewPlanNode(query.PlanNodeFilter)
+	filter.Properties["filter"] = query.EncodeExpression(query.BetweenExpr{
+		Expr:  query.ColumnRef{Name: "user_id"},
+		Lower: query.Literal{Value: columnar.NewIntValue(1)},
+		Upper: query.Literal{Value: columnar.NewIntValue(5)},
+	})
+	filter.AddChild(scan)
+
+	scanner := &recordingScanner{}
+	root, err := Build(scanner, filter)
+	if err != nil {
+		t.Fatalf("erro montando fragmento: %v", err)
+	}
+	if _, err := root.Next(); err == nil {
+		t.Fatalf("esperava fim dos batches")
+	}
+	if scanner.opts.Filter == nil {
+		t.Fatalf("filtro não foi empurrado para ScanOptions.Filter")
+	}
+	if len(scanner.opts.Prune) != 1 || scanner.opts.Prune[0].Operator != storage.PruneBetween {
+		t.Fatalf("predicado de poda não derivado do filtro: %v", scanner.opts.Prune)
+	}
+}
+
+func TestExecutePartialAggregateFragment(t *testing.T) {
+	engine, err := storage.NewEngine(filepath.Join(t.TempDir(), "data"))
+	if err != nil {
+		t.Fatalf("erro criando engine: %v", err)
+	}
+	schema := storage.TableSchema{
+		Name: "events",
+		Columns: []storage.ColumnSchema{
+			{Name: "user_id", Type: columnar.TypeInt},
+			{Name: "country", Type: columnar.TypeString},
+			{Name: "amount", Type: columnar.TypeFloat},
+		},
+	}
+	if err := engine.RegisterTable(schema); err != nil {
+		t.Fatalf("erro registrando tabela: %v", err)
+	}
+	row := func(user int64, country string, amount float64) storage.Row {
+		return storage.Row{
+			"user_id": columnar.NewIntValue(user),
+			"country": columnar.NewStringValue(country),
+			"amount":  columnar.NewFloatValue(amount),
+		}
+	}
+	partitions := map[string][]storage.Row{
+		"p1": {row(1, "BR", 1), row(2, "BR", 2), row(9, "BR", -1)},
+		"p2": {row(1, "BR", 6), row(3, "US", 4)},
+	}
+	for id, rows := range partitions {
+		if _, err := engine.Ingest("events", id, rows); err != nil {
+			t.Fatalf("erro ao ingerir dados: %v", err)
+		}
+	}
+
+	stmt, err := parser.Parse(`SELECT LOWER(country) AS c, AVG(amount * 2) AS avg, COUNT(DISTINCT user_id) AS users, PERCENTILE_APPROX(amount, 0.5) AS median, ARRAY_AGG(user_id) AS ids FROM events WHERE amount > 0 GROUP BY c ORDER BY c`)
+	if err != nil {
+		t.Fatalf("parser falhou: %v", err)
+	}
+	plan, err := planner.New(engine).Build(stmt)
+	if err != nil {
+		t.Fatalf("planner falhou: %v", err)
+	}
+	local := findNode(plan.Root, func(node *query.PlanNode) bool {
+		return node.Type == query.PlanNodeAggregate && node.Properties["stage"] == "LOCAL"
+	})
+	if local == nil || local.Properties["partial"] != true {
+		t.Fatalf("stage LOCAL deveria poder rodar nos workers: %+v", local)
+	}
+
+	// um task por partição, como o coordinator faz; cada worker devolve
+	// apenas estados parciais
+	var batches []*executor.Batch
+	for _, id := range []string{"p1", "p2"} {
+		fragment := local.Clone()
+		findNode(fragment, func(node *query.PlanNode) bool { return node.Type == query.PlanNodeScan }).Properties["partitions"] = []string{id}
+		data, err := json.Marshal(fragment)
+		if err != nil {
+			t.Fatalf("erro serializando fragmento: %v", err)
+		}
+		var decoded query.PlanNode
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Fatalf("erro desserializando fragmento: %v", err)
+		}
+		result := Execute(engine, distributed.TaskRequest{TaskID: id, Fragment: &decoded})
+		if result.Error != "" {
+			t.Fatalf("fragmento %s falhou: %s", id, result.Error)
+		}
+		for _, batch := range result.Batches {
+			if !executor.IsPartialAggregate(batch) {
+				t.Fatalf("fragmento %s deveria devolver estados parciais: %+v", id, batch)
+			}
+		}
+		batches = append(batches, result.Batches...)
+	}
+
+	rows, err := runner.New(engine).Merge(stmt, batches)
+	if err != nil {
+		t.Fatalf("merge falhou: %v", err)
+	}
+	if len(rows) != 2 || rows[0]["c"] != "br" || rows[0]["avg"] != float64(6) || rows[0]["users"] != int64(2) ||
+		rows[1]["c"] != "us" || rows[1]["avg"] != float64(8) || rows[1]["users"] != int64(1) {
+		t.Fatalf("merge dos estados parciais incorreto: %v", rows)
+	}
+	// os parâmetros das agregações chegam aos workers pelo fragmento
+	if rows[0]["median"] != float64(2) || fmt.Sprint(rows[0]["ids"]) != "[1 2 1]" || fmt.Sprint(rows[1]["ids"]) != "[3]" {
+		t.Fatalf("mediana e listas parciais incorretas: %v", rows)
+	}
+}
+
+func findNode(node *query.PlanNode, match func(*query.PlanNode) bool) *query.PlanNode {
+	if node == nil || match(node) {
+		return node
+	}
+	for _, child := range node.Children {
+		if found := findNode(child, match); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func TestExecuteSortFragmentSpills(t *testing.T) {
+	dir := t.TempDir()
+	engine, err := storage.NewEngine(filepath.Join(dir, "data"))
+	if err != nil {
+		t.Fatalf("erro criando engine: %v", err)
+	}
+	schema := storage.TableSchema{
+		Name:    "events",
+		Columns: []storage.ColumnSchema{{Name: "user_id", Type: columnar.TypeInt}},
+	}
+	if err := engine.RegisterTable(schema); err != nil {
+		t.Fatalf("erro registrando tabela: %v", err)
+	}
+	for p := 0; p < 4; p++ {
+		var rows []storage.Row
+		for i := 0; i < 200; i++ {
+			rows = append(rows, storage.Row{"user_id": columnar.NewIntValue(int64((i*31 + p) % 97))})
+		}
+		if _, err := engine.Ingest("events", fmt.Sprintf("p%d", p), rows); err != nil {
+			t.Fatalf("erro ao ingerir dados: %v", err)
+		}
+	}
+
+	scan := query.NewPlanNode(query.PlanNodeScan)
+	scan.Properties["table"] = "events"
+	scan.Properties["columns"] = schema.ColumnNames()
+	sort := query.NewPlanNode(query.PlanNodeSort)
+	sort.Properties["keys"] = []planner.SortSpec{{Expr: "events.user_id", Direction: query.SortAsc}}
+	sort.AddChild(scan)
+
+	result := ExecuteWithConfig(engine, distributed.TaskRequest{TaskID: "t1", Fragment: sort}, Config{
+		SpillDir:   filepath.Join(dir, "spill"),
+		SortMemory: 2 << 10,
+	})
+	if result.Error != "" {
+		t.Fatalf("fragmento falhou: %s", result.Error)
+	}
+	if result.Rows != 800 {
+		t.Fatalf("esperava 800 linhas, obteve %d", result.Rows)
+	}
+	previous := int64(-1)
+	for _, batch := range result.Batches {
+		for i := 0; i < batch.RowCount; i++ {
+			value, _ := batch.Columns["user_id"].Get(i)
+			current, _ := value.AsInt()
+			if current < previous {
+				t.Fatalf("saída fora de ordem: %d depois de %d", current, previous)
+			}
+			previous = current
+		}
+	}
+	if stats := result.Stats[sort.ID]; stats["spilledRuns"] < 2 || stats["spilledBytes"] == 0 {
+		t.Fatalf("esperava spill registrado no nó %s, obteve %v", sort.ID, result.Stats)
+	}
+}
+
+func TestExecuteTopNFragment(t *testing.T) {
+	engine, err := storage.NewEngine(filepath.Join(t.TempDir(), "data"))
+	if err != nil {
+		t.Fatalf("erro criando engine: %v", err)
+	}
+	schema := storage.TableSchema{
+		Name: "events",
+		Columns: []storage.ColumnSchema{
+			{Name: "user_id", Type: columnar.TypeInt},
+			{Name: "amount", Type: columnar.TypeFloat},
+		},
+	}
+	if err := engine.RegisterTable(schema); err != nil {
+		t.Fatalf("erro registrando tabela: %v", err)
+	}
+	for p := 0; p < 3; p++ {
+		var rows []storage.Row
+		for i := 0; i < 100; i++ {
+			rows = append(rows, storage.Row{
+				"user_id": columnar.NewIntValue(int64(p*100 + i)),
+				"amount":  columnar.NewFloatValue(float64((i*37 + p*11) % 101)),
+			})
+		}
+		if _, err := engine.Ingest("events", fmt.Sprintf("p%d", p), rows); err != nil {
+			t.Fatalf("erro ao ingerir dados: %v", err)
+		}
+	}
+
+	stmt, err := parser.Parse(`SELECT user_id, amount * 2 AS double FROM events WHERE user_id % 2 = 0 ORDER BY double DESC, user_id LIMIT 4`)
+	if err != nil {
+		t.Fatalf("parser falhou: %v", err)
+	}
+	plan, err := planner.New(engine).Build(stmt)
+	if err != nil {
+		t.Fatalf("planner falhou: %v", err)
+	}
+	top := findNode(plan.Root, func(node *query.PlanNode) bool { return node.Type == query.PlanNodeTopN })
+	if top == nil || top.Properties["partial"] != true {
+		t.Fatalf("TOPN deveria poder rodar nos workers: %+v", top)
+	}
+
+	var batches []*executor.Batch
+	for _, id := range []string{"p0", "p1", "p2"} {
+		fragment := top.Clone()
+		findNode(fragment, func(node *query.PlanNode) bool { return node.Type == query.PlanNodeScan }).Properties["partitions"] = []string{id}
+		data, err := json.Marshal(fragment)
+		if err != nil {
+			t.Fatalf("erro serializando fragmento: %v", err)
+		}
+		var decoded query.PlanNode
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Fatalf("erro desserializando fragmento: %v", err)
+		}
+		result := Execute(engine, distributed.TaskRequest{TaskID: id, Fragment: &decoded})
+		if result.Error != "" {
+			t.Fatalf("fragmento %s falhou: %s", id, result.Error)
+		}
+		// cada task devolve no máximo LIMIT linhas
+		if result.Rows != 4 {
+			t.Fatalf("fragmento %s devolveu %d linhas", id, result.Rows)
+		}
+		batches = append(batches, result.Batches...)
+	}
+
+	rows, err := runner.New(engine).Merge(stmt, batches)
+	if err != nil {
+		t.Fatalf("merge falhou: %v", err)
+	}
+	// o maior amount é 100 (dobrado 200); empates saem por user_id
+	want := "[200/30 200/284 198/60 196/90]"
+	var got []string
+	for _, row := range rows {
+		got = append(got, fmt.Sprintf("%v/%v", row["double"], row["user_id"]))
+	}
+	if fmt.Sprint(got) != want {
+		t.Fatalf("top-N incorreto: %v, esperava %s", got, want)
+	}
+}
+
+func TestExecuteLimitFragmentReadsFirstPartition(t *testing.T) {
+	engine, err := storage.NewEngine(filepath.Join(t.TempDir(), "data"))
+	if err != nil {
+		t.Fatalf("erro criando engine: %v", err)
+	}
+	schema := storage.TableSchema{
+		Name: "events",
+		Columns: []storage.ColumnSchema{
+			{Name: "user_id", Type: columnar.TypeInt},
+			{Name: "country", Type: columnar.TypeString},
+		},
+	}
+	if err := engine.RegisterTable(schema); err != nil {
+		t.Fatalf("erro registrando tabela: %v", err)
+	}
+	for p := 0; p < 3; p++ {
+		var rows []storage.Row
+		for i := 0; i < 100; i++ {
+			rows = append(rows, storage.Row{
+				"user_id": columnar.NewIntValue(int64(p*100 + i)),
+				"country": columnar.NewStringValue("BR"),
+			})
+		}
+		if _, err := engine.Ingest("events", fmt.Sprintf("p%d", p), rows); err != nil {
+			t.Fatalf("erro ao ingerir dados: %v", err)
+		}
+	}
+
+	stmt, err := parser.Parse(`SELECT user_id FROM events LIMIT 20`)
+	if err != nil {
+		t.Fatalf("parser falhou: %v", err)
+	}
+	plan, err := planner.New(engine).Build(stmt)
+	if err != nil {
+		t.Fatalf("planner falhou: %v", err)
+	}
+	limit := findNode(plan.Root, func(node *query.PlanNode) bool { return node.Type == query.PlanNodeLimit })
+	if limit == nil || limit.Properties["partial"] != true {
+		t.Fatalf("LIMIT deveria poder rodar nos workers: %+v", limit)
+	}
+	scan := findNode(limit, func(node *query.PlanNode) bool { return node.Type == query.PlanNodeScan })
+
+	// um único task com as três partições para no primeiro
+	result := Execute(engine, distributed.TaskRequest{TaskID: "t1", Fragment: limit})
+	if result.Error != "" {
+		t.Fatalf("fragmento falhou: %s", result.Error)
+	}
+	if result.Rows != 20 {
+		t.Fatalf("esperava 20 linhas, obteve %d", result.Rows)
+	}
+	if read := result.Stats[scan.ID]["partitionsRead"]; read != 1 {
+		t.Fatalf("LIMIT 20 deveria ler só a primeira partição, leu %d", read)
+	}
+
+	rows, err := runner.New(engine).Merge(stmt, result.Batches)
+	if err != nil {
+		t.Fatalf("merge falhou: %v", err)
+	}
+	if len(rows) != 20 || rows[0]["user_id"] != int64(0) || rows[19]["user_id"] != int64(19) {
+		t.Fatalf("resultado incorreto: %v", rows)
+	}
+}
+
+func TestCoordinatorLimitReadsFirstPartition(t *testing.T) {
+	engine, err := storage.NewEngine(filepath.Join(t.TempDir(), "data"))
+	if err != nil {
+		t.Fatalf("erro criando engine: %v", err)
+	}
+	schema := storage.TableSchema{
+		Name:    "events",
+		Columns: []storage.ColumnSchema{{Name: "user_id", Type: columnar.TypeInt}},
+	}
+	if err := engine.RegisterTable(schema); err != nil {
+		t.Fatalf("erro registrando tabela: %v", err)
+	}
+	for p := 0; p < 4; p++ {
+		var rows []storage.Row
+		for i := 0; i < 100; i++ {
+			rows = append(rows, storage.Row{"user_id": columnar.NewIntValue(int64(p*100 + i))})
+		}
+		if _, err := engine.Ingest("events", fmt.Sprintf("p%d", p), rows); err != nil {
+			t.Fatalf("erro ao ingerir dados: %v", err)
+		}
+	}
+	stmt, err := parser.Parse(`SELECT user_id FROM events LIMIT 5`)
+	if err != nil {
+		t.Fatalf("parser falhou: %v", err)
+	}
+	plan, err := planner.New(engine).Build(stmt)
+	if err != nil {
+		t.Fatalf("planner falhou: %v", err)
+	}
+
+	// com o catálogo o coordinator dividiria o scan por partição; o LIMIT
+	// continua em um único task que para na primeira partição
+	coord := distributed.NewCoordinatorWithConfig(distributed.Config{Catalog: engine})
+	for _, id := range []string{"w1", "w2"} {
+		coord.Register(distributed.NewLocalWorker(id, func(req distributed.TaskRequest) distributed.TaskResult {
+			return Execute(engine, req)
+		}))
+	}
+	id, err := coord.Submit(plan)
+	if err != nil {
+		t.Fatalf("submit falhou: %v", err)
+	}
+	if err := coord.Wait(id); err != nil {
+		t.Fatalf("query falhou: %v", err)
+	}
+	if results, _ := coord.QueryResults(id); len(results) != 1 || results[0].Rows != 5 {
+		t.Fatalf("esperava um task com 5 linhas, obteve %+v", results)
+	}
+	executed, err := coord.QueryPlan(id)
+	if err != nil {
+		t.Fatalf("plano indisponível: %v", err)
+	}
+	scan := findNode(executed.Root, func(node *query.PlanNode) bool { return node.Type == query.PlanNodeScan })
+	if read := scan.Stats["partitionsRead"]; read != int64(1) {
+		t.Fatalf("LIMIT 5 deveria abrir só a primeira das 4 partições, abriu %v", read)
+	}
+}
+
+func TestExecuteAggregateFragmentSpills(t *testing.T) {
+	dir := t.TempDir()
+	engine, err := storage.NewEngine(filepath.Join(dir, "data"))
+	if err != nil {
+		t.Fatalf("erro criando engine: %v", err)
+	}
+	schema := storage.TableSchema{
+		Name: "events",
+		Columns: []storage.ColumnSchema{
+			{Name: "user_id", Type: columnar.TypeInt},
+			{Name: "amount", Type: columnar.TypeInt},
+		},
+	}
+	if err := engine.RegisterTable(schema); err != nil {
+		t.Fatalf("erro registrando tabela: %v", err)
+	}
+	for p := 0; p < 4; p++ {
+		var rows []storage.Row
+		for i := 0; i < 500; i++ {
+			rows = append(rows, storage.Row{
+				"user_id": columnar.NewIntValue(int64((p*500 + i) % 1000)),
+				"amount":  columnar.NewIntValue(1),
+			})
+		}
+		if _, err := engine.Ingest("events", fmt.Sprintf("p%d", p), rows); err != nil {
+			t.Fatalf("erro ao ingerir dados: %v", err)
+		}
+	}
+
+	stmt, err := parser.Parse(`SELECT user_id, SUM(amount) AS total FROM events GROUP BY user_id`)
+	if err != nil {
+		t.Fatalf("parser falhou: %v", err)
+	}
+	plan, err := planner.New(engine).Build(stmt)
+	if err != nil {
+		t.Fatalf("planner falhou: %v", err)
+	}
+	local := findNode(plan.Root, func(node *query.PlanNode) bool {
+		return node.Type == query.PlanNodeAggregate && node.Properties["stage"] == "LOCAL"
+	})
+	result := ExecuteWithConfig(engine, distributed.TaskRequest{TaskID: "t1", Fragment: local}, Config{
+		SpillDir:   filepath.Join(dir, "spill"),
+		HashMemory: 4 << 10,
+	})
+	if result.Error != "" {
+		t.Fatalf("fragmento falhou: %s", result.Error)
+	}
+	if stats := result.Stats[local.ID]; stats["spilledPartitions"] == 0 || stats["spilledRows"] == 0 {
+		t.Fatalf("esperava spill registrado no nó %s, obteve %v", local.ID, result.Stats)
+	}
+	rows, err := runner.New(engine).Merge(stmt, result.Batches)
+	if err != nil {
+		t.Fatalf("merge falhou: %v", err)
+	}
+	var total int64
+	for _, row := range rows {
+		total += row["total"].(int64)
+	}
+	if len(rows) != 1000 || total != 2000 {
+		t.Fatalf("esperava 1000 grupos somando 2000, obteve %d grupos somando %d", len(rows), total)
+	}
+	if entries, _ := os.ReadDir(filepath.Join(dir, "spill")); len(entries) != 0 {
+		t.Fatalf("partições não foram apagadas: %d arquivos", len(entries))
+	}
+}
+
+func TestExecuteFailsOnQueryMemoryLimit(t *testing.T) {
+	engine, err := storage.NewEngine(filepath.Join(t.TempDir(), "data"))
+	if err != nil {
+		t.Fatalf("erro criando engine: %v", err)
+	}
+	schema := storage.TableSchema{
+		Name:    "events",
+		Columns: []storage.ColumnSchema{{Name: "user_id", Type: columnar.TypeInt}},
+	}
+	if err := engine.RegisterTable(schema); err != nil {
+		t.Fatalf("erro registrando tabela: %v", err)
+	}
+	var rows []storage.Row
+	for i := 0; i < 1000; i++ {
+		rows = append(rows, storage.Row{"user_id": columnar.NewIntValue(int64(i))})
+	}
+	if _, err := engine.Ingest("events", "p1", rows); err != nil {
+		t.Fatalf("erro ao ingerir dados: %v", err)
+	}
+	scan := query.NewPlanNode(query.PlanNodeScan)
+	scan.Properties["table"] = "events"
+	scan.Properties["columns"] = schema.ColumnNames()
+
+	process := executor.NewMemoryTracker("worker", 0)
+	config := Config{Memory: process, QueryMemory: 1 << 10}
+	result := ExecuteWithConfig(engine, distributed.TaskRequest{QueryID: "q-0001", TaskID: "t1", Fragment: scan}, config)
+	if result.ErrorCode != distributed.ErrorCodeMemoryLimit || !errors.Is(result.Err(), executor.ErrMemoryLimitExceeded) {
+		t.Fatalf("esperava falha por memória, obteve %q (%q)", result.Error, result.ErrorCode)
+	}
+	if len(result.Batches) != 0 || process.Used() != 0 {
+		t.Fatalf("task com erro não deveria devolver batches nem manter reservas: %d batches, %d bytes", len(result.Batches), process.Used())
+	}
+
+	config.QueryMemory = 1 << 20
+	result = ExecuteWithConfig(engine, distributed.TaskRequest{QueryID: "q-0002", TaskID: "t1", Fragment: scan}, config)
+	if result.Error != "" || result.Rows != 1000 {
+		t.Fatalf("task dentro do orçamento falhou: %q, %d linhas", result.Error, result.Rows)
+	}
+	if process.Used() != 0 || process.Peak() == 0 {
+		t.Fatalf("os batches devolvidos deveriam ter sido reservados e liberados: uso %d, pico %d", process.Used(), process.Peak())
+	}
+}
+
+func TestExecuteSharesQueryMemoryAcrossTasks(t *testing.T) {
+	engine, err := storage.NewEngine(filepath.Join(t.TempDir(), "data"))
+	if err != nil {
+		t.Fatalf("erro criando engine: %v", err)
+	}
+	schema := storage.TableSchema{
+		Name:    "events",
+		Columns: []storage.ColumnSchema{{Name: "user_id", Type: columnar.TypeInt}},
+	}
+	if err := engine.RegisterTable(schema); err != nil {
+		t.Fatalf("erro registrando tabela: %v", err)
+	}
+	var rows []storage.Row
+	for i := 0; i < 1000; i++ {
+		rows = append(rows, storage.Row{"user_id": columnar.NewIntValue(int64(i))})
+	}
+	if _, err := engine.Ingest("events", "p1", rows); err != nil {
+		t.Fatalf("erro ao ingerir dados: %v", err)
+	}
+	scan := query.NewPlanNode(query.PlanNodeScan)
+	scan.Properties["table"] = "events"
+	scan.Properties["columns"] = schema.ColumnNames()
+
+	// o pico de um task sozinho dimensiona o orçamento da query
+	process := executor.NewMemoryTracker("worker", 0)
+	config := Config{Memory: process}
+	if result := ExecuteWithConfig(engine, distributed.TaskRequest{QueryID: "q-0000", TaskID: "t1", Fragment: scan}, config); result.Error != "" {
+		t.Fatalf("task falhou: %s", result.Error)
+	}
+	task := process.Peak()
+
+	// quatro tasks simultâneos cabem em quatro vezes o pico de um
+	config.QueryMemory = 4 * task
+	var wg sync.WaitGroup
+	results := make([]distributed.TaskResult, 4)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = ExecuteWithConfig(engine, distributed.TaskRequest{QueryID: "q-0001", TaskID: fmt.Sprintf("t%d", i), Fragment: scan}, config)
+		}(i)
+	}
+	wg.Wait()
+	for i, result := range results {
+		if result.Error != "" || result.Rows != 1000 {
+			t.Fatalf("task %d falhou: %q, %d linhas", i, result.Error, result.Rows)
+		}
+	}
+	if process.Used() != 0 {
+		t.Fatalf("os tasks deveriam liberar as reservas, restaram %d bytes", process.Used())
+	}
+
+	// enquanto um task da query segura quase todo o orçamento, outro task da
+	// mesma query não cabe; o de outra query tem orçamento próprio
+	running, release := process.Shared("query q-0002", config.QueryMemory)
+	if err := running.Reserve(config.QueryMemory - task/2); err != nil {
+		t.Fatalf("reserva do task em andamento falhou: %v", err)
+	}
+	result := ExecuteWithConfig(engine, distributed.TaskRequest{QueryID: "q-0002", TaskID: "t2", Fragment: scan}, config)
+	if !errors.Is(result.Err(), executor.ErrMemoryLimitExceeded) {
+		t.Fatalf("o orçamento da query deveria valer para todos os seus tasks, obteve %q", result.Error)
+	}
+	result = ExecuteWithConfig(engine, distributed.TaskRequest{QueryID: "q-0003", TaskID: "t1", Fragment: scan}, config)
+	if result.Error != "" {
+		t.Fatalf("task de outra query falhou: %s", result.Error)
+	}
+	running.Release(config.QueryMemory - task/2)
+	release()
+	if process.Used() != 0 {
+		t.Fatalf("restaram %d bytes reservados", process.Used())
+	}
+}
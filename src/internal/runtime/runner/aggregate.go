@@ -0,0 +1,385 @@
+package runner
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/Jonatan852/distributed-query-processing/internal/executor"
+	"github.com/Jonatan852/distributed-query-processing/internal/expr"
+	"github.com/Jonatan852/distributed-query-processing/internal/planner"
+	"github.com/Jonatan852/distributed-query-processing/pkg/columnar"
+	"github.com/Jonatan852/distributed-query-processing/pkg/query"
+)
+
+// grouping agrupa as linhas que passaram pelo WHERE (ou combina os estados
+// parciais calculados pelos workers) e calcula as agregações de cada grupo.
+// SELECT, HAVING e ORDER BY vêm reescritos por planner.AnalyzeAggregation
+// para ler as colunas #groupN e #aggN da linha do grupo.
+//
+// Os grupos ficam no executor.AggregateExecutor do stage final (GLOBAL): as
+// linhas lidas no coordinator são pré-agregadas em lotes (stage parcial) e os
+// estados entram no stage final junto com os dos workers, de modo que o
+// estado respeita o HashConfig da query e vai para disco quando passa dele.
+type grouping struct {
+	keys       []expr.Evaluator
+	aggregates []aggregateCall
+
+	columns []query.SelectItem
+	having  query.Expression
+	orderBy []query.OrderExpression
+}
+
+type aggregateCall struct {
+	fn       executor.AggregateFunc
+	distinct bool
+	// arg é nil em COUNT(*)
+	arg    expr.Evaluator
+	params []columnar.Value
+}
+
+func newGrouping(stmt *query.SelectStatement, metadata planner.MetadataProvider) (*grouping, error) {
+	analysis, err := planner.AnalyzeAggregation(stmt, metadata)
+	if err != nil {
+		return nil, fmt.Errorf("runner: %w", err)
+	}
+	g := &grouping{
+		columns: analysis.Columns,
+		having:  analysis.Having,
+		orderBy: analysis.OrderBy,
+	}
+	for _, e := range analysis.GroupBy {
+		key, err := expr.Compile(e)
+		if err != nil {
+			return nil, err
+		}
+		g.keys = append(g.keys, key)
+	}
+	for _, call := range analysis.Aggregates {
+		compiled, err := compileAggregate(call)
+		if err != nil {
+			return nil, err
+		}
+		g.aggregates = append(g.aggregates, compiled)
+	}
+	return g, nil
+}
+
+// compileAggregate compila o argumento e avalia os parâmetros constantes de
+// uma agregação já validada por planner.AnalyzeAggregation.
+func compileAggregate(call query.FunctionCall) (aggregateCall, error) {
+	params, err := planner.AggregateParams(call)
+	if err != nil {
+		return aggregateCall{}, err
+	}
+	result := aggregateCall{fn: executor.AggregateFunc(strings.ToUpper(call.Name)), distinct: call.Distinct, params: params}
+	arg := planner.AggregateArgument(call)
+	if _, ok := arg.(query.Wildcard); ok {
+		return result, nil
+	}
+	eval, err := expr.Compile(arg)
+	if err != nil {
+		return aggregateCall{}, err
+	}
+	result.arg = eval
+	return result, nil
+}
+
+// aggregate agrupa as linhas de rows, junto com os estados parciais dos
+// batches de table, e devolve as linhas dos grupos; o HAVING fica com quem
+// chama. As métricas de spill do stage final vão para stats.
+func (g *grouping) aggregate(table *tableInput, rows rowStream, config executor.HashConfig, stats Stats) *groupRows {
+	keys := make([]executor.GroupKey, len(g.keys))
+	for i := range g.keys {
+		keys[i] = executor.GroupKey{Name: planner.GroupColumn(i)}
+	}
+	specs := make([]executor.AggregateSpec, len(g.aggregates))
+	for i, call := range g.aggregates {
+		specs[i] = executor.AggregateSpec{
+			Func:     call.fn,
+			Column:   planner.AggregateColumn(i),
+			Alias:    planner.AggregateColumn(i),
+			Distinct: call.distinct,
+			Params:   call.params,
+		}
+	}
+	input := &partialInput{grouping: g, sets: table.sets, rows: rows}
+	final := executor.NewExternalAggregateExecutor(input, executor.AggregateFinal, keys, specs, config)
+	return &groupRows{grouping: g, final: final, alias: strings.ToLower(table.alias), stats: stats}
+}
+
+// partialRows é quantas linhas lidas no coordinator são pré-agregadas por vez.
+const partialRows = 1024
+
+// partialInput entrega ao stage final os batches com estados parciais: os
+// que vieram dos workers e, depois, os calculados sobre lotes de linhas de
+// rows por um AggregateExecutor do stage parcial. As chaves e os argumentos
+// são avaliados sobre as linhas do lote, que o batch referencia pela coluna
+// partialRowColumn.
+type partialInput struct {
+	grouping *grouping
+	sets     []columnSet
+	rows     rowStream
+	set      int
+	chunk    []rowContext
+	done     bool
+}
+
+const partialRowColumn = "#row"
+
+func (p *partialInput) Next() (*executor.Batch, error) {
+	for p.set < len(p.sets) {
+		set := p.sets[p.set]
+		p.set++
+		if set.partial {
+			return &executor.Batch{Columns: set.columns, RowCount: set.rows}, nil
+		}
+	}
+	for !p.done {
+		p.chunk = p.chunk[:0]
+		for len(p.chunk) < partialRows {
+			ctx, err := p.rows.next()
+			if err == io.EOF {
+				p.done = true
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			p.chunk = append(p.chunk, ctx)
+		}
+		if len(p.chunk) == 0 {
+			break
+		}
+		batch, err := p.aggregateChunk()
+		if err != nil {
+			return nil, err
+		}
+		if batch.RowCount > 0 {
+			return batch, nil
+		}
+	}
+	return nil, executor.ErrNoMoreBatches
+}
+
+// aggregateChunk calcula os estados parciais das linhas de p.chunk.
+func (p *partialInput) aggregateChunk() (*executor.Batch, error) {
+	refs := columnar.NewColumn(partialRowColumn, columnar.TypeInt)
+	refs.IntData = make([]int64, len(p.chunk))
+	for i := range refs.IntData {
+		refs.IntData[i] = int64(i)
+	}
+	row := func(view executor.RowView) (rowContext, error) {
+		ref, err := view.Value(partialRowColumn)
+		if err != nil {
+			return rowContext{}, err
+		}
+		index, _ := ref.AsInt()
+		return p.chunk[index], nil
+	}
+	g := p.grouping
+	keys := make([]executor.GroupKey, len(g.keys))
+	for i, key := range g.keys {
+		key := key
+		keys[i] = executor.GroupKey{Name: planner.GroupColumn(i), Value: func(view executor.RowView) (columnar.Value, error) {
+			ctx, err := row(view)
+			if err != nil {
+				return columnar.Value{}, err
+			}
+			return key(ctx)
+		}}
+	}
+	specs := make([]executor.AggregateSpec, len(g.aggregates))
+	for i, call := range g.aggregates {
+		arg := call.arg
+		specs[i] = executor.AggregateSpec{
+			Func:     call.fn,
+			Alias:    planner.AggregateColumn(i),
+			Distinct: call.distinct,
+			Params:   call.params,
+			Value: func(view executor.RowView) (columnar.Value, error) {
+				if arg == nil {
+					return columnar.NewIntValue(1), nil
+				}
+				ctx, err := row(view)
+				if err != nil {
+					return columnar.Value{}, err
+				}
+				return arg(ctx)
+			},
+		}
+	}
+	source := &batchSource{batch: &executor.Batch{Columns: map[string]*columnar.Column{partialRowColumn: refs}, RowCount: len(p.chunk)}}
+	partial := executor.NewStagedAggregateExecutor(source, executor.AggregatePartial, keys, specs)
+	defer partial.Close()
+	return partial.Next()
+}
+
+func (p *partialInput) Close() error {
+	return nil
+}
+
+// batchSource entrega um único batch.
+type batchSource struct {
+	batch *executor.Batch
+}
+
+func (b *batchSource) Next() (*executor.Batch, error) {
+	if b.batch == nil {
+		return nil, executor.ErrNoMoreBatches
+	}
+	batch := b.batch
+	b.batch = nil
+	return batch, nil
+}
+
+func (b *batchSource) Close() error {
+	return nil
+}
+
+// groupRows entrega uma linha por grupo do stage final, com as chaves em
+// #groupN e os resultados em #aggN (ou em lists, para agregações que
+// produzem listas). Sem GROUP BY sempre existe um grupo, mesmo sem linhas
+// (SELECT COUNT(*) ... resulta em 0).
+type groupRows struct {
+	grouping *grouping
+	final    *executor.AggregateExecutor
+	alias    string
+	stats    Stats
+	batch    *executor.Batch
+	lists    map[int][][]columnar.Value
+	index    int
+	groups   int
+	done     bool
+}
+
+func (g *groupRows) next() (rowContext, error) {
+	for !g.done && (g.batch == nil || g.index >= g.batch.RowCount) {
+		batch, err := g.final.Next()
+		if err == executor.ErrNoMoreBatches {
+			g.done = true
+			g.stats[query.PlanNodeAggregate] = g.final.Stats()
+			break
+		}
+		if err != nil {
+			return rowContext{}, err
+		}
+		g.batch, g.index = batch, 0
+		if batch.RowCount == 0 {
+			continue
+		}
+		if g.lists, err = g.grouping.batchLists(batch); err != nil {
+			return rowContext{}, err
+		}
+	}
+	if g.done {
+		if g.groups > 0 || len(g.grouping.keys) > 0 {
+			return rowContext{}, io.EOF
+		}
+		g.groups++
+		return g.grouping.emptyGroup(g.alias)
+	}
+	ctx, err := g.grouping.groupRow(g.batch, g.lists, g.index, g.alias)
+	if err != nil {
+		return rowContext{}, err
+	}
+	g.index++
+	g.groups++
+	return ctx, nil
+}
+
+// close fecha o stage final, apagando as partições gravadas em disco.
+func (g *groupRows) close() error {
+	return g.final.Close()
+}
+
+// batchLists separa, por registro, as listas das agregações que produzem
+// listas; um registro só com uma entrada NULL é uma lista vazia.
+func (g *grouping) batchLists(batch *executor.Batch) (map[int][][]columnar.Value, error) {
+	var lists map[int][][]columnar.Value
+	for i, call := range g.aggregates {
+		if !executor.ReturnsList(call.fn) {
+			continue
+		}
+		col, ok := batch.Columns[planner.AggregateColumn(i)]
+		if !ok {
+			return nil, fmt.Errorf("runner: resultado sem a coluna %s", planner.AggregateColumn(i))
+		}
+		offsets := col.RecordOffsets()
+		records := make([][]columnar.Value, len(offsets)-1)
+		for r := range records {
+			for e := offsets[r]; e < offsets[r+1]; e++ {
+				if col.DefinitionLevels != nil && col.DefinitionLevels[e] == 0 {
+					continue
+				}
+				value, err := col.Get(e)
+				if err != nil {
+					return nil, err
+				}
+				records[r] = append(records[r], value)
+			}
+		}
+		if lists == nil {
+			lists = map[int][][]columnar.Value{}
+		}
+		lists[i] = records
+	}
+	return lists, nil
+}
+
+// groupRow monta a linha do grupo index do batch.
+func (g *grouping) groupRow(batch *executor.Batch, lists map[int][][]columnar.Value, index int, alias string) (rowContext, error) {
+	values := make(map[string]columnar.Value, len(g.keys)+len(g.aggregates))
+	for i := range g.keys {
+		value, err := resultValue(batch, planner.GroupColumn(i), index)
+		if err != nil {
+			return rowContext{}, err
+		}
+		values[planner.GroupColumn(i)] = value
+	}
+	var groupLists map[string][]columnar.Value
+	for i, call := range g.aggregates {
+		if executor.ReturnsList(call.fn) {
+			if groupLists == nil {
+				groupLists = map[string][]columnar.Value{}
+			}
+			groupLists[planner.AggregateColumn(i)] = lists[i][index]
+			continue
+		}
+		value, err := resultValue(batch, planner.AggregateColumn(i), index)
+		if err != nil {
+			return rowContext{}, err
+		}
+		values[planner.AggregateColumn(i)] = value
+	}
+	return rowContext{values: values, lists: groupLists, alias: alias}, nil
+}
+
+func resultValue(batch *executor.Batch, name string, index int) (columnar.Value, error) {
+	col, ok := batch.Columns[name]
+	if !ok {
+		return columnar.Value{}, fmt.Errorf("runner: resultado sem a coluna %s", name)
+	}
+	return col.Get(index)
+}
+
+// emptyGroup é o grupo de uma agregação sem GROUP BY que não recebeu linhas.
+func (g *grouping) emptyGroup(alias string) (rowContext, error) {
+	values := make(map[string]columnar.Value, len(g.aggregates))
+	var lists map[string][]columnar.Value
+	for i, call := range g.aggregates {
+		acc, err := executor.NewAccumulator(call.fn, call.distinct, call.params...)
+		if err != nil {
+			return rowContext{}, err
+		}
+		if executor.ReturnsList(call.fn) {
+			if lists == nil {
+				lists = map[string][]columnar.Value{}
+			}
+			lists[planner.AggregateColumn(i)] = acc.Values()
+			continue
+		}
+		values[planner.AggregateColumn(i)] = acc.Result()
+	}
+	return rowContext{values: values, lists: lists, alias: alias}, nil
+}
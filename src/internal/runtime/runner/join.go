@@ -0,0 +1,603 @@
+package runner
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/Jonatan852/distributed-query-processing/internal/executor"
+	"github.com/Jonatan852/distributed-query-processing/internal/expr"
+	"github.com/Jonatan852/distributed-query-processing/internal/storage"
+	"github.com/Jonatan852/distributed-query-processing/pkg/columnar"
+	"github.com/Jonatan852/distributed-query-processing/pkg/query"
+)
+
+// tableInput reúne os batches lidos de uma tabela do FROM. Em queries com
+// join há uma entrada por tabela, na ordem em que aparecem na query.
+type tableInput struct {
+	name    string
+	alias   string
+	schema  storage.TableSchema
+	columns []string
+	sets    []columnSet
+	// scan, quando presente, fornece os batches seguintes sob demanda
+	scan *storage.Scanner
+	// fields guarda os campos aninhados de cada set, montados sob demanda
+	// pelas linhas de um join
+	fields []*nestedFields
+}
+
+// drain lê o scan inteiro para sets; joins precisam de todas as linhas.
+func (t *tableInput) drain(scanner *storage.Scanner) error {
+	for {
+		batch, err := scanner.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		t.sets = append(t.sets, columnSet{columns: batch.Columns, rows: batch.RowCount})
+	}
+}
+
+// queryTables lista as tabelas do FROM e dos JOINs, na ordem da query.
+func queryTables(stmt *query.SelectStatement) []tableInput {
+	var tables []tableInput
+	add := func(name, alias string) {
+		if alias == "" {
+			alias = name
+		}
+		tables = append(tables, tableInput{name: name, alias: alias})
+	}
+	for _, ref := range stmt.From {
+		add(ref.Name, ref.Alias)
+		for _, join := range ref.Joins {
+			add(join.Table, join.Alias)
+		}
+	}
+	return tables
+}
+
+// joinLayout descreve as tabelas de uma linha combinada por joins; a linha
+// guarda em rowContext.joined uma linha por tabela, na mesma ordem.
+type joinLayout struct {
+	tables []*tableInput
+	// config limita as tabelas hash; joins guarda os executores criados, cujas
+	// métricas de spill são somadas no fim
+	config executor.HashConfig
+	joins  []*executor.HashJoinExecutor
+}
+
+// Os joins rodam no executor.HashJoinExecutor sobre referências: cada linha
+// de uma tabela vira o par (setColumn, rowColumn) que aponta para o batch e a
+// linha em tableInput.sets, de modo que campos aninhados e repetidos não
+// precisam atravessar o join. Uma referência NULL (ou ausente, quando o lado
+// não teve linhas) é a linha só com NULLs de um outer join.
+func setColumn(table int) string { return fmt.Sprintf("%d#set", table) }
+
+func rowColumn(table int) string { return fmt.Sprintf("%d#row", table) }
+
+// row monta a linha index do batch set da tabela.
+func (t *tableInput) row(set, index int) (rowContext, error) {
+	if set < 0 || set >= len(t.sets) || index < 0 || index >= t.sets[set].rows {
+		return rowContext{}, fmt.Errorf("runner: linha %d/%d fora dos batches de %s", set, index, t.alias)
+	}
+	if t.fields == nil {
+		t.fields = make([]*nestedFields, len(t.sets))
+	}
+	if t.fields[set] == nil {
+		t.fields[set] = newNestedFields(t.schema, t.sets[set].columns)
+	}
+	ctx, err := newRowContext(t.sets[set].columns, t.columns, index, t.alias)
+	if err != nil {
+		return rowContext{}, err
+	}
+	ctx.fields, ctx.record = t.fields[set], index
+	return ctx, nil
+}
+
+// nullRow é a linha que um outer join usa quando a tabela não tem par: todas
+// as colunas valem NULL.
+func (t *tableInput) nullRow() rowContext {
+	values := make(map[string]columnar.Value, len(t.columns))
+	for _, name := range t.columns {
+		typ := columnar.TypeString
+		if field, _, ok := t.schema.Field(name); ok {
+			typ = field.Type
+		}
+		values[strings.ToLower(name)] = columnar.NewNullValue(typ)
+	}
+	return rowContext{
+		values: values,
+		order:  t.columns,
+		alias:  strings.ToLower(t.alias),
+		fields: newNestedFields(t.schema, nil),
+		null:   true,
+	}
+}
+
+// tuple lê as referências das tabelas from..to-1 na linha combinada.
+func (l *joinLayout) tuple(row executor.RowView, from, to int) ([]rowContext, error) {
+	tuple := make([]rowContext, 0, to-from)
+	for i := from; i < to; i++ {
+		table := l.tables[i]
+		set, err := row.Value(setColumn(i))
+		if err != nil || set.IsNull() {
+			tuple = append(tuple, table.nullRow())
+			continue
+		}
+		index, err := row.Value(rowColumn(i))
+		if err != nil {
+			return nil, err
+		}
+		s, _ := set.AsInt()
+		r, _ := index.AsInt()
+		ctx, err := table.row(int(s), int(r))
+		if err != nil {
+			return nil, err
+		}
+		tuple = append(tuple, ctx)
+	}
+	return tuple, nil
+}
+
+// joinedRows combina as tabelas seguindo os JOINs de cada entrada do FROM
+// (entradas separadas por vírgula são combinadas por produto cartesiano) e
+// entrega as linhas à medida que o join as produz.
+type joinedRows struct {
+	layout *joinLayout
+	joined executor.Executor
+	stats  Stats
+	batch  *executor.Batch
+	index  int
+}
+
+func newJoinedRows(stmt *query.SelectStatement, tables []*tableInput, config executor.HashConfig, stats Stats) (*joinedRows, error) {
+	layout := &joinLayout{tables: tables, config: config}
+	joined, err := layout.build(stmt)
+	if err != nil {
+		return nil, err
+	}
+	return &joinedRows{layout: layout, joined: joined, stats: stats}, nil
+}
+
+func (j *joinedRows) next() (rowContext, error) {
+	for j.batch == nil || j.index >= j.batch.RowCount {
+		batch, err := j.joined.Next()
+		if err == executor.ErrNoMoreBatches {
+			j.recordStats()
+			return rowContext{}, io.EOF
+		}
+		if err != nil {
+			return rowContext{}, err
+		}
+		j.batch, j.index = batch, 0
+	}
+	tuple, err := j.layout.tuple(batchView{batch: j.batch, index: j.index}, 0, len(j.layout.tables))
+	if err != nil {
+		return rowContext{}, err
+	}
+	j.index++
+	return rowContext{joined: tuple, join: j.layout}, nil
+}
+
+// recordStats soma em stats o spill de todos os joins da query.
+func (j *joinedRows) recordStats() {
+	total := map[string]int64{}
+	for _, join := range j.layout.joins {
+		for key, value := range join.Stats() {
+			total[key] += value
+		}
+	}
+	j.stats[query.PlanNodeJoin] = total
+}
+
+func (j *joinedRows) close() error {
+	return j.joined.Close()
+}
+
+// hashJoin cria um join com o HashConfig da query.
+func (l *joinLayout) hashJoin(left, right executor.Executor, cond executor.JoinCondition) *executor.HashJoinExecutor {
+	join := executor.NewExternalHashJoinExecutor(left, right, cond, l.config)
+	l.joins = append(l.joins, join)
+	return join
+}
+
+// build monta a árvore de HashJoinExecutors da query.
+func (l *joinLayout) build(stmt *query.SelectStatement) (executor.Executor, error) {
+	var result executor.Executor
+	next := 0
+	for idx, ref := range stmt.From {
+		first := next
+		var entry executor.Executor = &tableSource{table: l.tables[first], index: first}
+		next++
+		for _, join := range ref.Joins {
+			var err error
+			if entry, err = l.join(entry, first, next, join); err != nil {
+				return nil, err
+			}
+			next++
+		}
+		if idx == 0 {
+			result = entry
+			continue
+		}
+		// produto cartesiano: todas as linhas dos dois lados têm a mesma chave
+		result = l.hashJoin(
+			&keyedExecutor{child: result, name: leftKeyColumn(first)},
+			&keyedExecutor{child: entry, name: rightKeyColumn(first)},
+			executor.JoinCondition{LeftColumns: []string{leftKeyColumn(first)}, RightColumns: []string{rightKeyColumn(first)}},
+		)
+	}
+	return result, nil
+}
+
+func leftKeyColumn(table int) string { return fmt.Sprintf("#lkey%d", table) }
+
+func rightKeyColumn(table int) string { return fmt.Sprintf("#rkey%d", table) }
+
+// join combina left (tabelas first..right-1) com a tabela right. A chave do
+// hash são as igualdades entre os dois lados da condição; sem nenhuma, todas
+// as linhas têm a mesma chave. A condição completa é sempre reavaliada no par
+// (JoinCondition.Filter).
+func (l *joinLayout) join(left executor.Executor, first, right int, join query.JoinClause) (executor.Executor, error) {
+	// o parser entrega CROSS JOIN como INNER sem condição: os dois são o
+	// produto cartesiano. Joins externos precisam do ON.
+	condition := join.Condition
+	if join.Type == query.JoinTypeCross {
+		condition = nil
+	} else if condition == nil && join.Type != query.JoinTypeInner {
+		return nil, fmt.Errorf("runner: %s JOIN com %s exige condição ON", join.Type, l.tables[right].alias)
+	}
+	leftKeys, rightKeys, err := l.equiKeys(condition, first, right)
+	if err != nil {
+		return nil, err
+	}
+	cond := executor.JoinCondition{
+		Type:         joinType(join.Type),
+		LeftColumns:  []string{leftKeyColumn(right)},
+		RightColumns: []string{rightKeyColumn(right)},
+	}
+	if condition != nil {
+		predicate, err := expr.CompilePredicate(condition)
+		if err != nil {
+			return nil, err
+		}
+		// a condição enxerga apenas as tabelas desta entrada do FROM
+		scope := &joinLayout{tables: l.tables[first : right+1]}
+		cond.Filter = func(row executor.RowView) (bool, error) {
+			tuple, err := l.tuple(row, first, right+1)
+			if err != nil {
+				return false, err
+			}
+			return predicate(rowContext{joined: tuple, join: scope})
+		}
+	}
+	return l.hashJoin(
+		&keyedExecutor{child: left, name: leftKeyColumn(right), keys: leftKeys, layout: l, from: first, to: right},
+		&keyedExecutor{child: &tableSource{table: l.tables[right], index: right}, name: rightKeyColumn(right), keys: rightKeys, layout: l, from: right, to: right + 1},
+		cond,
+	), nil
+}
+
+func joinType(typ query.JoinType) executor.JoinType {
+	switch typ {
+	case query.JoinTypeLeft:
+		return executor.JoinTypeLeft
+	case query.JoinTypeRight:
+		return executor.JoinTypeRight
+	case query.JoinTypeFull:
+		return executor.JoinTypeFull
+	default:
+		return executor.JoinTypeInner
+	}
+}
+
+// tableSource entrega as referências das linhas de uma tabela, um batch por
+// entrada de tableInput.sets.
+type tableSource struct {
+	table *tableInput
+	index int
+	next  int
+}
+
+func (s *tableSource) Next() (*executor.Batch, error) {
+	for s.next < len(s.table.sets) {
+		set := s.table.sets[s.next]
+		s.next++
+		if set.partial {
+			return nil, fmt.Errorf("runner: batch com estados parciais em query com join")
+		}
+		if set.rows == 0 {
+			continue
+		}
+		sets := columnar.NewColumn(setColumn(s.index), columnar.TypeInt)
+		rows := columnar.NewColumn(rowColumn(s.index), columnar.TypeInt)
+		sets.IntData = make([]int64, set.rows)
+		rows.IntData = make([]int64, set.rows)
+		for i := range rows.IntData {
+			sets.IntData[i] = int64(s.next - 1)
+			rows.IntData[i] = int64(i)
+		}
+		return &executor.Batch{
+			Columns:  map[string]*columnar.Column{sets.Name: sets, rows.Name: rows},
+			RowCount: set.rows,
+		}, nil
+	}
+	return nil, executor.ErrNoMoreBatches
+}
+
+func (s *tableSource) Close() error {
+	return nil
+}
+
+// keyedExecutor acrescenta aos batches do filho a coluna name com a chave do
+// join (executor.HashKey das expressões keys sobre as tabelas from..to-1);
+// NULL em qualquer parte da chave vira NULL, que não casa com nada. Sem keys
+// a chave é constante.
+type keyedExecutor struct {
+	child    executor.Executor
+	name     string
+	keys     []expr.Evaluator
+	layout   *joinLayout
+	from, to int
+}
+
+func (k *keyedExecutor) Next() (*executor.Batch, error) {
+	batch, err := k.child.Next()
+	if err != nil {
+		return nil, err
+	}
+	key := columnar.NewColumn(k.name, columnar.TypeString)
+	var scope *joinLayout
+	if len(k.keys) > 0 {
+		scope = &joinLayout{tables: k.layout.tables[k.from:k.to]}
+	}
+	for i := 0; i < batch.RowCount; i++ {
+		if scope == nil {
+			key.StringData = append(key.StringData, "")
+			continue
+		}
+		tuple, err := k.layout.tuple(batchView{batch: batch, index: i}, k.from, k.to)
+		if err != nil {
+			return nil, err
+		}
+		id, ok, err := hashKey(k.keys, rowContext{joined: tuple, join: scope})
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			err = key.AppendNull()
+		} else {
+			err = key.Append(columnar.NewStringValue(id))
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	columns := make(map[string]*columnar.Column, len(batch.Columns)+1)
+	for name, col := range batch.Columns {
+		columns[name] = col
+	}
+	columns[k.name] = key
+	return &executor.Batch{Columns: columns, RowCount: batch.RowCount, Meta: batch.Meta}, nil
+}
+
+func (k *keyedExecutor) Close() error {
+	return k.child.Close()
+}
+
+// batchView lê a linha index de um batch.
+type batchView struct {
+	batch *executor.Batch
+	index int
+}
+
+func (v batchView) Value(column string) (columnar.Value, error) {
+	col, ok := v.batch.Columns[column]
+	if !ok {
+		return columnar.Value{}, fmt.Errorf("coluna %s não encontrada", column)
+	}
+	return col.Get(v.index)
+}
+
+// equiKeys extrai da condição as igualdades entre uma expressão das tabelas
+// first..right-1 e outra da tabela right, usadas como chave do hash.
+func (l *joinLayout) equiKeys(condition query.Expression, first, right int) ([]expr.Evaluator, []expr.Evaluator, error) {
+	var leftKeys, rightKeys []expr.Evaluator
+	for _, conjunct := range conjuncts(condition) {
+		bin, ok := conjunct.(query.BinaryExpr)
+		if !ok || bin.Operator != "=" {
+			continue
+		}
+		a, b := l.owners(bin.Left, first, right), l.owners(bin.Right, first, right)
+		leftSide, rightSide := bin.Left, bin.Right
+		switch {
+		case a == sideLeft && b == sideRight:
+		case a == sideRight && b == sideLeft:
+			leftSide, rightSide = bin.Right, bin.Left
+		default:
+			continue
+		}
+		leftEval, err := expr.Compile(leftSide)
+		if err != nil {
+			return nil, nil, err
+		}
+		rightEval, err := expr.Compile(rightSide)
+		if err != nil {
+			return nil, nil, err
+		}
+		leftKeys = append(leftKeys, leftEval)
+		rightKeys = append(rightKeys, rightEval)
+	}
+	return leftKeys, rightKeys, nil
+}
+
+type joinSide int
+
+const (
+	sideNone joinSide = iota
+	sideLeft
+	sideRight
+	sideMixed
+)
+
+// owners indica de que lado do join vêm as colunas da expressão; colunas sem
+// qualificador pertencem à única tabela que as possui.
+func (l *joinLayout) owners(e query.Expression, first, right int) joinSide {
+	side := sideNone
+	merge := func(s joinSide) {
+		if side == sideNone {
+			side = s
+		} else if side != s {
+			side = sideMixed
+		}
+	}
+	walk(e, func(node query.Expression) {
+		col, ok := node.(query.ColumnRef)
+		if !ok {
+			return
+		}
+		owner := -1
+		for i, table := range l.tables[first : right+1] {
+			if col.Table != "" {
+				if strings.EqualFold(col.Table, table.alias) {
+					owner = first + i
+				}
+				continue
+			}
+			if _, _, found := table.schema.Field(col.Name); found {
+				if owner >= 0 {
+					merge(sideMixed)
+					return
+				}
+				owner = first + i
+			}
+		}
+		switch {
+		case owner < 0:
+			merge(sideMixed)
+		case owner == right:
+			merge(sideRight)
+		default:
+			merge(sideLeft)
+		}
+	})
+	return side
+}
+
+// hashKey calcula a chave da linha; NULL em qualquer parte da chave nunca
+// encontra par.
+func hashKey(keys []expr.Evaluator, row rowContext) (string, bool, error) {
+	values := make([]columnar.Value, len(keys))
+	for i, key := range keys {
+		value, err := key(row)
+		if err != nil {
+			return "", false, err
+		}
+		values[i] = value
+	}
+	id, ok := executor.HashKey(values)
+	return id, ok, nil
+}
+
+func conjuncts(e query.Expression) []query.Expression {
+	if bin, ok := e.(query.BinaryExpr); ok && strings.EqualFold(bin.Operator, "AND") {
+		return append(conjuncts(bin.Left), conjuncts(bin.Right)...)
+	}
+	if e == nil {
+		return nil
+	}
+	return []query.Expression{e}
+}
+
+func walk(e query.Expression, fn func(query.Expression)) {
+	if e == nil {
+		return
+	}
+	fn(e)
+	switch node := e.(type) {
+	case query.BinaryExpr:
+		walk(node.Left, fn)
+		walk(node.Right, fn)
+	case query.UnaryExpr:
+		walk(node.Expr, fn)
+	case query.BetweenExpr:
+		walk(node.Expr, fn)
+		walk(node.Lower, fn)
+		walk(node.Upper, fn)
+	case query.InExpr:
+		walk(node.Expr, fn)
+		for _, item := range node.List {
+			walk(item, fn)
+		}
+	case query.FunctionCall:
+		for _, arg := range node.Args {
+			walk(arg, fn)
+		}
+	}
+}
+
+// joinedRow devolve a linha da tabela dona da coluna: a do alias, quando a
+// coluna é qualificada, ou a única tabela do join que possui a coluna.
+func (rc rowContext) joinedRow(col query.ColumnRef) (rowContext, error) {
+	found := -1
+	for i, table := range rc.join.tables {
+		if col.Table != "" {
+			if strings.EqualFold(col.Table, table.alias) {
+				return rc.joined[i], nil
+			}
+			continue
+		}
+		if _, _, ok := table.schema.Field(col.Name); !ok {
+			continue
+		}
+		if found >= 0 {
+			return rowContext{}, fmt.Errorf("coluna %s é ambígua: existe em %s e %s", col.Name, rc.join.tables[found].alias, table.alias)
+		}
+		found = i
+	}
+	if col.Table != "" {
+		return rowContext{}, fmt.Errorf("tabela %s não disponível nesta linha", col.Table)
+	}
+	if found < 0 {
+		return rowContext{}, fmt.Errorf("coluna %s não encontrada", col.Name)
+	}
+	return rc.joined[found], nil
+}
+
+// joinedWildcard projeta as colunas de cada tabela do join (ou só as de
+// table, em alias.*). Nomes repetidos entre tabelas saem qualificados pelo
+// alias.
+func (rc rowContext) joinedWildcard(table string, result map[string]interface{}) error {
+	var outputs []map[string]interface{}
+	var aliases []string
+	counts := map[string]int{}
+	for i, t := range rc.join.tables {
+		if table != "" && !strings.EqualFold(table, t.alias) {
+			continue
+		}
+		values := map[string]interface{}{}
+		if err := rc.joined[i].wildcard(values); err != nil {
+			return err
+		}
+		for name := range values {
+			counts[name]++
+		}
+		outputs = append(outputs, values)
+		aliases = append(aliases, t.alias)
+	}
+	if table != "" && len(outputs) == 0 {
+		return fmt.Errorf("tabela %s não disponível nesta linha", table)
+	}
+	for i, values := range outputs {
+		for name, value := range values {
+			if counts[name] > 1 {
+				name = aliases[i] + "." + name
+			}
+			result[name] = value
+		}
+	}
+	return nil
+}
@@ -0,0 +1,260 @@
+package runner
+
+import (
+	"container/heap"
+	"sort"
+	"strings"
+
+	"github.com/Jonatan852/distributed-query-processing/internal/expr"
+	"github.com/Jonatan852/distributed-query-processing/pkg/columnar"
+	"github.com/Jonatan852/distributed-query-processing/pkg/query"
+)
+
+// projection é um item do SELECT compilado uma única vez por query.
+type projection struct {
+	key      string
+	wildcard bool
+	// table restringe o wildcard às colunas de uma tabela (alias.*)
+	table string
+	// column guarda referências diretas, que podem ser STRUCTs ou campos
+	// repetidos remontados
+	column *query.ColumnRef
+	eval   expr.Evaluator
+}
+
+func compileProjections(items []query.SelectItem) ([]projection, error) {
+	if len(items) == 0 {
+		return []projection{{wildcard: true}}, nil
+	}
+	result := make([]projection, 0, len(items))
+	for _, item := range items {
+		if item.Wildcard != nil {
+			result = append(result, projection{wildcard: true, table: item.Wildcard.Table})
+			continue
+		}
+		p := projection{key: item.Alias}
+		switch e := item.Expr.(type) {
+		case query.ColumnRef:
+			p.column = &e
+			if p.key == "" {
+				p.key = outputColumnName(e)
+			}
+		case query.FunctionCall:
+			if e.WithinRecord {
+				fn := e
+				p.eval = func(row expr.Row) (columnar.Value, error) {
+					return row.(rowContext).withinRecord(fn)
+				}
+			}
+		}
+		if p.key == "" {
+			p.key = item.Expr.String()
+		}
+		if p.eval == nil {
+			eval, err := expr.Compile(item.Expr)
+			if err != nil {
+				return nil, err
+			}
+			p.eval = eval
+		}
+		result = append(result, p)
+	}
+	return result, nil
+}
+
+func buildProjection(items []projection, ctx rowContext) (map[string]interface{}, error) {
+	result := map[string]interface{}{}
+	for _, item := range items {
+		if item.wildcard {
+			var err error
+			if ctx.join != nil {
+				err = ctx.joinedWildcard(item.table, result)
+			} else {
+				err = ctx.wildcard(result)
+			}
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if item.column != nil {
+			value, err := ctx.field(*item.column)
+			if err != nil {
+				return nil, err
+			}
+			result[item.key] = value
+			continue
+		}
+		value, err := item.eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		result[item.key] = valueToInterface(value)
+	}
+	return result, nil
+}
+
+// wildcard projeta todas as colunas lidas da tabela.
+func (rc rowContext) wildcard(result map[string]interface{}) error {
+	if rc.fields != nil && rc.fields.schema.IsNested() {
+		// campos aninhados saem remontados, um por coluna de topo
+		for _, col := range rc.fields.schema.Columns {
+			value, err := rc.field(query.ColumnRef{Name: col.Name})
+			if err != nil {
+				return err
+			}
+			result[col.Name] = value
+		}
+		return nil
+	}
+	for _, name := range rc.order {
+		result[name] = valueToInterface(rc.values[strings.ToLower(name)])
+	}
+	return nil
+}
+
+// orderedRow é uma linha do resultado com os valores das chaves do ORDER BY.
+type orderedRow struct {
+	record map[string]interface{}
+	keys   []columnar.Value
+	// seq é a ordem de chegada, que desempata chaves iguais
+	seq int
+}
+
+type orderKey struct {
+	eval expr.Evaluator
+	desc bool
+}
+
+type orderKeys []orderKey
+
+// compileOrder compila as chaves do ORDER BY; um nome sem qualificador que
+// coincide com um alias do SELECT usa a expressão projetada.
+func compileOrder(items []query.OrderExpression, projections []projection) (orderKeys, error) {
+	keys := make(orderKeys, 0, len(items))
+	for _, item := range items {
+		key := orderKey{desc: item.Direction == query.SortDesc}
+		if col, ok := item.Expr.(query.ColumnRef); ok && col.Table == "" {
+			for _, p := range projections {
+				if !p.wildcard && strings.EqualFold(p.key, col.Name) {
+					key.eval = p.eval
+					break
+				}
+			}
+		}
+		if key.eval == nil {
+			eval, err := expr.Compile(item.Expr)
+			if err != nil {
+				return nil, err
+			}
+			key.eval = eval
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func (o orderKeys) keys(ctx rowContext) ([]columnar.Value, error) {
+	if len(o) == 0 {
+		return nil, nil
+	}
+	values := make([]columnar.Value, len(o))
+	for i, key := range o {
+		value, err := key.eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+// sort ordena as linhas de forma estável; NULL fica depois de qualquer valor,
+// como no SortExecutor.
+func (o orderKeys) sort(rows []orderedRow) {
+	if len(o) == 0 || len(rows) <= 1 {
+		return
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		return o.less(rows[i].keys, rows[j].keys)
+	})
+}
+
+func (o orderKeys) less(left, right []columnar.Value) bool {
+	for k, key := range o {
+		cmp, err := expr.Compare(left[k], right[k])
+		if err != nil || cmp == 0 {
+			continue
+		}
+		if key.desc {
+			return cmp > 0
+		}
+		return cmp < 0
+	}
+	return false
+}
+
+// topRows guarda só as limit primeiras linhas do ORDER BY ... LIMIT: um heap
+// com a pior linha no topo, trocada quando chega uma linha melhor.
+type topRows struct {
+	order orderKeys
+	limit int64
+	rows  []orderedRow
+}
+
+// wants indica se uma linha com essas chaves entraria no resultado; evita
+// montar a projeção de linhas descartadas.
+func (t *topRows) wants(keys []columnar.Value, seq int) bool {
+	if int64(len(t.rows)) < t.limit {
+		return true
+	}
+	return t.limit > 0 && t.worse(t.rows[0], orderedRow{keys: keys, seq: seq})
+}
+
+// add guarda a linha e devolve a que ela tirou do resultado, se houver.
+func (t *topRows) add(row orderedRow) (orderedRow, bool) {
+	switch {
+	case int64(len(t.rows)) < t.limit:
+		heap.Push(t, row)
+	case t.limit > 0 && t.worse(t.rows[0], row):
+		evicted := t.rows[0]
+		t.rows[0] = row
+		heap.Fix(t, 0)
+		return evicted, true
+	}
+	return orderedRow{}, false
+}
+
+// sorted devolve as linhas guardadas na ordem final.
+func (t *topRows) sorted() []orderedRow {
+	rows := t.rows
+	sort.Slice(rows, func(i, j int) bool {
+		return t.worse(rows[j], rows[i])
+	})
+	return rows
+}
+
+// worse indica se a vem depois de b no resultado.
+func (t *topRows) worse(a, b orderedRow) bool {
+	if t.order.less(b.keys, a.keys) {
+		return true
+	}
+	if t.order.less(a.keys, b.keys) {
+		return false
+	}
+	return a.seq > b.seq
+}
+
+func (t *topRows) Len() int { return len(t.rows) }
+
+func (t *topRows) Less(i, j int) bool { return t.worse(t.rows[i], t.rows[j]) }
+
+func (t *topRows) Swap(i, j int) { t.rows[i], t.rows[j] = t.rows[j], t.rows[i] }
+
+func (t *topRows) Push(x any) { t.rows = append(t.rows, x.(orderedRow)) }
+
+func (t *topRows) Pop() any {
+	last := t.rows[len(t.rows)-1]
+	t.rows = t.rows[:len(t.rows)-1]
+	return last
+}
@@ -0,0 +1,211 @@
+package runner
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/Jonatan852/distributed-query-processing/pkg/columnar"
+)
+
+// Tags dos valores de uma linha do resultado serializada por encodeRecord.
+const (
+	recordNull byte = iota
+	recordInt
+	recordFloat
+	recordString
+	recordBool
+	recordTime
+	recordDecimal
+	recordList
+	recordObject
+)
+
+// encodeRecord serializa uma linha do resultado para que o sort externo possa
+// gravá-la em disco; decodeRecord devolve os mesmos tipos Go (int64, float64,
+// time.Time, columnar.Decimal, listas e objetos aninhados), que o JSON não
+// preservaria.
+func encodeRecord(buf []byte, record map[string]interface{}) ([]byte, error) {
+	return appendRecordValue(buf, record)
+}
+
+func appendRecordValue(buf []byte, value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case nil:
+		return append(buf, recordNull), nil
+	case int64:
+		return binary.AppendVarint(append(buf, recordInt), v), nil
+	case float64:
+		return binary.LittleEndian.AppendUint64(append(buf, recordFloat), math.Float64bits(v)), nil
+	case string:
+		return appendRecordString(append(buf, recordString), v), nil
+	case bool:
+		if v {
+			return append(buf, recordBool, 1), nil
+		}
+		return append(buf, recordBool, 0), nil
+	case time.Time:
+		data, err := v.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		return appendRecordString(append(buf, recordTime), string(data)), nil
+	case columnar.Decimal:
+		buf = binary.AppendVarint(append(buf, recordDecimal), v.Unscaled)
+		return binary.AppendVarint(buf, int64(v.Scale)), nil
+	case []interface{}:
+		buf = binary.AppendUvarint(append(buf, recordList), uint64(len(v)))
+		for _, item := range v {
+			var err error
+			if buf, err = appendRecordValue(buf, item); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	case map[string]interface{}:
+		buf = binary.AppendUvarint(append(buf, recordObject), uint64(len(v)))
+		for name, item := range v {
+			buf = appendRecordString(buf, name)
+			var err error
+			if buf, err = appendRecordValue(buf, item); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	default:
+		return nil, fmt.Errorf("runner: valor %T não pode ser ordenado em disco", value)
+	}
+}
+
+func appendRecordString(buf []byte, s string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+func decodeRecord(data []byte) (map[string]interface{}, error) {
+	r := recordReader{data: data}
+	value := r.value()
+	if r.err == nil && len(r.data) > 0 {
+		r.err = fmt.Errorf("runner: %d byte(s) sobrando na linha", len(r.data))
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	record, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("runner: linha serializada não é um objeto")
+	}
+	return record, nil
+}
+
+// recordReader lê o formato de encodeRecord; o primeiro erro interrompe a
+// leitura.
+type recordReader struct {
+	data []byte
+	err  error
+}
+
+func (r *recordReader) fail() {
+	if r.err == nil {
+		r.err = fmt.Errorf("runner: linha serializada truncada")
+	}
+}
+
+func (r *recordReader) byte() byte {
+	if r.err != nil || len(r.data) == 0 {
+		r.fail()
+		return 0
+	}
+	b := r.data[0]
+	r.data = r.data[1:]
+	return b
+}
+
+func (r *recordReader) varint() int64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(r.data)
+	if n <= 0 {
+		r.fail()
+		return 0
+	}
+	r.data = r.data[n:]
+	return v
+}
+
+// count lê o tamanho de uma lista ou objeto; cada item ocupa ao menos um
+// byte, o que limita o valor antes de qualquer alocação.
+func (r *recordReader) count() int {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.data)
+	if n <= 0 || v > uint64(len(r.data)-n) {
+		r.fail()
+		return 0
+	}
+	r.data = r.data[n:]
+	return int(v)
+}
+
+func (r *recordReader) string() string {
+	length := r.count()
+	if r.err != nil || length > len(r.data) {
+		r.fail()
+		return ""
+	}
+	s := string(r.data[:length])
+	r.data = r.data[length:]
+	return s
+}
+
+func (r *recordReader) value() interface{} {
+	switch tag := r.byte(); tag {
+	case recordNull:
+		return nil
+	case recordInt:
+		return r.varint()
+	case recordFloat:
+		if r.err != nil || len(r.data) < 8 {
+			r.fail()
+			return nil
+		}
+		v := math.Float64frombits(binary.LittleEndian.Uint64(r.data))
+		r.data = r.data[8:]
+		return v
+	case recordString:
+		return r.string()
+	case recordBool:
+		return r.byte() == 1
+	case recordTime:
+		var t time.Time
+		if err := t.UnmarshalBinary([]byte(r.string())); err != nil && r.err == nil {
+			r.err = err
+		}
+		return t
+	case recordDecimal:
+		unscaled := r.varint()
+		return columnar.NewDecimal(unscaled, int32(r.varint()))
+	case recordList:
+		items := make([]interface{}, 0, r.count())
+		for i := cap(items); i > 0 && r.err == nil; i-- {
+			items = append(items, r.value())
+		}
+		return items
+	case recordObject:
+		count := r.count()
+		object := make(map[string]interface{}, count)
+		for i := 0; i < count && r.err == nil; i++ {
+			name := r.string()
+			object[name] = r.value()
+		}
+		return object
+	default:
+		if r.err == nil {
+			r.err = fmt.Errorf("runner: tipo %d desconhecido na linha serializada", tag)
+		}
+		return nil
+	}
+}
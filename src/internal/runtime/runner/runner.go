@@ -2,9 +2,12 @@ package runner
 
 import (
 	"fmt"
-	"sort"
+	"io"
 	"strings"
 
+	"github.com/Jonatan852/distributed-query-processing/internal/executor"
+	"github.com/Jonatan852/distributed-query-processing/internal/expr"
+	"github.com/Jonatan852/distributed-query-processing/internal/planner"
 	"github.com/Jonatan852/distributed-query-processing/internal/storage"
 	"github.com/Jonatan852/distributed-query-processing/pkg/columnar"
 	"github.com/Jonatan852/distributed-query-processing/pkg/query"
@@ -13,174 +16,569 @@ import (
 // Runner executa consultas SELECT diretamente sobre o storage local.
 type Runner struct {
 	engine *storage.Engine
+	config Config
 }
 
+// Config ajusta os operadores que o runner executa no coordinator. Com
+// SpillDir informado, um ORDER BY sem LIMIT que passa de SortMemory bytes
+// grava runs ordenados em disco (executor.SortConfig) e o agrupamento e as
+// tabelas hash dos joins que passam de HashMemory bytes gravam partições
+// (executor.HashConfig); sem SpillDir tudo fica em memória.
+type Config struct {
+	SpillDir   string
+	SortMemory int64
+	HashMemory int64
+}
+
+// Stats são as métricas dos operadores executados pelo runner, por tipo de
+// nó do plano (ex.: o spill do SORT).
+type Stats map[query.PlanNodeType]map[string]int64
+
 // New cria um novo runner usando o storage informado.
 func New(engine *storage.Engine) *Runner {
-	return &Runner{engine: engine}
+	return NewWithConfig(engine, Config{})
+}
+
+// NewWithConfig cria um runner com os limites informados.
+func NewWithConfig(engine *storage.Engine, config Config) *Runner {
+	return &Runner{engine: engine, config: config}
 }
 
 // Execute processa um SelectStatement e retorna linhas em formato map[string]interface{}.
 func (r *Runner) Execute(stmt *query.SelectStatement) ([]map[string]interface{}, error) {
-	if stmt == nil {
-		return nil, fmt.Errorf("runner: statement vazio")
-	}
-	if len(stmt.From) != 1 {
-		return nil, fmt.Errorf("runner: apenas uma tabela é suportada neste MVP")
+	if err := validateStatement(stmt); err != nil {
+		return nil, err
 	}
-	if len(stmt.GroupBy) > 0 {
-		return nil, fmt.Errorf("runner: GROUP BY ainda não suportado")
+	tables, err := r.tables(stmt)
+	if err != nil {
+		return nil, err
 	}
-	for _, item := range stmt.Columns {
-		if _, ok := item.Expr.(query.FunctionCall); ok {
-			return nil, fmt.Errorf("runner: funções agregadas ainda não suportadas")
+	// WHERE é avaliado dentro do scan e também usado para podar partições;
+	// com joins, cada tabela recebe só os predicados que dependem dela.
+	predicates, _ := planner.PushdownPredicates(stmt)
+	for _, table := range tables {
+		where := stmt.Where
+		if len(tables) > 1 {
+			where = nil
+			for _, predicate := range predicates[strings.ToLower(table.alias)] {
+				where = and(where, predicate)
+			}
+		}
+		filter, err := expr.ScanFilter(where)
+		if err != nil {
+			return nil, err
+		}
+		schema := table.schema
+		prune := expr.PruningPredicates(where, func(col query.ColumnRef) (string, bool) {
+			column, ok := schema.ColumnByName(col.Name)
+			return column.Name, ok
+		})
+		scanner, err := r.engine.OpenScan(table.name, storage.ScanOptions{Columns: table.columns, Filter: filter, Prune: prune})
+		if err != nil {
+			return nil, err
+		}
+		defer scanner.Close()
+		if len(tables) == 1 {
+			// uma tabela só é lida enquanto o resultado pede linhas: um LIMIT
+			// sem ORDER BY encerra o scan antes das próximas partições
+			table.scan = scanner
+			continue
+		}
+		if err := table.drain(scanner); err != nil {
+			return nil, err
 		}
 	}
+	rows, _, err := r.finish(stmt, tables, nil)
+	return rows, err
+}
+
+// Merge monta o resultado final a partir dos batches produzidos pelos workers,
+// aplicando projeção, ordenação e limite sem reler o storage. Em queries com
+// join cada batch é atribuído à tabela pelo alias do scan que o produziu.
+func (r *Runner) Merge(stmt *query.SelectStatement, batches []*executor.Batch) ([]map[string]interface{}, error) {
+	rows, _, err := r.MergeWithMemory(stmt, batches, nil)
+	return rows, err
+}
 
-	tableRef := stmt.From[0]
-	tableName := tableRef.Name
-	schema, err := r.engine.Table(tableName)
+// MergeWithMemory é Merge reservando em memory, enquanto o resultado é
+// calculado, as linhas montadas (RowBytes), os grupos do GROUP BY, as
+// tabelas hash dos joins e as linhas guardadas pelo ORDER BY; sem espaço (e
+// sem Config.SpillDir para onde mandá-los) a query falha com
+// executor.ErrMemoryLimitExceeded. As reservas são devolvidas no
+// fim: quem guarda o resultado passa a contabilizá-lo. Stats traz as métricas
+// dos operadores executados no merge.
+func (r *Runner) MergeWithMemory(stmt *query.SelectStatement, batches []*executor.Batch, memory *executor.MemoryTracker) ([]map[string]interface{}, Stats, error) {
+	if err := validateStatement(stmt); err != nil {
+		return nil, nil, err
+	}
+	tables, err := r.tables(stmt)
 	if err != nil {
+		return nil, nil, err
+	}
+	for _, table := range tables {
+		table.columns = table.schema.ColumnNames()
+	}
+	for _, batch := range batches {
+		if batch == nil {
+			continue
+		}
+		table, err := batchTable(tables, batch)
+		if err != nil {
+			return nil, nil, err
+		}
+		table.sets = append(table.sets, columnSet{columns: batch.Columns, rows: batch.RowCount, partial: executor.IsPartialAggregate(batch)})
+	}
+	return r.finish(stmt, tables, memory)
+}
+
+// tables resolve os schemas e as colunas lidas de cada tabela da query.
+func (r *Runner) tables(stmt *query.SelectStatement) ([]*tableInput, error) {
+	if err := planner.ResolveFieldPaths(stmt, r.engine); err != nil {
 		return nil, err
 	}
-	columns := schema.ColumnNames()
+	var tables []*tableInput
+	for _, table := range queryTables(stmt) {
+		schema, err := r.engine.Table(table.name)
+		if err != nil {
+			return nil, err
+		}
+		table := table
+		table.schema = schema
+		table.columns = planner.RequiredColumns(stmt, table.alias, schema)
+		tables = append(tables, &table)
+	}
+	return tables, nil
+}
+
+// batchTable encontra a tabela do batch pelo alias (executor.MetaAlias) ou,
+// na falta dele, pelo nome da tabela lida.
+func batchTable(tables []*tableInput, batch *executor.Batch) (*tableInput, error) {
+	if len(tables) == 1 {
+		return tables[0], nil
+	}
+	if alias := batch.Meta[executor.MetaAlias]; alias != "" {
+		for _, table := range tables {
+			if strings.EqualFold(table.alias, alias) {
+				return table, nil
+			}
+		}
+		return nil, fmt.Errorf("runner: batch de %s não pertence à query", alias)
+	}
+	var found *tableInput
+	for _, table := range tables {
+		if strings.EqualFold(table.name, batch.Meta[executor.MetaTable]) {
+			if found != nil {
+				return nil, fmt.Errorf("runner: batch de %s sem alias em query que lê a tabela mais de uma vez", table.name)
+			}
+			found = table
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("runner: batch sem tabela de origem em query com join")
+	}
+	return found, nil
+}
+
+func and(left, right query.Expression) query.Expression {
+	if left == nil {
+		return right
+	}
+	return query.BinaryExpr{Left: left, Operator: "AND", Right: right}
+}
+
+// columnSet é a visão mínima de um batch colunar usada pelo runner. partial
+// marca batches com estados de agregação (#groupN, #aggN) em vez de linhas.
+type columnSet struct {
+	columns map[string]*columnar.Column
+	rows    int
+	partial bool
+}
+
+func validateStatement(stmt *query.SelectStatement) error {
+	if stmt == nil {
+		return fmt.Errorf("runner: statement vazio")
+	}
+	if len(stmt.From) == 0 {
+		return fmt.Errorf("runner: cláusula FROM obrigatória")
+	}
+	if stmt.Where != nil && expr.ContainsAggregate(stmt.Where) {
+		return fmt.Errorf("runner: agregações não são permitidas no WHERE; use HAVING")
+	}
+	return nil
+}
 
-	batches, err := r.engine.Scan(tableName, storage.ScanOptions{Columns: columns})
+func (r *Runner) finish(stmt *query.SelectStatement, tables []*tableInput, memory *executor.MemoryTracker) ([]map[string]interface{}, Stats, error) {
+	where, err := expr.CompilePredicate(stmt.Where)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	alias := tableRef.Alias
-	if alias == "" {
-		alias = tableName
+	items, orderBy := stmt.Columns, stmt.OrderBy
+	var groups *grouping
+	if planner.NeedsAggregation(stmt) {
+		if groups, err = newGrouping(stmt, r.engine); err != nil {
+			return nil, nil, err
+		}
+		items, orderBy = groups.columns, groups.orderBy
+	}
+	projections, err := compileProjections(items)
+	if err != nil {
+		return nil, nil, err
+	}
+	order, err := compileOrder(orderBy, projections)
+	if err != nil {
+		return nil, nil, err
+	}
+	stats := Stats{}
+	hash := executor.HashConfig{MemoryLimit: r.config.HashMemory, SpillDir: r.config.SpillDir, Memory: memory}
+	input, err := inputRows(stmt, tables, groups != nil, hash, stats)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer input.close()
+	var rows rowStream = &filteredRows{rows: input, where: where}
+	if groups != nil {
+		having, err := expr.CompilePredicate(groups.having)
+		if err != nil {
+			return nil, nil, err
+		}
+		grouped := groups.aggregate(tables[0], rows, hash, stats)
+		defer grouped.close()
+		rows = &filteredRows{rows: grouped, where: having}
 	}
 
-	var rows []map[string]interface{}
-	for _, batch := range batches {
-		for i := 0; i < batch.RowCount; i++ {
-			ctx, err := newRowContext(batch.Columns, columns, i, alias)
+	var result []map[string]interface{}
+	var reserved int64
+	defer func() { memory.Release(reserved) }()
+	keep := func(record map[string]interface{}) error {
+		size := RowBytes(record)
+		if err := memory.Reserve(size); err != nil {
+			return err
+		}
+		reserved += size
+		result = append(result, record)
+		return nil
+	}
+	switch {
+	case len(order) > 0 && stmt.Limit != nil:
+		// com ORDER BY e LIMIT só as primeiras linhas ficam em memória
+		top := &topRows{order: order, limit: *stmt.Limit}
+		for seq := 1; ; seq++ {
+			ctx, err := rows.next()
+			if err == io.EOF {
+				break
+			}
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
-			pass, err := evaluateBoolean(stmt.Where, ctx, alias)
+			keys, err := order.keys(ctx)
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
-			if !pass {
+			if !top.wants(keys, seq) {
 				continue
 			}
-			record, err := buildProjection(stmt.Columns, ctx)
+			record, err := buildProjection(projections, ctx)
 			if err != nil {
-				return nil, err
+				return nil, nil, err
+			}
+			size := RowBytes(record)
+			if err := memory.Reserve(size); err != nil {
+				return nil, nil, err
+			}
+			reserved += size
+			if evicted, ok := top.add(orderedRow{record: record, keys: keys, seq: seq}); ok {
+				size := RowBytes(evicted.record)
+				memory.Release(size)
+				reserved -= size
+			}
+		}
+		for _, row := range top.sorted() {
+			result = append(result, row.record)
+		}
+	case len(order) > 0:
+		if err := r.sortRows(rows, projections, order, memory, stats, keep); err != nil {
+			return nil, nil, err
+		}
+	default:
+		// sem ORDER BY as primeiras linhas bastam
+		for stmt.Limit == nil || int64(len(result)) < *stmt.Limit {
+			ctx, err := rows.next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, nil, err
+			}
+			record, err := buildProjection(projections, ctx)
+			if err != nil {
+				return nil, nil, err
 			}
-			rows = append(rows, record)
-			if stmt.Limit != nil && int64(len(rows)) >= *stmt.Limit {
-				return applyOrder(rows, stmt.OrderBy), nil
+			if err := keep(record); err != nil {
+				return nil, nil, err
 			}
 		}
 	}
-	rows = applyOrder(rows, stmt.OrderBy)
-	return rows, nil
+	if result == nil {
+		result = []map[string]interface{}{}
+	}
+	return result, stats, nil
 }
 
-func applyOrder(rows []map[string]interface{}, order []query.OrderExpression) []map[string]interface{} {
-	if len(order) == 0 || len(rows) <= 1 {
-		return rows
+// sortRows ordena as linhas com o executor.NewExternalSortExecutor: cada
+// linha vai projetada e serializada (encodeRecord) junto com as chaves, de
+// modo que um resultado maior que SortMemory é ordenado em runs gravados em
+// SpillDir. O buffer do sort é reservado em memory; keep recebe as linhas na
+// ordem final.
+func (r *Runner) sortRows(rows rowStream, projections []projection, order orderKeys, memory *executor.MemoryTracker, stats Stats, keep func(map[string]interface{}) error) error {
+	keys := make([]executor.SortKey, 0, len(order)+1)
+	for i, key := range order {
+		keys = append(keys, executor.SortKey{Column: sortKeyColumn(i), Ascending: !key.desc, Value: decodeSortKey(sortKeyColumn(i))})
 	}
-	sort.SliceStable(rows, func(i, j int) bool {
-		for _, item := range order {
-			col, ok := item.Expr.(query.ColumnRef)
-			if !ok {
-				continue
+	// a ordem de chegada desempata chaves iguais, também entre runs
+	keys = append(keys, executor.SortKey{Column: sortSeqColumn, Ascending: true})
+	sorter := executor.NewExternalSortExecutor(&sortInput{rows: rows, projections: projections, order: order}, keys, executor.SortConfig{
+		MemoryLimit: r.config.SortMemory,
+		SpillDir:    r.config.SpillDir,
+		Memory:      memory,
+	})
+	defer sorter.Close()
+	for {
+		batch, err := sorter.Next()
+		if err == executor.ErrNoMoreBatches {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		records := batch.Columns[sortRecordColumn]
+		for i := 0; i < batch.RowCount; i++ {
+			value, err := records.Get(i)
+			if err != nil {
+				return err
 			}
-			l := rows[i][outputColumnName(col)]
-			r := rows[j][outputColumnName(col)]
-			cmp := compareInterfaces(l, r)
-			if cmp == 0 {
-				continue
+			data, _ := value.AsString()
+			record, err := decodeRecord([]byte(data))
+			if err != nil {
+				return err
 			}
-			if item.Direction == query.SortDesc {
-				return cmp > 0
+			if err := keep(record); err != nil {
+				return err
 			}
-			return cmp < 0
 		}
-		return false
-	})
-	return rows
-}
-
-func compareInterfaces(left, right interface{}) int {
-	switch l := left.(type) {
-	case int64:
-		r := right.(int64)
-		switch {
-		case l < r:
-			return -1
-		case l > r:
-			return 1
-		default:
-			return 0
-		}
-	case float64:
-		r := right.(float64)
-		switch {
-		case l < r:
-			return -1
-		case l > r:
-			return 1
-		default:
-			return 0
-		}
-	case string:
-		r := right.(string)
-		switch {
-		case l < r:
-			return -1
-		case l > r:
-			return 1
-		default:
-			return 0
-		}
-	case bool:
-		r := right.(bool)
-		if l == r {
-			return 0
-		}
-		if !l && r {
-			return -1
-		}
-		return 1
-	default:
-		return 0
 	}
+	stats[query.PlanNodeSort] = sorter.Stats()
+	return nil
+}
+
+const (
+	sortSeqColumn    = "#seq"
+	sortRecordColumn = "#record"
+)
+
+func sortKeyColumn(i int) string { return fmt.Sprintf("#key%d", i) }
+
+// sortInput entrega ao sort as linhas projetadas, em batches de
+// sortBatchRows linhas: as chaves do ORDER BY (tipo e texto, já que uma
+// expressão pode variar de tipo entre linhas), a ordem de chegada e a linha
+// serializada.
+type sortInput struct {
+	rows        rowStream
+	projections []projection
+	order       orderKeys
+	seq         int64
+	done        bool
 }
 
-func buildProjection(items []query.SelectItem, ctx rowContext) (map[string]interface{}, error) {
-	result := map[string]interface{}{}
-	if len(items) == 0 {
-		items = append(items, query.SelectItem{Wildcard: &query.Wildcard{}})
+const sortBatchRows = 1024
+
+func (s *sortInput) Next() (*executor.Batch, error) {
+	if s.done {
+		return nil, executor.ErrNoMoreBatches
 	}
-	for _, item := range items {
-		if item.Wildcard != nil {
-			for _, name := range ctx.order {
-				result[name] = valueToInterface(ctx.values[strings.ToLower(name)])
-			}
-			continue
+	columns := map[string]*columnar.Column{
+		sortSeqColumn:    columnar.NewColumn(sortSeqColumn, columnar.TypeInt),
+		sortRecordColumn: columnar.NewColumn(sortRecordColumn, columnar.TypeString),
+	}
+	for i := range s.order {
+		columns[sortKeyColumn(i)] = columnar.NewColumn(sortKeyColumn(i), columnar.TypeString)
+	}
+	batch := &executor.Batch{Columns: columns}
+	var buf []byte
+	for batch.RowCount < sortBatchRows {
+		ctx, err := s.rows.next()
+		if err == io.EOF {
+			s.done = true
+			break
+		}
+		if err != nil {
+			return nil, err
 		}
-		colRef, ok := item.Expr.(query.ColumnRef)
-		if !ok {
-			return nil, fmt.Errorf("runner: apenas projeções de colunas são suportadas no momento")
+		keys, err := s.order.keys(ctx)
+		if err != nil {
+			return nil, err
 		}
-		value, err := ctx.getColumn(colRef)
+		record, err := buildProjection(s.projections, ctx)
 		if err != nil {
 			return nil, err
 		}
-		key := item.Alias
-		if key == "" {
-			key = outputColumnName(colRef)
+		if buf, err = encodeRecord(buf[:0], record); err != nil {
+			return nil, err
+		}
+		for i, key := range keys {
+			value := columnar.NewNullValue(columnar.TypeString)
+			if !key.IsNull() {
+				value = columnar.NewStringValue(string(byte(key.Type)) + key.String())
+			}
+			if err := columns[sortKeyColumn(i)].Append(value); err != nil {
+				return nil, err
+			}
+		}
+		s.seq++
+		if err := columns[sortSeqColumn].Append(columnar.NewIntValue(s.seq)); err != nil {
+			return nil, err
 		}
-		result[key] = valueToInterface(value)
+		if err := columns[sortRecordColumn].Append(columnar.NewStringValue(string(buf))); err != nil {
+			return nil, err
+		}
+		batch.RowCount++
+	}
+	if batch.RowCount == 0 {
+		return nil, executor.ErrNoMoreBatches
+	}
+	return batch, nil
+}
+
+func (s *sortInput) Close() error {
+	return nil
+}
+
+// decodeSortKey lê de volta a chave gravada por sortInput.
+func decodeSortKey(column string) executor.ValueFunc {
+	return func(row executor.RowView) (columnar.Value, error) {
+		value, err := row.Value(column)
+		if err != nil || value.IsNull() {
+			return value, err
+		}
+		text, _ := value.AsString()
+		if text == "" {
+			return columnar.Value{}, fmt.Errorf("runner: chave de ordenação vazia")
+		}
+		return columnar.ParseValue(columnar.DataType(text[0]), text[1:])
+	}
+}
+
+// rowStream entrega as linhas da query uma a uma; io.EOF marca o fim.
+type rowStream interface {
+	next() (rowContext, error)
+}
+
+// inputStream é o rowStream das tabelas do FROM, que precisa ser fechado.
+type inputStream interface {
+	rowStream
+	close() error
+}
+
+// inputRows devolve as linhas das tabelas: as de uma única tabela (batches e
+// depois o scan em andamento) ou as combinadas pelos joins, que usam config
+// e publicam o spill em stats. Batches com estados parciais não são linhas:
+// vão direto para o agrupamento.
+func inputRows(stmt *query.SelectStatement, tables []*tableInput, aggregated bool, config executor.HashConfig, stats Stats) (inputStream, error) {
+	if len(tables) > 1 {
+		return newJoinedRows(stmt, tables, config, stats)
+	}
+	for _, set := range tables[0].sets {
+		// WHERE já foi aplicado pelos workers antes do stage LOCAL
+		if set.partial && !aggregated {
+			return nil, fmt.Errorf("runner: batch com estados parciais em query sem agregação")
+		}
+	}
+	return &tableRows{table: tables[0]}, nil
+}
+
+// tableRows percorre as linhas dos batches de uma única tabela e depois as do
+// scan, que só lê a próxima partição quando as linhas lidas acabam.
+type tableRows struct {
+	table   *tableInput
+	set     int
+	current columnSet
+	fields  *nestedFields
+	index   int
+}
+
+func (t *tableRows) next() (rowContext, error) {
+	for t.index >= t.current.rows {
+		set, err := t.nextSet()
+		if err != nil {
+			return rowContext{}, err
+		}
+		t.current, t.index = set, 0
+		t.fields = newNestedFields(t.table.schema, set.columns)
+	}
+	ctx, err := newRowContext(t.current.columns, t.table.columns, t.index, t.table.alias)
+	if err != nil {
+		return rowContext{}, err
 	}
-	return result, nil
+	ctx.fields, ctx.record = t.fields, t.index
+	t.index++
+	return ctx, nil
+}
+
+func (t *tableRows) nextSet() (columnSet, error) {
+	for t.set < len(t.table.sets) {
+		set := t.table.sets[t.set]
+		t.set++
+		if !set.partial {
+			return set, nil
+		}
+	}
+	if t.table.scan == nil {
+		return columnSet{}, io.EOF
+	}
+	batch, err := t.table.scan.Next()
+	if err != nil {
+		return columnSet{}, err
+	}
+	return columnSet{columns: batch.Columns, rows: batch.RowCount}, nil
+}
+
+func (t *tableRows) close() error {
+	return nil
+}
+
+// filteredRows descarta as linhas que não passam em where.
+type filteredRows struct {
+	rows  rowStream
+	where expr.Predicate
+}
+
+func (f *filteredRows) next() (rowContext, error) {
+	for {
+		ctx, err := f.rows.next()
+		if err != nil {
+			return rowContext{}, err
+		}
+		pass, err := f.where(ctx)
+		if err != nil {
+			return rowContext{}, err
+		}
+		if pass {
+			return ctx, nil
+		}
+	}
+}
+
+// sliceRows entrega linhas já materializadas.
+type sliceRows struct {
+	rows []rowContext
+}
+
+func (s *sliceRows) next() (rowContext, error) {
+	if len(s.rows) == 0 {
+		return rowContext{}, io.EOF
+	}
+	ctx := s.rows[0]
+	s.rows = s.rows[1:]
+	return ctx, nil
 }
 
 func outputColumnName(col query.ColumnRef) string {
@@ -191,6 +589,9 @@ func outputColumnName(col query.ColumnRef) string {
 }
 
 func valueToInterface(v columnar.Value) interface{} {
+	if v.IsNull() {
+		return nil
+	}
 	switch v.Type {
 	case columnar.TypeInt:
 		i, _ := v.AsInt()
@@ -204,6 +605,17 @@ func valueToInterface(v columnar.Value) interface{} {
 	case columnar.TypeBool:
 		b, _ := v.AsBool()
 		return b
+	case columnar.TypeTimestamp:
+		// time.Time vira RFC 3339 (UTC) no JSON
+		t, _ := v.AsTime()
+		return t
+	case columnar.TypeDate:
+		// datas no formato ISO ordenam corretamente como string
+		return v.String()
+	case columnar.TypeDecimal:
+		// Decimal é serializado como número JSON exato
+		d, _ := v.AsDecimal()
+		return d
 	default:
 		return nil
 	}
@@ -211,15 +623,27 @@ func valueToInterface(v columnar.Value) interface{} {
 
 type rowContext struct {
 	values map[string]columnar.Value
+	// lists guarda os resultados de agregações que produzem listas
+	// (ARRAY_AGG, APPROX_QUANTILES), que só podem ser projetados
+	lists  map[string][]columnar.Value
 	order  []string
 	alias  string
+	fields *nestedFields
+	record int
+	// joined guarda, em linhas combinadas por joins, a linha de cada tabela
+	// de join.tables; null marca a linha só com NULLs de um outer join
+	joined []rowContext
+	join   *joinLayout
+	null   bool
 }
 
 func newRowContext(cols map[string]*columnar.Column, order []string, index int, alias string) (rowContext, error) {
 	values := make(map[string]columnar.Value, len(order))
 	for _, name := range order {
 		col := cols[name]
-		if col == nil {
+		// campos repetidos têm várias entradas por linha e só são lidos
+		// remontados (rowContext.field)
+		if col == nil || col.RepetitionLevels != nil {
 			continue
 		}
 		val, err := col.Get(index)
@@ -231,182 +655,195 @@ func newRowContext(cols map[string]*columnar.Column, order []string, index int,
 	return rowContext{values: values, order: order, alias: strings.ToLower(alias)}, nil
 }
 
-func (rc rowContext) getColumn(col query.ColumnRef) (columnar.Value, error) {
+// Column resolve a referência respeitando o alias da tabela.
+func (rc rowContext) Column(col query.ColumnRef) (columnar.Value, error) {
+	if rc.join != nil {
+		row, err := rc.joinedRow(col)
+		if err != nil {
+			return columnar.Value{}, err
+		}
+		return row.Column(query.ColumnRef{Name: col.Name})
+	}
 	if col.Table != "" && !strings.EqualFold(col.Table, rc.alias) {
 		return columnar.Value{}, fmt.Errorf("tabela %s não disponível nesta linha", col.Table)
 	}
 	val, ok := rc.values[strings.ToLower(col.Name)]
 	if !ok {
+		if _, isList := rc.lists[strings.ToLower(col.Name)]; isList {
+			return columnar.Value{}, fmt.Errorf("o resultado de %s é uma lista e não pode ser usado em expressões", col.Name)
+		}
 		return columnar.Value{}, fmt.Errorf("coluna %s não encontrada", col.Name)
 	}
 	return val, nil
 }
 
-func evaluateBoolean(expr query.Expression, ctx rowContext, alias string) (bool, error) {
-	if expr == nil {
-		return true, nil
-	}
-	switch e := expr.(type) {
-	case query.BinaryExpr:
-		op := strings.ToUpper(e.Operator)
-		switch op {
-		case "AND":
-			left, err := evaluateBoolean(e.Left, ctx, alias)
-			if err != nil {
-				return false, err
-			}
-			if !left {
-				return false, nil
-			}
-			return evaluateBoolean(e.Right, ctx, alias)
-		case "OR":
-			left, err := evaluateBoolean(e.Left, ctx, alias)
-			if err != nil {
-				return false, err
-			}
-			if left {
-				return true, nil
-			}
-			return evaluateBoolean(e.Right, ctx, alias)
-		default:
-			leftVal, err := evaluateValue(e.Left, ctx, alias)
-			if err != nil {
-				return false, err
-			}
-			rightVal, err := evaluateValue(e.Right, ctx, alias)
-			if err != nil {
-				return false, err
-			}
-			cmp, err := compareValues(leftVal, rightVal)
-			if err != nil {
-				return false, err
-			}
-			switch op {
-			case "=", "==":
-				return cmp == 0, nil
-			case "!=", "<>":
-				return cmp != 0, nil
-			case "<":
-				return cmp < 0, nil
-			case "<=":
-				return cmp <= 0, nil
-			case ">":
-				return cmp > 0, nil
-			case ">=":
-				return cmp >= 0, nil
-			default:
-				return false, fmt.Errorf("operador %s não suportado", e.Operator)
-			}
+// field devolve o valor de saída da referência: colunas escalares vêm de
+// values, STRUCTs e campos repetidos são remontados a partir das folhas.
+func (rc rowContext) field(col query.ColumnRef) (interface{}, error) {
+	if rc.join != nil {
+		row, err := rc.joinedRow(col)
+		if err != nil {
+			return nil, err
 		}
-	case query.UnaryExpr:
-		if strings.EqualFold(e.Operator, "NOT") {
-			val, err := evaluateBoolean(e.Expr, ctx, alias)
-			return !val, err
+		return row.field(query.ColumnRef{Name: col.Name})
+	}
+	if rc.null {
+		return nil, nil
+	}
+	if rc.fields != nil && rc.fields.composite(col.Name) {
+		if col.Table != "" && !strings.EqualFold(col.Table, rc.alias) {
+			return nil, fmt.Errorf("tabela %s não disponível nesta linha", col.Table)
 		}
-		return false, fmt.Errorf("operador unário %s não suportado", e.Operator)
-	default:
-		val, err := evaluateValue(expr, ctx, alias)
+		value, err := rc.fields.value(col.Name, rc.record)
 		if err != nil {
-			return false, err
+			return nil, err
+		}
+		return nestedToInterface(value), nil
+	}
+	if list, ok := rc.lists[strings.ToLower(col.Name)]; ok && (col.Table == "" || strings.EqualFold(col.Table, rc.alias)) {
+		if list == nil {
+			return nil, nil
 		}
-		boolVal, err := valueToBool(val)
-		return boolVal, err
+		out := make([]interface{}, len(list))
+		for i, value := range list {
+			out[i] = valueToInterface(value)
+		}
+		return out, nil
+	}
+	value, err := rc.Column(col)
+	if err != nil {
+		return nil, err
 	}
+	return valueToInterface(value), nil
 }
 
-func evaluateValue(expr query.Expression, ctx rowContext, alias string) (columnar.Value, error) {
-	switch e := expr.(type) {
-	case query.ColumnRef:
-		return ctx.getColumn(e)
-	case query.Literal:
-		return e.Value, nil
-	case query.BinaryExpr:
-		return columnar.Value{}, fmt.Errorf("expressões aritméticas ainda não suportadas")
-	default:
-		return columnar.Value{}, fmt.Errorf("expressão %T não suportada", expr)
-	}
-}
-
-func compareValues(left, right columnar.Value) (int, error) {
-	if left.Type == right.Type {
-		switch left.Type {
-		case columnar.TypeInt:
-			l, _ := left.AsInt()
-			r, _ := right.AsInt()
-			switch {
-			case l < r:
-				return -1, nil
-			case l > r:
-				return 1, nil
-			default:
-				return 0, nil
-			}
-		case columnar.TypeFloat:
-			l, _ := left.AsFloat()
-			r, _ := right.AsFloat()
-			switch {
-			case l < r:
-				return -1, nil
-			case l > r:
-				return 1, nil
-			default:
-				return 0, nil
-			}
-		case columnar.TypeString:
-			l, _ := left.AsString()
-			r, _ := right.AsString()
-			switch {
-			case l < r:
-				return -1, nil
-			case l > r:
-				return 1, nil
-			default:
-				return 0, nil
-			}
-		case columnar.TypeBool:
-			l, _ := left.AsBool()
-			r, _ := right.AsBool()
-			if l == r {
-				return 0, nil
-			}
-			if !l && r {
-				return -1, nil
-			}
-			return 1, nil
-		default:
-			return 0, fmt.Errorf("tipo %v não suportado em comparação", left.Type)
+// withinRecord agrega os valores que o campo assume dentro do registro atual
+// (ex.: COUNT(tags) WITHIN RECORD).
+func (rc rowContext) withinRecord(fn query.FunctionCall) (columnar.Value, error) {
+	if len(fn.Args) != 1 || fn.Distinct {
+		return columnar.Value{}, fmt.Errorf("WITHIN RECORD exige exatamente um campo como argumento")
+	}
+	col, ok := fn.Args[0].(query.ColumnRef)
+	if !ok {
+		return columnar.Value{}, fmt.Errorf("WITHIN RECORD exige um campo como argumento, obteve %s", fn.Args[0])
+	}
+	if rc.join != nil {
+		row, err := rc.joinedRow(col)
+		if err != nil {
+			return columnar.Value{}, err
 		}
+		fn.Args = []query.Expression{query.ColumnRef{Name: col.Name}}
+		return row.withinRecord(fn)
 	}
-	// Comparar INT com FLOAT convertendo para float64
-	if left.Type == columnar.TypeInt && right.Type == columnar.TypeFloat {
-		l, _ := left.AsInt()
-		r, _ := right.AsFloat()
-		return compareFloat(float64(l), r), nil
+	if rc.null {
+		return executor.AggregateValues(executor.AggregateFunc(strings.ToUpper(fn.Name)), nil)
 	}
-	if left.Type == columnar.TypeFloat && right.Type == columnar.TypeInt {
-		l, _ := left.AsFloat()
-		r, _ := right.AsInt()
-		return compareFloat(l, float64(r)), nil
+	var values []columnar.Value
+	if rc.fields != nil && rc.fields.composite(col.Name) {
+		assembled, err := rc.fields.value(col.Name, rc.record)
+		if err != nil {
+			return columnar.Value{}, err
+		}
+		if values, err = flattenValues(col.Name, assembled, values); err != nil {
+			return columnar.Value{}, err
+		}
+	} else {
+		value, err := rc.Column(col)
+		if err != nil {
+			return columnar.Value{}, err
+		}
+		values = append(values, value)
 	}
-	return 0, fmt.Errorf("tipos incompatíveis (%v vs %v)", left.Type, right.Type)
+	return executor.AggregateValues(executor.AggregateFunc(strings.ToUpper(fn.Name)), values)
 }
 
-func compareFloat(left, right float64) int {
-	switch {
-	case left < right:
-		return -1
-	case left > right:
-		return 1
+// nestedFields remonta os campos STRUCT e repetidos de um batch, mantendo um
+// FieldAssembler por caminho.
+type nestedFields struct {
+	schema     storage.TableSchema
+	columns    map[string]*columnar.Column
+	assemblers map[string]*storage.FieldAssembler
+}
+
+func newNestedFields(schema storage.TableSchema, columns map[string]*columnar.Column) *nestedFields {
+	return &nestedFields{schema: schema, columns: columns, assemblers: map[string]*storage.FieldAssembler{}}
+}
+
+// composite indica se o caminho precisa ser remontado: STRUCTs e caminhos que
+// atravessam campos repetidos.
+func (n *nestedFields) composite(path string) bool {
+	field, canonical, ok := n.schema.Field(path)
+	return ok && (field.Type == columnar.TypeStruct || n.schema.RepeatedPath(canonical))
+}
+
+func (n *nestedFields) value(path string, record int) (interface{}, error) {
+	key := strings.ToLower(path)
+	assembler, ok := n.assemblers[key]
+	if !ok {
+		var err error
+		if assembler, err = storage.NewFieldAssembler(n.schema, path, n.columns); err != nil {
+			return nil, err
+		}
+		n.assemblers[key] = assembler
+	}
+	return assembler.Value(record)
+}
+
+// nestedToInterface converte o valor remontado para o formato do resultado:
+// STRUCT vira objeto e campo repetido vira lista.
+func nestedToInterface(value interface{}) interface{} {
+	switch v := value.(type) {
+	case columnar.Value:
+		return valueToInterface(v)
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for name, item := range v {
+			out[name] = nestedToInterface(item)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			out = append(out, nestedToInterface(item))
+		}
+		return out
 	default:
-		return 0
+		return nil
 	}
 }
 
-func valueToBool(value columnar.Value) (bool, error) {
-	switch value.Type {
-	case columnar.TypeBool:
-		return value.AsBool()
+// flattenValues junta os escalares do valor remontado, percorrendo listas
+// aninhadas.
+func flattenValues(path string, value interface{}, out []columnar.Value) ([]columnar.Value, error) {
+	switch v := value.(type) {
+	case columnar.Value:
+		return append(out, v), nil
+	case []interface{}:
+		for _, item := range v {
+			var err error
+			if out, err = flattenValues(path, item, out); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	case nil:
+		return out, nil
 	default:
-		return false, fmt.Errorf("valor %v não pode ser interpretado como boolean", value.Type)
+		return nil, fmt.Errorf("WITHIN RECORD exige um campo escalar, %s é um STRUCT", path)
+	}
+}
+
+// RowBytes estima a memória de uma linha do resultado.
+func RowBytes(row map[string]interface{}) int64 {
+	total := int64(48)
+	for name, value := range row {
+		total += 48 + int64(len(name))
+		switch v := value.(type) {
+		case string:
+			total += int64(len(v))
+		case []interface{}:
+			total += 16 * int64(len(v))
+		}
 	}
+	return total
 }
@@ -1,12 +1,20 @@
 package runner
 
 import (
+	"errors"
+	"fmt"
+	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/Jonatan852/distributed-query-processing/internal/executor"
 	"github.com/Jonatan852/distributed-query-processing/internal/parser"
+	alternative "github.com/Jonatan852/distributed-query-processing/internal/parser_alternative"
 	"github.com/Jonatan852/distributed-query-processing/internal/storage"
 	"github.com/Jonatan852/distributed-query-processing/pkg/columnar"
+	"github.com/Jonatan852/distributed-query-processing/pkg/query"
 )
 
 func TestRunnerExecuteSimpleSelect(t *testing.T) {
@@ -55,3 +63,665 @@ func TestRunnerExecuteSimpleSelect(t *testing.T) {
 		t.Fatalf("country incorreto: %v", got)
 	}
 }
+
+func TestRunnerNestedFields(t *testing.T) {
+	engine, err := storage.NewEngine(filepath.Join(t.TempDir(), "data"))
+	if err != nil {
+		t.Fatalf("erro criando engine: %v", err)
+	}
+	schema := storage.TableSchema{
+		Name: "events",
+		Columns: []storage.ColumnSchema{
+			{Name: "id", Type: columnar.TypeInt},
+			{Name: "payload", Type: columnar.TypeStruct, Nullable: true, Fields: []storage.ColumnSchema{
+				{Name: "device", Type: columnar.TypeStruct, Fields: []storage.ColumnSchema{
+					{Name: "os", Type: columnar.TypeString, Nullable: true},
+				}},
+			}},
+			{Name: "tags", Type: columnar.TypeString, Repeated: true},
+		},
+	}
+	if err := engine.RegisterTable(schema); err != nil {
+		t.Fatalf("erro registrando tabela: %v", err)
+	}
+	device := func(os string) storage.Record {
+		return storage.Record{"device": storage.Record{"os": columnar.NewStringValue(os)}}
+	}
+	records := []storage.Record{
+		{"id": columnar.NewIntValue(1), "payload": device("linux"), "tags": []interface{}{columnar.NewStringValue("a"), columnar.NewStringValue("b")}},
+		{"id": columnar.NewIntValue(2), "payload": nil, "tags": []interface{}{}},
+		{"id": columnar.NewIntValue(3), "payload": device("linux"), "tags": []interface{}{columnar.NewStringValue("c")}},
+	}
+	if _, err := engine.IngestRecords("events", "p1", records); err != nil {
+		t.Fatalf("erro ao ingerir registros: %v", err)
+	}
+
+	stmt, err := parser.Parse(`SELECT e.id, e.payload.device.os, tags, COUNT(tags) WITHIN RECORD AS n FROM events e WHERE payload.device.os = 'linux'`)
+	if err != nil {
+		t.Fatalf("parser falhou: %v", err)
+	}
+	result, err := New(engine).Execute(stmt)
+	if err != nil {
+		t.Fatalf("runner falhou: %v", err)
+	}
+	if len(result) != 2 {
+		t.Fatalf("esperava 2 linhas, obteve %v", result)
+	}
+	first := result[0]
+	if first["id"] != int64(1) || first["payload.device.os"] != "linux" || first["n"] != int64(2) {
+		t.Fatalf("linha inesperada: %v", first)
+	}
+	if tags, ok := first["tags"].([]interface{}); !ok || len(tags) != 2 || tags[1] != "b" {
+		t.Fatalf("tags deveriam ser remontadas como lista: %v", first["tags"])
+	}
+
+	stmt, err = parser.Parse(`SELECT * FROM events WHERE id = 2`)
+	if err != nil {
+		t.Fatalf("parser falhou: %v", err)
+	}
+	result, err = New(engine).Execute(stmt)
+	if err != nil {
+		t.Fatalf("runner falhou: %v", err)
+	}
+	if len(result) != 1 || result[0]["payload"] != nil {
+		t.Fatalf("payload ausente deveria ser nulo: %v", result)
+	}
+	if tags, ok := result[0]["tags"].([]interface{}); !ok || len(tags) != 0 {
+		t.Fatalf("tags vazias deveriam virar lista vazia: %v", result[0]["tags"])
+	}
+
+	stmt, err = parser.Parse(`SELECT id FROM events WHERE tags = 'a'`)
+	if err != nil {
+		t.Fatalf("parser falhou: %v", err)
+	}
+	if _, err := New(engine).Execute(stmt); err == nil {
+		t.Fatalf("campo repetido no WHERE deveria ser rejeitado")
+	}
+}
+
+func TestRunnerComputedProjections(t *testing.T) {
+	engine, err := storage.NewEngine(filepath.Join(t.TempDir(), "data"))
+	if err != nil {
+		t.Fatalf("erro criando engine: %v", err)
+	}
+	schema := storage.TableSchema{
+		Name: "events",
+		Columns: []storage.ColumnSchema{
+			{Name: "user_id", Type: columnar.TypeInt},
+			{Name: "value", Type: columnar.TypeFloat},
+			{Name: "country", Type: columnar.TypeString},
+		},
+	}
+	if err := engine.RegisterTable(schema); err != nil {
+		t.Fatalf("erro registrando tabela: %v", err)
+	}
+	rows := []storage.Row{
+		{"user_id": columnar.NewIntValue(1), "value": columnar.NewFloatValue(10), "country": columnar.NewStringValue("BR")},
+		{"user_id": columnar.NewIntValue(2), "value": columnar.NewFloatValue(30), "country": columnar.NewStringValue("US")},
+		{"user_id": columnar.NewIntValue(3), "value": columnar.NewFloatValue(20), "country": columnar.NewStringValue("AR")},
+	}
+	if _, err := engine.Ingest("events", "p1", rows); err != nil {
+		t.Fatalf("erro ao ingerir dados: %v", err)
+	}
+
+	stmt, err := parser.Parse(`SELECT user_id, value * 1.5 AS adjusted, country + '-' + country AS tag, -user_id FROM events WHERE value - 5 > 6 ORDER BY user_id * -1 LIMIT 1`)
+	if err != nil {
+		t.Fatalf("parser falhou: %v", err)
+	}
+	result, err := New(engine).Execute(stmt)
+	if err != nil {
+		t.Fatalf("runner falhou: %v", err)
+	}
+	// ORDER BY é aplicado antes do LIMIT: a maior user_id vem primeiro
+	if len(result) != 1 || result[0]["user_id"] != int64(3) {
+		t.Fatalf("resultado inesperado: %v", result)
+	}
+	if got := result[0]["adjusted"]; got != float64(30) {
+		t.Fatalf("adjusted incorreto: %v", got)
+	}
+	if got := result[0]["tag"]; got != "AR-AR" {
+		t.Fatalf("tag incorreta: %v", got)
+	}
+	if got := result[0]["(- user_id)"]; got != int64(-3) {
+		t.Fatalf("chave de expressão sem alias incorreta: %v", result[0])
+	}
+
+	stmt, err = parser.Parse(`SELECT user_id, value / 10 AS ratio FROM events ORDER BY ratio DESC`)
+	if err != nil {
+		t.Fatalf("parser falhou: %v", err)
+	}
+	result, err = New(engine).Execute(stmt)
+	if err != nil {
+		t.Fatalf("runner falhou: %v", err)
+	}
+	if len(result) != 3 || result[0]["user_id"] != int64(2) || result[2]["user_id"] != int64(1) {
+		t.Fatalf("ordenação por alias incorreta: %v", result)
+	}
+}
+
+func TestRunnerScalarFunctions(t *testing.T) {
+	engine, err := storage.NewEngine(filepath.Join(t.TempDir(), "data"))
+	if err != nil {
+		t.Fatalf("erro criando engine: %v", err)
+	}
+	schema := storage.TableSchema{
+		Name: "events",
+		Columns: []storage.ColumnSchema{
+			{Name: "user_id", Type: columnar.TypeInt},
+			{Name: "country", Type: columnar.TypeString, Nullable: true},
+			{Name: "value", Type: columnar.TypeFloat},
+		},
+	}
+	if err := engine.RegisterTable(schema); err != nil {
+		t.Fatalf("erro registrando tabela: %v", err)
+	}
+	rows := []storage.Row{
+		{"user_id": columnar.NewIntValue(1), "country": columnar.NewStringValue("br"), "value": columnar.NewFloatValue(10.26)},
+		{"user_id": columnar.NewIntValue(2), "country": columnar.NewNullValue(columnar.TypeString), "value": columnar.NewFloatValue(-3.5)},
+		{"user_id": columnar.NewIntValue(3), "country": columnar.NewStringValue("us"), "value": columnar.NewFloatValue(7)},
+	}
+	if _, err := engine.Ingest("events", "p1", rows); err != nil {
+		t.Fatalf("erro ao ingerir dados: %v", err)
+	}
+
+	stmt, err := parser.Parse(`SELECT user_id, UPPER(COALESCE(country, 'xx')) AS code, ROUND(ABS(value), 1) AS amount, IF(value > 0, 'in', 'out') AS flow FROM events WHERE LENGTH(COALESCE(country, '')) < 3 ORDER BY LOWER(COALESCE(country, 'zz')) DESC`)
+	if err != nil {
+		t.Fatalf("parser falhou: %v", err)
+	}
+	result, err := New(engine).Execute(stmt)
+	if err != nil {
+		t.Fatalf("runner falhou: %v", err)
+	}
+	if len(result) != 3 || result[0]["user_id"] != int64(2) || result[2]["user_id"] != int64(1) {
+		t.Fatalf("ordenação por função incorreta: %v", result)
+	}
+	if result[0]["code"] != "XX" || result[0]["amount"] != 3.5 || result[0]["flow"] != "out" {
+		t.Fatalf("projeção com funções incorreta: %v", result[0])
+	}
+	if result[2]["amount"] != 10.3 {
+		t.Fatalf("ROUND incorreto: %v", result[2])
+	}
+
+	stmt, err = parser.Parse(`SELECT LOWER(country, 2) FROM events`)
+	if err != nil {
+		t.Fatalf("parser falhou: %v", err)
+	}
+	if _, err := New(engine).Execute(stmt); err == nil || !strings.Contains(err.Error(), "LOWER") {
+		t.Fatalf("aridade inválida deveria falhar: %v", err)
+	}
+}
+
+func TestRunnerGroupByAggregates(t *testing.T) {
+	engine, err := storage.NewEngine(filepath.Join(t.TempDir(), "data"))
+	if err != nil {
+		t.Fatalf("erro criando engine: %v", err)
+	}
+	schema := storage.TableSchema{
+		Name: "events",
+		Columns: []storage.ColumnSchema{
+			{Name: "user_id", Type: columnar.TypeInt},
+			{Name: "event_type", Type: columnar.TypeString, Nullable: true},
+			{Name: "value", Type: columnar.TypeFloat},
+		},
+	}
+	if err := engine.RegisterTable(schema); err != nil {
+		t.Fatalf("erro registrando tabela: %v", err)
+	}
+	event := func(user int64, typ string, value float64) storage.Row {
+		row := storage.Row{"user_id": columnar.NewIntValue(user), "value": columnar.NewFloatValue(value)}
+		row["event_type"] = columnar.NewStringValue(typ)
+		if typ == "" {
+			row["event_type"] = columnar.NewNullValue(columnar.TypeString)
+		}
+		return row
+	}
+	if _, err := engine.Ingest("events", "p1", []storage.Row{
+		event(1, "click", 10), event(1, "click", 5), event(2, "click", 1),
+		event(2, "view", 3), event(3, "view", 4),
+	}); err != nil {
+		t.Fatalf("erro ao ingerir dados: %v", err)
+	}
+	if _, err := engine.Ingest("events", "p2", []storage.Row{
+		event(3, "buy", 100), event(4, "", 2), event(4, "", 7),
+	}); err != nil {
+		t.Fatalf("erro ao ingerir dados: %v", err)
+	}
+
+	run := func(sql string) []map[string]interface{} {
+		t.Helper()
+		stmt, err := parser.Parse(sql)
+		if err != nil {
+			t.Fatalf("parser falhou: %v", err)
+		}
+		result, err := New(engine).Execute(stmt)
+		if err != nil {
+			t.Fatalf("runner falhou (%s): %v", sql, err)
+		}
+		return result
+	}
+
+	result := run(`SELECT event_type, COUNT(*) AS total, COUNT(DISTINCT user_id) AS users, SUM(value) FROM events WHERE value > 1 GROUP BY event_type HAVING COUNT(*) > 1 ORDER BY total DESC, event_type LIMIT 2`)
+	if len(result) != 2 {
+		t.Fatalf("esperava 2 grupos, obteve %v", result)
+	}
+	// click perde a linha com value = 1; NULL forma um grupo próprio
+	if result[0]["event_type"] != "click" || result[0]["total"] != int64(2) || result[0]["users"] != int64(1) || result[0]["SUM(value)"] != float64(15) {
+		t.Fatalf("grupo click incorreto: %v", result[0])
+	}
+	if result[1]["event_type"] != "view" || result[1]["users"] != int64(2) {
+		t.Fatalf("segundo grupo deveria ser view: %v", result[1])
+	}
+
+	result = run(`SELECT UPPER(event_type) AS kind, MAX(value) - MIN(value) AS spread FROM events GROUP BY event_type HAVING spread >= 5 ORDER BY SUM(value) DESC`)
+	if len(result) != 2 || result[0]["kind"] != "CLICK" || result[0]["spread"] != float64(9) || result[1]["kind"] != nil || result[1]["spread"] != float64(5) {
+		t.Fatalf("HAVING/ORDER BY sobre agregações incorretos: %v", result)
+	}
+
+	result = run(`SELECT COUNT(*) AS total, AVG(value) AS avg FROM events WHERE user_id > 10`)
+	if len(result) != 1 || result[0]["total"] != int64(0) || result[0]["avg"] != nil {
+		t.Fatalf("agregação sem linhas deveria devolver um grupo vazio: %v", result)
+	}
+
+	result = run(`SELECT SUM(user_id) AS total, MIN(event_type) AS first, MAX(event_type) AS last FROM events`)
+	if len(result) != 1 || result[0]["total"] != int64(20) || result[0]["first"] != "buy" || result[0]["last"] != "view" {
+		t.Fatalf("SUM de INT deveria ser INT e MIN/MAX aceitar STRING: %v", result)
+	}
+
+	result = run(`SELECT event_type, ARRAY_AGG(user_id) AS users, APPROX_QUANTILES(value, 2) AS q, STDDEV_POP(value) AS sd, APPROX_COUNT_DISTINCT(user_id) AS approx FROM events WHERE event_type = 'view' GROUP BY event_type`)
+	if len(result) != 1 || fmt.Sprint(result[0]["users"]) != "[2 3]" || fmt.Sprint(result[0]["q"]) != "[3 3.5 4]" || result[0]["sd"] != 0.5 || result[0]["approx"] != int64(2) {
+		t.Fatalf("agregações estatísticas incorretas: %v", result)
+	}
+	result = run(`SELECT STRING_AGG(DISTINCT event_type, '|') AS kinds, ANY_VALUE(user_id) AS any FROM events WHERE user_id < 3`)
+	if len(result) != 1 || result[0]["kinds"] != "click|view" || result[0]["any"] != int64(1) {
+		t.Fatalf("STRING_AGG/ANY_VALUE incorretos: %v", result)
+	}
+	for sql, want := range map[string]string{
+		`SELECT ARRAY_AGG(value) AS v FROM events ORDER BY v`: "lista",
+		`SELECT APPROX_QUANTILES(value, user_id) FROM events`: "constantes",
+		`SELECT PERCENTILE_APPROX(value, 2) FROM events`:      "entre 0 e 1",
+	} {
+		stmt, err := parser.Parse(sql)
+		if err != nil {
+			t.Fatalf("parser falhou: %v", err)
+		}
+		if _, err := New(engine).Execute(stmt); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("%s deveria falhar com %q: %v", sql, want, err)
+		}
+	}
+
+	// o coordinator agrega os batches brutos devolvidos pelos workers
+	scanned, err := engine.Scan("events", storage.ScanOptions{})
+	if err != nil {
+		t.Fatalf("scan falhou: %v", err)
+	}
+	var batches []*executor.Batch
+	for _, batch := range scanned {
+		batches = append(batches, &executor.Batch{Columns: batch.Columns, RowCount: batch.RowCount})
+	}
+	stmt, err := parser.Parse(`SELECT user_id, COUNT(DISTINCT event_type) AS kinds FROM events GROUP BY user_id HAVING kinds > 1`)
+	if err != nil {
+		t.Fatalf("parser falhou: %v", err)
+	}
+	merged, err := New(engine).Merge(stmt, batches)
+	if err != nil {
+		t.Fatalf("merge falhou: %v", err)
+	}
+	if len(merged) != 2 || merged[0]["user_id"] != int64(2) || merged[1]["user_id"] != int64(3) {
+		t.Fatalf("merge agregado incorreto: %v", merged)
+	}
+
+	stmt, err = parser.Parse(`SELECT user_id, COUNT(*) FROM events GROUP BY event_type`)
+	if err != nil {
+		t.Fatalf("parser falhou: %v", err)
+	}
+	if _, err := New(engine).Execute(stmt); err == nil || !strings.Contains(err.Error(), "GROUP BY") {
+		t.Fatalf("coluna fora do GROUP BY deveria falhar: %v", err)
+	}
+}
+
+func TestRunnerJoins(t *testing.T) {
+	engine, err := storage.NewEngine(filepath.Join(t.TempDir(), "data"))
+	if err != nil {
+		t.Fatalf("erro criando engine: %v", err)
+	}
+	tables := []storage.TableSchema{
+		{Name: "events", Columns: []storage.ColumnSchema{
+			{Name: "user_id", Type: columnar.TypeInt},
+			{Name: "event_type", Type: columnar.TypeString},
+			{Name: "value", Type: columnar.TypeFloat},
+		}},
+		{Name: "users", Columns: []storage.ColumnSchema{
+			{Name: "id", Type: columnar.TypeInt},
+			{Name: "country", Type: columnar.TypeString},
+		}},
+	}
+	for _, schema := range tables {
+		if err := engine.RegisterTable(schema); err != nil {
+			t.Fatalf("erro registrando tabela: %v", err)
+		}
+	}
+	event := func(user int64, typ string, value float64) storage.Row {
+		return storage.Row{"user_id": columnar.NewIntValue(user), "event_type": columnar.NewStringValue(typ), "value": columnar.NewFloatValue(value)}
+	}
+	user := func(id int64, country string) storage.Row {
+		return storage.Row{"id": columnar.NewIntValue(id), "country": columnar.NewStringValue(country)}
+	}
+	// o usuário 4 não está em users e o 5 não tem eventos
+	if _, err := engine.Ingest("events", "p1", []storage.Row{
+		event(1, "click", 10), event(2, "view", 3), event(1, "buy", 50), event(4, "view", 1),
+	}); err != nil {
+		t.Fatalf("erro ao ingerir dados: %v", err)
+	}
+	if _, err := engine.Ingest("users", "p1", []storage.Row{user(1, "BR"), user(2, "US"), user(5, "AR")}); err != nil {
+		t.Fatalf("erro ao ingerir dados: %v", err)
+	}
+
+	run := func(sql string) []map[string]interface{} {
+		t.Helper()
+		stmt, err := parser.Parse(sql)
+		if err != nil {
+			t.Fatalf("parser falhou: %v", err)
+		}
+		result, err := New(engine).Execute(stmt)
+		if err != nil {
+			t.Fatalf("runner falhou (%s): %v", sql, err)
+		}
+		return result
+	}
+	pairs := func(rows []map[string]interface{}, a, b string) string {
+		out := make([]string, 0, len(rows))
+		for _, row := range rows {
+			out = append(out, fmt.Sprintf("%v/%v", row[a], row[b]))
+		}
+		return strings.Join(out, " ")
+	}
+
+	result := run(`SELECT e.event_type, u.country FROM events e JOIN users u ON e.user_id = u.id ORDER BY e.value`)
+	if got := pairs(result, "event_type", "country"); got != "view/US click/BR buy/BR" {
+		t.Fatalf("INNER JOIN incorreto: %s", got)
+	}
+	result = run(`SELECT user_id, country FROM events LEFT JOIN users ON user_id = id ORDER BY value`)
+	if got := pairs(result, "user_id", "country"); got != "4/<nil> 2/US 1/BR 1/BR" {
+		t.Fatalf("LEFT JOIN incorreto: %s", got)
+	}
+	result = run(`SELECT u.id, e.event_type FROM events e RIGHT JOIN users u ON e.user_id = u.id AND e.value > 5 ORDER BY u.id`)
+	if got := pairs(result, "id", "event_type"); got != "1/click 1/buy 2/<nil> 5/<nil>" {
+		t.Fatalf("RIGHT JOIN incorreto: %s", got)
+	}
+	// FULL JOIN só é reconhecido pelo parser alternativo
+	full, err := alternative.Parse(`SELECT e.user_id, u.id FROM events e FULL JOIN users u ON e.user_id = u.id WHERE e.user_id IS NULL OR u.id IS NULL`)
+	if err != nil {
+		t.Fatalf("parser alternativo falhou: %v", err)
+	}
+	if result, err = New(engine).Execute(full); err != nil {
+		t.Fatalf("FULL JOIN falhou: %v", err)
+	}
+	if got := pairs(result, "user_id", "id"); got != "4/<nil> <nil>/5" {
+		t.Fatalf("FULL JOIN incorreto: %s", got)
+	}
+	result = run(`SELECT COUNT(*) AS total FROM events CROSS JOIN users`)
+	if len(result) != 1 || result[0]["total"] != int64(12) {
+		t.Fatalf("CROSS JOIN deveria combinar 4 x 3 linhas: %v", result)
+	}
+	result = run(`SELECT u.country, COUNT(*) AS total, SUM(e.value) AS amount FROM events e JOIN users u ON e.user_id = u.id WHERE u.country <> 'AR' GROUP BY u.country ORDER BY amount DESC`)
+	if got := pairs(result, "country", "amount"); got != "BR/60 US/3" {
+		t.Fatalf("agregação sobre join incorreta: %s", got)
+	}
+	result = run(`SELECT u.*, e.event_type FROM events e JOIN users u ON e.user_id = u.id WHERE e.event_type = 'view'`)
+	if len(result) != 1 || len(result[0]) != 3 || result[0]["id"] != int64(2) || result[0]["country"] != "US" {
+		t.Fatalf("u.* deveria projetar só as colunas de users: %v", result)
+	}
+	result = run(`SELECT * FROM events a JOIN events b ON a.user_id = b.user_id AND a.value < b.value`)
+	if len(result) != 1 || result[0]["a.event_type"] != "click" || result[0]["b.event_type"] != "buy" {
+		t.Fatalf("colunas repetidas deveriam sair qualificadas: %v", result)
+	}
+
+	stmt, err := parser.Parse(`SELECT user_id FROM events a JOIN events b ON a.user_id = b.user_id`)
+	if err != nil {
+		t.Fatalf("parser falhou: %v", err)
+	}
+	if _, err := New(engine).Execute(stmt); err == nil || !strings.Contains(err.Error(), "ambígua") {
+		t.Fatalf("coluna presente nas duas tabelas deveria ser ambígua: %v", err)
+	}
+
+	// os workers devolvem os scans de cada lado marcados com o alias
+	stmt, err = parser.Parse(`SELECT e.event_type, u.country FROM events e LEFT JOIN users u ON e.user_id = u.id WHERE e.value > 2 ORDER BY e.value`)
+	if err != nil {
+		t.Fatalf("parser falhou: %v", err)
+	}
+	var batches []*executor.Batch
+	for alias, table := range map[string]string{"e": "events", "u": "users"} {
+		scanned, err := engine.Scan(table, storage.ScanOptions{})
+		if err != nil {
+			t.Fatalf("scan falhou: %v", err)
+		}
+		for _, batch := range scanned {
+			batches = append(batches, &executor.Batch{Columns: batch.Columns, RowCount: batch.RowCount, Meta: map[string]string{executor.MetaAlias: alias}})
+		}
+	}
+	merged, err := New(engine).Merge(stmt, batches)
+	if err != nil {
+		t.Fatalf("merge falhou: %v", err)
+	}
+	if got := pairs(merged, "event_type", "country"); got != "view/US click/BR buy/BR" {
+		t.Fatalf("merge do join incorreto: %s", got)
+	}
+}
+
+func TestRunnerExternalOrderBy(t *testing.T) {
+	dir := t.TempDir()
+	engine, err := storage.NewEngine(filepath.Join(dir, "data"))
+	if err != nil {
+		t.Fatalf("erro criando engine: %v", err)
+	}
+	if err := engine.RegisterTable(storage.TableSchema{Name: "readings", Columns: []storage.ColumnSchema{
+		{Name: "id", Type: columnar.TypeInt},
+		{Name: "sensor", Type: columnar.TypeString},
+		{Name: "at", Type: columnar.TypeTimestamp},
+	}}); err != nil {
+		t.Fatalf("erro registrando tabela: %v", err)
+	}
+	// 3000 linhas em 3 partições; o sensor se repete para que o desempate pela
+	// ordem de chegada (o id) atravesse os runs gravados em disco
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for p := 0; p < 3; p++ {
+		var rows []storage.Row
+		for i := 0; i < 1000; i++ {
+			id := int64(p*1000 + i)
+			rows = append(rows, storage.Row{
+				"id":     columnar.NewIntValue(id),
+				"sensor": columnar.NewStringValue(fmt.Sprintf("s%02d", (id*7)%37)),
+				"at":     columnar.NewTimestampValue(start.Add(time.Duration(id) * time.Minute)),
+			})
+		}
+		if _, err := engine.Ingest("readings", fmt.Sprintf("p%d", p), rows); err != nil {
+			t.Fatalf("erro ao ingerir dados: %v", err)
+		}
+	}
+	scanned, err := engine.Scan("readings", storage.ScanOptions{})
+	if err != nil {
+		t.Fatalf("scan falhou: %v", err)
+	}
+	var batches []*executor.Batch
+	for _, batch := range scanned {
+		batches = append(batches, &executor.Batch{Columns: batch.Columns, RowCount: batch.RowCount})
+	}
+	stmt, err := parser.Parse(`SELECT id, sensor, at FROM readings ORDER BY sensor DESC`)
+	if err != nil {
+		t.Fatalf("parser falhou: %v", err)
+	}
+
+	spill := filepath.Join(dir, "spill")
+	memory := executor.NewMemoryTracker("query", 0)
+	r := NewWithConfig(engine, Config{SpillDir: spill, SortMemory: 16 << 10})
+	result, stats, err := r.MergeWithMemory(stmt, batches, memory)
+	if err != nil {
+		t.Fatalf("merge falhou: %v", err)
+	}
+	if runs := stats[query.PlanNodeSort]["spilledRuns"]; runs < 2 {
+		t.Fatalf("o ORDER BY deveria gravar runs em disco: %v", stats)
+	}
+	if len(result) != 3000 {
+		t.Fatalf("esperava 3000 linhas, obteve %d", len(result))
+	}
+	for i, row := range result {
+		id, ok := row["id"].(int64)
+		at, isTime := row["at"].(time.Time)
+		if !ok || !isTime || !at.Equal(start.Add(time.Duration(id)*time.Minute)) {
+			t.Fatalf("linha %d perdeu os tipos ao passar pelo disco: %#v", i, row)
+		}
+		if i == 0 {
+			continue
+		}
+		prev := result[i-1]
+		sensor, prevSensor := row["sensor"].(string), prev["sensor"].(string)
+		if sensor > prevSensor || (sensor == prevSensor && id < prev["id"].(int64)) {
+			t.Fatalf("ordem incorreta na linha %d: %v depois de %v", i, row, prev)
+		}
+	}
+	if used := memory.Used(); used != 0 {
+		t.Fatalf("o merge deveria devolver as reservas, restaram %d bytes", used)
+	}
+	if files, _ := os.ReadDir(spill); len(files) != 0 {
+		t.Fatalf("os runs deveriam ser apagados, restaram %d arquivos", len(files))
+	}
+
+	// sem spill o buffer do sort conta no orçamento da query
+	_, _, err = New(engine).MergeWithMemory(stmt, batches, executor.NewMemoryTracker("query", 64<<10))
+	if !errors.Is(err, executor.ErrMemoryLimitExceeded) {
+		t.Fatalf("esperava ErrMemoryLimitExceeded, obteve %v", err)
+	}
+}
+
+func TestRunnerExternalHashOperators(t *testing.T) {
+	dir := t.TempDir()
+	engine, err := storage.NewEngine(filepath.Join(dir, "data"))
+	if err != nil {
+		t.Fatalf("erro criando engine: %v", err)
+	}
+	tables := []storage.TableSchema{
+		{Name: "events", Columns: []storage.ColumnSchema{
+			{Name: "user_id", Type: columnar.TypeInt},
+			{Name: "value", Type: columnar.TypeInt},
+		}},
+		{Name: "users", Columns: []storage.ColumnSchema{
+			{Name: "id", Type: columnar.TypeInt},
+			{Name: "country", Type: columnar.TypeString},
+		}},
+	}
+	for _, schema := range tables {
+		if err := engine.RegisterTable(schema); err != nil {
+			t.Fatalf("erro registrando tabela: %v", err)
+		}
+	}
+	// 2000 usuários com dois eventos cada: grupos e tabela hash bem maiores que
+	// o limite de memória
+	var events, users []storage.Row
+	for id := int64(0); id < 2000; id++ {
+		users = append(users, storage.Row{"id": columnar.NewIntValue(id), "country": columnar.NewStringValue(fmt.Sprintf("c%d", id%10))})
+		for i := int64(0); i < 2; i++ {
+			events = append(events, storage.Row{"user_id": columnar.NewIntValue(id), "value": columnar.NewIntValue(id + i)})
+		}
+	}
+	if _, err := engine.Ingest("events", "p1", events); err != nil {
+		t.Fatalf("erro ao ingerir dados: %v", err)
+	}
+	if _, err := engine.Ingest("users", "p1", users); err != nil {
+		t.Fatalf("erro ao ingerir dados: %v", err)
+	}
+	var batches []*executor.Batch
+	for alias, table := range map[string]string{"e": "events", "u": "users"} {
+		scanned, err := engine.Scan(table, storage.ScanOptions{})
+		if err != nil {
+			t.Fatalf("scan falhou: %v", err)
+		}
+		for _, batch := range scanned {
+			batches = append(batches, &executor.Batch{Columns: batch.Columns, RowCount: batch.RowCount, Meta: map[string]string{executor.MetaAlias: alias}})
+		}
+	}
+
+	spill := filepath.Join(dir, "spill")
+	r := NewWithConfig(engine, Config{SpillDir: spill, HashMemory: 8 << 10})
+	merge := func(sql string, input []*executor.Batch) ([]map[string]interface{}, Stats) {
+		t.Helper()
+		stmt, err := parser.Parse(sql)
+		if err != nil {
+			t.Fatalf("parser falhou: %v", err)
+		}
+		memory := executor.NewMemoryTracker("query", 0)
+		result, stats, err := r.MergeWithMemory(stmt, input, memory)
+		if err != nil {
+			t.Fatalf("merge falhou (%s): %v", sql, err)
+		}
+		if used := memory.Used(); used != 0 {
+			t.Fatalf("o merge deveria devolver as reservas, restaram %d bytes", used)
+		}
+		if files, _ := os.ReadDir(spill); len(files) != 0 {
+			t.Fatalf("as partições deveriam ser apagadas, restaram %d arquivos", len(files))
+		}
+		return result, stats
+	}
+
+	var eventBatches []*executor.Batch
+	for _, batch := range batches {
+		if batch.Meta[executor.MetaAlias] == "e" {
+			eventBatches = append(eventBatches, batch)
+		}
+	}
+	result, stats := merge(`SELECT user_id, COUNT(*) AS total, SUM(value) AS amount FROM events GROUP BY user_id`, eventBatches)
+	if stats[query.PlanNodeAggregate]["spilledPartitions"] == 0 {
+		t.Fatalf("o GROUP BY deveria gravar partições em disco: %v", stats)
+	}
+	if len(result) != 2000 {
+		t.Fatalf("esperava 2000 grupos, obteve %d", len(result))
+	}
+	seen := map[int64]bool{}
+	for _, row := range result {
+		id := row["user_id"].(int64)
+		if seen[id] || row["total"] != int64(2) || row["amount"] != 2*id+1 {
+			t.Fatalf("grupo incorreto: %v", row)
+		}
+		seen[id] = true
+	}
+
+	result, stats = merge(`SELECT u.country, COUNT(*) AS total FROM events e JOIN users u ON e.user_id = u.id GROUP BY u.country ORDER BY u.country`, batches)
+	if stats[query.PlanNodeJoin]["spilledPartitions"] == 0 {
+		t.Fatalf("o join deveria gravar partições em disco: %v", stats)
+	}
+	if len(result) != 10 {
+		t.Fatalf("esperava 10 países, obteve %v", result)
+	}
+	for i, row := range result {
+		if row["country"] != fmt.Sprintf("c%d", i) || row["total"] != int64(400) {
+			t.Fatalf("join agregado incorreto: %v", row)
+		}
+	}
+
+	// sem spill os grupos e a tabela hash contam no orçamento da query
+	for sql, input := range map[string][]*executor.Batch{
+		`SELECT user_id, COUNT(*) AS total FROM events GROUP BY user_id`:                   eventBatches,
+		`SELECT e.value, u.country FROM events e JOIN users u ON e.user_id = u.id LIMIT 1`: batches,
+	} {
+		stmt, err := parser.Parse(sql)
+		if err != nil {
+			t.Fatalf("parser falhou: %v", err)
+		}
+		memory := executor.NewMemoryTracker("query", 16<<10)
+		if _, _, err := New(engine).MergeWithMemory(stmt, input, memory); !errors.Is(err, executor.ErrMemoryLimitExceeded) {
+			t.Fatalf("esperava ErrMemoryLimitExceeded em %s, obteve %v", sql, err)
+		}
+		if used := memory.Used(); used != 0 {
+			t.Fatalf("a query com erro deveria devolver as reservas, restaram %d bytes", used)
+		}
+	}
+	// o ORDER BY ... LIMIT só mantém reservadas as linhas que ainda estão no
+	// resultado
+	stmt, err := parser.Parse(`SELECT user_id, value FROM events ORDER BY value DESC LIMIT 10`)
+	if err != nil {
+		t.Fatalf("parser falhou: %v", err)
+	}
+	result, _, err = New(engine).MergeWithMemory(stmt, eventBatches, executor.NewMemoryTracker("query", 16<<10))
+	if err != nil || len(result) != 10 || result[0]["value"] != int64(2000) {
+		t.Fatalf("ORDER BY ... LIMIT incorreto: %v (%v)", result, err)
+	}
+}
@@ -0,0 +1,182 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Jonatan852/distributed-query-processing/pkg/columnar"
+)
+
+// FieldAssembler rebuilds nested values from the leaf columns of a batch,
+// reversing shredRecords. Scalars come back as columnar.Value, STRUCTs as
+// map[string]interface{} and repeated fields as []interface{}; a missing
+// STRUCT is nil.
+type FieldAssembler struct {
+	root    ColumnSchema
+	rest    []string
+	columns map[string]*columnar.Column
+	offsets map[string][]int
+}
+
+// NewFieldAssembler prepares the assembly of the field at path, which may be a
+// top-level column or a nested path such as payload.device. Only the leaves
+// below path are read; they must all be present in columns. Paths crossing a
+// repeated field produce one value per element.
+func NewFieldAssembler(schema TableSchema, path string, columns map[string]*columnar.Column) (*FieldAssembler, error) {
+	_, canonical, ok := schema.Field(path)
+	if !ok {
+		return nil, fmt.Errorf("unknown field %s", path)
+	}
+	segments := strings.Split(canonical, ".")
+	root, _, _ := schema.Field(segments[0])
+	root = pruneField(root, segments[1:])
+	a := &FieldAssembler{
+		root:    root,
+		rest:    segments[1:],
+		columns: columns,
+		offsets: map[string][]int{},
+	}
+	for _, leaf := range (TableSchema{Columns: []ColumnSchema{root}}).leaves() {
+		col := columns[leaf.path]
+		if col == nil {
+			return nil, fmt.Errorf("column %s not loaded", leaf.path)
+		}
+		a.offsets[leaf.path] = col.RecordOffsets()
+	}
+	return a, nil
+}
+
+// Value assembles the field for the given record (row) of the batch.
+func (a *FieldAssembler) Value(record int) (interface{}, error) {
+	ranges := make(map[string][2]int, len(a.offsets))
+	for path, offsets := range a.offsets {
+		if record < 0 || record+1 >= len(offsets) {
+			return nil, fmt.Errorf("record %d out of bounds for column %s", record, path)
+		}
+		ranges[path] = [2]int{offsets[record], offsets[record+1]}
+	}
+	value := a.field(a.root, a.root.Name, ranges, 0, 0)
+	return project(value, a.rest), nil
+}
+
+// field assembles one occurrence slot of fs whose enclosing fields reached
+// definition level def, below depth repeated fields.
+func (a *FieldAssembler) field(fs ColumnSchema, path string, ranges map[string][2]int, def, depth uint8) interface{} {
+	if fs.Repeated {
+		level := depth + 1
+		if a.definition(fs, path, ranges) <= def {
+			return []interface{}{}
+		}
+		elements := a.split(fs, path, ranges, level)
+		items := make([]interface{}, 0, len(elements))
+		for _, element := range elements {
+			items = append(items, a.element(fs, path, element, def+1, level))
+		}
+		return items
+	}
+	if fs.Nullable {
+		if a.definition(fs, path, ranges) <= def {
+			if fs.Type == columnar.TypeStruct {
+				return nil
+			}
+			return columnar.NewNullValue(fs.Type)
+		}
+		def++
+	}
+	return a.element(fs, path, ranges, def, depth)
+}
+
+// element assembles a defined occurrence of fs.
+func (a *FieldAssembler) element(fs ColumnSchema, path string, ranges map[string][2]int, def, depth uint8) interface{} {
+	if fs.Type != columnar.TypeStruct {
+		value, err := a.columns[path].Get(ranges[path][0])
+		if err != nil {
+			return columnar.NewNullValue(fs.Type)
+		}
+		return value
+	}
+	record := make(map[string]interface{}, len(fs.Fields))
+	for _, child := range fs.Fields {
+		record[child.Name] = a.field(child, path+"."+child.Name, ranges, def, depth)
+	}
+	return record
+}
+
+// definition returns the definition level of the first entry of the slot,
+// read from the first leaf below fs.
+func (a *FieldAssembler) definition(fs ColumnSchema, path string, ranges map[string][2]int) uint8 {
+	for fs.Type == columnar.TypeStruct {
+		fs = fs.Fields[0]
+		path += "." + fs.Name
+	}
+	col := a.columns[path]
+	entry := ranges[path][0]
+	if col.DefinitionLevels != nil {
+		return col.DefinitionLevels[entry]
+	}
+	// flat nullable column: the null bitmap is the only definition level
+	if col.IsNull(entry) {
+		return 0
+	}
+	return 1
+}
+
+// split cuts the slot of a repeated field into its elements: in every leaf a
+// new element starts at entries whose repetition level is at most level.
+func (a *FieldAssembler) split(fs ColumnSchema, path string, ranges map[string][2]int, level uint8) []map[string][2]int {
+	var elements []map[string][2]int
+	for _, leaf := range (TableSchema{Columns: []ColumnSchema{fs}}).leaves() {
+		leafPath := path + strings.TrimPrefix(leaf.path, fs.Name)
+		col := a.columns[leafPath]
+		bounds := ranges[leafPath]
+		index := -1
+		for entry := bounds[0]; entry < bounds[1]; entry++ {
+			if entry > bounds[0] && col.RepetitionLevels[entry] > level {
+				continue
+			}
+			index++
+			if index == len(elements) {
+				elements = append(elements, map[string][2]int{})
+			}
+			elements[index][leafPath] = [2]int{entry, bounds[1]}
+			if index > 0 {
+				previous := elements[index-1][leafPath]
+				elements[index-1][leafPath] = [2]int{previous[0], entry}
+			}
+		}
+	}
+	return elements
+}
+
+// pruneField keeps only the branch of fs that leads to the path.
+func pruneField(fs ColumnSchema, path []string) ColumnSchema {
+	if len(path) == 0 {
+		return fs
+	}
+	for _, child := range fs.Fields {
+		if strings.EqualFold(child.Name, path[0]) {
+			fs.Fields = []ColumnSchema{pruneField(child, path[1:])}
+			return fs
+		}
+	}
+	return fs
+}
+
+// project walks the assembled value down the path, mapping over lists.
+func project(value interface{}, path []string) interface{} {
+	if len(path) == 0 || value == nil {
+		return value
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return project(v[path[0]], path[1:])
+	case []interface{}:
+		items := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			items = append(items, project(item, path))
+		}
+		return items
+	default:
+		return value
+	}
+}
@@ -26,13 +26,16 @@ type TableMetadata struct {
 
 // PartitionMetadata points to the serialized columnar files and holds statistics.
 type PartitionMetadata struct {
-	ID        string                 `json:"id"`
-	FilePath  string                 `json:"filePath"`
-	RowCount  int                    `json:"rowCount"`
-	Stats     map[string]ColumnStats `json:"stats"`
-	CreatedAt time.Time              `json:"createdAt"`
-	UpdatedAt time.Time              `json:"updatedAt"`
-	Tags      map[string]string      `json:"tags,omitempty"`
+	ID       string `json:"id"`
+	FilePath string `json:"filePath"`
+	RowCount int    `json:"rowCount"`
+	// Compression is the chunk codec used when the partition was written; empty
+	// for partitions written before compression support (uncompressed).
+	Compression string                 `json:"compression,omitempty"`
+	Stats       map[string]ColumnStats `json:"stats"`
+	CreatedAt   time.Time              `json:"createdAt"`
+	UpdatedAt   time.Time              `json:"updatedAt"`
+	Tags        map[string]string      `json:"tags,omitempty"`
 }
 
 // ColumnStats stores basic min/max/NULL counts used for pruning.
@@ -50,10 +53,17 @@ type ScalarValue struct {
 	StringValue *string           `json:"string,omitempty"`
 	FloatValue  *float64          `json:"float,omitempty"`
 	BoolValue   *bool             `json:"bool,omitempty"`
+	// TimeValue holds TIMESTAMP and DATE values.
+	TimeValue *time.Time `json:"time,omitempty"`
+	// DecimalValue keeps the exact decimal text.
+	DecimalValue *string `json:"decimal,omitempty"`
 }
 
-// FromValue converts a columnar.Value into a ScalarValue.
+// FromValue converts a columnar.Value into a ScalarValue; NULL becomes nil.
 func FromValue(v columnar.Value) *ScalarValue {
+	if v.IsNull() {
+		return nil
+	}
 	result := &ScalarValue{Type: v.Type}
 	switch v.Type {
 	case columnar.TypeInt:
@@ -68,6 +78,13 @@ func FromValue(v columnar.Value) *ScalarValue {
 	case columnar.TypeBool:
 		b, _ := v.AsBool()
 		result.BoolValue = &b
+	case columnar.TypeTimestamp, columnar.TypeDate:
+		t, _ := v.AsTime()
+		result.TimeValue = &t
+	case columnar.TypeDecimal:
+		d, _ := v.AsDecimal()
+		text := d.String()
+		result.DecimalValue = &text
 	default:
 		return nil
 	}
@@ -96,6 +113,20 @@ func (s *ScalarValue) ToValue() columnar.Value {
 		if s.BoolValue != nil {
 			return columnar.NewBoolValue(*s.BoolValue)
 		}
+	case columnar.TypeTimestamp:
+		if s.TimeValue != nil {
+			return columnar.NewTimestampValue(*s.TimeValue)
+		}
+	case columnar.TypeDate:
+		if s.TimeValue != nil {
+			return columnar.NewDateValue(*s.TimeValue)
+		}
+	case columnar.TypeDecimal:
+		if s.DecimalValue != nil {
+			if d, err := columnar.ParseDecimal(*s.DecimalValue); err == nil {
+				return columnar.NewDecimalValue(d)
+			}
+		}
 	}
 	return columnar.Value{}
 }
@@ -0,0 +1,524 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+
+	"github.com/Jonatan852/distributed-query-processing/pkg/columnar"
+)
+
+// Chunk encodings. Every chunk starts with one of these bytes followed by the
+// row count and the encoding-specific body.
+const (
+	encodingPlain      byte = 0
+	encodingDictionary byte = 1
+	encodingRLE        byte = 2
+	encodingDelta      byte = 3
+
+	// chunkNullFlag is OR-ed into the encoding byte when the column has a null
+	// bitmap; every value section is then preceded by its bit-packed nulls.
+	chunkNullFlag byte = 0x80
+	// chunkLevelsFlag marks leaves of nested columns: the body is followed by a
+	// byte telling which level arrays follow (levelsRepetition,
+	// levelsDefinition), each holding one byte per entry.
+	chunkLevelsFlag byte = 0x40
+
+	levelsRepetition byte = 1
+	levelsDefinition byte = 2
+)
+
+// encodedChunk is a column chunk kept in its storage encoding. Dictionary and
+// RLE chunks let predicates run once per distinct value or run; the plain
+// column is only materialized when someone asks for it.
+type encodedChunk struct {
+	encoding columnar.Encoding
+	// rows counts records; leaves of repeated fields hold more entries
+	rows  int
+	plain *columnar.Column
+	dict  *columnar.DictionaryColumn
+	rle   *columnar.RLEColumn
+	// repetition and definition are the levels of nested leaves, attached to
+	// the decoded column
+	repetition []uint8
+	definition []uint8
+}
+
+func plainChunk(col *columnar.Column) *encodedChunk {
+	return &encodedChunk{encoding: columnar.EncodingPlain, rows: col.Len(), plain: col}
+}
+
+// column returns the decoded column, caching it.
+func (c *encodedChunk) column() (*columnar.Column, error) {
+	if c.plain != nil {
+		return c.plain, nil
+	}
+	var err error
+	switch {
+	case c.dict != nil:
+		c.plain, err = c.dict.Decode()
+	case c.rle != nil:
+		c.plain, err = c.rle.Decode()
+	default:
+		err = errors.New("empty chunk")
+	}
+	if err == nil {
+		c.plain.RepetitionLevels = c.repetition
+		c.plain.DefinitionLevels = c.definition
+	}
+	return c.plain, err
+}
+
+// restrict clears mask entries of rows that cannot satisfy pred, evaluating the
+// predicate once per dictionary entry or run. It reports false when the chunk
+// encoding gives no shortcut (the caller then relies on the row filter) or when
+// entries do not map one to one to rows.
+func (c *encodedChunk) restrict(pred ColumnPredicate, mask []bool) bool {
+	if c.repetition != nil {
+		return false
+	}
+	switch {
+	case c.dict != nil:
+		matches := make([]bool, c.dict.Values.Len())
+		for code := range matches {
+			value, _ := c.dict.Values.Get(code)
+			matches[code] = pred.Matches(value)
+		}
+		for row, code := range c.dict.Codes {
+			if !matches[code] {
+				mask[row] = false
+			}
+		}
+		return true
+	case c.rle != nil:
+		row := 0
+		for run, length := range c.rle.Lengths {
+			value, _ := c.rle.Values.Get(run)
+			if !pred.Matches(value) {
+				for i := row; i < row+int(length); i++ {
+					mask[i] = false
+				}
+			}
+			row += int(length)
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+// encodeChunk serializes a column with the requested encoding. Plain values are
+// written as zigzag varint ints (also timestamps and dates), 8-byte
+// little-endian floats, length-prefixed strings, bit-packed bools and decimals
+// as varint unscaled value plus scale; the other encodings reuse that layout for their
+// dictionary or run values. Columns with NULLs set chunkNullFlag and leaves
+// of nested columns set chunkLevelsFlag.
+func encodeChunk(col *columnar.Column, encoding columnar.Encoding) ([]byte, error) {
+	if col == nil {
+		return nil, errors.New("nil column")
+	}
+	if !encoding.Supports(col.Type) {
+		return nil, fmt.Errorf("encoding %s does not support %s", encoding, col.Type)
+	}
+	var flags byte
+	nullable := col.NullBitmap != nil
+	if nullable {
+		flags = chunkNullFlag
+	}
+	leveled := col.RepetitionLevels != nil || col.DefinitionLevels != nil
+	if leveled {
+		flags |= chunkLevelsFlag
+	}
+	var buf bytes.Buffer
+	switch encoding {
+	case columnar.EncodingDictionary:
+		dict := columnar.EncodeDictionary(col)
+		buf.WriteByte(encodingDictionary | flags)
+		putUvarint(&buf, uint64(dict.Len()))
+		putUvarint(&buf, uint64(dict.Values.Len()))
+		if err := writeValues(&buf, dict.Values, nullable); err != nil {
+			return nil, err
+		}
+		for _, code := range dict.Codes {
+			putUvarint(&buf, uint64(code))
+		}
+	case columnar.EncodingRLE:
+		rle := columnar.EncodeRLE(col)
+		buf.WriteByte(encodingRLE | flags)
+		putUvarint(&buf, uint64(col.Len()))
+		putUvarint(&buf, uint64(len(rle.Lengths)))
+		if err := writeValues(&buf, rle.Values, nullable); err != nil {
+			return nil, err
+		}
+		for _, length := range rle.Lengths {
+			putUvarint(&buf, uint64(length))
+		}
+	case columnar.EncodingDelta:
+		delta, err := columnar.EncodeDelta(col)
+		if err != nil {
+			return nil, err
+		}
+		buf.WriteByte(encodingDelta | flags)
+		putUvarint(&buf, uint64(delta.Len()))
+		if nullable {
+			writeNulls(&buf, delta.NullBitmap, delta.Len())
+		}
+		for _, v := range delta.Deltas {
+			putVarint(&buf, v)
+		}
+	default:
+		buf.WriteByte(encodingPlain | flags)
+		putUvarint(&buf, uint64(col.Len()))
+		if err := writeValues(&buf, col, nullable); err != nil {
+			return nil, err
+		}
+	}
+	if leveled {
+		writeLevels(&buf, col)
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeChunk rebuilds a chunk from the bytes produced by encodeChunk.
+func decodeChunk(name string, typ columnar.DataType, chunk []byte) (*encodedChunk, error) {
+	r := bytes.NewReader(chunk)
+	header, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	nullable := header&chunkNullFlag != 0
+	encoding := header &^ (chunkNullFlag | chunkLevelsFlag)
+	count, err := readCount(r)
+	if err != nil {
+		return nil, err
+	}
+	decoded, err := decodeValues(r, name, typ, encoding, count, nullable)
+	if err != nil {
+		return nil, err
+	}
+	if header&chunkLevelsFlag != 0 {
+		if err := decoded.readLevels(r, count); err != nil {
+			return nil, err
+		}
+	}
+	return decoded, nil
+}
+
+// decodeValues reads the encoding-specific body of a chunk with count entries.
+func decodeValues(r *bytes.Reader, name string, typ columnar.DataType, encoding byte, count int, nullable bool) (*encodedChunk, error) {
+	var err error
+	switch encoding {
+	case encodingPlain:
+		col, err := readValues(r, name, typ, count, nullable)
+		if err != nil {
+			return nil, err
+		}
+		return plainChunk(col), nil
+	case encodingDictionary:
+		size, err := readCount(r)
+		if err != nil {
+			return nil, err
+		}
+		values, err := readValues(r, name, typ, size, nullable)
+		if err != nil {
+			return nil, err
+		}
+		codes := make([]uint32, count)
+		for i := range codes {
+			code, err := binary.ReadUvarint(r)
+			if err != nil {
+				return nil, err
+			}
+			if code >= uint64(size) {
+				return nil, fmt.Errorf("dictionary code %d out of range", code)
+			}
+			codes[i] = uint32(code)
+		}
+		dict := &columnar.DictionaryColumn{Values: values, Codes: codes}
+		return &encodedChunk{encoding: columnar.EncodingDictionary, rows: count, dict: dict}, nil
+	case encodingRLE:
+		runs, err := readCount(r)
+		if err != nil {
+			return nil, err
+		}
+		values, err := readValues(r, name, typ, runs, nullable)
+		if err != nil {
+			return nil, err
+		}
+		lengths := make([]uint32, runs)
+		total := 0
+		for i := range lengths {
+			length, err := binary.ReadUvarint(r)
+			if err != nil {
+				return nil, err
+			}
+			lengths[i] = uint32(length)
+			total += int(length)
+		}
+		if total != count {
+			return nil, fmt.Errorf("run lengths sum to %d, expected %d rows", total, count)
+		}
+		rle := &columnar.RLEColumn{Values: values, Lengths: lengths}
+		return &encodedChunk{encoding: columnar.EncodingRLE, rows: count, rle: rle}, nil
+	case encodingDelta:
+		if !columnar.EncodingDelta.Supports(typ) {
+			return nil, fmt.Errorf("delta chunk for %s column", typ)
+		}
+		delta := &columnar.DeltaColumn{Name: name, Type: typ, Deltas: make([]int64, count)}
+		if nullable {
+			if delta.NullBitmap, err = readNulls(r, count); err != nil {
+				return nil, err
+			}
+		}
+		for i := range delta.Deltas {
+			if delta.Deltas[i], err = binary.ReadVarint(r); err != nil {
+				return nil, err
+			}
+		}
+		chunk := plainChunk(delta.Decode())
+		chunk.encoding = columnar.EncodingDelta
+		return chunk, nil
+	default:
+		return nil, fmt.Errorf("unknown chunk encoding %d", encoding)
+	}
+}
+
+// writeLevels appends the level arrays of a nested leaf.
+func writeLevels(buf *bytes.Buffer, col *columnar.Column) {
+	var present byte
+	if col.RepetitionLevels != nil {
+		present |= levelsRepetition
+	}
+	if col.DefinitionLevels != nil {
+		present |= levelsDefinition
+	}
+	buf.WriteByte(present)
+	buf.Write(col.RepetitionLevels)
+	buf.Write(col.DefinitionLevels)
+}
+
+// readLevels reads the arrays written by writeLevels and recounts the rows as
+// records.
+func (c *encodedChunk) readLevels(r *bytes.Reader, count int) error {
+	present, err := r.ReadByte()
+	if err != nil {
+		return err
+	}
+	read := func() ([]uint8, error) {
+		levels := make([]uint8, count)
+		_, err := io.ReadFull(r, levels)
+		return levels, err
+	}
+	if present&levelsRepetition != 0 {
+		if c.repetition, err = read(); err != nil {
+			return err
+		}
+		if count > 0 && c.repetition[0] != 0 {
+			return errors.New("repetition levels must start a record")
+		}
+		c.rows = 0
+		for _, level := range c.repetition {
+			if level == 0 {
+				c.rows++
+			}
+		}
+	}
+	if present&levelsDefinition != 0 {
+		if c.definition, err = read(); err != nil {
+			return err
+		}
+	}
+	if c.plain != nil {
+		c.plain.RepetitionLevels = c.repetition
+		c.plain.DefinitionLevels = c.definition
+	}
+	return nil
+}
+
+// readCount reads a value count, rejecting counts larger than the remaining
+// bytes could hold (every encoded value takes at least one bit).
+func readCount(r *bytes.Reader) (int, error) {
+	count, err := binary.ReadUvarint(r)
+	if err != nil {
+		return 0, err
+	}
+	if count > uint64(r.Len())*8 {
+		return 0, errors.New("chunk value count exceeds chunk size")
+	}
+	return int(count), nil
+}
+
+func writeValues(buf *bytes.Buffer, col *columnar.Column, withNulls bool) error {
+	if withNulls {
+		writeNulls(buf, col.NullBitmap, col.Len())
+	}
+	switch col.Type {
+	case columnar.TypeInt, columnar.TypeTimestamp, columnar.TypeDate:
+		for _, v := range col.IntData {
+			putVarint(buf, v)
+		}
+	case columnar.TypeDecimal:
+		for _, v := range col.DecimalData {
+			putVarint(buf, v.Unscaled)
+			putVarint(buf, int64(v.Scale))
+		}
+	case columnar.TypeFloat:
+		var scratch [8]byte
+		for _, v := range col.FloatData {
+			binary.LittleEndian.PutUint64(scratch[:], math.Float64bits(v))
+			buf.Write(scratch[:])
+		}
+	case columnar.TypeString:
+		for _, v := range col.StringData {
+			putString(buf, v)
+		}
+	case columnar.TypeBool:
+		buf.Write(packBools(col.BoolData))
+	default:
+		return fmt.Errorf("unsupported column type %s", col.Type)
+	}
+	return nil
+}
+
+func readValues(r *bytes.Reader, name string, typ columnar.DataType, count int, withNulls bool) (*columnar.Column, error) {
+	col := columnar.NewColumn(name, typ)
+	var err error
+	if withNulls {
+		if col.NullBitmap, err = readNulls(r, count); err != nil {
+			return nil, err
+		}
+	}
+	switch typ {
+	case columnar.TypeInt, columnar.TypeTimestamp, columnar.TypeDate:
+		col.IntData = make([]int64, count)
+		for i := range col.IntData {
+			if col.IntData[i], err = binary.ReadVarint(r); err != nil {
+				return nil, err
+			}
+		}
+	case columnar.TypeDecimal:
+		col.DecimalData = make([]columnar.Decimal, count)
+		for i := range col.DecimalData {
+			unscaled, err := binary.ReadVarint(r)
+			if err != nil {
+				return nil, err
+			}
+			scale, err := binary.ReadVarint(r)
+			if err != nil {
+				return nil, err
+			}
+			col.DecimalData[i] = columnar.NewDecimal(unscaled, int32(scale))
+		}
+	case columnar.TypeFloat:
+		col.FloatData = make([]float64, count)
+		var scratch [8]byte
+		for i := range col.FloatData {
+			if _, err := io.ReadFull(r, scratch[:]); err != nil {
+				return nil, err
+			}
+			col.FloatData[i] = math.Float64frombits(binary.LittleEndian.Uint64(scratch[:]))
+		}
+	case columnar.TypeString:
+		col.StringData = make([]string, count)
+		for i := range col.StringData {
+			if col.StringData[i], err = getString(r); err != nil {
+				return nil, err
+			}
+		}
+	case columnar.TypeBool:
+		packed := make([]byte, (count+7)/8)
+		if _, err := io.ReadFull(r, packed); err != nil {
+			return nil, err
+		}
+		col.BoolData = unpackBools(packed, count)
+	default:
+		return nil, fmt.Errorf("unsupported column type %d", typ)
+	}
+	return col, nil
+}
+
+// writeNulls writes a bit-packed null bitmap padded to count rows.
+func writeNulls(buf *bytes.Buffer, bitmap []bool, count int) {
+	nulls := make([]bool, count)
+	copy(nulls, bitmap)
+	buf.Write(packBools(nulls))
+}
+
+// readNulls reads the bitmap written by writeNulls; it returns nil when no row
+// is NULL so columns without nulls keep an empty bitmap.
+func readNulls(r *bytes.Reader, count int) ([]bool, error) {
+	packed := make([]byte, (count+7)/8)
+	if _, err := io.ReadFull(r, packed); err != nil {
+		return nil, err
+	}
+	nulls := unpackBools(packed, count)
+	for _, null := range nulls {
+		if null {
+			return nulls, nil
+		}
+	}
+	return nil, nil
+}
+
+func packBools(values []bool) []byte {
+	packed := make([]byte, (len(values)+7)/8)
+	for i, v := range values {
+		if v {
+			packed[i/8] |= 1 << (i % 8)
+		}
+	}
+	return packed
+}
+
+func unpackBools(packed []byte, count int) []bool {
+	values := make([]bool, count)
+	for i := range values {
+		values[i] = packed[i/8]&(1<<(i%8)) != 0
+	}
+	return values
+}
+
+func putUvarint(buf *bytes.Buffer, v uint64) {
+	var scratch [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(scratch[:], v)
+	buf.Write(scratch[:n])
+}
+
+func putVarint(buf *bytes.Buffer, v int64) {
+	var scratch [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(scratch[:], v)
+	buf.Write(scratch[:n])
+}
+
+func putString(buf *bytes.Buffer, s string) {
+	putUvarint(buf, uint64(len(s)))
+	buf.WriteString(s)
+}
+
+func getString(r *bytes.Reader) (string, error) {
+	length, err := binary.ReadUvarint(r)
+	if err != nil {
+		return "", err
+	}
+	if length > uint64(r.Len()) {
+		return "", io.ErrUnexpectedEOF
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func sortedColumnNames(columns map[string]*columnar.Column) []string {
+	names := make([]string, 0, len(columns))
+	for name := range columns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
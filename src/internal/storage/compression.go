@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Chunk compression codecs. The codec is chosen per table through
+// TableSchema.Properties[CompressionProperty] and recorded in each
+// PartitionMetadata, so changing the table setting never affects partitions that
+// were already written.
+const (
+	CompressionProperty = "compression"
+
+	CompressionNone   = "none"
+	CompressionGzip   = "gzip"
+	CompressionSnappy = "snappy"
+)
+
+// chunkCodec compresses column chunks independently, keeping lazy column
+// loading intact.
+type chunkCodec interface {
+	compress(data []byte) ([]byte, error)
+	decompress(data []byte) ([]byte, error)
+}
+
+// normalizeCompression validates a codec name; empty means no compression.
+func normalizeCompression(name string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", CompressionNone:
+		return CompressionNone, nil
+	case CompressionGzip:
+		return CompressionGzip, nil
+	case CompressionSnappy:
+		return CompressionSnappy, nil
+	default:
+		return "", fmt.Errorf("unknown compression codec: %s", name)
+	}
+}
+
+// codecFor returns the codec registered under name. Partitions written before
+// compression existed carry an empty name and map to the identity codec.
+func codecFor(name string) (chunkCodec, error) {
+	normalized, err := normalizeCompression(name)
+	if err != nil {
+		return nil, err
+	}
+	switch normalized {
+	case CompressionGzip:
+		return gzipCodec{}, nil
+	case CompressionSnappy:
+		return snappyCodec{}, nil
+	default:
+		return noCompression{}, nil
+	}
+}
+
+// Compression returns the codec configured for the table.
+func (ts TableSchema) Compression() (string, error) {
+	return normalizeCompression(ts.Properties[CompressionProperty])
+}
+
+type noCompression struct{}
+
+func (noCompression) compress(data []byte) ([]byte, error)   { return data, nil }
+func (noCompression) decompress(data []byte) ([]byte, error) { return data, nil }
+
+type gzipCodec struct{}
+
+func (gzipCodec) compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gzipCodec) decompress(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+type snappyCodec struct{}
+
+func (snappyCodec) compress(data []byte) ([]byte, error) {
+	return snappyEncode(data), nil
+}
+
+func (snappyCodec) decompress(data []byte) ([]byte, error) {
+	return snappyDecode(data)
+}
@@ -82,17 +82,47 @@ func (e *Engine) ListTables() []TableSchema {
 	return result
 }
 
-// Ingest stores rows as a new partition for the given table.
+// PartitionIDs returns the partition IDs of a table sorted by ID.
+func (e *Engine) PartitionIDs(tableName string) ([]string, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	meta, ok := e.catalog.Tables[tableName]
+	if !ok {
+		return nil, ErrTableNotFound
+	}
+	partitions := meta.SortedPartitions()
+	ids := make([]string, 0, len(partitions))
+	for _, partition := range partitions {
+		ids = append(ids, partition.ID)
+	}
+	return ids, nil
+}
+
+// Ingest stores rows as a new partition for the given table. Tables with
+// nested columns treat each row as a Record whose STRUCT and repeated columns
+// are NULL or empty.
 func (e *Engine) Ingest(tableName, partitionID string, rows []Row) (*PartitionMetadata, error) {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
-	tableMeta, ok := e.catalog.Tables[tableName]
-	if !ok {
-		return nil, ErrTableNotFound
+	tableMeta, err := e.newPartitionTable(tableName, partitionID)
+	if err != nil {
+		return nil, err
 	}
-	if _, exists := tableMeta.Partitions[partitionID]; exists {
-		return nil, ErrPartitionExists
+	if tableMeta.Schema.IsNested() {
+		records := make([]Record, 0, len(rows))
+		for _, row := range rows {
+			record := make(Record, len(row))
+			for name, value := range row {
+				record[name] = value
+			}
+			records = append(records, record)
+		}
+		columns, err := tableMeta.Schema.shredRecords(records)
+		if err != nil {
+			return nil, err
+		}
+		return e.storePartition(tableName, tableMeta, partitionID, columns, len(rows))
 	}
 
 	columns := make(map[string]*columnar.Column, len(tableMeta.Schema.Columns))
@@ -105,32 +135,75 @@ func (e *Engine) Ingest(tableName, partitionID string, rows []Row) (*PartitionMe
 			return nil, fmt.Errorf("row %d: %w", i, err)
 		}
 		for _, colSchema := range tableMeta.Schema.Columns {
-			if err := columns[colSchema.Name].Append(row[colSchema.Name]); err != nil {
+			value, err := colSchema.Normalize(row[colSchema.Name])
+			if err != nil {
+				return nil, fmt.Errorf("row %d column %s: %w", i, colSchema.Name, err)
+			}
+			if err := columns[colSchema.Name].Append(value); err != nil {
 				return nil, fmt.Errorf("row %d column %s: %w", i, colSchema.Name, err)
 			}
 		}
 	}
+	return e.storePartition(tableName, tableMeta, partitionID, columns, len(rows))
+}
+
+// IngestRecords stores nested records as a new partition, shredding STRUCT and
+// repeated columns into one column per leaf (see Record).
+func (e *Engine) IngestRecords(tableName, partitionID string, records []Record) (*PartitionMetadata, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
 
-	relativePath := filepath.Join(tableName, fmt.Sprintf("%s.gob", partitionID))
+	tableMeta, err := e.newPartitionTable(tableName, partitionID)
+	if err != nil {
+		return nil, err
+	}
+	columns, err := tableMeta.Schema.shredRecords(records)
+	if err != nil {
+		return nil, err
+	}
+	return e.storePartition(tableName, tableMeta, partitionID, columns, len(records))
+}
+
+// newPartitionTable returns the table that will receive partitionID. Callers
+// hold the write lock.
+func (e *Engine) newPartitionTable(tableName, partitionID string) (*TableMetadata, error) {
+	tableMeta, ok := e.catalog.Tables[tableName]
+	if !ok {
+		return nil, ErrTableNotFound
+	}
+	if _, exists := tableMeta.Partitions[partitionID]; exists {
+		return nil, ErrPartitionExists
+	}
+	return tableMeta, nil
+}
+
+// storePartition writes the columns and registers the partition in the
+// catalog. Callers hold the write lock.
+func (e *Engine) storePartition(tableName string, tableMeta *TableMetadata, partitionID string, columns map[string]*columnar.Column, rowCount int) (*PartitionMetadata, error) {
+	relativePath := filepath.Join(tableName, partitionID+partitionExt)
 	fullPath := filepath.Join(e.rootDir, relativePath)
-	if err := writePartition(fullPath, columns); err != nil {
+	compression, err := tableMeta.Schema.Compression()
+	if err != nil {
+		return nil, err
+	}
+	codec, err := codecFor(compression)
+	if err != nil {
+		return nil, err
+	}
+	if err := writePartition(fullPath, columns, tableMeta.Schema.Encodings(), codec); err != nil {
 		return nil, err
 	}
 
 	stats := computeStats(columns)
-	rowCount := 0
-	if len(tableMeta.Schema.Columns) > 0 {
-		firstCol := columns[tableMeta.Schema.Columns[0].Name]
-		rowCount = firstCol.Len()
-	}
 	now := time.Now().UTC()
 	partitionMeta := &PartitionMetadata{
-		ID:        partitionID,
-		FilePath:  relativePath,
-		RowCount:  rowCount,
-		Stats:     stats,
-		CreatedAt: now,
-		UpdatedAt: now,
+		ID:          partitionID,
+		FilePath:    filepath.ToSlash(relativePath),
+		RowCount:    rowCount,
+		Compression: compression,
+		Stats:       stats,
+		CreatedAt:   now,
+		UpdatedAt:   now,
 	}
 	if tableMeta.Partitions == nil {
 		tableMeta.Partitions = map[string]*PartitionMetadata{}
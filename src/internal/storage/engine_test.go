@@ -1,7 +1,13 @@
 package storage
 
 import (
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/Jonatan852/distributed-query-processing/pkg/columnar"
@@ -73,3 +79,720 @@ func TestEngineIngestAndScan(t *testing.T) {
 		t.Fatalf("expected 2 rows after filter, got %d", filtered)
 	}
 }
+
+func TestScanPrunesPartitionsByMinMax(t *testing.T) {
+	engine, err := NewEngine(filepath.Join(t.TempDir(), "store"))
+	if err != nil {
+		t.Fatalf("failed to create engine: %v", err)
+	}
+	schema := TableSchema{
+		Name:    "events",
+		Columns: []ColumnSchema{{Name: "user_id", Type: columnar.TypeInt}},
+	}
+	if err := engine.RegisterTable(schema); err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+	// p1 = [1, 10], p2 = [11, 20], p3 = [21, 30]
+	for idx, id := range []string{"p1", "p2", "p3"} {
+		rows := make([]Row, 0, 10)
+		for i := 1; i <= 10; i++ {
+			rows = append(rows, Row{"user_id": columnar.NewIntValue(int64(idx*10 + i))})
+		}
+		if _, err := engine.Ingest("events", id, rows); err != nil {
+			t.Fatalf("ingest failed: %v", err)
+		}
+	}
+
+	cases := []struct {
+		name string
+		pred ColumnPredicate
+		kept []string
+	}{
+		{"equal", ColumnPredicate{Column: "user_id", Operator: PruneEqual, Values: []columnar.Value{columnar.NewIntValue(15)}}, []string{"p2"}},
+		{"less", ColumnPredicate{Column: "user_id", Operator: PruneLess, Values: []columnar.Value{columnar.NewIntValue(11)}}, []string{"p1"}},
+		{"greater", ColumnPredicate{Column: "user_id", Operator: PruneGreater, Values: []columnar.Value{columnar.NewFloatValue(19.5)}}, []string{"p2", "p3"}},
+		{"between", ColumnPredicate{Column: "user_id", Operator: PruneBetween, Values: []columnar.Value{columnar.NewIntValue(5), columnar.NewIntValue(12)}}, []string{"p1", "p2"}},
+		{"in", ColumnPredicate{Column: "user_id", Operator: PruneIn, Values: []columnar.Value{columnar.NewIntValue(3), columnar.NewIntValue(25), columnar.NewIntValue(99)}}, []string{"p1", "p3"}},
+		{"incomparable", ColumnPredicate{Column: "user_id", Operator: PruneEqual, Values: []columnar.Value{columnar.NewStringValue("x")}}, []string{"p1", "p2", "p3"}},
+	}
+	for _, tc := range cases {
+		kept, total, err := engine.PrunePartitions("events", []ColumnPredicate{tc.pred})
+		if err != nil {
+			t.Fatalf("%s: prune failed: %v", tc.name, err)
+		}
+		if total != 3 || strings.Join(kept, ",") != strings.Join(tc.kept, ",") {
+			t.Fatalf("%s: expected %v of 3, got %v of %d", tc.name, tc.kept, kept, total)
+		}
+	}
+
+	batches, err := engine.Scan("events", ScanOptions{
+		Prune: []ColumnPredicate{{Column: "user_id", Operator: PruneGreaterEqual, Values: []columnar.Value{columnar.NewIntValue(21)}}},
+	})
+	if err != nil {
+		t.Fatalf("scan failed: %v", err)
+	}
+	if len(batches) != 1 || batches[0].Partition != "p3" {
+		t.Fatalf("expected only p3 to be scanned, got %d batches", len(batches))
+	}
+}
+
+func TestScannerReadsPartitionsOnDemand(t *testing.T) {
+	engine, err := NewEngine(filepath.Join(t.TempDir(), "store"))
+	if err != nil {
+		t.Fatalf("failed to create engine: %v", err)
+	}
+	schema := TableSchema{
+		Name:    "events",
+		Columns: []ColumnSchema{{Name: "user_id", Type: columnar.TypeInt}},
+	}
+	if err := engine.RegisterTable(schema); err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+	for idx, id := range []string{"p1", "p2", "p3"} {
+		rows := make([]Row, 0, 10)
+		for i := 1; i <= 10; i++ {
+			rows = append(rows, Row{"user_id": columnar.NewIntValue(int64(idx*10 + i))})
+		}
+		if _, err := engine.Ingest("events", id, rows); err != nil {
+			t.Fatalf("ingest failed: %v", err)
+		}
+	}
+	// a scanner that stops after p1 must never open the later files
+	tableMeta, err := engine.ensureTable("events")
+	if err != nil {
+		t.Fatalf("table lookup failed: %v", err)
+	}
+	if err := os.Remove(engine.partitionPath(tableMeta.Partitions["p3"])); err != nil {
+		t.Fatalf("remove failed: %v", err)
+	}
+
+	scanner, err := engine.OpenScan("events", ScanOptions{BatchSize: 4})
+	if err != nil {
+		t.Fatalf("open scan failed: %v", err)
+	}
+	if scanner.PartitionsRead() != 0 {
+		t.Fatalf("OpenScan should not read partitions, read %d", scanner.PartitionsRead())
+	}
+	var rows int
+	for rows < 10 {
+		batch, err := scanner.Next()
+		if err != nil {
+			t.Fatalf("next failed: %v", err)
+		}
+		if batch.Partition != "p1" {
+			t.Fatalf("expected batches of p1 first, got %s", batch.Partition)
+		}
+		rows += batch.RowCount
+	}
+	if rows != 10 || scanner.PartitionsRead() != 1 {
+		t.Fatalf("expected 10 rows from 1 partition, got %d rows from %d", rows, scanner.PartitionsRead())
+	}
+	if err := scanner.Close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+	if _, err := scanner.Next(); err != io.EOF {
+		t.Fatalf("expected io.EOF after Close, got %v", err)
+	}
+
+	// reading past p2 reaches the missing file
+	scanner, err = engine.OpenScan("events", ScanOptions{})
+	if err != nil {
+		t.Fatalf("open scan failed: %v", err)
+	}
+	defer scanner.Close()
+	for _, want := range []string{"p1", "p2"} {
+		batch, err := scanner.Next()
+		if err != nil || batch.Partition != want {
+			t.Fatalf("expected %s, got %s (%v)", want, batch.Partition, err)
+		}
+	}
+	if _, err := scanner.Next(); err == nil || err == io.EOF {
+		t.Fatalf("expected an error reading the removed partition, got %v", err)
+	}
+}
+
+func TestColumnarPartitionLoadsColumnsLazily(t *testing.T) {
+	engine, err := NewEngine(filepath.Join(t.TempDir(), "store"))
+	if err != nil {
+		t.Fatalf("failed to create engine: %v", err)
+	}
+	schema := TableSchema{
+		Name: "events",
+		Columns: []ColumnSchema{
+			{Name: "user_id", Type: columnar.TypeInt},
+			{Name: "value", Type: columnar.TypeFloat},
+			{Name: "country", Type: columnar.TypeString},
+			{Name: "active", Type: columnar.TypeBool},
+		},
+	}
+	if err := engine.RegisterTable(schema); err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+	rows := []Row{
+		{"user_id": columnar.NewIntValue(-3), "value": columnar.NewFloatValue(1.5), "country": columnar.NewStringValue("BR"), "active": columnar.NewBoolValue(true)},
+		{"user_id": columnar.NewIntValue(9), "value": columnar.NewFloatValue(2.5), "country": columnar.NewStringValue(""), "active": columnar.NewBoolValue(false)},
+	}
+	meta, err := engine.Ingest("events", "p1", rows)
+	if err != nil {
+		t.Fatalf("ingest failed: %v", err)
+	}
+	if filepath.Ext(meta.FilePath) != partitionExt {
+		t.Fatalf("expected new partitions to use %s, got %s", partitionExt, meta.FilePath)
+	}
+
+	reader, err := openPartition(filepath.Join(engine.rootDir, meta.FilePath), noCompression{})
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	defer reader.Close()
+	columnarReader, ok := reader.(*columnarPartition)
+	if !ok {
+		t.Fatalf("expected columnar reader, got %T", reader)
+	}
+	if reader.RowCount() != 2 || len(reader.ColumnNames()) != 4 {
+		t.Fatalf("unexpected footer: %d rows, columns %v", reader.RowCount(), reader.ColumnNames())
+	}
+	col, err := reader.Column("country")
+	if err != nil {
+		t.Fatalf("column read failed: %v", err)
+	}
+	if len(columnarReader.loaded) != 1 {
+		t.Fatalf("expected only one decoded column, got %d", len(columnarReader.loaded))
+	}
+	if col.StringData[0] != "BR" || col.StringData[1] != "" {
+		t.Fatalf("unexpected column data %v", col.StringData)
+	}
+	for _, name := range []string{"user_id", "value", "active"} {
+		col, err := reader.Column(name)
+		if err != nil || col.Len() != 2 {
+			t.Fatalf("column %s: len=%d err=%v", name, col.Len(), err)
+		}
+	}
+	userID, _ := reader.Column("user_id")
+	active, _ := reader.Column("active")
+	if userID.IntData[0] != -3 || !active.BoolData[0] {
+		t.Fatalf("round trip mismatch")
+	}
+}
+
+func TestScanFiltersOnEncodedChunks(t *testing.T) {
+	engine, err := NewEngine(filepath.Join(t.TempDir(), "store"))
+	if err != nil {
+		t.Fatalf("failed to create engine: %v", err)
+	}
+	invalid := TableSchema{
+		Name:    "bad",
+		Columns: []ColumnSchema{{Name: "country", Type: columnar.TypeString, Encoding: "DELTA"}},
+	}
+	if err := engine.RegisterTable(invalid); err == nil {
+		t.Fatalf("expected DELTA on a STRING column to be rejected")
+	}
+	schema := TableSchema{
+		Name: "events",
+		Columns: []ColumnSchema{
+			{Name: "user_id", Type: columnar.TypeInt, Encoding: "DELTA"},
+			{Name: "country", Type: columnar.TypeString, Encoding: "DICTIONARY"},
+			{Name: "active", Type: columnar.TypeBool, Encoding: "RLE"},
+		},
+	}
+	if err := engine.RegisterTable(schema); err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+	countries := []string{"BR", "US", "BR", "AR", "US", "BR"}
+	rows := make([]Row, 0, len(countries))
+	for i, country := range countries {
+		rows = append(rows, Row{
+			"user_id": columnar.NewIntValue(int64(100 + i*3)),
+			"country": columnar.NewStringValue(country),
+			"active":  columnar.NewBoolValue(i < 4),
+		})
+	}
+	meta, err := engine.Ingest("events", "p1", rows)
+	if err != nil {
+		t.Fatalf("ingest failed: %v", err)
+	}
+
+	reader, err := openPartition(filepath.Join(engine.rootDir, meta.FilePath), noCompression{})
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	expected := map[string]columnar.Encoding{
+		"user_id": columnar.EncodingDelta,
+		"country": columnar.EncodingDictionary,
+		"active":  columnar.EncodingRLE,
+	}
+	for name, encoding := range expected {
+		chunk, err := reader.Chunk(name)
+		if err != nil {
+			t.Fatalf("chunk %s: %v", name, err)
+		}
+		if chunk.encoding != encoding {
+			t.Fatalf("column %s: expected %s, got %s", name, encoding, chunk.encoding)
+		}
+	}
+	userID, _ := reader.Column("user_id")
+	if userID.IntData[5] != 115 {
+		t.Fatalf("delta round trip mismatch: %v", userID.IntData)
+	}
+	reader.Close()
+
+	// without a row filter only the dictionary codes decide which rows survive
+	batches, err := engine.Scan("events", ScanOptions{
+		Columns: []string{"user_id", "country", "active"},
+		Prune: []ColumnPredicate{
+			{Column: "country", Operator: PruneEqual, Values: []columnar.Value{columnar.NewStringValue("BR")}},
+			{Column: "active", Operator: PruneEqual, Values: []columnar.Value{columnar.NewBoolValue(true)}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("scan failed: %v", err)
+	}
+	var ids []int64
+	for _, batch := range batches {
+		for _, country := range batch.Columns["country"].StringData {
+			if country != "BR" {
+				t.Fatalf("unexpected country %s", country)
+			}
+		}
+		ids = append(ids, batch.Columns["user_id"].IntData...)
+	}
+	if len(ids) != 2 || ids[0] != 100 || ids[1] != 106 {
+		t.Fatalf("expected rows 100 and 106, got %v", ids)
+	}
+}
+
+func TestCompressedPartitionsRoundTrip(t *testing.T) {
+	engine, err := NewEngine(filepath.Join(t.TempDir(), "store"))
+	if err != nil {
+		t.Fatalf("failed to create engine: %v", err)
+	}
+	invalid := TableSchema{
+		Name:       "bad",
+		Columns:    []ColumnSchema{{Name: "id", Type: columnar.TypeInt}},
+		Properties: map[string]string{CompressionProperty: "lzma"},
+	}
+	if err := engine.RegisterTable(invalid); err == nil {
+		t.Fatalf("expected unknown codec to be rejected")
+	}
+
+	rows := make([]Row, 0, 2000)
+	for i := 0; i < 2000; i++ {
+		rows = append(rows, Row{
+			"id":      columnar.NewIntValue(int64(i)),
+			"country": columnar.NewStringValue([]string{"BR", "US", "AR"}[i%3]),
+		})
+	}
+	sizes := map[string]int64{}
+	for _, codec := range []string{CompressionNone, CompressionGzip, CompressionSnappy} {
+		table := "events_" + codec
+		schema := TableSchema{
+			Name: table,
+			Columns: []ColumnSchema{
+				{Name: "id", Type: columnar.TypeInt},
+				{Name: "country", Type: columnar.TypeString},
+			},
+			Properties: map[string]string{CompressionProperty: codec},
+		}
+		if err := engine.RegisterTable(schema); err != nil {
+			t.Fatalf("register %s failed: %v", table, err)
+		}
+		meta, err := engine.Ingest(table, "p1", rows)
+		if err != nil {
+			t.Fatalf("ingest %s failed: %v", table, err)
+		}
+		if meta.Compression != codec {
+			t.Fatalf("expected codec %s in metadata, got %q", codec, meta.Compression)
+		}
+		info, err := os.Stat(filepath.Join(engine.rootDir, meta.FilePath))
+		if err != nil {
+			t.Fatalf("stat failed: %v", err)
+		}
+		sizes[codec] = info.Size()
+
+		batches, err := engine.Scan(table, ScanOptions{Columns: []string{"id", "country"}})
+		if err != nil {
+			t.Fatalf("scan %s failed: %v", table, err)
+		}
+		seen := 0
+		for _, batch := range batches {
+			for i, id := range batch.Columns["id"].IntData {
+				if id != int64(seen) || batch.Columns["country"].StringData[i] != rows[seen]["country"].Data {
+					t.Fatalf("%s: row %d mismatch", codec, seen)
+				}
+				seen++
+			}
+		}
+		if seen != len(rows) {
+			t.Fatalf("%s: expected %d rows, got %d", codec, len(rows), seen)
+		}
+	}
+	if sizes[CompressionGzip] >= sizes[CompressionNone] || sizes[CompressionSnappy] >= sizes[CompressionNone] {
+		t.Fatalf("compressed partitions are not smaller: %v", sizes)
+	}
+}
+
+func TestSnappyRoundTrip(t *testing.T) {
+	inputs := [][]byte{
+		nil,
+		[]byte("abc"),
+		[]byte(strings.Repeat("columnar ", 5000)),
+		[]byte(strings.Repeat("a", 70000)),
+	}
+	random := make([]byte, 100000)
+	state := uint32(7)
+	for i := range random {
+		state = state*1103515245 + 12345
+		random[i] = byte(state >> 16)
+	}
+	inputs = append(inputs, random)
+	for i, input := range inputs {
+		decoded, err := snappyDecode(snappyEncode(input))
+		if err != nil {
+			t.Fatalf("input %d: decode failed: %v", i, err)
+		}
+		if string(decoded) != string(input) {
+			t.Fatalf("input %d: round trip mismatch", i)
+		}
+	}
+	if _, err := snappyDecode([]byte{10, 0x0d, 0x01}); err == nil {
+		t.Fatalf("expected corrupt input to fail")
+	}
+}
+
+func TestSnappyRejectsCorruptInput(t *testing.T) {
+	// a 6-byte chunk claiming 4 GiB of output must fail before allocating
+	huge := binary.AppendUvarint(nil, 1<<32-1)
+	huge = append(huge, 0x00)
+	if _, err := snappyDecode(huge); err == nil {
+		t.Fatalf("expected oversized length to fail")
+	}
+	if _, err := snappyDecode(binary.AppendUvarint(nil, 1)); err == nil {
+		t.Fatalf("expected length without elements to fail")
+	}
+
+	// truncated and bit-flipped encodings must return an error or a buffer,
+	// never panic or allocate beyond the expansion bound
+	encoded := snappyEncode([]byte(strings.Repeat("columnar storage ", 200)))
+	for cut := 0; cut < len(encoded); cut++ {
+		if _, err := snappyDecode(encoded[:cut]); err == nil {
+			t.Fatalf("expected truncation at %d to fail", cut)
+		}
+	}
+	for i := range encoded {
+		for _, mask := range []byte{0x01, 0x80, 0xff} {
+			corrupt := append([]byte(nil), encoded...)
+			corrupt[i] ^= mask
+			decoded, err := snappyDecode(corrupt)
+			if err == nil && len(decoded) > len(corrupt)*snappyMaxExpansion {
+				t.Fatalf("byte %d: decoded %d bytes from %d", i, len(decoded), len(corrupt))
+			}
+		}
+	}
+}
+
+func TestNullableColumns(t *testing.T) {
+	engine, err := NewEngine(filepath.Join(t.TempDir(), "store"))
+	if err != nil {
+		t.Fatalf("failed to create engine: %v", err)
+	}
+	schema := TableSchema{
+		Name: "events",
+		Columns: []ColumnSchema{
+			{Name: "user_id", Type: columnar.TypeInt},
+			{Name: "country", Type: columnar.TypeString, Nullable: true, Encoding: "DICTIONARY"},
+			{Name: "score", Type: columnar.TypeInt, Nullable: true, Encoding: "DELTA"},
+		},
+	}
+	if err := engine.RegisterTable(schema); err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+	if _, err := engine.Ingest("events", "bad", []Row{{"country": columnar.NewStringValue("BR")}}); err == nil {
+		t.Fatalf("expected missing non-nullable column to be rejected")
+	}
+	rows := []Row{
+		{"user_id": columnar.NewIntValue(1), "country": columnar.NewStringValue("BR"), "score": columnar.NewIntValue(10)},
+		{"user_id": columnar.NewIntValue(2), "score": columnar.NewNullValue(columnar.TypeInt)},
+		{"user_id": columnar.NewIntValue(3), "country": columnar.NewStringValue("AR")},
+	}
+	meta, err := engine.Ingest("events", "p1", rows)
+	if err != nil {
+		t.Fatalf("ingest failed: %v", err)
+	}
+	country := meta.Stats["country"]
+	if country.Count != 3 || country.NullCount != 1 || country.Min.ToValue().Data != "AR" || country.Max.ToValue().Data != "BR" {
+		t.Fatalf("unexpected country stats %+v", country)
+	}
+	if score := meta.Stats["score"]; score.NullCount != 2 || score.Min.ToValue().Data != int64(10) {
+		t.Fatalf("unexpected score stats %+v", score)
+	}
+
+	batches, err := engine.Scan("events", ScanOptions{Columns: []string{"user_id", "country", "score"}})
+	if err != nil || len(batches) != 1 {
+		t.Fatalf("scan failed: %v", err)
+	}
+	cols := batches[0].Columns
+	if !cols["country"].IsNull(1) || cols["country"].IsNull(2) || !cols["score"].IsNull(1) || !cols["score"].IsNull(2) {
+		t.Fatalf("null bitmap lost: country=%v score=%v", cols["country"].NullBitmap, cols["score"].NullBitmap)
+	}
+	if v, _ := cols["score"].Get(0); v.Data != int64(10) {
+		t.Fatalf("unexpected score %v", v)
+	}
+
+	// NULL never satisfies a comparison evaluated on dictionary codes
+	batches, err = engine.Scan("events", ScanOptions{
+		Columns: []string{"user_id"},
+		Prune:   []ColumnPredicate{{Column: "country", Operator: PruneLessEqual, Values: []columnar.Value{columnar.NewStringValue("BR")}}},
+	})
+	if err != nil || len(batches) != 1 || batches[0].RowCount != 2 {
+		t.Fatalf("expected 2 non-null rows, got %v (err %v)", batches, err)
+	}
+}
+
+func TestTemporalAndDecimalColumns(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "store")
+	engine, err := NewEngine(root)
+	if err != nil {
+		t.Fatalf("failed to create engine: %v", err)
+	}
+	schema := TableSchema{
+		Name: "orders",
+		Columns: []ColumnSchema{
+			{Name: "ts", Type: columnar.TypeTimestamp, Encoding: "DELTA"},
+			{Name: "day", Type: columnar.TypeDate},
+			{Name: "amount", Type: columnar.TypeDecimal, Precision: 4, Scale: 2},
+		},
+	}
+	if err := engine.RegisterTable(schema); err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+	mustParse := func(dt columnar.DataType, text string) columnar.Value {
+		v, err := columnar.ParseValue(dt, text)
+		if err != nil {
+			t.Fatalf("parse %q failed: %v", text, err)
+		}
+		return v
+	}
+	// p1 covers 10:00-10:30 UTC, p2 covers 12:00-12:30 UTC
+	for _, part := range []struct{ id, from, to string }{
+		{"p1", "2025-01-01T07:00:00-03:00", "2025-01-01T10:30:00Z"},
+		{"p2", "2025-01-01 12:00:00", "2025-01-01T09:30:00-03:00"},
+	} {
+		rows := []Row{
+			{"ts": mustParse(columnar.TypeTimestamp, part.from), "day": mustParse(columnar.TypeDate, "2025-01-01"), "amount": mustParse(columnar.TypeDecimal, "12.5")},
+			{"ts": mustParse(columnar.TypeTimestamp, part.to), "day": mustParse(columnar.TypeDate, "2025-01-02"), "amount": mustParse(columnar.TypeDecimal, "1.005")},
+		}
+		if _, err := engine.Ingest("orders", part.id, rows); err != nil {
+			t.Fatalf("ingest %s failed: %v", part.id, err)
+		}
+	}
+
+	// stats survive a catalog reload
+	engine, err = NewEngine(root)
+	if err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	parts := engine.catalog.Tables["orders"].SortedPartitions()
+	if len(parts) != 2 {
+		t.Fatalf("expected 2 partitions, got %d", len(parts))
+	}
+	stats := parts[0].Stats
+	if min := stats["ts"].Min.ToValue(); min.String() != "2025-01-01T10:00:00Z" {
+		t.Fatalf("unexpected ts min %v", min)
+	}
+	if max := stats["amount"].Max.ToValue(); max.Type != columnar.TypeDecimal || max.String() != "12.50" {
+		t.Fatalf("unexpected amount max %v", max)
+	}
+	if max := stats["day"].Max.ToValue(); max.String() != "2025-01-02" {
+		t.Fatalf("unexpected day max %v", max)
+	}
+
+	// string bounds with an offset are compared as instants
+	between := ColumnPredicate{Column: "ts", Operator: PruneBetween, Values: []columnar.Value{
+		columnar.NewStringValue("2025-01-01T08:45:00-03:00"),
+		columnar.NewStringValue("2025-01-01T09:15:00-03:00"),
+	}}
+	kept, _, err := engine.PrunePartitions("orders", []ColumnPredicate{between})
+	if err != nil || strings.Join(kept, ",") != "p2" {
+		t.Fatalf("expected only p2, got %v (err %v)", kept, err)
+	}
+
+	batches, err := engine.Scan("orders", ScanOptions{Columns: []string{"ts", "amount"}})
+	if err != nil || len(batches) != 2 {
+		t.Fatalf("scan failed: %v", err)
+	}
+	if v, _ := batches[1].Columns["ts"].Get(1); v.String() != "2025-01-01T12:30:00Z" {
+		t.Fatalf("unexpected ts %v", v)
+	}
+	if v, _ := batches[0].Columns["amount"].Get(1); v.String() != "1.01" {
+		t.Fatalf("expected amount rounded to scale 2, got %v", v)
+	}
+
+	// the precision survives the reload: DECIMAL(4,2) holds at most 99.99
+	for _, text := range []string{"123.4", "99.995"} {
+		row := Row{"ts": mustParse(columnar.TypeTimestamp, "2025-01-03T00:00:00Z"), "day": mustParse(columnar.TypeDate, "2025-01-03"), "amount": mustParse(columnar.TypeDecimal, text)}
+		if _, err := engine.Ingest("orders", "p3", []Row{row}); err == nil || !strings.Contains(err.Error(), "DECIMAL(4,2)") {
+			t.Fatalf("expected %s to overflow DECIMAL(4,2), got %v", text, err)
+		}
+	}
+	for _, col := range []ColumnSchema{
+		{Name: "amount", Type: columnar.TypeDecimal, Precision: columnar.MaxDecimalPrecision + 1},
+		{Name: "amount", Type: columnar.TypeDecimal, Precision: 2, Scale: 3},
+		{Name: "amount", Type: columnar.TypeInt, Precision: 4},
+	} {
+		if err := (TableSchema{Name: "bad", Columns: []ColumnSchema{col}}).Validate(); err == nil {
+			t.Fatalf("expected %+v to be rejected", col)
+		}
+	}
+}
+
+func TestNestedRecordsRoundTrip(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "store")
+	engine, err := NewEngine(root)
+	if err != nil {
+		t.Fatalf("failed to create engine: %v", err)
+	}
+	// the Document example of the Dremel paper
+	schema := TableSchema{
+		Name: "docs",
+		Columns: []ColumnSchema{
+			{Name: "id", Type: columnar.TypeInt},
+			{Name: "name", Type: columnar.TypeStruct, Repeated: true, Fields: []ColumnSchema{
+				{Name: "language", Type: columnar.TypeStruct, Repeated: true, Fields: []ColumnSchema{
+					{Name: "code", Type: columnar.TypeString},
+					{Name: "country", Type: columnar.TypeString, Nullable: true},
+				}},
+				{Name: "url", Type: columnar.TypeString, Nullable: true},
+			}},
+		},
+		Properties: map[string]string{"compression": "gzip"},
+	}
+	if err := engine.RegisterTable(schema); err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+	str := columnar.NewStringValue
+	language := func(code, country string) Record {
+		lang := Record{"code": str(code)}
+		if country != "" {
+			lang["country"] = str(country)
+		}
+		return lang
+	}
+	records := []Record{
+		{"id": columnar.NewIntValue(10), "name": []interface{}{
+			Record{"language": []interface{}{language("en-us", "us"), language("en", "")}, "url": str("http://A")},
+			Record{"url": str("http://B")},
+			Record{"language": []interface{}{language("en-gb", "gb")}},
+		}},
+		{"id": columnar.NewIntValue(20), "name": []interface{}{Record{"url": str("http://C")}}},
+	}
+	if _, err := engine.IngestRecords("docs", "p1", records); err != nil {
+		t.Fatalf("ingest failed: %v", err)
+	}
+	if _, err := engine.IngestRecords("docs", "p2", []Record{{"id": columnar.NewIntValue(30), "name": []interface{}{Record{"url": columnar.NewIntValue(1)}}}}); err == nil {
+		t.Fatalf("expected type mismatch error")
+	}
+
+	engine, err = NewEngine(root)
+	if err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	columns := []string{"id", "name.language.code", "name.language.country", "name.url"}
+	batches, err := engine.Scan("docs", ScanOptions{Columns: columns, BatchSize: 1})
+	if err != nil {
+		t.Fatalf("scan failed: %v", err)
+	}
+	if len(batches) != 2 || batches[0].RowCount != 1 {
+		t.Fatalf("expected one record per batch, got %d batches", len(batches))
+	}
+	first := batches[0].Columns
+	levels := func(col *columnar.Column) string {
+		var b strings.Builder
+		for i := range col.RepetitionLevels {
+			fmt.Fprintf(&b, "%d%d ", col.RepetitionLevels[i], col.DefinitionLevels[i])
+		}
+		return b.String()
+	}
+	if got := levels(first["name.language.code"]); got != "02 22 11 12 " {
+		t.Fatalf("unexpected code levels %q", got)
+	}
+	if got := levels(first["name.language.country"]); got != "03 22 11 13 " {
+		t.Fatalf("unexpected country levels %q", got)
+	}
+
+	assembler, err := NewFieldAssembler(schema, "name", first)
+	if err != nil {
+		t.Fatalf("assembler failed: %v", err)
+	}
+	value, err := assembler.Value(0)
+	if err != nil {
+		t.Fatalf("assembly failed: %v", err)
+	}
+	names := value.([]interface{})
+	if len(names) != 3 {
+		t.Fatalf("expected 3 names, got %v", names)
+	}
+	second := names[1].(map[string]interface{})
+	if langs := second["language"].([]interface{}); len(langs) != 0 || second["url"].(columnar.Value).String() != "http://B" {
+		t.Fatalf("unexpected second name %v", second)
+	}
+	langs := names[0].(map[string]interface{})["language"].([]interface{})
+	if country := langs[1].(map[string]interface{})["country"].(columnar.Value); !country.IsNull() {
+		t.Fatalf("expected NULL country, got %v", country)
+	}
+
+	codes, err := NewFieldAssembler(schema, "name.language.code", batches[1].Columns)
+	if err != nil {
+		t.Fatalf("assembler failed: %v", err)
+	}
+	if value, _ := codes.Value(0); len(value.([]interface{})) != 1 || len(value.([]interface{})[0].([]interface{})) != 0 {
+		t.Fatalf("expected one name without languages, got %v", value)
+	}
+
+	if err := (TableSchema{Name: "bad", Columns: []ColumnSchema{{Name: "tags", Type: columnar.TypeString, Repeated: true, Nullable: true}}}).Validate(); err == nil {
+		t.Fatalf("expected repeated nullable field to be rejected")
+	}
+}
+
+func TestScanReadsLegacyGobPartition(t *testing.T) {
+	engine, err := NewEngine(filepath.Join(t.TempDir(), "store"))
+	if err != nil {
+		t.Fatalf("failed to create engine: %v", err)
+	}
+	schema := TableSchema{
+		Name: "events",
+		Columns: []ColumnSchema{
+			{Name: "user_id", Type: columnar.TypeInt},
+			{Name: "country", Type: columnar.TypeString},
+		},
+	}
+	if err := engine.RegisterTable(schema); err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+	// Partition written the way older versions did: one gob-encoded map.
+	userID := columnar.NewColumn("user_id", columnar.TypeInt)
+	userID.IntData = []int64{1, 2}
+	country := columnar.NewColumn("country", columnar.TypeString)
+	country.StringData = []string{"BR", "US"}
+	relative := filepath.Join("events", "old.gob")
+	if err := os.MkdirAll(filepath.Join(engine.rootDir, "events"), 0o755); err != nil {
+		t.Fatalf("mkdir failed: %v", err)
+	}
+	file, err := os.Create(filepath.Join(engine.rootDir, relative))
+	if err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	payload := partitionPayload{Columns: map[string]*columnar.Column{"user_id": userID, "country": country}}
+	if err := gob.NewEncoder(file).Encode(&payload); err != nil {
+		t.Fatalf("gob encode failed: %v", err)
+	}
+	file.Close()
+	engine.catalog.Tables["events"].Partitions["old"] = &PartitionMetadata{ID: "old", FilePath: relative, RowCount: 2}
+
+	batches, err := engine.Scan("events", ScanOptions{Columns: []string{"country"}})
+	if err != nil {
+		t.Fatalf("scan failed: %v", err)
+	}
+	if len(batches) != 1 || batches[0].RowCount != 2 || batches[0].Columns["country"].StringData[1] != "US" {
+		t.Fatalf("unexpected legacy scan result %+v", batches)
+	}
+}
@@ -1,13 +1,40 @@
 package storage
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
 	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"sort"
 
 	"github.com/Jonatan852/distributed-query-processing/pkg/columnar"
 )
 
+// Columnar partition layout (all integers are uvarints unless noted):
+//
+//	header   magic "DQPC" | version byte
+//	chunks   one chunk per column, back to back (see encodeChunk), each one
+//	         compressed with the codec recorded in PartitionMetadata
+//	footer   row count | column count | per column: name, type, offset, length
+//	trailer  footer length (uint32 LE) | magic "DQPC"
+//
+// The footer is an index of chunk offsets, so readers seek straight to the
+// columns they need instead of decoding the whole file.
+const (
+	partitionMagic   = "DQPC"
+	partitionVersion = 1
+	trailerSize      = 4 + len(partitionMagic)
+
+	// partitionExt is used for partitions written in the columnar format; older
+	// partitions keep their .gob extension and are still readable.
+	partitionExt = ".dqp"
+)
+
 type partitionPayload struct {
 	Columns map[string]*columnar.Column
 }
@@ -16,7 +43,32 @@ func init() {
 	gob.Register(&columnar.Column{})
 }
 
-func writePartition(path string, columns map[string]*columnar.Column) error {
+// chunkRef locates one column chunk inside a partition file.
+type chunkRef struct {
+	Name   string
+	Type   columnar.DataType
+	Offset int64
+	Length int64
+}
+
+// partitionReader gives access to the columns of one partition file.
+type partitionReader interface {
+	// Chunk loads (and caches) a column in its storage encoding. Missing
+	// columns return nil.
+	Chunk(name string) (*encodedChunk, error)
+	// Column loads (and caches) a single decoded column. Missing columns return nil.
+	Column(name string) (*columnar.Column, error)
+	// ColumnNames lists the columns stored in the partition.
+	ColumnNames() []string
+	// RowCount reports the number of rows stored in the partition.
+	RowCount() int
+	Close() error
+}
+
+// writePartition stores the columns in the columnar format, encoding each one
+// as requested in encodings (PLAIN when absent) and compressing every chunk with
+// codec.
+func writePartition(path string, columns map[string]*columnar.Column, encodings map[string]columnar.Encoding, codec chunkCodec) error {
 	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
 		return err
 	}
@@ -26,20 +78,259 @@ func writePartition(path string, columns map[string]*columnar.Column) error {
 	}
 	defer file.Close()
 
-	payload := partitionPayload{Columns: columns}
-	encoder := gob.NewEncoder(file)
-	return encoder.Encode(&payload)
+	w := bufio.NewWriter(file)
+	if _, err := w.WriteString(partitionMagic); err != nil {
+		return err
+	}
+	if err := w.WriteByte(partitionVersion); err != nil {
+		return err
+	}
+	offset := int64(len(partitionMagic) + 1)
+	rows := 0
+	refs := make([]chunkRef, 0, len(columns))
+	for _, name := range sortedColumnNames(columns) {
+		col := columns[name]
+		encoding := encodings[name]
+		if encoding == "" {
+			encoding = columnar.EncodingPlain
+		}
+		chunk, err := encodeChunk(col, encoding)
+		if err != nil {
+			return fmt.Errorf("column %s: %w", name, err)
+		}
+		if chunk, err = codec.compress(chunk); err != nil {
+			return fmt.Errorf("column %s: %w", name, err)
+		}
+		if _, err := w.Write(chunk); err != nil {
+			return err
+		}
+		refs = append(refs, chunkRef{Name: name, Type: col.Type, Offset: offset, Length: int64(len(chunk))})
+		offset += int64(len(chunk))
+		rows = col.Records()
+	}
+
+	var footer bytes.Buffer
+	putUvarint(&footer, uint64(rows))
+	putUvarint(&footer, uint64(len(refs)))
+	for _, ref := range refs {
+		putString(&footer, ref.Name)
+		putUvarint(&footer, uint64(ref.Type))
+		putUvarint(&footer, uint64(ref.Offset))
+		putUvarint(&footer, uint64(ref.Length))
+	}
+	if _, err := w.Write(footer.Bytes()); err != nil {
+		return err
+	}
+	var trailer [trailerSize]byte
+	binary.LittleEndian.PutUint32(trailer[:4], uint32(footer.Len()))
+	copy(trailer[4:], partitionMagic)
+	if _, err := w.Write(trailer[:]); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return file.Close()
 }
 
-func readPartition(path string) (map[string]*columnar.Column, error) {
+// openPartition detects the file format and returns a reader for it. codec
+// decompresses the chunks of columnar files; legacy gob files ignore it.
+func openPartition(path string, codec chunkCodec) (partitionReader, error) {
 	file, err := os.Open(path)
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
+	magic := make([]byte, len(partitionMagic))
+	if _, err := io.ReadFull(file, magic); err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		file.Close()
+		return nil, err
+	}
+	if string(magic) != partitionMagic {
+		defer file.Close()
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		return openGobPartition(file)
+	}
+	reader, err := openColumnarPartition(file, codec)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return reader, nil
+}
+
+// columnarPartition reads chunks on demand through ReadAt.
+type columnarPartition struct {
+	file   *os.File
+	codec  chunkCodec
+	rows   int
+	refs   map[string]chunkRef
+	loaded map[string]*encodedChunk
+}
+
+func openColumnarPartition(file *os.File, codec chunkCodec) (*columnarPartition, error) {
+	var version [1]byte
+	if _, err := file.ReadAt(version[:], int64(len(partitionMagic))); err != nil {
+		return nil, err
+	}
+	if version[0] != partitionVersion {
+		return nil, fmt.Errorf("unsupported partition format version %d", version[0])
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() < int64(len(partitionMagic)+1+trailerSize) {
+		return nil, errors.New("partition file truncated")
+	}
+	var trailer [trailerSize]byte
+	if _, err := file.ReadAt(trailer[:], info.Size()-int64(trailerSize)); err != nil {
+		return nil, err
+	}
+	if string(trailer[4:]) != partitionMagic {
+		return nil, errors.New("partition file without footer")
+	}
+	footerLen := int64(binary.LittleEndian.Uint32(trailer[:4]))
+	footerStart := info.Size() - int64(trailerSize) - footerLen
+	if footerStart < int64(len(partitionMagic)+1) {
+		return nil, errors.New("partition footer out of bounds")
+	}
+	footer := make([]byte, footerLen)
+	if _, err := file.ReadAt(footer, footerStart); err != nil {
+		return nil, err
+	}
+
+	r := bytes.NewReader(footer)
+	rows, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, fmt.Errorf("partition footer: %w", err)
+	}
+	count, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, fmt.Errorf("partition footer: %w", err)
+	}
+	p := &columnarPartition{
+		file:   file,
+		codec:  codec,
+		rows:   int(rows),
+		refs:   make(map[string]chunkRef, count),
+		loaded: make(map[string]*encodedChunk, count),
+	}
+	for i := uint64(0); i < count; i++ {
+		var ref chunkRef
+		if ref.Name, err = getString(r); err != nil {
+			return nil, fmt.Errorf("partition footer: %w", err)
+		}
+		fields := make([]uint64, 3)
+		for j := range fields {
+			if fields[j], err = binary.ReadUvarint(r); err != nil {
+				return nil, fmt.Errorf("partition footer: %w", err)
+			}
+		}
+		ref.Type = columnar.DataType(fields[0])
+		ref.Offset = int64(fields[1])
+		ref.Length = int64(fields[2])
+		if ref.Offset+ref.Length > footerStart {
+			return nil, fmt.Errorf("column %s: chunk out of bounds", ref.Name)
+		}
+		p.refs[ref.Name] = ref
+	}
+	return p, nil
+}
+
+func (p *columnarPartition) Chunk(name string) (*encodedChunk, error) {
+	if chunk, ok := p.loaded[name]; ok {
+		return chunk, nil
+	}
+	ref, ok := p.refs[name]
+	if !ok {
+		return nil, nil
+	}
+	data := make([]byte, ref.Length)
+	if _, err := p.file.ReadAt(data, ref.Offset); err != nil {
+		return nil, fmt.Errorf("column %s: %w", name, err)
+	}
+	data, err := p.codec.decompress(data)
+	if err != nil {
+		return nil, fmt.Errorf("column %s: %w", name, err)
+	}
+	chunk, err := decodeChunk(name, ref.Type, data)
+	if err != nil {
+		return nil, fmt.Errorf("column %s: %w", name, err)
+	}
+	if chunk.rows != p.rows {
+		return nil, fmt.Errorf("column %s: %d rows, partition has %d", name, chunk.rows, p.rows)
+	}
+	p.loaded[name] = chunk
+	return chunk, nil
+}
+
+func (p *columnarPartition) Column(name string) (*columnar.Column, error) {
+	chunk, err := p.Chunk(name)
+	if err != nil || chunk == nil {
+		return nil, err
+	}
+	return chunk.column()
+}
+
+func (p *columnarPartition) ColumnNames() []string {
+	names := make([]string, 0, len(p.refs))
+	for name := range p.refs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (p *columnarPartition) RowCount() int {
+	return p.rows
+}
+
+func (p *columnarPartition) Close() error {
+	p.loaded = nil
+	return p.file.Close()
+}
+
+// gobPartition serves partitions written before the columnar format: the gob
+// payload cannot be decoded partially, so every column is loaded at open time.
+type gobPartition struct {
+	columns map[string]*columnar.Column
+}
+
+func openGobPartition(r io.Reader) (*gobPartition, error) {
 	var payload partitionPayload
-	if err := gob.NewDecoder(file).Decode(&payload); err != nil {
+	if err := gob.NewDecoder(r).Decode(&payload); err != nil {
 		return nil, err
 	}
-	return payload.Columns, nil
+	return &gobPartition{columns: payload.Columns}, nil
+}
+
+func (g *gobPartition) Chunk(name string) (*encodedChunk, error) {
+	col := g.columns[name]
+	if col == nil {
+		return nil, nil
+	}
+	return plainChunk(col), nil
+}
+
+func (g *gobPartition) Column(name string) (*columnar.Column, error) {
+	return g.columns[name], nil
+}
+
+func (g *gobPartition) ColumnNames() []string {
+	return sortedColumnNames(g.columns)
+}
+
+func (g *gobPartition) RowCount() int {
+	for _, col := range g.columns {
+		if col != nil {
+			return col.Len()
+		}
+	}
+	return 0
+}
+
+func (g *gobPartition) Close() error {
+	return nil
 }
@@ -0,0 +1,180 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Jonatan852/distributed-query-processing/pkg/columnar"
+)
+
+// Pruning operators understood by ColumnPredicate.
+const (
+	PruneEqual        = "="
+	PruneLess         = "<"
+	PruneLessEqual    = "<="
+	PruneGreater      = ">"
+	PruneGreaterEqual = ">="
+	PruneBetween      = "BETWEEN"
+	PruneIn           = "IN"
+)
+
+// ColumnPredicate is a "column op constant" condition that can be checked against
+// partition min/max statistics. BETWEEN takes two values (lower, upper) and IN
+// takes the full list of candidates.
+type ColumnPredicate struct {
+	Column   string           `json:"column"`
+	Operator string           `json:"op"`
+	Values   []columnar.Value `json:"values"`
+}
+
+// String renders the predicate for plan output.
+func (p ColumnPredicate) String() string {
+	values := make([]string, 0, len(p.Values))
+	for _, v := range p.Values {
+		values = append(values, v.String())
+	}
+	switch strings.ToUpper(p.Operator) {
+	case PruneBetween:
+		return fmt.Sprintf("%s BETWEEN %s", p.Column, strings.Join(values, " AND "))
+	case PruneIn:
+		return fmt.Sprintf("%s IN (%s)", p.Column, strings.Join(values, ", "))
+	default:
+		return fmt.Sprintf("%s %s %s", p.Column, p.Operator, strings.Join(values, ", "))
+	}
+}
+
+// MayMatch reports whether a partition with the given statistics can contain rows
+// satisfying the predicate. It only returns false when the stats prove that no row
+// matches; missing stats or incomparable types keep the partition.
+func (p ColumnPredicate) MayMatch(stats ColumnStats) bool {
+	if stats.Min == nil || stats.Max == nil || len(p.Values) == 0 {
+		return true
+	}
+	minVal := stats.Min.ToValue()
+	maxVal := stats.Max.ToValue()
+	switch strings.ToUpper(p.Operator) {
+	case PruneEqual:
+		return withinRange(p.Values[0], minVal, maxVal)
+	case PruneLess:
+		order, ok := compareScalar(minVal, p.Values[0])
+		return !ok || order < 0
+	case PruneLessEqual:
+		order, ok := compareScalar(minVal, p.Values[0])
+		return !ok || order <= 0
+	case PruneGreater:
+		order, ok := compareScalar(maxVal, p.Values[0])
+		return !ok || order > 0
+	case PruneGreaterEqual:
+		order, ok := compareScalar(maxVal, p.Values[0])
+		return !ok || order >= 0
+	case PruneBetween:
+		if len(p.Values) != 2 {
+			return true
+		}
+		lowCmp, okLow := compareScalar(maxVal, p.Values[0])
+		highCmp, okHigh := compareScalar(minVal, p.Values[1])
+		return !okLow || !okHigh || (lowCmp >= 0 && highCmp <= 0)
+	case PruneIn:
+		for _, v := range p.Values {
+			if withinRange(v, minVal, maxVal) {
+				return true
+			}
+		}
+		return false
+	default:
+		return true
+	}
+}
+
+// Matches evaluates the predicate against a single value. NULL never matches;
+// incomparable types return true so that the row filter makes the final decision.
+func (p ColumnPredicate) Matches(v columnar.Value) bool {
+	if v.IsNull() {
+		// comparisons with NULL are never true
+		return false
+	}
+	if len(p.Values) == 0 {
+		return true
+	}
+	switch strings.ToUpper(p.Operator) {
+	case PruneEqual:
+		order, ok := compareScalar(v, p.Values[0])
+		return !ok || order == 0
+	case PruneLess:
+		order, ok := compareScalar(v, p.Values[0])
+		return !ok || order < 0
+	case PruneLessEqual:
+		order, ok := compareScalar(v, p.Values[0])
+		return !ok || order <= 0
+	case PruneGreater:
+		order, ok := compareScalar(v, p.Values[0])
+		return !ok || order > 0
+	case PruneGreaterEqual:
+		order, ok := compareScalar(v, p.Values[0])
+		return !ok || order >= 0
+	case PruneBetween:
+		if len(p.Values) != 2 {
+			return true
+		}
+		return withinRange(v, p.Values[0], p.Values[1])
+	case PruneIn:
+		for _, candidate := range p.Values {
+			order, ok := compareScalar(v, candidate)
+			if !ok || order == 0 {
+				return true
+			}
+		}
+		return false
+	default:
+		return true
+	}
+}
+
+// MayMatch reports whether the partition can satisfy every predicate.
+func (pm *PartitionMetadata) MayMatch(preds []ColumnPredicate) bool {
+	for _, pred := range preds {
+		stats, ok := pm.Stats[pred.Column]
+		if !ok {
+			continue
+		}
+		if !pred.MayMatch(stats) {
+			return false
+		}
+	}
+	return true
+}
+
+// PrunePartitions returns the IDs of the partitions that may satisfy preds (sorted
+// by ID) together with the total number of partitions of the table.
+func (e *Engine) PrunePartitions(tableName string, preds []ColumnPredicate) ([]string, int, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	meta, ok := e.catalog.Tables[tableName]
+	if !ok {
+		return nil, 0, ErrTableNotFound
+	}
+	partitions := meta.SortedPartitions()
+	kept := make([]string, 0, len(partitions))
+	for _, partition := range partitions {
+		if partition.MayMatch(preds) {
+			kept = append(kept, partition.ID)
+		}
+	}
+	return kept, len(partitions), nil
+}
+
+func withinRange(v, minVal, maxVal columnar.Value) bool {
+	lowCmp, okLow := compareScalar(v, minVal)
+	highCmp, okHigh := compareScalar(v, maxVal)
+	return !okLow || !okHigh || (lowCmp >= 0 && highCmp <= 0)
+}
+
+// compareScalar orders two values with columnar.Compare. ok is false when the
+// types cannot be compared or either side is NULL.
+func compareScalar(left, right columnar.Value) (int, bool) {
+	if left.IsNull() || right.IsNull() {
+		return 0, false
+	}
+	order, err := columnar.Compare(left, right)
+	return order, err == nil
+}
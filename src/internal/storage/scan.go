@@ -2,8 +2,10 @@ package storage
 
 import (
 	"fmt"
+	"io"
 	"path/filepath"
 	"sort"
+	"strings"
 
 	"github.com/Jonatan852/distributed-query-processing/pkg/columnar"
 )
@@ -24,7 +26,14 @@ type ScanOptions struct {
 	Columns    []string
 	Partitions []string
 	Filter     FilterFunc
-	BatchSize  int
+	// FilterColumns lists the columns read by Filter; they are loaded before the
+	// filter runs. Other columns are still loaded the first time Filter reads them.
+	FilterColumns []string
+	BatchSize     int
+	// Prune holds conjuncts of Filter in "column op constant" form. They skip
+	// partitions through min/max statistics and discard rows of dictionary/RLE
+	// chunks without decoding them, so they must be implied by Filter.
+	Prune []ColumnPredicate
 }
 
 // RowView provides read-only access to row values for filter predicates.
@@ -33,7 +42,44 @@ type RowView interface {
 }
 
 // Scan iterates over selected partitions returning batches that satisfy the predicate.
+// It reads the whole selection; use OpenScan to consume it incrementally.
 func (e *Engine) Scan(tableName string, opts ScanOptions) ([]RecordBatch, error) {
+	scanner, err := e.OpenScan(tableName, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer scanner.Close()
+	result := make([]RecordBatch, 0)
+	for {
+		batch, err := scanner.Next()
+		if err == io.EOF {
+			return result, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, batch)
+	}
+}
+
+// Scanner reads the batches of a scan one partition at a time, so callers that
+// stop early (e.g. a LIMIT) never open the remaining partitions.
+type Scanner struct {
+	engine     *Engine
+	table      string
+	meta       *TableMetadata
+	projected  []string
+	opts       ScanOptions
+	batchSize  int
+	partitions []string
+	next       int
+	pending    []RecordBatch
+	read       int
+}
+
+// OpenScan validates the scan and returns a Scanner positioned before the first
+// partition; no partition file is opened until Next is called.
+func (e *Engine) OpenScan(tableName string, opts ScanOptions) (*Scanner, error) {
 	tableMeta, err := e.ensureTable(tableName)
 	if err != nil {
 		return nil, err
@@ -45,63 +91,175 @@ func (e *Engine) Scan(tableName string, opts ScanOptions) ([]RecordBatch, error)
 	if err := validateProjection(tableMeta.Schema, projected); err != nil {
 		return nil, err
 	}
-	partitions := opts.Partitions
-	if len(partitions) == 0 {
+	if err := validateProjection(tableMeta.Schema, opts.FilterColumns); err != nil {
+		return nil, err
+	}
+	var partitions []string
+	if len(opts.Partitions) == 0 {
 		for _, meta := range tableMeta.SortedPartitions() {
 			partitions = append(partitions, meta.ID)
 		}
 	} else {
+		partitions = append(partitions, opts.Partitions...)
 		sort.Strings(partitions)
 	}
-	if len(partitions) == 0 {
-		return []RecordBatch{}, nil
-	}
 	batchSize := opts.BatchSize
 	if batchSize <= 0 {
 		batchSize = 4096
 	}
+	return &Scanner{
+		engine:     e,
+		table:      tableName,
+		meta:       tableMeta,
+		projected:  projected,
+		opts:       opts,
+		batchSize:  batchSize,
+		partitions: partitions,
+	}, nil
+}
 
-	result := make([]RecordBatch, 0)
-	for _, partitionID := range partitions {
-		partitionMeta, ok := tableMeta.Partitions[partitionID]
+// Next returns the next batch, reading the following partition when the
+// current one is exhausted. It returns io.EOF after the last batch.
+func (s *Scanner) Next() (RecordBatch, error) {
+	for len(s.pending) == 0 {
+		if s.next >= len(s.partitions) {
+			return RecordBatch{}, io.EOF
+		}
+		partitionID := s.partitions[s.next]
+		s.next++
+		partitionMeta, ok := s.meta.Partitions[partitionID]
 		if !ok {
-			return nil, ErrPartitionNotFound
+			return RecordBatch{}, ErrPartitionNotFound
+		}
+		if !partitionMeta.MayMatch(s.opts.Prune) {
+			continue
 		}
-		fullPath := filepath.Join(e.rootDir, partitionMeta.FilePath)
-		columns, err := readPartition(fullPath)
+		s.read++
+		batches, err := s.engine.scanPartition(s.table, partitionMeta, s.projected, s.opts, s.batchSize)
 		if err != nil {
-			return nil, fmt.Errorf("partition %s: %w", partitionID, err)
+			return RecordBatch{}, fmt.Errorf("partition %s: %w", partitionID, err)
+		}
+		s.pending = batches
+	}
+	batch := s.pending[0]
+	s.pending[0] = RecordBatch{}
+	s.pending = s.pending[1:]
+	return batch, nil
+}
+
+// PartitionsRead reports how many partition files the scanner has opened so far.
+func (s *Scanner) PartitionsRead() int {
+	return s.read
+}
+
+// Close drops the buffered batches; later calls to Next return io.EOF.
+func (s *Scanner) Close() error {
+	s.pending = nil
+	s.next = len(s.partitions)
+	return nil
+}
+
+// scanPartition evaluates the filter first, loading only the columns it reads,
+// and decodes the projected columns only when at least one row survives.
+func (e *Engine) scanPartition(table string, meta *PartitionMetadata, projected []string, opts ScanOptions, batchSize int) ([]RecordBatch, error) {
+	codec, err := codecFor(meta.Compression)
+	if err != nil {
+		return nil, fmt.Errorf("partition %s: %w", meta.ID, err)
+	}
+	reader, err := openPartition(e.partitionPath(meta), codec)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	rowLen := meta.RowCount
+	if rowLen == 0 {
+		rowLen = reader.RowCount()
+	}
+	candidates, err := preselectRows(reader, opts.Prune, rowLen)
+	if err != nil {
+		return nil, err
+	}
+	indexes := make([]int, 0, rowLen)
+	if opts.Filter == nil {
+		for rowIndex := 0; rowIndex < rowLen; rowIndex++ {
+			if candidates == nil || candidates[rowIndex] {
+				indexes = append(indexes, rowIndex)
+			}
 		}
-		rowLen := partitionMeta.RowCount
-		if rowLen == 0 && len(columns) > 0 {
-			if firstCol, ok := columns[projected[0]]; ok && firstCol != nil {
-				rowLen = firstCol.Len()
+	} else {
+		for _, name := range opts.FilterColumns {
+			if _, err := reader.Column(name); err != nil {
+				return nil, err
 			}
 		}
-		filteredIdx := make([]int, 0, batchSize)
-		row := rowAccessor{columns: columns}
+		row := rowAccessor{reader: reader}
 		for rowIndex := 0; rowIndex < rowLen; rowIndex++ {
-			if opts.Filter != nil {
-				row.index = rowIndex
-				pass, err := opts.Filter(row)
-				if err != nil {
-					return nil, err
-				}
-				if !pass {
-					continue
-				}
+			if candidates != nil && !candidates[rowIndex] {
+				continue
 			}
-			filteredIdx = append(filteredIdx, rowIndex)
-			if len(filteredIdx) == batchSize {
-				result = append(result, buildBatch(tableName, partitionID, columns, projected, filteredIdx))
-				filteredIdx = filteredIdx[:0]
+			row.index = rowIndex
+			pass, err := opts.Filter(row)
+			if err != nil {
+				return nil, err
 			}
+			if pass {
+				indexes = append(indexes, rowIndex)
+			}
+		}
+	}
+	if len(indexes) == 0 {
+		return nil, nil
+	}
+
+	columns := make(map[string]*columnar.Column, len(projected))
+	for _, name := range projected {
+		col, err := reader.Column(name)
+		if err != nil {
+			return nil, err
+		}
+		columns[name] = col
+	}
+	batches := make([]RecordBatch, 0, (len(indexes)+batchSize-1)/batchSize)
+	for start := 0; start < len(indexes); start += batchSize {
+		end := start + batchSize
+		if end > len(indexes) {
+			end = len(indexes)
+		}
+		batches = append(batches, buildBatch(table, meta.ID, columns, projected, indexes[start:end]))
+	}
+	return batches, nil
+}
+
+// preselectRows evaluates the pruning predicates directly on dictionary and RLE
+// chunks (once per distinct value or run) and returns the rows that may still
+// match, or nil when no predicate could be applied that way.
+func preselectRows(reader partitionReader, preds []ColumnPredicate, rowLen int) ([]bool, error) {
+	var mask []bool
+	for _, pred := range preds {
+		chunk, err := reader.Chunk(pred.Column)
+		if err != nil {
+			return nil, err
 		}
-		if len(filteredIdx) > 0 {
-			result = append(result, buildBatch(tableName, partitionID, columns, projected, filteredIdx))
+		if chunk == nil || chunk.encoding == columnar.EncodingPlain || chunk.encoding == columnar.EncodingDelta {
+			continue
 		}
+		if mask == nil {
+			mask = make([]bool, rowLen)
+			for i := range mask {
+				mask[i] = true
+			}
+		}
+		chunk.restrict(pred, mask)
 	}
-	return result, nil
+	return mask, nil
+}
+
+// partitionPath resolves the partition file on disk. Catalogs written on Windows
+// store backslash-separated paths, so both separators are accepted.
+func (e *Engine) partitionPath(meta *PartitionMetadata) string {
+	relative := strings.ReplaceAll(meta.FilePath, "\\", "/")
+	return filepath.Join(e.rootDir, filepath.FromSlash(relative))
 }
 
 func validateProjection(schema TableSchema, projected []string) error {
@@ -130,41 +288,31 @@ func projectColumn(col *columnar.Column, indexes []int) *columnar.Column {
 	if col == nil {
 		return nil
 	}
-	out := columnar.NewColumn(col.Name, col.Type)
-	switch col.Type {
-	case columnar.TypeInt:
-		out.IntData = make([]int64, 0, len(indexes))
-		for _, idx := range indexes {
-			out.IntData = append(out.IntData, col.IntData[idx])
-		}
-	case columnar.TypeFloat:
-		out.FloatData = make([]float64, 0, len(indexes))
-		for _, idx := range indexes {
-			out.FloatData = append(out.FloatData, col.FloatData[idx])
-		}
-	case columnar.TypeString:
-		out.StringData = make([]string, 0, len(indexes))
-		for _, idx := range indexes {
-			out.StringData = append(out.StringData, col.StringData[idx])
-		}
-	case columnar.TypeBool:
-		out.BoolData = make([]bool, 0, len(indexes))
-		for _, idx := range indexes {
-			out.BoolData = append(out.BoolData, col.BoolData[idx])
-		}
+	// indexes come from this partition, so Take cannot go out of bounds
+	out, err := col.Take(indexes)
+	if err != nil {
+		return columnar.NewColumn(col.Name, col.Type)
 	}
 	return out
 }
 
+// rowAccessor reads values straight from the partition, loading each column the
+// first time the filter touches it.
 type rowAccessor struct {
-	columns map[string]*columnar.Column
-	index   int
+	reader partitionReader
+	index  int
 }
 
 func (r rowAccessor) Value(column string) (columnar.Value, error) {
-	col, ok := r.columns[column]
-	if !ok {
+	col, err := r.reader.Column(column)
+	if err != nil {
+		return columnar.Value{}, err
+	}
+	if col == nil {
 		return columnar.Value{}, fmt.Errorf("column %s not found in row", column)
 	}
+	if col.RepetitionLevels != nil {
+		return columnar.Value{}, fmt.Errorf("column %s is repeated and has no single value per row", column)
+	}
 	return col.Get(r.index)
 }
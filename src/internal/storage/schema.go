@@ -7,14 +7,25 @@ import (
 	"github.com/Jonatan852/distributed-query-processing/pkg/columnar"
 )
 
-// ColumnSchema describes a single column stored in the engine.
+// ColumnSchema describes a single column stored in the engine. STRUCT columns
+// hold their children in Fields and store no data themselves: every scalar leaf
+// becomes a physical column named by its dotted path (payload.device.os).
 type ColumnSchema struct {
 	Name     string            `json:"name"`
 	Type     columnar.DataType `json:"type"`
-	Encoding string            `json:"encoding,omitempty"`
-	Comment  string            `json:"comment,omitempty"`
-	Stats    *ColumnStats      `json:"stats,omitempty"`
-	Tags     map[string]string `json:"tags,omitempty"`
+	Nullable bool              `json:"nullable,omitempty"`
+	// Repeated marks ARRAY fields, which hold zero or more values per record.
+	Repeated bool `json:"repeated,omitempty"`
+	// Scale is the number of fractional digits kept by DECIMAL columns.
+	Scale int32 `json:"scale,omitempty"`
+	// Precision bounds the total digits of DECIMAL columns (0 means only the
+	// int64 range); values that need more digits are rejected on ingest.
+	Precision int32             `json:"precision,omitempty"`
+	Encoding  string            `json:"encoding,omitempty"`
+	Comment   string            `json:"comment,omitempty"`
+	Stats     *ColumnStats      `json:"stats,omitempty"`
+	Tags      map[string]string `json:"tags,omitempty"`
+	Fields    []ColumnSchema    `json:"fields,omitempty"`
 }
 
 // TableSchema contains metadata about a table.
@@ -34,48 +45,260 @@ func (ts TableSchema) Validate() error {
 	if len(ts.Columns) == 0 {
 		return fmt.Errorf("table %s must have at least one column", ts.Name)
 	}
+	if err := validateFields(ts.Name, "", ts.Columns, 0); err != nil {
+		return err
+	}
+	if _, err := ts.Compression(); err != nil {
+		return fmt.Errorf("table %s: %w", ts.Name, err)
+	}
+	return nil
+}
+
+// maxLevel bounds the nesting depth so repetition and definition levels fit in
+// a byte.
+const maxLevel = 255
+
+// validateFields checks one level of the schema; prefix is the dotted path of
+// the enclosing STRUCT and depth counts the levels used so far.
+func validateFields(table, prefix string, fields []ColumnSchema, depth int) error {
 	seen := map[string]struct{}{}
-	for _, col := range ts.Columns {
+	for _, col := range fields {
 		if strings.TrimSpace(col.Name) == "" {
-			return fmt.Errorf("table %s has a column without name", ts.Name)
+			return fmt.Errorf("table %s has a column without name", table)
 		}
+		if strings.Contains(col.Name, ".") {
+			return fmt.Errorf("column %s%s: names cannot contain dots", prefix, col.Name)
+		}
+		path := prefix + col.Name
 		lower := strings.ToLower(col.Name)
 		if _, ok := seen[lower]; ok {
-			return fmt.Errorf("duplicated column %s in table %s", col.Name, ts.Name)
+			return fmt.Errorf("duplicated column %s in table %s", path, table)
 		}
 		seen[lower] = struct{}{}
+		if col.Repeated && col.Nullable {
+			return fmt.Errorf("column %s: repeated fields cannot be nullable (an empty list stands for NULL)", path)
+		}
+		if col.Type == columnar.TypeStruct {
+			if len(col.Fields) == 0 {
+				return fmt.Errorf("column %s: STRUCT requires fields", path)
+			}
+			if col.Encoding != "" || col.Scale != 0 || col.Precision != 0 {
+				return fmt.Errorf("column %s: encoding, precision and scale apply to the STRUCT fields", path)
+			}
+			if depth+1 >= maxLevel {
+				return fmt.Errorf("column %s: nesting too deep", path)
+			}
+			if err := validateFields(table, path+".", col.Fields, depth+1); err != nil {
+				return err
+			}
+			continue
+		}
+		if len(col.Fields) > 0 {
+			return fmt.Errorf("column %s: only STRUCT columns have fields", path)
+		}
+		encoding, err := columnar.ParseEncoding(col.Encoding)
+		if err != nil {
+			return fmt.Errorf("column %s: %w", path, err)
+		}
+		if !encoding.Supports(col.Type) {
+			return fmt.Errorf("column %s: encoding %s does not support %s", path, encoding, col.Type)
+		}
+		if (col.Scale != 0 || col.Precision != 0) && col.Type != columnar.TypeDecimal {
+			return fmt.Errorf("column %s: precision and scale are only valid for DECIMAL", path)
+		}
+		if col.Scale < 0 || col.Scale > columnar.MaxDecimalScale {
+			return fmt.Errorf("column %s: scale must be between 0 and %d", path, columnar.MaxDecimalScale)
+		}
+		if col.Precision < 0 || col.Precision > columnar.MaxDecimalPrecision {
+			return fmt.Errorf("column %s: precision must be between 1 and %d", path, columnar.MaxDecimalPrecision)
+		}
+		if col.Precision != 0 && col.Scale > col.Precision {
+			return fmt.Errorf("column %s: scale %d exceeds precision %d", path, col.Scale, col.Precision)
+		}
 	}
 	return nil
 }
 
-// ColumnNames returns the ordered list of column names defined in the schema.
+// Encodings maps each physical column to the encoding used when writing
+// partitions. Invalid names fall back to PLAIN; Validate rejects them at
+// registration.
+func (ts TableSchema) Encodings() map[string]columnar.Encoding {
+	leaves := ts.leaves()
+	result := make(map[string]columnar.Encoding, len(leaves))
+	for _, leaf := range leaves {
+		encoding, err := columnar.ParseEncoding(leaf.schema.Encoding)
+		if err != nil || !encoding.Supports(leaf.schema.Type) {
+			encoding = columnar.EncodingPlain
+		}
+		result[leaf.path] = encoding
+	}
+	return result
+}
+
+// Normalize converts a value to the column's stored form: decimals are rescaled
+// to the declared scale (rounding half away from zero) and must then fit the
+// declared precision.
+func (cs ColumnSchema) Normalize(v columnar.Value) (columnar.Value, error) {
+	if cs.Type != columnar.TypeDecimal || v.IsNull() {
+		return v, nil
+	}
+	d, err := v.AsDecimal()
+	if err != nil {
+		return columnar.Value{}, err
+	}
+	scaled, err := d.Rescale(cs.Scale)
+	if err != nil {
+		return columnar.Value{}, err
+	}
+	if cs.Precision > 0 && decimalDigits(scaled.Unscaled) > int(cs.Precision) {
+		return columnar.Value{}, fmt.Errorf("value %s exceeds DECIMAL(%d,%d)", scaled, cs.Precision, cs.Scale)
+	}
+	return columnar.NewDecimalValue(scaled), nil
+}
+
+// decimalDigits counts the digits of an unscaled decimal.
+func decimalDigits(unscaled int64) int {
+	digits := 1
+	for unscaled <= -10 || unscaled >= 10 {
+		unscaled /= 10
+		digits++
+	}
+	return digits
+}
+
+// ColumnNames returns the ordered list of physical columns: top-level scalar
+// columns by name and the leaves of STRUCT columns by dotted path.
 func (ts TableSchema) ColumnNames() []string {
-	names := make([]string, 0, len(ts.Columns))
-	for _, col := range ts.Columns {
-		names = append(names, col.Name)
+	leaves := ts.leaves()
+	names := make([]string, 0, len(leaves))
+	for _, leaf := range leaves {
+		names = append(names, leaf.path)
 	}
 	return names
 }
 
-// ColumnByName returns the schema entry for the requested column, ignoring case.
+// ColumnByName returns the schema entry for the requested physical column,
+// ignoring case. Nested leaves are found by dotted path and returned with Name
+// set to the full path.
 func (ts TableSchema) ColumnByName(name string) (ColumnSchema, bool) {
+	col, path, ok := ts.lookup(name)
+	if !ok || col.Type == columnar.TypeStruct {
+		return ColumnSchema{}, false
+	}
+	col.Name = path
+	return col, true
+}
+
+// Field returns the schema of any field, STRUCTs included, addressed by dotted
+// path, together with its canonical path.
+func (ts TableSchema) Field(path string) (ColumnSchema, string, bool) {
+	return ts.lookup(path)
+}
+
+// IsNested reports whether the table has STRUCT or repeated columns.
+func (ts TableSchema) IsNested() bool {
 	for _, col := range ts.Columns {
-		if strings.EqualFold(col.Name, name) {
-			return col, true
+		if col.Type == columnar.TypeStruct || col.Repeated {
+			return true
+		}
+	}
+	return false
+}
+
+// RepeatedPath reports whether the path crosses a repeated field, in which case
+// a record holds any number of values for it.
+func (ts TableSchema) RepeatedPath(path string) bool {
+	fields := ts.Columns
+	for _, segment := range strings.Split(path, ".") {
+		found := false
+		for _, col := range fields {
+			if strings.EqualFold(col.Name, segment) {
+				if col.Repeated {
+					return true
+				}
+				fields = col.Fields
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return false
+}
+
+func (ts TableSchema) lookup(path string) (ColumnSchema, string, bool) {
+	fields := ts.Columns
+	var current ColumnSchema
+	canonical := make([]string, 0, strings.Count(path, ".")+1)
+	for _, segment := range strings.Split(path, ".") {
+		found := false
+		for _, col := range fields {
+			if strings.EqualFold(col.Name, segment) {
+				current = col
+				found = true
+				break
+			}
+		}
+		if !found {
+			return ColumnSchema{}, "", false
+		}
+		canonical = append(canonical, current.Name)
+		fields = current.Fields
+	}
+	return current, strings.Join(canonical, "."), true
+}
+
+// leafColumn is a physical column of the schema.
+type leafColumn struct {
+	path   string
+	schema ColumnSchema
+	// repeated reports a repeated field on the path (the column then stores
+	// repetition levels); nested reports that it stores definition levels.
+	repeated bool
+	nested   bool
+}
+
+func (ts TableSchema) leaves() []leafColumn {
+	var out []leafColumn
+	var walk func(prefix string, fields []ColumnSchema, repeated, nested bool)
+	walk = func(prefix string, fields []ColumnSchema, repeated, nested bool) {
+		for _, col := range fields {
+			path := prefix + col.Name
+			if col.Type == columnar.TypeStruct {
+				walk(path+".", col.Fields, repeated || col.Repeated, true)
+				continue
+			}
+			out = append(out, leafColumn{
+				path:     path,
+				schema:   col,
+				repeated: repeated || col.Repeated,
+				nested:   nested || col.Repeated,
+			})
 		}
 	}
-	return ColumnSchema{}, false
+	walk("", ts.Columns, false, false)
+	return out
 }
 
 // Row represents a single tuple ready to be ingested in the storage engine.
 type Row map[string]columnar.Value
 
 // ValidateRow ensures that the provided row matches the schema definition.
+// Missing or NULL values are only accepted for nullable columns. Rows only hold
+// scalars; records of nested tables are checked while being shredded.
 func (ts TableSchema) ValidateRow(row Row) error {
 	for _, col := range ts.Columns {
 		val, ok := row[col.Name]
-		if !ok {
-			return fmt.Errorf("missing value for column %q", col.Name)
+		if !ok || val.IsNull() {
+			if !col.Nullable {
+				if !ok {
+					return fmt.Errorf("missing value for column %q", col.Name)
+				}
+				return fmt.Errorf("column %s is not nullable", col.Name)
+			}
+			continue
 		}
 		if val.Type != col.Type {
 			return fmt.Errorf("column %s expects %s but received %s", col.Name, col.Type, val.Type)
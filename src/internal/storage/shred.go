@@ -0,0 +1,168 @@
+package storage
+
+import (
+	"fmt"
+
+	"github.com/Jonatan852/distributed-query-processing/pkg/columnar"
+)
+
+// Record is a nested row used to ingest tables with STRUCT or repeated
+// columns. Scalar fields hold columnar.Value, STRUCT fields hold a Record (or
+// map[string]interface{}) and repeated fields hold a []interface{} of their
+// elements. Missing keys and nil behave like NULL.
+type Record map[string]interface{}
+
+// shredRecords splits records into one column per schema leaf, Dremel style:
+// leaves below a STRUCT or a repeated field also get definition levels, and
+// leaves below a repeated field get repetition levels. Top-level scalar
+// columns are written exactly like flat rows.
+func (ts TableSchema) shredRecords(records []Record) (map[string]*columnar.Column, error) {
+	s := shredder{columns: map[string]*columnar.Column{}}
+	for _, leaf := range ts.leaves() {
+		col := columnar.NewColumn(leaf.path, leaf.schema.Type)
+		if leaf.nested {
+			col.DefinitionLevels = []uint8{}
+		}
+		if leaf.repeated {
+			col.RepetitionLevels = []uint8{}
+		}
+		s.columns[leaf.path] = col
+	}
+	for i, record := range records {
+		for _, field := range ts.Columns {
+			if err := s.field(field, field.Name, record[field.Name], 0, 0, 0); err != nil {
+				return nil, fmt.Errorf("record %d: %w", i, err)
+			}
+		}
+	}
+	return s.columns, nil
+}
+
+type shredder struct {
+	columns map[string]*columnar.Column
+}
+
+// field shreds one occurrence of fs. rep is the repetition level of the first
+// entry it writes, def the definition level reached by the enclosing fields and
+// depth the number of repeated fields above fs.
+func (s *shredder) field(fs ColumnSchema, path string, value interface{}, rep, def, depth uint8) error {
+	if fs.Repeated {
+		items, err := asList(path, value)
+		if err != nil {
+			return err
+		}
+		if len(items) == 0 {
+			return s.absent(fs, path, rep, def)
+		}
+		for i, item := range items {
+			if isNullField(item) {
+				return fmt.Errorf("field %s: repeated elements cannot be NULL", path)
+			}
+			level := rep
+			if i > 0 {
+				level = depth + 1
+			}
+			if err := s.present(fs, path, item, level, def+1, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if isNullField(value) {
+		if !fs.Nullable {
+			return fmt.Errorf("field %s is not nullable", path)
+		}
+		return s.absent(fs, path, rep, def)
+	}
+	if fs.Nullable {
+		def++
+	}
+	return s.present(fs, path, value, rep, def, depth)
+}
+
+// present writes a defined occurrence of fs.
+func (s *shredder) present(fs ColumnSchema, path string, value interface{}, rep, def, depth uint8) error {
+	if fs.Type != columnar.TypeStruct {
+		scalar, ok := value.(columnar.Value)
+		if !ok {
+			return fmt.Errorf("field %s expects %s but received %T", path, fs.Type, value)
+		}
+		if scalar.Type != fs.Type {
+			return fmt.Errorf("field %s expects %s but received %s", path, fs.Type, scalar.Type)
+		}
+		normalized, err := fs.Normalize(scalar)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", path, err)
+		}
+		return s.emit(path, normalized, rep, def)
+	}
+	record, err := asRecord(path, value)
+	if err != nil {
+		return err
+	}
+	for _, child := range fs.Fields {
+		if err := s.field(child, path+"."+child.Name, record[child.Name], rep, def, depth); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// absent writes a NULL entry at definition level def in every leaf below fs.
+func (s *shredder) absent(fs ColumnSchema, path string, rep, def uint8) error {
+	if fs.Type != columnar.TypeStruct {
+		return s.emit(path, columnar.NewNullValue(fs.Type), rep, def)
+	}
+	for _, child := range fs.Fields {
+		if err := s.absent(child, path+"."+child.Name, rep, def); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *shredder) emit(path string, value columnar.Value, rep, def uint8) error {
+	col := s.columns[path]
+	if err := col.Append(value); err != nil {
+		return fmt.Errorf("field %s: %w", path, err)
+	}
+	if col.RepetitionLevels != nil {
+		col.RepetitionLevels = append(col.RepetitionLevels, rep)
+	}
+	if col.DefinitionLevels != nil {
+		col.DefinitionLevels = append(col.DefinitionLevels, def)
+	}
+	return nil
+}
+
+func isNullField(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	scalar, ok := value.(columnar.Value)
+	return ok && scalar.IsNull()
+}
+
+func asList(path string, value interface{}) ([]interface{}, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case []interface{}:
+		return v, nil
+	case columnar.Value:
+		if v.IsNull() {
+			return nil, nil
+		}
+	}
+	return nil, fmt.Errorf("field %s is repeated and expects a list, got %T", path, value)
+}
+
+func asRecord(path string, value interface{}) (Record, error) {
+	switch v := value.(type) {
+	case Record:
+		return v, nil
+	case map[string]interface{}:
+		return Record(v), nil
+	}
+	return nil, fmt.Errorf("field %s is a STRUCT and expects an object, got %T", path, value)
+}
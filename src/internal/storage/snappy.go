@@ -0,0 +1,190 @@
+package storage
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Pure Go implementation of the Snappy block format
+// (https://github.com/google/snappy/blob/main/format_description.txt): a uvarint
+// with the decoded length followed by literal and copy elements. The encoder is
+// a greedy single-pass matcher over 64KB blocks, trading ratio for speed.
+
+const (
+	snappyTagLiteral = 0x00
+	snappyTagCopy1   = 0x01
+	snappyTagCopy2   = 0x02
+	snappyTagCopy4   = 0x03
+
+	snappyBlockSize  = 1 << 16
+	snappyHashBits   = 14
+	snappyMinMatch   = 4
+	snappyInputLimit = 15 // trailing bytes always emitted as literal
+	// snappyMaxExpansion bounds the decoded bytes per encoded byte: the densest
+	// element is a 3-byte copy2 producing 64 bytes.
+	snappyMaxExpansion = 22
+)
+
+var errSnappyCorrupt = errors.New("snappy: corrupt input")
+
+// snappyEncode compresses src into a new buffer.
+func snappyEncode(src []byte) []byte {
+	dst := make([]byte, binary.MaxVarintLen64, binary.MaxVarintLen64+len(src)+len(src)/6+32)
+	dst = dst[:binary.PutUvarint(dst, uint64(len(src)))]
+	for start := 0; start < len(src); start += snappyBlockSize {
+		end := start + snappyBlockSize
+		if end > len(src) {
+			end = len(src)
+		}
+		dst = snappyEncodeBlock(dst, src[start:end])
+	}
+	return dst
+}
+
+func snappyEncodeBlock(dst, block []byte) []byte {
+	if len(block) < snappyInputLimit {
+		return snappyLiteral(dst, block)
+	}
+	var table [1 << snappyHashBits]int32
+	for i := range table {
+		table[i] = -1
+	}
+	literalStart := 0
+	limit := len(block) - snappyInputLimit
+	for i := 0; i < limit; {
+		seq := binary.LittleEndian.Uint32(block[i:])
+		h := snappyHash(seq)
+		candidate := int(table[h])
+		table[h] = int32(i)
+		if candidate < 0 || binary.LittleEndian.Uint32(block[candidate:]) != seq {
+			i++
+			continue
+		}
+		dst = snappyLiteral(dst, block[literalStart:i])
+		length := snappyMinMatch
+		for i+length < len(block) && block[candidate+length] == block[i+length] {
+			length++
+		}
+		dst = snappyCopy(dst, i-candidate, length)
+		i += length
+		literalStart = i
+	}
+	return snappyLiteral(dst, block[literalStart:])
+}
+
+func snappyHash(seq uint32) uint32 {
+	return (seq * 0x1e35a7bd) >> (32 - snappyHashBits)
+}
+
+func snappyLiteral(dst, lit []byte) []byte {
+	if len(lit) == 0 {
+		return dst
+	}
+	n := len(lit) - 1
+	switch {
+	case n < 60:
+		dst = append(dst, byte(n)<<2|snappyTagLiteral)
+	case n < 1<<8:
+		dst = append(dst, 60<<2|snappyTagLiteral, byte(n))
+	case n < 1<<16:
+		dst = append(dst, 61<<2|snappyTagLiteral, byte(n), byte(n>>8))
+	case n < 1<<24:
+		dst = append(dst, 62<<2|snappyTagLiteral, byte(n), byte(n>>8), byte(n>>16))
+	default:
+		dst = append(dst, 63<<2|snappyTagLiteral, byte(n), byte(n>>8), byte(n>>16), byte(n>>24))
+	}
+	return append(dst, lit...)
+}
+
+// snappyCopy emits copy elements for a match; offsets are always below 64KB
+// because matches never cross block boundaries.
+func snappyCopy(dst []byte, offset, length int) []byte {
+	for length >= 68 {
+		dst = append(dst, 63<<2|snappyTagCopy2, byte(offset), byte(offset>>8))
+		length -= 64
+	}
+	if length > 64 {
+		// leave at least 4 bytes so the remainder can still use copy1
+		dst = append(dst, 59<<2|snappyTagCopy2, byte(offset), byte(offset>>8))
+		length -= 60
+	}
+	if length >= 4 && length < 12 && offset < 2048 {
+		return append(dst, byte(offset>>8)<<5|byte(length-4)<<2|snappyTagCopy1, byte(offset))
+	}
+	return append(dst, byte(length-1)<<2|snappyTagCopy2, byte(offset), byte(offset>>8))
+}
+
+// snappyDecode expands a buffer produced by snappyEncode (or any conforming
+// Snappy block encoder).
+func snappyDecode(src []byte) ([]byte, error) {
+	length, n := binary.Uvarint(src)
+	if n <= 0 || length > uint64(1<<32-1) {
+		return nil, errSnappyCorrupt
+	}
+	// the header is untrusted: reject lengths the elements cannot produce
+	// before sizing the output buffer from it
+	if length > uint64(len(src)-n)*snappyMaxExpansion {
+		return nil, errSnappyCorrupt
+	}
+	dst := make([]byte, 0, length)
+	for s := n; s < len(src); {
+		tag := src[s]
+		var offset, size int
+		switch tag & 0x03 {
+		case snappyTagLiteral:
+			size = int(tag >> 2)
+			s++
+			if size >= 60 {
+				extra := size - 59
+				if s+extra > len(src) {
+					return nil, errSnappyCorrupt
+				}
+				size = 0
+				for k := extra - 1; k >= 0; k-- {
+					size = size<<8 | int(src[s+k])
+				}
+				s += extra
+			}
+			size++
+			if size <= 0 || s+size > len(src) || uint64(len(dst)+size) > length {
+				return nil, errSnappyCorrupt
+			}
+			dst = append(dst, src[s:s+size]...)
+			s += size
+			continue
+		case snappyTagCopy1:
+			if s+2 > len(src) {
+				return nil, errSnappyCorrupt
+			}
+			size = 4 + int(tag>>2&0x07)
+			offset = int(tag&0xe0)<<3 | int(src[s+1])
+			s += 2
+		case snappyTagCopy2:
+			if s+3 > len(src) {
+				return nil, errSnappyCorrupt
+			}
+			size = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint16(src[s+1:]))
+			s += 3
+		case snappyTagCopy4:
+			if s+5 > len(src) {
+				return nil, errSnappyCorrupt
+			}
+			size = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint32(src[s+1:]))
+			s += 5
+		}
+		if offset <= 0 || offset > len(dst) || uint64(len(dst)+size) > length {
+			return nil, errSnappyCorrupt
+		}
+		// byte-by-byte so overlapping copies (offset < size) repeat the pattern
+		from := len(dst) - offset
+		for k := 0; k < size; k++ {
+			dst = append(dst, dst[from+k])
+		}
+	}
+	if uint64(len(dst)) != length {
+		return nil, errSnappyCorrupt
+	}
+	return dst, nil
+}
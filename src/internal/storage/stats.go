@@ -10,32 +10,52 @@ func computeStats(columns map[string]*columnar.Column) map[string]ColumnStats {
 	return stats
 }
 
+// summarizeColumn counts rows and NULLs; min/max only consider non-NULL values
+// and stay empty when every row is NULL.
 func summarizeColumn(col *columnar.Column) ColumnStats {
-	if col == nil {
+	if col == nil || col.Len() == 0 {
 		return ColumnStats{}
 	}
+	stats := ColumnStats{Count: col.Len(), NullCount: col.NullCount()}
+	if stats.NullCount == stats.Count {
+		return stats
+	}
 
 	switch col.Type {
 	case columnar.TypeInt:
-		return summarizeInt(col)
+		summarizeInt(col, &stats)
 	case columnar.TypeFloat:
-		return summarizeFloat(col)
+		summarizeFloat(col, &stats)
 	case columnar.TypeString:
-		return summarizeString(col)
+		summarizeString(col, &stats)
 	case columnar.TypeBool:
-		return summarizeBool(col)
-	default:
-		return ColumnStats{}
+		summarizeBool(col, &stats)
+	case columnar.TypeTimestamp, columnar.TypeDate, columnar.TypeDecimal:
+		summarizeOrdered(col, &stats)
 	}
+	return stats
 }
 
-func summarizeInt(col *columnar.Column) ColumnStats {
-	if len(col.IntData) == 0 {
-		return ColumnStats{}
+// firstNonNull returns the index of the first non-NULL row; callers guarantee
+// there is at least one.
+func firstNonNull(col *columnar.Column) int {
+	for i := 0; i < col.Len(); i++ {
+		if !col.IsNull(i) {
+			return i
+		}
 	}
-	min := col.IntData[0]
-	max := col.IntData[0]
-	for _, v := range col.IntData[1:] {
+	return col.Len()
+}
+
+func summarizeInt(col *columnar.Column, stats *ColumnStats) {
+	start := firstNonNull(col)
+	min := col.IntData[start]
+	max := col.IntData[start]
+	for i := start + 1; i < len(col.IntData); i++ {
+		if col.IsNull(i) {
+			continue
+		}
+		v := col.IntData[i]
 		if v < min {
 			min = v
 		}
@@ -43,20 +63,19 @@ func summarizeInt(col *columnar.Column) ColumnStats {
 			max = v
 		}
 	}
-	return ColumnStats{
-		Count: len(col.IntData),
-		Min:   FromValue(columnar.NewIntValue(min)),
-		Max:   FromValue(columnar.NewIntValue(max)),
-	}
+	stats.Min = FromValue(columnar.NewIntValue(min))
+	stats.Max = FromValue(columnar.NewIntValue(max))
 }
 
-func summarizeFloat(col *columnar.Column) ColumnStats {
-	if len(col.FloatData) == 0 {
-		return ColumnStats{}
-	}
-	min := col.FloatData[0]
-	max := col.FloatData[0]
-	for _, v := range col.FloatData[1:] {
+func summarizeFloat(col *columnar.Column, stats *ColumnStats) {
+	start := firstNonNull(col)
+	min := col.FloatData[start]
+	max := col.FloatData[start]
+	for i := start + 1; i < len(col.FloatData); i++ {
+		if col.IsNull(i) {
+			continue
+		}
+		v := col.FloatData[i]
 		if v < min {
 			min = v
 		}
@@ -64,20 +83,19 @@ func summarizeFloat(col *columnar.Column) ColumnStats {
 			max = v
 		}
 	}
-	return ColumnStats{
-		Count: len(col.FloatData),
-		Min:   FromValue(columnar.NewFloatValue(min)),
-		Max:   FromValue(columnar.NewFloatValue(max)),
-	}
+	stats.Min = FromValue(columnar.NewFloatValue(min))
+	stats.Max = FromValue(columnar.NewFloatValue(max))
 }
 
-func summarizeString(col *columnar.Column) ColumnStats {
-	if len(col.StringData) == 0 {
-		return ColumnStats{}
-	}
-	min := col.StringData[0]
-	max := col.StringData[0]
-	for _, v := range col.StringData[1:] {
+func summarizeString(col *columnar.Column, stats *ColumnStats) {
+	start := firstNonNull(col)
+	min := col.StringData[start]
+	max := col.StringData[start]
+	for i := start + 1; i < len(col.StringData); i++ {
+		if col.IsNull(i) {
+			continue
+		}
+		v := col.StringData[i]
 		if v < min {
 			min = v
 		}
@@ -85,30 +103,51 @@ func summarizeString(col *columnar.Column) ColumnStats {
 			max = v
 		}
 	}
-	return ColumnStats{
-		Count: len(col.StringData),
-		Min:   FromValue(columnar.NewStringValue(min)),
-		Max:   FromValue(columnar.NewStringValue(max)),
-	}
+	stats.Min = FromValue(columnar.NewStringValue(min))
+	stats.Max = FromValue(columnar.NewStringValue(max))
 }
 
-func summarizeBool(col *columnar.Column) ColumnStats {
-	if len(col.BoolData) == 0 {
-		return ColumnStats{}
-	}
-	min := col.BoolData[0]
-	max := col.BoolData[0]
-	for _, v := range col.BoolData[1:] {
-		if !v {
-			min = false
+func summarizeBool(col *columnar.Column, stats *ColumnStats) {
+	start := firstNonNull(col)
+	min := col.BoolData[start]
+	max := col.BoolData[start]
+	for i := start + 1; i < len(col.BoolData); i++ {
+		if col.IsNull(i) {
+			continue
 		}
-		if v {
+		if !col.BoolData[i] {
+			min = false
+		} else {
 			max = true
 		}
 	}
-	return ColumnStats{
-		Count: len(col.BoolData),
-		Min:   FromValue(columnar.NewBoolValue(min)),
-		Max:   FromValue(columnar.NewBoolValue(max)),
+	stats.Min = FromValue(columnar.NewBoolValue(min))
+	stats.Max = FromValue(columnar.NewBoolValue(max))
+}
+
+// summarizeOrdered covers types whose order needs columnar.Compare (timestamps,
+// dates and decimals of mixed scale).
+func summarizeOrdered(col *columnar.Column, stats *ColumnStats) {
+	var min, max columnar.Value
+	for i := 0; i < col.Len(); i++ {
+		if col.IsNull(i) {
+			continue
+		}
+		v, err := col.Get(i)
+		if err != nil {
+			continue
+		}
+		if min.IsNull() {
+			min, max = v, v
+			continue
+		}
+		if order, err := columnar.Compare(v, min); err == nil && order < 0 {
+			min = v
+		}
+		if order, err := columnar.Compare(v, max); err == nil && order > 0 {
+			max = v
+		}
 	}
+	stats.Min = FromValue(min)
+	stats.Max = FromValue(max)
 }
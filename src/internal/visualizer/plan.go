@@ -31,6 +31,9 @@ func PlanToDOT(plan *query.PhysicalPlan) (string, error) {
 		if len(node.Properties) > 0 {
 			label = fmt.Sprintf("%s\\n%s", label, formatProperties(node.Properties))
 		}
+		if len(node.Stats) > 0 {
+			label = fmt.Sprintf("%s\\n%s", label, formatProperties(node.Stats))
+		}
 		buf.WriteString(fmt.Sprintf("  \"%s\" [label=\"%s\", shape=box];\n", node.ID, label))
 		for _, child := range node.Children {
 			buf.WriteString(fmt.Sprintf("  \"%s\" -> \"%s\";\n", node.ID, child.ID))
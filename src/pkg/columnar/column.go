@@ -1,19 +1,31 @@
 package columnar
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 // Column representa uma coluna de dados homogêneos
 // Armazena valores do mesmo tipo de forma contígua em memória
 type Column struct {
 	Name string
 	Type DataType
-	// Usamos diferentes slices para cada tipo para eficiência
-	IntData    []int64
-	StringData []string
-	FloatData  []float64
-	BoolData   []bool
-	// Bitmap para valores NULL (opcional, futuro)
-	// NullBitmap []bool
+	// Usamos diferentes slices para cada tipo para eficiência. TIMESTAMP e DATE
+	// ficam em IntData (microssegundos e dias desde a época, respectivamente)
+	IntData     []int64
+	StringData  []string
+	FloatData   []float64
+	BoolData    []bool
+	DecimalData []Decimal
+	// NullBitmap marca as linhas NULL (true = NULL). Fica nil enquanto a coluna
+	// não possui nulos; nessas posições as slices de dados guardam o valor zero
+	NullBitmap []bool
+	// RepetitionLevels e DefinitionLevels só existem em folhas de campos
+	// aninhados ou repetidos (ver nested.go), com um nível por entrada. Com
+	// RepetitionLevels a coluna tem mais entradas que registros, e Slice e Take
+	// passam a receber posições de registros
+	RepetitionLevels []uint8
+	DefinitionLevels []uint8
 }
 
 // NewColumn cria uma nova coluna com o nome e tipo especificados
@@ -24,8 +36,11 @@ func NewColumn(name string, dataType DataType) *Column {
 	}
 }
 
-// Append adiciona um valor à coluna
+// Append adiciona um valor à coluna; valores NULL são aceitos em qualquer tipo
 func (c *Column) Append(value Value) error {
+	if value.IsNull() {
+		return c.AppendNull()
+	}
 	if value.Type != c.Type {
 		return fmt.Errorf("type mismatch: column is %s, got %s", c.Type, value.Type)
 	}
@@ -33,6 +48,12 @@ func (c *Column) Append(value Value) error {
 	switch c.Type {
 	case TypeInt:
 		c.IntData = append(c.IntData, value.Data.(int64))
+	case TypeTimestamp:
+		c.IntData = append(c.IntData, TimestampMicros(value.Data.(time.Time)))
+	case TypeDate:
+		c.IntData = append(c.IntData, DateDays(value.Data.(time.Time)))
+	case TypeDecimal:
+		c.DecimalData = append(c.DecimalData, value.Data.(Decimal))
 	case TypeString:
 		c.StringData = append(c.StringData, value.Data.(string))
 	case TypeFloat:
@@ -42,19 +63,71 @@ func (c *Column) Append(value Value) error {
 	default:
 		return fmt.Errorf("unsupported type: %s", c.Type)
 	}
+	if c.NullBitmap != nil {
+		c.NullBitmap = append(c.NullBitmap, false)
+	}
 
 	return nil
 }
 
+// AppendNull adiciona um NULL, guardando o valor zero do tipo na slice de dados
+func (c *Column) AppendNull() error {
+	length := c.Len()
+	switch c.Type {
+	case TypeInt, TypeTimestamp, TypeDate:
+		c.IntData = append(c.IntData, 0)
+	case TypeDecimal:
+		c.DecimalData = append(c.DecimalData, Decimal{})
+	case TypeString:
+		c.StringData = append(c.StringData, "")
+	case TypeFloat:
+		c.FloatData = append(c.FloatData, 0)
+	case TypeBool:
+		c.BoolData = append(c.BoolData, false)
+	default:
+		return fmt.Errorf("unsupported type: %s", c.Type)
+	}
+	if c.NullBitmap == nil {
+		c.NullBitmap = make([]bool, length, length+1)
+	}
+	c.NullBitmap = append(c.NullBitmap, true)
+	return nil
+}
+
+// IsNull indica se a linha informada é NULL
+func (c *Column) IsNull(index int) bool {
+	return index >= 0 && index < len(c.NullBitmap) && c.NullBitmap[index]
+}
+
+// NullCount retorna o número de linhas NULL
+func (c *Column) NullCount() int {
+	count := 0
+	for _, null := range c.NullBitmap {
+		if null {
+			count++
+		}
+	}
+	return count
+}
+
 // Get retorna o valor na posição especificada
 func (c *Column) Get(index int) (Value, error) {
 	if index < 0 || index >= c.Len() {
 		return Value{}, fmt.Errorf("index out of bounds: %d (len: %d)", index, c.Len())
 	}
+	if c.IsNull(index) {
+		return NewNullValue(c.Type), nil
+	}
 
 	switch c.Type {
 	case TypeInt:
 		return NewIntValue(c.IntData[index]), nil
+	case TypeTimestamp:
+		return NewTimestampValue(TimestampFromMicros(c.IntData[index])), nil
+	case TypeDate:
+		return NewDateValue(DateFromDays(c.IntData[index])), nil
+	case TypeDecimal:
+		return NewDecimalValue(c.DecimalData[index]), nil
 	case TypeString:
 		return NewStringValue(c.StringData[index]), nil
 	case TypeFloat:
@@ -69,8 +142,10 @@ func (c *Column) Get(index int) (Value, error) {
 // Len retorna o número de elementos na coluna
 func (c *Column) Len() int {
 	switch c.Type {
-	case TypeInt:
+	case TypeInt, TypeTimestamp, TypeDate:
 		return len(c.IntData)
+	case TypeDecimal:
+		return len(c.DecimalData)
 	case TypeString:
 		return len(c.StringData)
 	case TypeFloat:
@@ -90,9 +165,12 @@ func (c *Column) Clone() *Column {
 	}
 
 	switch c.Type {
-	case TypeInt:
+	case TypeInt, TypeTimestamp, TypeDate:
 		newCol.IntData = make([]int64, len(c.IntData))
 		copy(newCol.IntData, c.IntData)
+	case TypeDecimal:
+		newCol.DecimalData = make([]Decimal, len(c.DecimalData))
+		copy(newCol.DecimalData, c.DecimalData)
 	case TypeString:
 		newCol.StringData = make([]string, len(c.StringData))
 		copy(newCol.StringData, c.StringData)
@@ -103,12 +181,26 @@ func (c *Column) Clone() *Column {
 		newCol.BoolData = make([]bool, len(c.BoolData))
 		copy(newCol.BoolData, c.BoolData)
 	}
+	if c.NullBitmap != nil {
+		newCol.NullBitmap = make([]bool, len(c.NullBitmap))
+		copy(newCol.NullBitmap, c.NullBitmap)
+	}
+	newCol.RepetitionLevels = cloneLevels(c.RepetitionLevels)
+	newCol.DefinitionLevels = cloneLevels(c.DefinitionLevels)
 
 	return newCol
 }
 
-// Slice retorna uma nova coluna com um subset de dados [start:end)
+// Slice retorna uma nova coluna com um subset de dados [start:end); em colunas
+// repetidas o intervalo é de registros
 func (c *Column) Slice(start, end int) (*Column, error) {
+	if c.RepetitionLevels != nil {
+		if start < 0 || end > c.Records() || start > end {
+			return nil, fmt.Errorf("invalid slice range: [%d:%d] for %d records", start, end, c.Records())
+		}
+		offsets := c.RecordOffsets()
+		start, end = offsets[start], offsets[end]
+	}
 	if start < 0 || end > c.Len() || start > end {
 		return nil, fmt.Errorf("invalid slice range: [%d:%d] for length %d", start, end, c.Len())
 	}
@@ -119,8 +211,10 @@ func (c *Column) Slice(start, end int) (*Column, error) {
 	}
 
 	switch c.Type {
-	case TypeInt:
+	case TypeInt, TypeTimestamp, TypeDate:
 		newCol.IntData = c.IntData[start:end]
+	case TypeDecimal:
+		newCol.DecimalData = c.DecimalData[start:end]
 	case TypeString:
 		newCol.StringData = c.StringData[start:end]
 	case TypeFloat:
@@ -128,6 +222,74 @@ func (c *Column) Slice(start, end int) (*Column, error) {
 	case TypeBool:
 		newCol.BoolData = c.BoolData[start:end]
 	}
+	if c.NullBitmap != nil {
+		newCol.NullBitmap = c.NullBitmap[start:end]
+	}
+	if c.RepetitionLevels != nil {
+		newCol.RepetitionLevels = c.RepetitionLevels[start:end]
+	}
+	if c.DefinitionLevels != nil {
+		newCol.DefinitionLevels = c.DefinitionLevels[start:end]
+	}
+
+	return newCol, nil
+}
+
+// Take retorna uma nova coluna com os valores nas posições informadas, na ordem
+// dada; em colunas repetidas as posições são de registros
+func (c *Column) Take(indexes []int) (*Column, error) {
+	if c.RepetitionLevels != nil {
+		entries, err := c.recordEntries(indexes)
+		if err != nil {
+			return nil, err
+		}
+		indexes = entries
+	}
+	newCol := NewColumn(c.Name, c.Type)
+	length := c.Len()
+	for _, idx := range indexes {
+		if idx < 0 || idx >= length {
+			return nil, fmt.Errorf("index out of bounds: %d (len: %d)", idx, length)
+		}
+	}
+
+	switch c.Type {
+	case TypeInt, TypeTimestamp, TypeDate:
+		newCol.IntData = make([]int64, len(indexes))
+		for i, idx := range indexes {
+			newCol.IntData[i] = c.IntData[idx]
+		}
+	case TypeDecimal:
+		newCol.DecimalData = make([]Decimal, len(indexes))
+		for i, idx := range indexes {
+			newCol.DecimalData[i] = c.DecimalData[idx]
+		}
+	case TypeString:
+		newCol.StringData = make([]string, len(indexes))
+		for i, idx := range indexes {
+			newCol.StringData[i] = c.StringData[idx]
+		}
+	case TypeFloat:
+		newCol.FloatData = make([]float64, len(indexes))
+		for i, idx := range indexes {
+			newCol.FloatData[i] = c.FloatData[idx]
+		}
+	case TypeBool:
+		newCol.BoolData = make([]bool, len(indexes))
+		for i, idx := range indexes {
+			newCol.BoolData[i] = c.BoolData[idx]
+		}
+	default:
+		return nil, fmt.Errorf("unsupported type: %s", c.Type)
+	}
+	if c.NullBitmap != nil {
+		newCol.NullBitmap = make([]bool, len(indexes))
+		for i, idx := range indexes {
+			newCol.NullBitmap[i] = c.NullBitmap[idx]
+		}
+	}
+	newCol.RepetitionLevels = takeLevels(c.RepetitionLevels, indexes)
+	newCol.DefinitionLevels = takeLevels(c.DefinitionLevels, indexes)
 
 	return newCol, nil
 }
@@ -0,0 +1,92 @@
+package columnar
+
+import (
+	"cmp"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Compare ordena dois valores não nulos (-1, 0 ou 1). INT, FLOAT e DECIMAL são
+// comparáveis entre si; TIMESTAMP e DATE também, e aceitam STRING em formato
+// ISO 8601 do outro lado (o texto é convertido para o tipo temporal, de modo que
+// fusos horários diferentes são comparados pelo instante). NULLs devem ser
+// tratados pelo chamador.
+func Compare(left, right Value) (int, error) {
+	if left.Data == nil || right.Data == nil {
+		return 0, ErrNullValue
+	}
+	switch {
+	case left.Type == right.Type:
+		switch left.Type {
+		case TypeInt:
+			return cmp.Compare(left.Data.(int64), right.Data.(int64)), nil
+		case TypeFloat:
+			return cmp.Compare(left.Data.(float64), right.Data.(float64)), nil
+		case TypeString:
+			return strings.Compare(left.Data.(string), right.Data.(string)), nil
+		case TypeBool:
+			return cmp.Compare(boolRank(left.Data.(bool)), boolRank(right.Data.(bool))), nil
+		case TypeTimestamp, TypeDate:
+			return left.Data.(time.Time).Compare(right.Data.(time.Time)), nil
+		case TypeDecimal:
+			return left.Data.(Decimal).Cmp(right.Data.(Decimal)), nil
+		}
+	case isNumeric(left.Type) && isNumeric(right.Type):
+		return compareNumeric(left, right), nil
+	case isTemporal(left.Type) && isTemporal(right.Type):
+		return left.Data.(time.Time).Compare(right.Data.(time.Time)), nil
+	case isTemporal(left.Type) && right.Type == TypeString:
+		parsed, err := ParseValue(left.Type, right.Data.(string))
+		if err != nil {
+			return 0, err
+		}
+		return Compare(left, parsed)
+	case left.Type == TypeString && isTemporal(right.Type):
+		order, err := Compare(right, left)
+		return -order, err
+	}
+	return 0, fmt.Errorf("incompatible types (%s vs %s)", left.Type, right.Type)
+}
+
+// compareNumeric compara tipos numéricos diferentes: INT contra DECIMAL fica
+// exato, qualquer lado FLOAT força a comparação em float64
+func compareNumeric(left, right Value) int {
+	if left.Type != TypeFloat && right.Type != TypeFloat {
+		return toDecimal(left).Cmp(toDecimal(right))
+	}
+	return cmp.Compare(toFloat(left), toFloat(right))
+}
+
+func toDecimal(v Value) Decimal {
+	if v.Type == TypeInt {
+		return Decimal{Unscaled: v.Data.(int64)}
+	}
+	return v.Data.(Decimal)
+}
+
+func toFloat(v Value) float64 {
+	switch v.Type {
+	case TypeInt:
+		return float64(v.Data.(int64))
+	case TypeDecimal:
+		return v.Data.(Decimal).Float64()
+	default:
+		return v.Data.(float64)
+	}
+}
+
+func isNumeric(dt DataType) bool {
+	return dt == TypeInt || dt == TypeFloat || dt == TypeDecimal
+}
+
+func isTemporal(dt DataType) bool {
+	return dt == TypeTimestamp || dt == TypeDate
+}
+
+func boolRank(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,237 @@
+package columnar
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// MaxDecimalScale é o maior número de casas decimais suportado (cabe em int64)
+const MaxDecimalScale = 18
+
+// MaxDecimalPrecision é o maior número de dígitos de um DECIMAL(p,s): todo
+// valor com até 18 dígitos cabe em int64
+const MaxDecimalPrecision = 18
+
+var errDecimalOverflow = errors.New("decimal overflow")
+
+// Decimal é um número de precisão fixa com valor Unscaled * 10^-Scale
+type Decimal struct {
+	Unscaled int64
+	Scale    int32
+}
+
+// NewDecimal cria um decimal a partir do valor sem escala e do número de casas
+func NewDecimal(unscaled int64, scale int32) Decimal {
+	return Decimal{Unscaled: unscaled, Scale: scale}
+}
+
+// ParseDecimal lê números no formato [-+]digitos[.digitos]; a escala é o número
+// de dígitos após o ponto
+func ParseDecimal(text string) (Decimal, error) {
+	s := strings.TrimSpace(text)
+	if s == "" {
+		return Decimal{}, fmt.Errorf("invalid decimal %q", text)
+	}
+	negative := false
+	switch s[0] {
+	case '-':
+		negative = true
+		s = s[1:]
+	case '+':
+		s = s[1:]
+	}
+	intPart, fracPart, _ := strings.Cut(s, ".")
+	if intPart == "" && fracPart == "" {
+		return Decimal{}, fmt.Errorf("invalid decimal %q", text)
+	}
+	if len(fracPart) > MaxDecimalScale {
+		return Decimal{}, fmt.Errorf("decimal %q exceeds scale %d", text, MaxDecimalScale)
+	}
+	digits := intPart + fracPart
+	for _, ch := range digits {
+		if ch < '0' || ch > '9' {
+			return Decimal{}, fmt.Errorf("invalid decimal %q", text)
+		}
+	}
+	unscaled, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil {
+		return Decimal{}, fmt.Errorf("decimal %q: %w", text, errDecimalOverflow)
+	}
+	if negative {
+		unscaled = -unscaled
+	}
+	return Decimal{Unscaled: unscaled, Scale: int32(len(fracPart))}, nil
+}
+
+// String formata o decimal com exatamente Scale casas
+func (d Decimal) String() string {
+	if d.Scale <= 0 {
+		return strconv.FormatInt(d.Unscaled, 10)
+	}
+	sign := ""
+	abs := strconv.FormatUint(absInt64(d.Unscaled), 10)
+	if d.Unscaled < 0 {
+		sign = "-"
+	}
+	if pad := int(d.Scale) + 1 - len(abs); pad > 0 {
+		abs = strings.Repeat("0", pad) + abs
+	}
+	cut := len(abs) - int(d.Scale)
+	return sign + abs[:cut] + "." + abs[cut:]
+}
+
+// MarshalJSON serializa como número JSON, sem passar por float64
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalJSON aceita números ou strings JSON
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+	parsed, err := ParseDecimal(strings.Trim(string(data), `"`))
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+// Rescale muda o número de casas; ao reduzir a escala arredonda metade para
+// longe do zero
+func (d Decimal) Rescale(scale int32) (Decimal, error) {
+	if scale < 0 || scale > MaxDecimalScale {
+		return Decimal{}, fmt.Errorf("invalid decimal scale %d", scale)
+	}
+	value := big.NewInt(d.Unscaled)
+	switch {
+	case scale > d.Scale:
+		value.Mul(value, pow10(scale-d.Scale))
+	case scale < d.Scale:
+		divisor := pow10(d.Scale - scale)
+		quotient, remainder := new(big.Int).QuoRem(value, divisor, new(big.Int))
+		if new(big.Int).Mul(new(big.Int).Abs(remainder), big.NewInt(2)).Cmp(divisor) >= 0 {
+			quotient.Add(quotient, big.NewInt(int64(value.Sign())))
+		}
+		value = quotient
+	}
+	if !value.IsInt64() {
+		return Decimal{}, errDecimalOverflow
+	}
+	return Decimal{Unscaled: value.Int64(), Scale: scale}, nil
+}
+
+// Cmp compara dois decimais de escalas possivelmente diferentes
+func (d Decimal) Cmp(other Decimal) int {
+	if d.Scale == other.Scale {
+		return cmp.Compare(d.Unscaled, other.Unscaled)
+	}
+	left := big.NewInt(d.Unscaled)
+	right := big.NewInt(other.Unscaled)
+	if d.Scale < other.Scale {
+		left.Mul(left, pow10(other.Scale-d.Scale))
+	} else {
+		right.Mul(right, pow10(d.Scale-other.Scale))
+	}
+	return left.Cmp(right)
+}
+
+// Add soma dois decimais na maior das escalas
+func (d Decimal) Add(other Decimal) (Decimal, error) {
+	scale, left, right := alignDecimals(d, other)
+	return bigDecimal(new(big.Int).Add(left, right), scale)
+}
+
+// Sub subtrai dois decimais na maior das escalas
+func (d Decimal) Sub(other Decimal) (Decimal, error) {
+	scale, left, right := alignDecimals(d, other)
+	return bigDecimal(new(big.Int).Sub(left, right), scale)
+}
+
+// Mul multiplica somando as escalas; acima de MaxDecimalScale o resultado é
+// arredondado
+func (d Decimal) Mul(other Decimal) (Decimal, error) {
+	product := new(big.Int).Mul(big.NewInt(d.Unscaled), big.NewInt(other.Unscaled))
+	scale := d.Scale + other.Scale
+	if scale > MaxDecimalScale {
+		product = roundQuo(product, pow10(scale-MaxDecimalScale))
+		scale = MaxDecimalScale
+	}
+	return bigDecimal(product, scale)
+}
+
+// Quo divide com o número de casas informado, arredondando metade para longe
+// do zero
+func (d Decimal) Quo(other Decimal, scale int32) (Decimal, error) {
+	if other.Unscaled == 0 {
+		return Decimal{}, errors.New("division by zero")
+	}
+	if scale < 0 || scale > MaxDecimalScale {
+		return Decimal{}, fmt.Errorf("invalid decimal scale %d", scale)
+	}
+	// d/other = d.Unscaled * 10^(other.Scale+scale-d.Scale) / other.Unscaled
+	numerator := big.NewInt(d.Unscaled)
+	denominator := big.NewInt(other.Unscaled)
+	if shift := other.Scale + scale - d.Scale; shift >= 0 {
+		numerator.Mul(numerator, pow10(shift))
+	} else {
+		denominator.Mul(denominator, pow10(-shift))
+	}
+	return bigDecimal(roundQuo(numerator, denominator), scale)
+}
+
+// Mod retorna o resto da divisão truncada, com o sinal do dividendo
+func (d Decimal) Mod(other Decimal) (Decimal, error) {
+	if other.Unscaled == 0 {
+		return Decimal{}, errors.New("division by zero")
+	}
+	scale, left, right := alignDecimals(d, other)
+	return bigDecimal(new(big.Int).Rem(left, right), scale)
+}
+
+// Neg inverte o sinal
+func (d Decimal) Neg() (Decimal, error) {
+	return bigDecimal(new(big.Int).Neg(big.NewInt(d.Unscaled)), d.Scale)
+}
+
+func alignDecimals(left, right Decimal) (int32, *big.Int, *big.Int) {
+	scale := max(left.Scale, right.Scale)
+	l := new(big.Int).Mul(big.NewInt(left.Unscaled), pow10(scale-left.Scale))
+	r := new(big.Int).Mul(big.NewInt(right.Unscaled), pow10(scale-right.Scale))
+	return scale, l, r
+}
+
+// roundQuo divide arredondando metade para longe do zero
+func roundQuo(numerator, denominator *big.Int) *big.Int {
+	quotient, remainder := new(big.Int).QuoRem(numerator, denominator, new(big.Int))
+	if new(big.Int).Mul(new(big.Int).Abs(remainder), big.NewInt(2)).CmpAbs(denominator) >= 0 {
+		quotient.Add(quotient, big.NewInt(int64(numerator.Sign()*denominator.Sign())))
+	}
+	return quotient
+}
+
+func bigDecimal(value *big.Int, scale int32) (Decimal, error) {
+	if !value.IsInt64() {
+		return Decimal{}, errDecimalOverflow
+	}
+	return Decimal{Unscaled: value.Int64(), Scale: scale}, nil
+}
+
+// Float64 converte o decimal (com possível perda de precisão)
+func (d Decimal) Float64() float64 {
+	return float64(d.Unscaled) / math.Pow10(int(d.Scale))
+}
+
+func pow10(n int32) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+func absInt64(v int64) uint64 {
+	if v < 0 {
+		return uint64(-(v + 1)) + 1
+	}
+	return uint64(v)
+}
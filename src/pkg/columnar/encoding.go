@@ -0,0 +1,178 @@
+package columnar
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Encoding identifica a codificação física usada para armazenar uma coluna
+type Encoding string
+
+const (
+	// EncodingPlain guarda os valores sem transformação
+	EncodingPlain Encoding = "PLAIN"
+	// EncodingDictionary guarda os valores distintos uma vez e um código por linha
+	EncodingDictionary Encoding = "DICTIONARY"
+	// EncodingRLE guarda cada sequência de valores iguais como (valor, tamanho)
+	EncodingRLE Encoding = "RLE"
+	// EncodingDelta guarda a diferença entre inteiros consecutivos
+	EncodingDelta Encoding = "DELTA"
+)
+
+// ParseEncoding converte o nome de uma codificação; vazio equivale a PLAIN
+func ParseEncoding(name string) (Encoding, error) {
+	switch Encoding(strings.ToUpper(strings.TrimSpace(name))) {
+	case "", EncodingPlain:
+		return EncodingPlain, nil
+	case EncodingDictionary, "DICT":
+		return EncodingDictionary, nil
+	case EncodingRLE:
+		return EncodingRLE, nil
+	case EncodingDelta:
+		return EncodingDelta, nil
+	default:
+		return "", fmt.Errorf("unknown encoding: %s", name)
+	}
+}
+
+// Supports indica se a codificação pode ser aplicada a colunas do tipo informado
+func (e Encoding) Supports(dt DataType) bool {
+	switch e {
+	case EncodingPlain, EncodingDictionary, EncodingRLE:
+		return true
+	case EncodingDelta:
+		return dt == TypeInt || dt == TypeTimestamp || dt == TypeDate
+	default:
+		return false
+	}
+}
+
+// DictionaryColumn representa uma coluna codificada por dicionário:
+// Values contém os valores distintos e Codes[i] indexa o valor da linha i
+type DictionaryColumn struct {
+	Values *Column
+	Codes  []uint32
+}
+
+// EncodeDictionary monta o dicionário na ordem de primeira ocorrência dos valores
+func EncodeDictionary(col *Column) *DictionaryColumn {
+	dict := &DictionaryColumn{
+		Values: NewColumn(col.Name, col.Type),
+		Codes:  make([]uint32, col.Len()),
+	}
+	index := map[interface{}]uint32{}
+	for i := 0; i < col.Len(); i++ {
+		value, _ := col.Get(i)
+		code, ok := index[value.Data]
+		if !ok {
+			code = uint32(dict.Values.Len())
+			index[value.Data] = code
+			_ = dict.Values.Append(value)
+		}
+		dict.Codes[i] = code
+	}
+	return dict
+}
+
+// Len retorna o número de linhas codificadas
+func (d *DictionaryColumn) Len() int {
+	return len(d.Codes)
+}
+
+// Decode expande o dicionário em uma coluna simples
+func (d *DictionaryColumn) Decode() (*Column, error) {
+	indexes := make([]int, len(d.Codes))
+	for i, code := range d.Codes {
+		indexes[i] = int(code)
+	}
+	return d.Values.Take(indexes)
+}
+
+// RLEColumn representa uma coluna codificada por run-length:
+// Values[i] se repete Lengths[i] vezes
+type RLEColumn struct {
+	Values  *Column
+	Lengths []uint32
+}
+
+// EncodeRLE agrupa valores consecutivos iguais em runs
+func EncodeRLE(col *Column) *RLEColumn {
+	rle := &RLEColumn{Values: NewColumn(col.Name, col.Type)}
+	var last Value
+	for i := 0; i < col.Len(); i++ {
+		value, _ := col.Get(i)
+		if i > 0 && value.Data == last.Data {
+			rle.Lengths[len(rle.Lengths)-1]++
+			continue
+		}
+		_ = rle.Values.Append(value)
+		rle.Lengths = append(rle.Lengths, 1)
+		last = value
+	}
+	return rle
+}
+
+// Len retorna o número de linhas codificadas
+func (r *RLEColumn) Len() int {
+	total := 0
+	for _, length := range r.Lengths {
+		total += int(length)
+	}
+	return total
+}
+
+// Decode expande os runs em uma coluna simples
+func (r *RLEColumn) Decode() (*Column, error) {
+	indexes := make([]int, 0, r.Len())
+	for run, length := range r.Lengths {
+		for j := uint32(0); j < length; j++ {
+			indexes = append(indexes, run)
+		}
+	}
+	return r.Values.Take(indexes)
+}
+
+// DeltaColumn representa uma coluna INT (ou TIMESTAMP/DATE) como diferenças entre valores
+// consecutivos; o primeiro delta é relativo a zero. Linhas NULL guardam o valor
+// zero e são marcadas em NullBitmap
+type DeltaColumn struct {
+	Name       string
+	Type       DataType
+	Deltas     []int64
+	NullBitmap []bool
+}
+
+// EncodeDelta codifica em deltas uma coluna armazenada em IntData
+func EncodeDelta(col *Column) (*DeltaColumn, error) {
+	if !EncodingDelta.Supports(col.Type) {
+		return nil, fmt.Errorf("delta encoding requires INT, TIMESTAMP or DATE, got %s", col.Type)
+	}
+	delta := &DeltaColumn{Name: col.Name, Type: col.Type, Deltas: make([]int64, len(col.IntData))}
+	if col.NullBitmap != nil {
+		delta.NullBitmap = append([]bool(nil), col.NullBitmap...)
+	}
+	var prev int64
+	for i, v := range col.IntData {
+		delta.Deltas[i] = v - prev
+		prev = v
+	}
+	return delta, nil
+}
+
+// Len retorna o número de linhas codificadas
+func (d *DeltaColumn) Len() int {
+	return len(d.Deltas)
+}
+
+// Decode reconstrói os valores somando os deltas
+func (d *DeltaColumn) Decode() *Column {
+	col := NewColumn(d.Name, d.Type)
+	col.IntData = make([]int64, len(d.Deltas))
+	var acc int64
+	for i, delta := range d.Deltas {
+		acc += delta
+		col.IntData[i] = acc
+	}
+	col.NullBitmap = d.NullBitmap
+	return col
+}
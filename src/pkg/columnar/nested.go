@@ -0,0 +1,82 @@
+package columnar
+
+import "fmt"
+
+// Campos aninhados e repetidos seguem a decomposição do Dremel: cada folha vira
+// uma coluna com uma entrada por valor (ou por ausência), acompanhada de
+//
+//   - nível de repetição: 0 abre um novo registro; r > 0 indica que a entrada
+//     repete o r-ésimo campo repetido do caminho;
+//   - nível de definição: quantos campos opcionais ou repetidos do caminho
+//     estão presentes. Abaixo do máximo da folha a entrada é NULL.
+//
+// Colunas planas não guardam níveis (slices nil).
+
+// Records retorna o número de registros (linhas) da coluna; difere de Len
+// apenas em colunas repetidas
+func (c *Column) Records() int {
+	if c.RepetitionLevels == nil {
+		return c.Len()
+	}
+	records := 0
+	for _, level := range c.RepetitionLevels {
+		if level == 0 {
+			records++
+		}
+	}
+	return records
+}
+
+// RecordOffsets retorna a primeira entrada de cada registro, com Len() no
+// final: as entradas do registro i ficam em [offsets[i], offsets[i+1])
+func (c *Column) RecordOffsets() []int {
+	if c.RepetitionLevels == nil {
+		offsets := make([]int, c.Len()+1)
+		for i := range offsets {
+			offsets[i] = i
+		}
+		return offsets
+	}
+	offsets := make([]int, 0, c.Len()+1)
+	for i, level := range c.RepetitionLevels {
+		if level == 0 {
+			offsets = append(offsets, i)
+		}
+	}
+	return append(offsets, len(c.RepetitionLevels))
+}
+
+// recordEntries expande posições de registros nas posições de suas entradas
+func (c *Column) recordEntries(records []int) ([]int, error) {
+	offsets := c.RecordOffsets()
+	entries := make([]int, 0, len(records))
+	for _, record := range records {
+		if record < 0 || record >= len(offsets)-1 {
+			return nil, fmt.Errorf("record out of bounds: %d (records: %d)", record, len(offsets)-1)
+		}
+		for entry := offsets[record]; entry < offsets[record+1]; entry++ {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+func cloneLevels(levels []uint8) []uint8 {
+	if levels == nil {
+		return nil
+	}
+	out := make([]uint8, len(levels))
+	copy(out, levels)
+	return out
+}
+
+func takeLevels(levels []uint8, indexes []int) []uint8 {
+	if levels == nil {
+		return nil
+	}
+	out := make([]uint8, len(indexes))
+	for i, idx := range indexes {
+		out[i] = levels[idx]
+	}
+	return out
+}
@@ -0,0 +1,107 @@
+package columnar
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DateLayout é o formato textual de DATE
+const DateLayout = "2006-01-02"
+
+const secondsPerDay = 24 * 60 * 60
+
+// timestampLayouts são tentados em ordem por ParseTimestamp; os formatos sem
+// fuso horário são interpretados em UTC
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+	DateLayout,
+}
+
+// ParseTimestamp converte o texto para um instante normalizado em UTC
+func ParseTimestamp(text string) (time.Time, error) {
+	s := strings.TrimSpace(text)
+	for _, layout := range timestampLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return normalizeTimestamp(t), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp %q", text)
+}
+
+// ParseDate converte o texto para uma data; timestamps com fuso usam a data
+// local do próprio texto
+func ParseDate(text string) (time.Time, error) {
+	s := strings.TrimSpace(text)
+	if t, err := time.Parse(DateLayout, s); err == nil {
+		return t, nil
+	}
+	for _, layout := range timestampLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return truncateDate(t), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q", text)
+}
+
+// NewTimestampValue cria um TIMESTAMP em UTC com precisão de microssegundos
+func NewTimestampValue(t time.Time) Value {
+	return Value{Type: TypeTimestamp, Data: normalizeTimestamp(t)}
+}
+
+// NewDateValue cria um DATE com o dia de t (no fuso de t)
+func NewDateValue(t time.Time) Value {
+	return Value{Type: TypeDate, Data: truncateDate(t)}
+}
+
+// AsTime retorna o instante de um TIMESTAMP ou a meia-noite UTC de um DATE
+func (v Value) AsTime() (time.Time, error) {
+	if v.Data == nil {
+		return time.Time{}, ErrNullValue
+	}
+	if v.Type != TypeTimestamp && v.Type != TypeDate {
+		return time.Time{}, fmt.Errorf("value is not a timestamp or date, got %s", v.Type)
+	}
+	return v.Data.(time.Time), nil
+}
+
+// TimestampMicros converte o instante para microssegundos desde a época (formato
+// armazenado nas colunas TIMESTAMP)
+func TimestampMicros(t time.Time) int64 {
+	return t.UnixMicro()
+}
+
+// TimestampFromMicros é o inverso de TimestampMicros
+func TimestampFromMicros(micros int64) time.Time {
+	return time.UnixMicro(micros).UTC()
+}
+
+// DateDays converte a data para dias desde a época (formato armazenado nas
+// colunas DATE)
+func DateDays(t time.Time) int64 {
+	seconds := truncateDate(t).Unix()
+	days := seconds / secondsPerDay
+	if seconds%secondsPerDay < 0 {
+		days--
+	}
+	return days
+}
+
+// DateFromDays é o inverso de DateDays
+func DateFromDays(days int64) time.Time {
+	return time.Unix(days*secondsPerDay, 0).UTC()
+}
+
+func normalizeTimestamp(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Microsecond)
+}
+
+func truncateDate(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
@@ -1,6 +1,13 @@
 package columnar
 
-import "fmt"
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
 
 // DataType representa os tipos de dados suportados no sistema colunar
 type DataType int
@@ -10,6 +17,15 @@ const (
 	TypeString
 	TypeFloat
 	TypeBool
+	// TypeTimestamp é um instante em UTC, armazenado em microssegundos
+	TypeTimestamp
+	// TypeDate é um dia do calendário, armazenado em dias desde a época
+	TypeDate
+	// TypeDecimal é um número de precisão fixa (ver Decimal)
+	TypeDecimal
+	// TypeStruct agrupa campos aninhados; só existe no schema, os dados ficam
+	// nas colunas folha
+	TypeStruct
 )
 
 // String retorna a representação em string do tipo
@@ -23,6 +39,14 @@ func (dt DataType) String() string {
 		return "FLOAT"
 	case TypeBool:
 		return "BOOL"
+	case TypeTimestamp:
+		return "TIMESTAMP"
+	case TypeDate:
+		return "DATE"
+	case TypeDecimal:
+		return "DECIMAL"
+	case TypeStruct:
+		return "STRUCT"
 	default:
 		return "UNKNOWN"
 	}
@@ -34,6 +58,20 @@ type Value struct {
 	Data interface{}
 }
 
+// ErrNullValue é devolvido pelos acessores As* quando o valor é NULL
+var ErrNullValue = errors.New("value is NULL")
+
+// NewNullValue cria um NULL do tipo informado. Um Value com Data nil é sempre
+// NULL; o tipo serve apenas para indicar a coluna de origem
+func NewNullValue(dt DataType) Value {
+	return Value{Type: dt}
+}
+
+// IsNull indica se o valor é NULL
+func (v Value) IsNull() bool {
+	return v.Data == nil
+}
+
 // NewIntValue cria um novo valor inteiro
 func NewIntValue(v int64) Value {
 	return Value{Type: TypeInt, Data: v}
@@ -54,8 +92,16 @@ func NewBoolValue(v bool) Value {
 	return Value{Type: TypeBool, Data: v}
 }
 
+// NewDecimalValue cria um novo valor decimal
+func NewDecimalValue(v Decimal) Value {
+	return Value{Type: TypeDecimal, Data: v}
+}
+
 // AsInt retorna o valor como int64, ou erro se o tipo for incompatível
 func (v Value) AsInt() (int64, error) {
+	if v.Data == nil {
+		return 0, ErrNullValue
+	}
 	if v.Type != TypeInt {
 		return 0, fmt.Errorf("value is not an int, got %s", v.Type)
 	}
@@ -64,6 +110,9 @@ func (v Value) AsInt() (int64, error) {
 
 // AsString retorna o valor como string, ou erro se o tipo for incompatível
 func (v Value) AsString() (string, error) {
+	if v.Data == nil {
+		return "", ErrNullValue
+	}
 	if v.Type != TypeString {
 		return "", fmt.Errorf("value is not a string, got %s", v.Type)
 	}
@@ -72,6 +121,9 @@ func (v Value) AsString() (string, error) {
 
 // AsFloat retorna o valor como float64, ou erro se o tipo for incompatível
 func (v Value) AsFloat() (float64, error) {
+	if v.Data == nil {
+		return 0, ErrNullValue
+	}
 	if v.Type != TypeFloat {
 		return 0, fmt.Errorf("value is not a float, got %s", v.Type)
 	}
@@ -80,13 +132,155 @@ func (v Value) AsFloat() (float64, error) {
 
 // AsBool retorna o valor como bool, ou erro se o tipo for incompatível
 func (v Value) AsBool() (bool, error) {
+	if v.Data == nil {
+		return false, ErrNullValue
+	}
 	if v.Type != TypeBool {
 		return false, fmt.Errorf("value is not a bool, got %s", v.Type)
 	}
 	return v.Data.(bool), nil
 }
 
+// AsDecimal retorna o valor como Decimal, ou erro se o tipo for incompatível
+func (v Value) AsDecimal() (Decimal, error) {
+	if v.Data == nil {
+		return Decimal{}, ErrNullValue
+	}
+	if v.Type != TypeDecimal {
+		return Decimal{}, fmt.Errorf("value is not a decimal, got %s", v.Type)
+	}
+	return v.Data.(Decimal), nil
+}
+
 // String retorna a representação em string do valor
 func (v Value) String() string {
+	if v.Data == nil {
+		return "NULL"
+	}
+	switch v.Type {
+	case TypeTimestamp:
+		return v.Data.(time.Time).Format(time.RFC3339Nano)
+	case TypeDate:
+		return v.Data.(time.Time).Format(DateLayout)
+	}
 	return fmt.Sprintf("%v", v.Data)
 }
+
+// ParseDataType converte o nome textual (INT, STRING, ...) no DataType correspondente.
+func ParseDataType(name string) (DataType, error) {
+	for _, dt := range []DataType{TypeInt, TypeString, TypeFloat, TypeBool, TypeTimestamp, TypeDate, TypeDecimal, TypeStruct} {
+		if dt.String() == name {
+			return dt, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown data type %q", name)
+}
+
+type valueJSON struct {
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value"`
+}
+
+// ParseValue converte a representação textual de um valor do tipo informado
+// (literais tipados como TIMESTAMP '...' e valores carregados via API).
+func ParseValue(dt DataType, text string) (Value, error) {
+	switch dt {
+	case TypeInt:
+		i, err := strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			return Value{}, fmt.Errorf("invalid int %q", text)
+		}
+		return NewIntValue(i), nil
+	case TypeFloat:
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return Value{}, fmt.Errorf("invalid float %q", text)
+		}
+		return NewFloatValue(f), nil
+	case TypeString:
+		return NewStringValue(text), nil
+	case TypeBool:
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return Value{}, fmt.Errorf("invalid bool %q", text)
+		}
+		return NewBoolValue(b), nil
+	case TypeTimestamp:
+		t, err := ParseTimestamp(text)
+		if err != nil {
+			return Value{}, err
+		}
+		return NewTimestampValue(t), nil
+	case TypeDate:
+		t, err := ParseDate(text)
+		if err != nil {
+			return Value{}, err
+		}
+		return NewDateValue(t), nil
+	case TypeDecimal:
+		d, err := ParseDecimal(text)
+		if err != nil {
+			return Value{}, err
+		}
+		return NewDecimalValue(d), nil
+	default:
+		return Value{}, fmt.Errorf("unsupported type: %s", dt)
+	}
+}
+
+// MarshalJSON serializa o valor preservando o tipo (ints não viram float no decode).
+func (v Value) MarshalJSON() ([]byte, error) {
+	data := v.Data
+	if v.Type == TypeDate && data != nil {
+		data = v.String()
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(valueJSON{Type: v.Type.String(), Value: raw})
+}
+
+// UnmarshalJSON reconstrói o valor a partir do formato gerado por MarshalJSON.
+func (v *Value) UnmarshalJSON(data []byte) error {
+	var payload valueJSON
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return err
+	}
+	dt, err := ParseDataType(payload.Type)
+	if err != nil {
+		return err
+	}
+	if len(payload.Value) == 0 || bytes.Equal(payload.Value, []byte("null")) {
+		*v = NewNullValue(dt)
+		return nil
+	}
+	switch dt {
+	case TypeInt:
+		var i int64
+		err = json.Unmarshal(payload.Value, &i)
+		*v = NewIntValue(i)
+	case TypeString:
+		var s string
+		err = json.Unmarshal(payload.Value, &s)
+		*v = NewStringValue(s)
+	case TypeFloat:
+		var f float64
+		err = json.Unmarshal(payload.Value, &f)
+		*v = NewFloatValue(f)
+	case TypeBool:
+		var b bool
+		err = json.Unmarshal(payload.Value, &b)
+		*v = NewBoolValue(b)
+	case TypeTimestamp, TypeDate:
+		var s string
+		if err = json.Unmarshal(payload.Value, &s); err == nil {
+			*v, err = ParseValue(dt, s)
+		}
+	case TypeDecimal:
+		var d Decimal
+		err = json.Unmarshal(payload.Value, &d)
+		*v = NewDecimalValue(d)
+	}
+	return err
+}
@@ -2,6 +2,7 @@ package query
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/Jonatan852/distributed-query-processing/pkg/columnar"
 )
@@ -18,6 +19,7 @@ type SelectStatement struct {
 	From     []TableReference
 	Where    Expression
 	GroupBy  []Expression
+	Having   Expression
 	OrderBy  []OrderExpression
 	Limit    *int64
 }
@@ -78,6 +80,8 @@ type Expression interface {
 }
 
 // ColumnRef is a reference to table.column.
+// Name may be the dotted path of a nested field (payload.device.os); String
+// quotes such names with backticks so they are not read as table qualifiers.
 type ColumnRef struct {
 	Table string
 	Name  string
@@ -86,10 +90,14 @@ type ColumnRef struct {
 func (ColumnRef) expression() {}
 
 func (c ColumnRef) String() string {
+	name := c.Name
+	if strings.Contains(name, ".") {
+		name = "`" + name + "`"
+	}
 	if c.Table != "" {
-		return fmt.Sprintf("%s.%s", c.Table, c.Name)
+		return fmt.Sprintf("%s.%s", c.Table, name)
 	}
-	return c.Name
+	return name
 }
 
 // Wildcard represents "*" or "table.*".
@@ -114,6 +122,12 @@ type Literal struct {
 func (Literal) expression() {}
 
 func (l Literal) String() string {
+	switch l.Value.Type {
+	case columnar.TypeTimestamp, columnar.TypeDate, columnar.TypeDecimal:
+		if !l.Value.IsNull() {
+			return fmt.Sprintf("%s '%s'", l.Value.Type, l.Value)
+		}
+	}
 	return l.Value.String()
 }
 
@@ -150,10 +164,13 @@ func (u UnaryExpr) String() string {
 }
 
 // FunctionCall models scalar/aggregate function invocations.
+// WithinRecord marks aggregates scoped to each record (COUNT(tags) WITHIN
+// RECORD), which summarize the values of repeated fields row by row.
 type FunctionCall struct {
-	Name     string
-	Args     []Expression
-	Distinct bool
+	Name         string
+	Args         []Expression
+	Distinct     bool
+	WithinRecord bool
 }
 
 func (FunctionCall) expression() {}
@@ -163,7 +180,11 @@ func (f FunctionCall) String() string {
 	if f.Distinct {
 		distinct = "DISTINCT "
 	}
-	return fmt.Sprintf("%s(%s%s)", f.Name, distinct, joinExpressions(f.Args))
+	within := ""
+	if f.WithinRecord {
+		within = " WITHIN RECORD"
+	}
+	return fmt.Sprintf("%s(%s%s)%s", f.Name, distinct, joinExpressions(f.Args), within)
 }
 
 // Parameter represents a named parameter (e.g., :country).
@@ -195,6 +216,23 @@ func (b BetweenExpr) String() string {
 	return fmt.Sprintf("(%s %sBETWEEN %s AND %s)", b.Expr, not, b.Lower, b.Upper)
 }
 
+// InExpr models "expr IN (v1, v2, ...)".
+type InExpr struct {
+	Expr Expression
+	List []Expression
+	Not  bool
+}
+
+func (InExpr) expression() {}
+
+func (i InExpr) String() string {
+	not := ""
+	if i.Not {
+		not = "NOT "
+	}
+	return fmt.Sprintf("(%s %sIN (%s))", i.Expr, not, joinExpressions(i.List))
+}
+
 func joinExpressions(exprs []Expression) string {
 	if len(exprs) == 0 {
 		return ""
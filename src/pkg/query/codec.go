@@ -0,0 +1,175 @@
+package query
+
+import (
+	"fmt"
+
+	"github.com/Jonatan852/distributed-query-processing/pkg/columnar"
+)
+
+// Expression kinds used by ExpressionSpec.
+const (
+	ExprKindColumn    = "column"
+	ExprKindWildcard  = "wildcard"
+	ExprKindLiteral   = "literal"
+	ExprKindNull      = "null"
+	ExprKindBinary    = "binary"
+	ExprKindUnary     = "unary"
+	ExprKindFunction  = "function"
+	ExprKindParameter = "parameter"
+	ExprKindBetween   = "between"
+	ExprKindIn        = "in"
+)
+
+// ExpressionSpec is a JSON-friendly encoding of an Expression tree. It is used to
+// ship predicates and other expressions inside plan fragments sent to workers.
+type ExpressionSpec struct {
+	Kind         string            `json:"kind"`
+	Table        string            `json:"table,omitempty"`
+	Name         string            `json:"name,omitempty"`
+	Operator     string            `json:"op,omitempty"`
+	Value        *columnar.Value   `json:"value,omitempty"`
+	Left         *ExpressionSpec   `json:"left,omitempty"`
+	Right        *ExpressionSpec   `json:"right,omitempty"`
+	Expr         *ExpressionSpec   `json:"expr,omitempty"`
+	Lower        *ExpressionSpec   `json:"lower,omitempty"`
+	Upper        *ExpressionSpec   `json:"upper,omitempty"`
+	Args         []*ExpressionSpec `json:"args,omitempty"`
+	Distinct     bool              `json:"distinct,omitempty"`
+	Not          bool              `json:"not,omitempty"`
+	WithinRecord bool              `json:"withinRecord,omitempty"`
+}
+
+// EncodeExpression converts an Expression into its serializable form.
+func EncodeExpression(expr Expression) *ExpressionSpec {
+	switch e := expr.(type) {
+	case nil:
+		return nil
+	case ColumnRef:
+		return &ExpressionSpec{Kind: ExprKindColumn, Table: e.Table, Name: e.Name}
+	case Wildcard:
+		return &ExpressionSpec{Kind: ExprKindWildcard, Table: e.Table}
+	case Literal:
+		value := e.Value
+		return &ExpressionSpec{Kind: ExprKindLiteral, Value: &value}
+	case NullLiteral:
+		return &ExpressionSpec{Kind: ExprKindNull}
+	case BinaryExpr:
+		return &ExpressionSpec{
+			Kind:     ExprKindBinary,
+			Operator: e.Operator,
+			Left:     EncodeExpression(e.Left),
+			Right:    EncodeExpression(e.Right),
+		}
+	case UnaryExpr:
+		return &ExpressionSpec{Kind: ExprKindUnary, Operator: e.Operator, Expr: EncodeExpression(e.Expr)}
+	case FunctionCall:
+		args := make([]*ExpressionSpec, 0, len(e.Args))
+		for _, arg := range e.Args {
+			args = append(args, EncodeExpression(arg))
+		}
+		return &ExpressionSpec{Kind: ExprKindFunction, Name: e.Name, Args: args, Distinct: e.Distinct, WithinRecord: e.WithinRecord}
+	case Parameter:
+		return &ExpressionSpec{Kind: ExprKindParameter, Name: e.Name}
+	case BetweenExpr:
+		return &ExpressionSpec{
+			Kind:  ExprKindBetween,
+			Expr:  EncodeExpression(e.Expr),
+			Lower: EncodeExpression(e.Lower),
+			Upper: EncodeExpression(e.Upper),
+			Not:   e.Not,
+		}
+	case InExpr:
+		list := make([]*ExpressionSpec, 0, len(e.List))
+		for _, item := range e.List {
+			list = append(list, EncodeExpression(item))
+		}
+		return &ExpressionSpec{Kind: ExprKindIn, Expr: EncodeExpression(e.Expr), Args: list, Not: e.Not}
+	default:
+		return nil
+	}
+}
+
+// Decode rebuilds the Expression tree described by the spec.
+func (s *ExpressionSpec) Decode() (Expression, error) {
+	if s == nil {
+		return nil, nil
+	}
+	switch s.Kind {
+	case ExprKindColumn:
+		return ColumnRef{Table: s.Table, Name: s.Name}, nil
+	case ExprKindWildcard:
+		return Wildcard{Table: s.Table}, nil
+	case ExprKindLiteral:
+		if s.Value == nil {
+			return nil, fmt.Errorf("literal without value")
+		}
+		return Literal{Value: *s.Value}, nil
+	case ExprKindNull:
+		return NullLiteral{}, nil
+	case ExprKindBinary:
+		left, err := s.Left.decodeRequired("left operand")
+		if err != nil {
+			return nil, err
+		}
+		right, err := s.Right.decodeRequired("right operand")
+		if err != nil {
+			return nil, err
+		}
+		return BinaryExpr{Left: left, Operator: s.Operator, Right: right}, nil
+	case ExprKindUnary:
+		inner, err := s.Expr.decodeRequired("unary operand")
+		if err != nil {
+			return nil, err
+		}
+		return UnaryExpr{Operator: s.Operator, Expr: inner}, nil
+	case ExprKindFunction:
+		args := make([]Expression, 0, len(s.Args))
+		for _, arg := range s.Args {
+			decoded, err := arg.decodeRequired("function argument")
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, decoded)
+		}
+		return FunctionCall{Name: s.Name, Args: args, Distinct: s.Distinct, WithinRecord: s.WithinRecord}, nil
+	case ExprKindParameter:
+		return Parameter{Name: s.Name}, nil
+	case ExprKindBetween:
+		inner, err := s.Expr.decodeRequired("BETWEEN operand")
+		if err != nil {
+			return nil, err
+		}
+		lower, err := s.Lower.decodeRequired("BETWEEN lower bound")
+		if err != nil {
+			return nil, err
+		}
+		upper, err := s.Upper.decodeRequired("BETWEEN upper bound")
+		if err != nil {
+			return nil, err
+		}
+		return BetweenExpr{Expr: inner, Lower: lower, Upper: upper, Not: s.Not}, nil
+	case ExprKindIn:
+		inner, err := s.Expr.decodeRequired("IN operand")
+		if err != nil {
+			return nil, err
+		}
+		list := make([]Expression, 0, len(s.Args))
+		for _, item := range s.Args {
+			decoded, err := item.decodeRequired("IN list item")
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, decoded)
+		}
+		return InExpr{Expr: inner, List: list, Not: s.Not}, nil
+	default:
+		return nil, fmt.Errorf("unknown expression kind %q", s.Kind)
+	}
+}
+
+func (s *ExpressionSpec) decodeRequired(what string) (Expression, error) {
+	if s == nil {
+		return nil, fmt.Errorf("missing %s", what)
+	}
+	return s.Decode()
+}
@@ -1,6 +1,7 @@
 package query
 
 import (
+	"encoding/json"
 	"fmt"
 	"sync/atomic"
 )
@@ -17,6 +18,7 @@ const (
 	PlanNodeJoin      PlanNodeType = "JOIN"
 	PlanNodeSort      PlanNodeType = "SORT"
 	PlanNodeLimit     PlanNodeType = "LIMIT"
+	PlanNodeTopN      PlanNodeType = "TOPN"
 	PlanNodeRoot      PlanNodeType = "ROOT"
 	PlanNodeUnknown   PlanNodeType = "UNKNOWN"
 )
@@ -53,3 +55,46 @@ func NewPlanNode(typ PlanNodeType) *PlanNode {
 func (n *PlanNode) AddChild(child *PlanNode) {
 	n.Children = append(n.Children, child)
 }
+
+// Clone copia o nó e toda a subárvore. Os mapas de propriedades e estatísticas
+// são copiados raso: os valores são tratados como imutáveis depois do planejamento.
+func (n *PlanNode) Clone() *PlanNode {
+	if n == nil {
+		return nil
+	}
+	clone := &PlanNode{
+		ID:         n.ID,
+		Type:       n.Type,
+		Children:   make([]*PlanNode, 0, len(n.Children)),
+		Properties: make(map[string]interface{}, len(n.Properties)),
+		Stats:      make(map[string]interface{}, len(n.Stats)),
+	}
+	for k, v := range n.Properties {
+		clone.Properties[k] = v
+	}
+	for k, v := range n.Stats {
+		clone.Stats[k] = v
+	}
+	for _, child := range n.Children {
+		clone.Children = append(clone.Children, child.Clone())
+	}
+	return clone
+}
+
+// DecodeProperty copia a propriedade informada para out. Funciona tanto para nós
+// montados em memória quanto para nós recebidos via JSON (onde os valores viram
+// map[string]interface{}). Retorna false quando a propriedade não existe.
+func (n *PlanNode) DecodeProperty(key string, out interface{}) (bool, error) {
+	raw, ok := n.Properties[key]
+	if !ok || raw == nil {
+		return false, nil
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return true, fmt.Errorf("propriedade %s: %w", key, err)
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return true, fmt.Errorf("propriedade %s: %w", key, err)
+	}
+	return true, nil
+}